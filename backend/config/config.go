@@ -2,9 +2,12 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,6 +18,192 @@ type App struct {
 	JWTSecret    string   `yaml:"jwt_secret"`
 	SM4Key       string   `yaml:"sm4_key"`
 	AllowOrigins []string `yaml:"allow_origins"`
+	// AllowMethods lists the CORS methods allowed in preflight
+	// (empty = GET, POST, PUT, PATCH, DELETE, OPTIONS).
+	AllowMethods []string `yaml:"allow_methods"`
+	// AllowHeaders lists the CORS request headers allowed in preflight
+	// (empty = Origin, Content-Type, Authorization, Idempotency-Key). Content-Type,
+	// Authorization and Idempotency-Key are always allowed, since the web app
+	// needs them.
+	AllowHeaders []string `yaml:"allow_headers"`
+	// ExposeHeaders lists response headers browsers may read (empty = none).
+	ExposeHeaders []string `yaml:"expose_headers"`
+	// AllowInsecure lets the server start on a non-loopback address while CORS
+	// accepts any origin and the default admin still has its configured default
+	// password. Without it that combination is refused at startup.
+	AllowInsecure bool `yaml:"allow_insecure"`
+	// TrustedProxies lists the IPs or CIDRs of reverse proxies whose
+	// X-Forwarded-For / X-Real-IP headers name the client, e.g. "127.0.0.1" or
+	// "10.0.0.0/8" (empty = none: the connection's address is the client). The
+	// login rate limit keys on that address, so only list proxies you run.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// PhoneMaxRetries is how many times a transient phone API failure is retried
+	// (0 = default 3, negative = disabled).
+	PhoneMaxRetries int `yaml:"phone_max_retries"`
+	// LogLevel is the minimum level logged: debug, info, warn or error (empty = info).
+	LogLevel string `yaml:"log_level"`
+	// LogFormat is "text" (key=value lines) or "json" for log shippers (empty = text).
+	LogFormat string `yaml:"log_format"`
+	// DebugPhoneIO logs the URL, encrypted request and decrypted response of every
+	// phone API call. Off by default: payloads include message content.
+	DebugPhoneIO bool `yaml:"debug_phone_io"`
+	// PhoneProxy routes phone API calls through an http(s) or socks5 proxy, e.g.
+	// "socks5://127.0.0.1:1080". A device's own proxy_url takes precedence.
+	PhoneProxy string `yaml:"phone_proxy"`
+	// PhoneInsecureSkipVerify accepts self-signed HTTPS certificates from all phones.
+	PhoneInsecureSkipVerify bool `yaml:"phone_insecure_skip_verify"`
+	// PhoneMaxResponseMB caps the size of a phone API response in MiB; larger
+	// responses fail instead of being read into memory (0 = default 8, negative = no limit).
+	PhoneMaxResponseMB int `yaml:"phone_max_response_mb"`
+	// SyncIntervalSeconds is how often the sync scheduler checks which devices are
+	// due for an automatic SMS/call sync (0 = default 5, negative = disabled).
+	SyncIntervalSeconds int `yaml:"sync_interval_seconds"`
+	// BatteryHistoryDays is how many days of battery history are kept
+	// (0 = default 30, negative = keep forever).
+	BatteryHistoryDays int `yaml:"battery_history_days"`
+	// BatteryPollInterval is how often the battery poller checks every device,
+	// as a duration such as "5m" (empty = default 5m, "0" = poller disabled).
+	BatteryPollInterval string `yaml:"battery_poll_interval"`
+	// BatteryAlertThreshold sends a battery.low alert to the webhook when a device's
+	// battery drops below this percentage, and battery.recovered once it is back
+	// at or above it (0 = disabled).
+	BatteryAlertThreshold int `yaml:"battery_alert_threshold"`
+	// OfflineAlertFailures sends a device.offline alert to the webhook after this
+	// many consecutive failed battery polls of an online device, and device.online
+	// when it answers again (0 = default 3, negative = disabled).
+	OfflineAlertFailures int `yaml:"offline_alert_failures"`
+	// SmsDedupWindow, when set (e.g. "2s"), makes SMS sync treat messages with the
+	// same address, type and body within this long of each other as duplicates.
+	// Empty or "0" keeps exact-key deduplication only.
+	SmsDedupWindow string `yaml:"sms_dedup_window"`
+	// SyncPageSize is how many records each sync requests per page from the
+	// phone (0 = default 50).
+	SyncPageSize int `yaml:"sync_page_size"`
+	// SyncMaxPages caps how many pages one SMS or call sync walks (0 = default
+	// 100). A sync that hits it is marked truncated.
+	SyncMaxPages int `yaml:"sync_max_pages"`
+	// SmsMaxSegments rejects sends whose body would take more SMS segments than
+	// this (0 = default 10, negative = no limit).
+	SmsMaxSegments int `yaml:"sms_max_segments"`
+	// MaxConcurrentPolls caps how many devices the battery poller and the
+	// refresh-all endpoint contact at once (0 = default 8).
+	MaxConcurrentPolls int `yaml:"max_concurrent_polls"`
+	// AccessTokenMinutes is the lifetime of access tokens (0 = default 15).
+	AccessTokenMinutes int `yaml:"access_token_minutes"`
+	// RefreshTokenDays is the lifetime of refresh tokens (0 = default 7).
+	RefreshTokenDays int `yaml:"refresh_token_days"`
+	// TokenTTL is the session (refresh token) lifetime as a duration such as
+	// "24h", "168h" or "7d". When set it overrides RefreshTokenDays.
+	TokenTTL string `yaml:"token_ttl"`
+	// LoginRateLimit throttles failed logins per client IP.
+	LoginRateLimit LoginRateLimit `yaml:"login_rate_limit"`
+	// Webhook is notified of every newly received SMS.
+	Webhook Webhook `yaml:"webhook"`
+}
+
+// Webhook configures the outbound notification for new received SMS.
+type Webhook struct {
+	URL        string `yaml:"url"`         // Target URL (empty = disabled)
+	Secret     string `yaml:"secret"`      // Optional HMAC-SHA256 key for the X-SMServer-Signature header
+	MaxRetries int    `yaml:"max_retries"` // Retries for failed deliveries (0 = default 3, negative = disabled)
+}
+
+// RefreshTokenTTL returns the refresh token lifetime: TokenTTL if set,
+// otherwise RefreshTokenDays. Load has already rejected invalid TokenTTL values.
+func (a App) RefreshTokenTTL() time.Duration {
+	if ttl, err := ParseTTL(a.TokenTTL); err == nil && ttl > 0 {
+		return ttl
+	}
+	return time.Duration(a.RefreshTokenDays) * 24 * time.Hour
+}
+
+// BatteryPollDuration returns the parsed BatteryPollInterval (0 = disabled).
+// Load has already rejected invalid values.
+func (a App) BatteryPollDuration() time.Duration {
+	d, _ := time.ParseDuration(a.BatteryPollInterval)
+	return d
+}
+
+// SmsDedupDuration returns the parsed SmsDedupWindow (0 = disabled).
+// Load has already rejected invalid values.
+func (a App) SmsDedupDuration() time.Duration {
+	d, _ := time.ParseDuration(a.SmsDedupWindow)
+	return d
+}
+
+// defaultCORSMethods and defaultCORSHeaders apply when allow_methods or
+// allow_headers is empty; requiredCORSHeaders are added to any custom list.
+var (
+	defaultCORSMethods  = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	defaultCORSHeaders  = []string{"Origin", "Content-Type", "Authorization", "Idempotency-Key"}
+	requiredCORSHeaders = []string{"Content-Type", "Authorization", "Idempotency-Key"}
+)
+
+// AllowsAnyOrigin reports whether CORS accepts every origin, either because
+// AllowOrigins is empty or because it contains "*".
+func (a App) AllowsAnyOrigin() bool {
+	if len(a.AllowOrigins) == 0 {
+		return true
+	}
+	for _, origin := range a.AllowOrigins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// CORSMethods returns AllowMethods upper-cased, or the defaults if it is empty.
+func (a App) CORSMethods() []string {
+	if len(a.AllowMethods) == 0 {
+		return defaultCORSMethods
+	}
+	methods := make([]string, len(a.AllowMethods))
+	for i, m := range a.AllowMethods {
+		methods[i] = strings.ToUpper(m)
+	}
+	return methods
+}
+
+// CORSHeaders returns AllowHeaders plus any missing required header,
+// or the defaults if it is empty.
+func (a App) CORSHeaders() []string {
+	if len(a.AllowHeaders) == 0 {
+		return defaultCORSHeaders
+	}
+	headers := append([]string(nil), a.AllowHeaders...)
+	for _, required := range requiredCORSHeaders {
+		found := false
+		for _, h := range headers {
+			if strings.EqualFold(h, required) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			headers = append(headers, required)
+		}
+	}
+	return headers
+}
+
+// ParseTTL parses a Go duration string, additionally accepting whole days ("7d").
+func ParseTTL(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// LoginRateLimit configures the lockout after repeated failed logins.
+type LoginRateLimit struct {
+	MaxFailures    int `yaml:"max_failures"`    // Failures allowed within the window (0 = default 5, negative = disabled)
+	WindowSeconds  int `yaml:"window_seconds"`  // Sliding window length (0 = default 60)
+	LockoutSeconds int `yaml:"lockout_seconds"` // Lockout once the limit is hit (0 = default 300)
 }
 
 // Database describes the database connection.
@@ -29,6 +218,21 @@ type Database struct {
 type Security struct {
 	DefaultAdminUser     string `yaml:"default_admin_user"`
 	DefaultAdminPassword string `yaml:"default_admin_password"`
+	// PasswordPolicy is enforced when users are created and passwords changed.
+	PasswordPolicy PasswordPolicy `yaml:"password_policy"`
+	// RejectWeakAdminPassword refuses to start when the admin about to be seeded
+	// has a password that fails PasswordPolicy or is a well-known default.
+	// When false such a password is only logged as a warning.
+	RejectWeakAdminPassword bool `yaml:"reject_weak_admin_password"`
+}
+
+// PasswordPolicy is the minimum strength required of panel passwords.
+type PasswordPolicy struct {
+	MinLength     int  `yaml:"min_length"`     // Minimum length in characters (0 = default 8)
+	RequireUpper  bool `yaml:"require_upper"`  // Require an uppercase letter
+	RequireLower  bool `yaml:"require_lower"`  // Require a lowercase letter
+	RequireDigit  bool `yaml:"require_digit"`  // Require a digit
+	RequireSymbol bool `yaml:"require_symbol"` // Require a character that is not a letter or digit
 }
 
 // Config is the root configuration object.
@@ -36,21 +240,77 @@ type Config struct {
 	App      App      `yaml:"app"`
 	Database Database `yaml:"database"`
 	Security Security `yaml:"security"`
+
+	jwtMu sync.RWMutex // Guards App.JWTSecret, which SetJWTSecret may replace at runtime
+}
+
+// JWTKey returns the current JWT signing key.
+func (c *Config) JWTKey() []byte {
+	c.jwtMu.RLock()
+	defer c.jwtMu.RUnlock()
+	return []byte(c.App.JWTSecret)
+}
+
+// SetJWTSecret replaces the JWT signing secret of the running server. Tokens
+// signed with the previous secret stop validating immediately.
+func (c *Config) SetJWTSecret(secret string) {
+	c.jwtMu.Lock()
+	defer c.jwtMu.Unlock()
+	c.App.JWTSecret = secret
 }
 
 // Load reads YAML configuration from the provided path and applies environment variable overrides.
-// Environment variables take precedence over YAML values.
+// Environment variables take precedence over YAML values. Secrets may instead
+// be read from a file named by the variable with a _FILE suffix, which takes
+// precedence over the variable itself.
 // If the config file doesn't exist, it will use environment variables and defaults only.
 // Supported environment variables:
 //   - SM_APP_ADDR
-//   - SM_APP_JWT_SECRET
+//   - SM_APP_JWT_SECRET (or SM_APP_JWT_SECRET_FILE)
 //   - SM_APP_ALLOW_ORIGINS (comma-separated)
+//   - SM_APP_ALLOW_METHODS (comma-separated)
+//   - SM_APP_ALLOW_HEADERS (comma-separated)
+//   - SM_APP_EXPOSE_HEADERS (comma-separated)
+//   - SM_APP_ALLOW_INSECURE
+//   - SM_APP_TRUSTED_PROXIES (comma-separated)
+//   - SM_APP_LOG_LEVEL
+//   - SM_APP_LOG_FORMAT
+//   - SM_APP_PHONE_MAX_RETRIES
+//   - SM_APP_DEBUG_PHONE_IO
+//   - SM_APP_PHONE_PROXY
+//   - SM_APP_PHONE_INSECURE_SKIP_VERIFY
+//   - SM_APP_PHONE_MAX_RESPONSE_MB
+//   - SM_APP_SYNC_INTERVAL_SECONDS
+//   - SM_APP_BATTERY_HISTORY_DAYS
+//   - SM_APP_BATTERY_POLL_INTERVAL
+//   - SM_APP_BATTERY_ALERT_THRESHOLD
+//   - SM_APP_OFFLINE_ALERT_FAILURES
+//   - SM_APP_SMS_DEDUP_WINDOW
+//   - SM_APP_SYNC_PAGE_SIZE
+//   - SM_APP_SYNC_MAX_PAGES
+//   - SM_APP_SMS_MAX_SEGMENTS
+//   - SM_APP_MAX_CONCURRENT_POLLS
+//   - SM_APP_ACCESS_TOKEN_MINUTES
+//   - SM_APP_REFRESH_TOKEN_DAYS
+//   - SM_APP_TOKEN_TTL
+//   - SM_APP_LOGIN_RATE_LIMIT_MAX_FAILURES
+//   - SM_APP_LOGIN_RATE_LIMIT_WINDOW_SECONDS
+//   - SM_APP_LOGIN_RATE_LIMIT_LOCKOUT_SECONDS
+//   - SM_APP_WEBHOOK_URL
+//   - SM_APP_WEBHOOK_SECRET (or SM_APP_WEBHOOK_SECRET_FILE)
+//   - SM_APP_WEBHOOK_MAX_RETRIES
 //   - SM_DATABASE_DRIVER
-//   - SM_DATABASE_DSN
+//   - SM_DATABASE_DSN (or SM_DATABASE_DSN_FILE)
 //   - SM_DATABASE_MAX_OPEN
 //   - SM_DATABASE_MAX_IDLE
 //   - SM_SECURITY_DEFAULT_ADMIN_USER
-//   - SM_SECURITY_DEFAULT_ADMIN_PASSWORD
+//   - SM_SECURITY_DEFAULT_ADMIN_PASSWORD (or SM_SECURITY_DEFAULT_ADMIN_PASSWORD_FILE)
+//   - SM_SECURITY_PASSWORD_MIN_LENGTH
+//   - SM_SECURITY_PASSWORD_REQUIRE_UPPER
+//   - SM_SECURITY_PASSWORD_REQUIRE_LOWER
+//   - SM_SECURITY_PASSWORD_REQUIRE_DIGIT
+//   - SM_SECURITY_PASSWORD_REQUIRE_SYMBOL
+//   - SM_SECURITY_REJECT_WEAK_ADMIN_PASSWORD
 func Load(path string) (*Config, error) {
 	var cfg Config
 
@@ -69,12 +329,104 @@ func Load(path string) (*Config, error) {
 	}
 
 	// Apply environment variable overrides
-	applyEnvOverrides(&cfg)
+	if err := applyEnvOverrides(&cfg); err != nil {
+		return nil, err
+	}
 
 	// Set defaults
 	if cfg.App.Addr == "" {
 		cfg.App.Addr = ":8080"
 	}
+	if cfg.App.PhoneMaxRetries == 0 {
+		cfg.App.PhoneMaxRetries = 3
+	} else if cfg.App.PhoneMaxRetries < 0 {
+		cfg.App.PhoneMaxRetries = 0
+	}
+	if cfg.App.PhoneMaxResponseMB == 0 {
+		cfg.App.PhoneMaxResponseMB = 8
+	}
+	if cfg.App.SyncIntervalSeconds == 0 {
+		cfg.App.SyncIntervalSeconds = 5
+	}
+	if cfg.App.BatteryHistoryDays == 0 {
+		cfg.App.BatteryHistoryDays = 30
+	}
+	if cfg.App.BatteryPollInterval == "" {
+		cfg.App.BatteryPollInterval = "5m"
+	}
+	if d, err := time.ParseDuration(cfg.App.BatteryPollInterval); err != nil {
+		return nil, fmt.Errorf("app.battery_poll_interval: %w", err)
+	} else if d < 0 {
+		return nil, fmt.Errorf("app.battery_poll_interval must not be negative, got %q", cfg.App.BatteryPollInterval)
+	}
+	if cfg.App.BatteryAlertThreshold < 0 || cfg.App.BatteryAlertThreshold > 100 {
+		return nil, fmt.Errorf("app.battery_alert_threshold must be between 0 and 100, got %d", cfg.App.BatteryAlertThreshold)
+	}
+	for _, proxy := range cfg.App.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return nil, fmt.Errorf("app.trusted_proxies: %q is not an IP or CIDR", proxy)
+			}
+		}
+	}
+	if cfg.App.OfflineAlertFailures == 0 {
+		cfg.App.OfflineAlertFailures = 3
+	} else if cfg.App.OfflineAlertFailures < 0 {
+		cfg.App.OfflineAlertFailures = 0
+	}
+	if cfg.App.SmsDedupWindow != "" {
+		if d, err := time.ParseDuration(cfg.App.SmsDedupWindow); err != nil {
+			return nil, fmt.Errorf("app.sms_dedup_window: %w", err)
+		} else if d < 0 {
+			return nil, fmt.Errorf("app.sms_dedup_window must not be negative, got %q", cfg.App.SmsDedupWindow)
+		}
+	}
+	if cfg.App.SyncPageSize <= 0 {
+		cfg.App.SyncPageSize = 50
+	}
+	if cfg.App.SyncMaxPages <= 0 {
+		cfg.App.SyncMaxPages = 100
+	}
+	if cfg.App.SmsMaxSegments == 0 {
+		cfg.App.SmsMaxSegments = 10
+	} else if cfg.App.SmsMaxSegments < 0 {
+		cfg.App.SmsMaxSegments = 0
+	}
+	if cfg.App.MaxConcurrentPolls <= 0 {
+		cfg.App.MaxConcurrentPolls = 8
+	}
+	if cfg.App.AccessTokenMinutes <= 0 {
+		cfg.App.AccessTokenMinutes = 15
+	}
+	if cfg.App.RefreshTokenDays <= 0 {
+		cfg.App.RefreshTokenDays = 7
+	}
+	if cfg.App.TokenTTL != "" {
+		ttl, err := ParseTTL(cfg.App.TokenTTL)
+		if err != nil {
+			return nil, fmt.Errorf("app.token_ttl: %w", err)
+		}
+		if ttl <= 0 {
+			return nil, fmt.Errorf("app.token_ttl must be positive, got %q", cfg.App.TokenTTL)
+		}
+	}
+	if cfg.App.LoginRateLimit.MaxFailures == 0 {
+		cfg.App.LoginRateLimit.MaxFailures = 5
+	}
+	if cfg.App.LoginRateLimit.WindowSeconds <= 0 {
+		cfg.App.LoginRateLimit.WindowSeconds = 60
+	}
+	if cfg.App.LoginRateLimit.LockoutSeconds <= 0 {
+		cfg.App.LoginRateLimit.LockoutSeconds = 300
+	}
+	if cfg.App.Webhook.MaxRetries == 0 {
+		cfg.App.Webhook.MaxRetries = 3
+	} else if cfg.App.Webhook.MaxRetries < 0 {
+		cfg.App.Webhook.MaxRetries = 0
+	}
+	if cfg.Security.PasswordPolicy.MinLength <= 0 {
+		cfg.Security.PasswordPolicy.MinLength = 8
+	}
 	if cfg.Database.MaxOpen == 0 {
 		cfg.Database.MaxOpen = 10
 	}
@@ -92,30 +444,178 @@ func Load(path string) (*Config, error) {
 	if cfg.Database.DSN == "" {
 		return nil, fmt.Errorf("database.dsn is required (set via config or SM_DATABASE_DSN)")
 	}
-	if cfg.Database.Driver != "mysql" {
-		return nil, fmt.Errorf("only mysql is supported; set database.driver to mysql")
+	switch cfg.Database.Driver {
+	case "mysql", "sqlite", "sqlite3":
+	default:
+		return nil, fmt.Errorf("unsupported database.driver %q; use mysql or sqlite", cfg.Database.Driver)
 	}
 
 	return &cfg, nil
 }
 
+// getSecretEnv returns the value of the environment variable name, or the
+// contents of the file named by name+"_FILE" (Docker/Kubernetes secrets), which
+// takes precedence. Trailing newlines are trimmed from file contents.
+func getSecretEnv(name string) (string, error) {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return os.Getenv(name), nil
+}
+
 // applyEnvOverrides applies environment variable overrides to the config.
-func applyEnvOverrides(cfg *Config) {
+// It fails only when a *_FILE variable names a file that cannot be read.
+func applyEnvOverrides(cfg *Config) error {
 	// App configuration
 	if v := os.Getenv("SM_APP_ADDR"); v != "" {
 		cfg.App.Addr = v
 	}
-	if v := os.Getenv("SM_APP_JWT_SECRET"); v != "" {
+	if v, err := getSecretEnv("SM_APP_JWT_SECRET"); err != nil {
+		return err
+	} else if v != "" {
 		cfg.App.JWTSecret = v
 	}
 	if v := os.Getenv("SM_APP_SM4_KEY"); v != "" {
 		cfg.App.SM4Key = v
 	}
 	if v := os.Getenv("SM_APP_ALLOW_ORIGINS"); v != "" {
-		cfg.App.AllowOrigins = strings.Split(v, ",")
-		// Trim whitespace from each origin
-		for i := range cfg.App.AllowOrigins {
-			cfg.App.AllowOrigins[i] = strings.TrimSpace(cfg.App.AllowOrigins[i])
+		cfg.App.AllowOrigins = splitList(v)
+	}
+	if v := os.Getenv("SM_APP_ALLOW_METHODS"); v != "" {
+		cfg.App.AllowMethods = splitList(v)
+	}
+	if v := os.Getenv("SM_APP_ALLOW_HEADERS"); v != "" {
+		cfg.App.AllowHeaders = splitList(v)
+	}
+	if v := os.Getenv("SM_APP_EXPOSE_HEADERS"); v != "" {
+		cfg.App.ExposeHeaders = splitList(v)
+	}
+	if v := os.Getenv("SM_APP_TRUSTED_PROXIES"); v != "" {
+		cfg.App.TrustedProxies = splitList(v)
+	}
+	if v := os.Getenv("SM_APP_ALLOW_INSECURE"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.App.AllowInsecure = b
+		}
+	}
+	if v := os.Getenv("SM_APP_LOG_LEVEL"); v != "" {
+		cfg.App.LogLevel = v
+	}
+	if v := os.Getenv("SM_APP_LOG_FORMAT"); v != "" {
+		cfg.App.LogFormat = v
+	}
+	if v := os.Getenv("SM_APP_PHONE_MAX_RETRIES"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.PhoneMaxRetries = i
+		}
+	}
+	if v := os.Getenv("SM_APP_DEBUG_PHONE_IO"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.App.DebugPhoneIO = b
+		}
+	}
+	if v := os.Getenv("SM_APP_PHONE_PROXY"); v != "" {
+		cfg.App.PhoneProxy = v
+	}
+	if v := os.Getenv("SM_APP_PHONE_INSECURE_SKIP_VERIFY"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.App.PhoneInsecureSkipVerify = b
+		}
+	}
+	if v := os.Getenv("SM_APP_PHONE_MAX_RESPONSE_MB"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.PhoneMaxResponseMB = i
+		}
+	}
+	if v := os.Getenv("SM_APP_SYNC_INTERVAL_SECONDS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.SyncIntervalSeconds = i
+		}
+	}
+	if v := os.Getenv("SM_APP_BATTERY_HISTORY_DAYS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.BatteryHistoryDays = i
+		}
+	}
+	if v := os.Getenv("SM_APP_BATTERY_POLL_INTERVAL"); v != "" {
+		cfg.App.BatteryPollInterval = v
+	}
+	if v := os.Getenv("SM_APP_BATTERY_ALERT_THRESHOLD"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.BatteryAlertThreshold = i
+		}
+	}
+	if v := os.Getenv("SM_APP_OFFLINE_ALERT_FAILURES"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.OfflineAlertFailures = i
+		}
+	}
+	if v := os.Getenv("SM_APP_SMS_DEDUP_WINDOW"); v != "" {
+		cfg.App.SmsDedupWindow = v
+	}
+	if v := os.Getenv("SM_APP_SYNC_PAGE_SIZE"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.SyncPageSize = i
+		}
+	}
+	if v := os.Getenv("SM_APP_SYNC_MAX_PAGES"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.SyncMaxPages = i
+		}
+	}
+	if v := os.Getenv("SM_APP_SMS_MAX_SEGMENTS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.SmsMaxSegments = i
+		}
+	}
+	if v := os.Getenv("SM_APP_MAX_CONCURRENT_POLLS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.MaxConcurrentPolls = i
+		}
+	}
+	if v := os.Getenv("SM_APP_ACCESS_TOKEN_MINUTES"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.AccessTokenMinutes = i
+		}
+	}
+	if v := os.Getenv("SM_APP_REFRESH_TOKEN_DAYS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.RefreshTokenDays = i
+		}
+	}
+	if v := os.Getenv("SM_APP_TOKEN_TTL"); v != "" {
+		cfg.App.TokenTTL = v
+	}
+	if v := os.Getenv("SM_APP_LOGIN_RATE_LIMIT_MAX_FAILURES"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.LoginRateLimit.MaxFailures = i
+		}
+	}
+	if v := os.Getenv("SM_APP_LOGIN_RATE_LIMIT_WINDOW_SECONDS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.LoginRateLimit.WindowSeconds = i
+		}
+	}
+	if v := os.Getenv("SM_APP_LOGIN_RATE_LIMIT_LOCKOUT_SECONDS"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.LoginRateLimit.LockoutSeconds = i
+		}
+	}
+	if v := os.Getenv("SM_APP_WEBHOOK_URL"); v != "" {
+		cfg.App.Webhook.URL = v
+	}
+	if v, err := getSecretEnv("SM_APP_WEBHOOK_SECRET"); err != nil {
+		return err
+	} else if v != "" {
+		cfg.App.Webhook.Secret = v
+	}
+	if v := os.Getenv("SM_APP_WEBHOOK_MAX_RETRIES"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.App.Webhook.MaxRetries = i
 		}
 	}
 
@@ -123,7 +623,9 @@ func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("SM_DATABASE_DRIVER"); v != "" {
 		cfg.Database.Driver = v
 	}
-	if v := os.Getenv("SM_DATABASE_DSN"); v != "" {
+	if v, err := getSecretEnv("SM_DATABASE_DSN"); err != nil {
+		return err
+	} else if v != "" {
 		cfg.Database.DSN = v
 	}
 	if v := os.Getenv("SM_DATABASE_MAX_OPEN"); v != "" {
@@ -141,7 +643,50 @@ func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("SM_SECURITY_DEFAULT_ADMIN_USER"); v != "" {
 		cfg.Security.DefaultAdminUser = v
 	}
-	if v := os.Getenv("SM_SECURITY_DEFAULT_ADMIN_PASSWORD"); v != "" {
+	if v, err := getSecretEnv("SM_SECURITY_DEFAULT_ADMIN_PASSWORD"); err != nil {
+		return err
+	} else if v != "" {
 		cfg.Security.DefaultAdminPassword = v
 	}
+	if v := os.Getenv("SM_SECURITY_PASSWORD_MIN_LENGTH"); v != "" {
+		if i, err := strconv.Atoi(v); err == nil {
+			cfg.Security.PasswordPolicy.MinLength = i
+		}
+	}
+	if v := os.Getenv("SM_SECURITY_PASSWORD_REQUIRE_UPPER"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Security.PasswordPolicy.RequireUpper = b
+		}
+	}
+	if v := os.Getenv("SM_SECURITY_PASSWORD_REQUIRE_LOWER"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Security.PasswordPolicy.RequireLower = b
+		}
+	}
+	if v := os.Getenv("SM_SECURITY_PASSWORD_REQUIRE_DIGIT"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Security.PasswordPolicy.RequireDigit = b
+		}
+	}
+	if v := os.Getenv("SM_SECURITY_PASSWORD_REQUIRE_SYMBOL"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Security.PasswordPolicy.RequireSymbol = b
+		}
+	}
+	if v := os.Getenv("SM_SECURITY_REJECT_WEAK_ADMIN_PASSWORD"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Security.RejectWeakAdminPassword = b
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma-separated environment value, trimming whitespace
+// from each item.
+func splitList(v string) []string {
+	items := strings.Split(v, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
 }
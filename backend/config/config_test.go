@@ -2,7 +2,10 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -107,6 +110,82 @@ security:
 		}
 	})
 
+	t.Run("CORSMethodsAndHeaders", func(t *testing.T) {
+		cfg, err := Load(tmpFile)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if got := strings.Join(cfg.App.CORSMethods(), ","); got != "GET,POST,PUT,PATCH,DELETE,OPTIONS" {
+			t.Errorf("Unexpected default methods %s", got)
+		}
+		if got := strings.Join(cfg.App.CORSHeaders(), ","); got != "Origin,Content-Type,Authorization,Idempotency-Key" {
+			t.Errorf("Unexpected default headers %s", got)
+		}
+
+		os.Setenv("SM_APP_ALLOW_METHODS", "get, patch")
+		os.Setenv("SM_APP_ALLOW_HEADERS", "X-Request-Id, authorization")
+		os.Setenv("SM_APP_EXPOSE_HEADERS", "X-Request-Id")
+		defer os.Unsetenv("SM_APP_ALLOW_METHODS")
+		defer os.Unsetenv("SM_APP_ALLOW_HEADERS")
+		defer os.Unsetenv("SM_APP_EXPOSE_HEADERS")
+		cfg, err = Load(tmpFile)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if got := strings.Join(cfg.App.CORSMethods(), ","); got != "GET,PATCH" {
+			t.Errorf("Expected configured methods, got %s", got)
+		}
+		if got := strings.Join(cfg.App.CORSHeaders(), ","); got != "X-Request-Id,authorization,Content-Type,Idempotency-Key" {
+			t.Errorf("Expected configured headers plus Content-Type, got %s", got)
+		}
+		if len(cfg.App.ExposeHeaders) != 1 || cfg.App.ExposeHeaders[0] != "X-Request-Id" {
+			t.Errorf("Expected X-Request-Id exposed, got %v", cfg.App.ExposeHeaders)
+		}
+	})
+
+	t.Run("AllowsAnyOrigin", func(t *testing.T) {
+		cfg, err := Load(tmpFile)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if cfg.App.AllowsAnyOrigin() {
+			t.Errorf("Expected http://example.com not to allow any origin")
+		}
+		for _, origins := range [][]string{nil, {"http://example.com", "*"}} {
+			if app := (App{AllowOrigins: origins}); !app.AllowsAnyOrigin() {
+				t.Errorf("Expected %v to allow any origin", origins)
+			}
+		}
+	})
+
+	t.Run("PasswordPolicy", func(t *testing.T) {
+		cfg, err := Load(tmpFile)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if cfg.Security.PasswordPolicy.MinLength != 8 {
+			t.Errorf("Expected default min length 8, got %d", cfg.Security.PasswordPolicy.MinLength)
+		}
+
+		os.Setenv("SM_SECURITY_PASSWORD_MIN_LENGTH", "12")
+		os.Setenv("SM_SECURITY_PASSWORD_REQUIRE_SYMBOL", "true")
+		os.Setenv("SM_SECURITY_REJECT_WEAK_ADMIN_PASSWORD", "true")
+		defer os.Unsetenv("SM_SECURITY_PASSWORD_MIN_LENGTH")
+		defer os.Unsetenv("SM_SECURITY_PASSWORD_REQUIRE_SYMBOL")
+		defer os.Unsetenv("SM_SECURITY_REJECT_WEAK_ADMIN_PASSWORD")
+		cfg, err = Load(tmpFile)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		policy := cfg.Security.PasswordPolicy
+		if policy.MinLength != 12 || !policy.RequireSymbol || policy.RequireDigit {
+			t.Errorf("Unexpected policy from env: %+v", policy)
+		}
+		if !cfg.Security.RejectWeakAdminPassword {
+			t.Errorf("Expected reject_weak_admin_password from env")
+		}
+	})
+
 	t.Run("MissingJWTSecret", func(t *testing.T) {
 		// Create config without JWT secret
 		tmpFileNoSecret := "test_config_no_secret.yaml"
@@ -155,5 +234,199 @@ database:
 		if cfg.Database.Driver != "mysql" {
 			t.Errorf("Expected default driver mysql, got %s", cfg.Database.Driver)
 		}
+		if cfg.App.SyncIntervalSeconds != 5 {
+			t.Errorf("Expected default sync interval 5, got %d", cfg.App.SyncIntervalSeconds)
+		}
+	})
+
+	t.Run("SQLiteDriver", func(t *testing.T) {
+		os.Setenv("SM_DATABASE_DRIVER", "sqlite")
+		os.Setenv("SM_DATABASE_DSN", "smserver.db")
+		defer func() {
+			os.Unsetenv("SM_DATABASE_DRIVER")
+			os.Unsetenv("SM_DATABASE_DSN")
+		}()
+
+		cfg, err := Load(tmpFile)
+		if err != nil {
+			t.Fatalf("Load with sqlite driver failed: %v", err)
+		}
+		if cfg.Database.Driver != "sqlite" {
+			t.Errorf("Expected driver sqlite, got %s", cfg.Database.Driver)
+		}
+	})
+
+	t.Run("UnsupportedDriver", func(t *testing.T) {
+		os.Setenv("SM_DATABASE_DRIVER", "postgres")
+		defer os.Unsetenv("SM_DATABASE_DRIVER")
+
+		if _, err := Load(tmpFile); err == nil {
+			t.Error("Expected error for unsupported driver, got nil")
+		}
+	})
+
+	t.Run("TokenTTL", func(t *testing.T) {
+		defer os.Unsetenv("SM_APP_TOKEN_TTL")
+
+		for value, want := range map[string]time.Duration{"1h": time.Hour, "168h": 168 * time.Hour, "7d": 7 * 24 * time.Hour} {
+			os.Setenv("SM_APP_TOKEN_TTL", value)
+			cfg, err := Load(tmpFile)
+			if err != nil {
+				t.Fatalf("Load with token_ttl %q failed: %v", value, err)
+			}
+			if got := cfg.App.RefreshTokenTTL(); got != want {
+				t.Errorf("token_ttl %q: expected %v, got %v", value, want, got)
+			}
+		}
+
+		for _, value := range []string{"0", "-1h", "0d", "soon"} {
+			os.Setenv("SM_APP_TOKEN_TTL", value)
+			if _, err := Load(tmpFile); err == nil {
+				t.Errorf("Expected token_ttl %q to be rejected", value)
+			}
+		}
+
+		os.Unsetenv("SM_APP_TOKEN_TTL")
+		cfg, err := Load(tmpFile)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if got := cfg.App.RefreshTokenTTL(); got != 7*24*time.Hour {
+			t.Errorf("Expected default session lifetime of 7 days, got %v", got)
+		}
+	})
+
+	t.Run("BatteryPollInterval", func(t *testing.T) {
+		defer os.Unsetenv("SM_APP_BATTERY_POLL_INTERVAL")
+
+		cfg, err := Load(tmpFile)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if got := cfg.App.BatteryPollDuration(); got != 5*time.Minute {
+			t.Errorf("Expected default battery poll interval of 5m, got %v", got)
+		}
+
+		for value, want := range map[string]time.Duration{"30s": 30 * time.Second, "0": 0} {
+			os.Setenv("SM_APP_BATTERY_POLL_INTERVAL", value)
+			cfg, err := Load(tmpFile)
+			if err != nil {
+				t.Fatalf("Load with battery_poll_interval %q failed: %v", value, err)
+			}
+			if got := cfg.App.BatteryPollDuration(); got != want {
+				t.Errorf("battery_poll_interval %q: expected %v, got %v", value, want, got)
+			}
+		}
+
+		for _, value := range []string{"-1m", "often"} {
+			os.Setenv("SM_APP_BATTERY_POLL_INTERVAL", value)
+			if _, err := Load(tmpFile); err == nil {
+				t.Errorf("Expected battery_poll_interval %q to be rejected", value)
+			}
+		}
+	})
+
+	t.Run("SmsDedupWindow", func(t *testing.T) {
+		defer os.Unsetenv("SM_APP_SMS_DEDUP_WINDOW")
+
+		cfg, err := Load(tmpFile)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if got := cfg.App.SmsDedupDuration(); got != 0 {
+			t.Errorf("Expected fuzzy SMS dedup to be off by default, got %v", got)
+		}
+
+		os.Setenv("SM_APP_SMS_DEDUP_WINDOW", "2s")
+		if cfg, err = Load(tmpFile); err != nil || cfg.App.SmsDedupDuration() != 2*time.Second {
+			t.Errorf("Expected a 2s dedup window, got %v (err %v)", cfg, err)
+		}
+		os.Setenv("SM_APP_SMS_DEDUP_WINDOW", "-2s")
+		if _, err := Load(tmpFile); err == nil {
+			t.Error("Expected a negative sms_dedup_window to be rejected")
+		}
+	})
+
+	t.Run("SyncLimits", func(t *testing.T) {
+		defer os.Unsetenv("SM_APP_SYNC_MAX_PAGES")
+
+		cfg, err := Load(tmpFile)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if cfg.App.SyncPageSize != 50 || cfg.App.SyncMaxPages != 100 {
+			t.Errorf("Expected default sync limits 50/100, got %d/%d", cfg.App.SyncPageSize, cfg.App.SyncMaxPages)
+		}
+
+		os.Setenv("SM_APP_SYNC_MAX_PAGES", "400")
+		if cfg, err = Load(tmpFile); err != nil || cfg.App.SyncMaxPages != 400 {
+			t.Errorf("Expected SM_APP_SYNC_MAX_PAGES=400 to apply, got %v (err %v)", cfg, err)
+		}
+	})
+
+	t.Run("SmsMaxSegments", func(t *testing.T) {
+		defer os.Unsetenv("SM_APP_SMS_MAX_SEGMENTS")
+
+		cfg, err := Load(tmpFile)
+		if err != nil || cfg.App.SmsMaxSegments != 10 {
+			t.Fatalf("Expected default sms_max_segments 10, got %v (err %v)", cfg, err)
+		}
+		os.Setenv("SM_APP_SMS_MAX_SEGMENTS", "-1")
+		if cfg, err = Load(tmpFile); err != nil || cfg.App.SmsMaxSegments != 0 {
+			t.Errorf("Expected a negative limit to disable the check, got %v (err %v)", cfg, err)
+		}
+	})
+
+	t.Run("DebugPhoneIO", func(t *testing.T) {
+		defer os.Unsetenv("SM_APP_DEBUG_PHONE_IO")
+
+		cfg, err := Load(tmpFile)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if cfg.App.DebugPhoneIO {
+			t.Error("Expected phone IO debugging to be off by default")
+		}
+
+		os.Setenv("SM_APP_DEBUG_PHONE_IO", "true")
+		cfg, err = Load(tmpFile)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if !cfg.App.DebugPhoneIO {
+			t.Error("Expected SM_APP_DEBUG_PHONE_IO=true to enable phone IO debugging")
+		}
+	})
+
+	t.Run("SecretFiles", func(t *testing.T) {
+		dir := t.TempDir()
+		secretFile := filepath.Join(dir, "jwt_secret")
+		dsnFile := filepath.Join(dir, "dsn")
+		os.WriteFile(secretFile, []byte("file-secret\n"), 0600)
+		os.WriteFile(dsnFile, []byte("file:file@tcp(filehost:3306)/filedb"), 0600)
+		os.Setenv("SM_APP_JWT_SECRET", "env-secret")
+		os.Setenv("SM_APP_JWT_SECRET_FILE", secretFile)
+		os.Setenv("SM_DATABASE_DSN_FILE", dsnFile)
+		defer func() {
+			os.Unsetenv("SM_APP_JWT_SECRET")
+			os.Unsetenv("SM_APP_JWT_SECRET_FILE")
+			os.Unsetenv("SM_DATABASE_DSN_FILE")
+		}()
+
+		cfg, err := Load(tmpFile)
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if cfg.App.JWTSecret != "file-secret" {
+			t.Errorf("Expected the file to win over the inline variable and lose its newline, got %q", cfg.App.JWTSecret)
+		}
+		if cfg.Database.DSN != "file:file@tcp(filehost:3306)/filedb" {
+			t.Errorf("Expected DSN from file, got %s", cfg.Database.DSN)
+		}
+
+		os.Setenv("SM_DATABASE_DSN_FILE", filepath.Join(dir, "missing"))
+		if _, err := Load(tmpFile); err == nil || !strings.Contains(err.Error(), "SM_DATABASE_DSN_FILE") {
+			t.Errorf("Expected an unreadable secret file to fail Load, got %v", err)
+		}
 	})
 }
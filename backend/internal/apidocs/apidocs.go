@@ -0,0 +1,62 @@
+// Package apidocs serves the OpenAPI description of the HTTP API and a Swagger UI for it.
+//
+// openapi.yaml is maintained by hand next to the handlers; the server tests
+// check that it lists exactly the routes the router registers.
+package apidocs
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	//go:embed openapi.yaml
+	specYAML []byte
+
+	//go:embed swagger.html
+	swaggerHTML []byte
+)
+
+var (
+	specOnce sync.Once
+	specJSON []byte
+	specErr  error
+)
+
+// Spec returns the OpenAPI document as JSON, converted from openapi.yaml once.
+func Spec() ([]byte, error) {
+	specOnce.Do(func() {
+		var doc interface{}
+		if specErr = yaml.Unmarshal(specYAML, &doc); specErr != nil {
+			return
+		}
+		specJSON, specErr = json.Marshal(doc)
+	})
+	return specJSON, specErr
+}
+
+// SpecHandler serves the OpenAPI document as JSON.
+func SpecHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		spec, err := Spec()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(spec)
+	})
+}
+
+// UIHandler serves a Swagger UI page for the document at /api/openapi.json.
+// The UI's scripts load from a CDN, so the page needs internet access.
+func UIHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(swaggerHTML)
+	})
+}
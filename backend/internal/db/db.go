@@ -2,48 +2,167 @@ package db
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"backend/config"
 	"backend/internal/models"
+	"backend/internal/smsutil"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
 	"xorm.io/xorm"
 )
 
 // NewEngine builds a xorm engine from configuration and performs schema sync.
+// Supported drivers: mysql, sqlite (DSN is a file path or ":memory:").
 func NewEngine(cfg *config.Config) (*xorm.Engine, error) {
 	driver := cfg.Database.Driver
 	dsn := cfg.Database.DSN
 
-	if driver != "mysql" {
-		return nil, fmt.Errorf("only mysql driver is supported")
+	name := driverName(driver)
+	if name == "" {
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
 	}
 
-	engine, err := xorm.NewEngine(driverName(driver), dsn)
+	engine, err := xorm.NewEngine(name, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("connect database: %w", err)
 	}
 
-	engine.SetMaxOpenConns(cfg.Database.MaxOpen)
-	engine.SetMaxIdleConns(cfg.Database.MaxIdle)
+	if name == "sqlite3" {
+		// SQLite only allows a single writer; an in-memory database is also
+		// private to its connection, so keep exactly one connection open.
+		engine.SetMaxOpenConns(1)
+		engine.SetMaxIdleConns(1)
+	} else {
+		engine.SetMaxOpenConns(cfg.Database.MaxOpen)
+		engine.SetMaxIdleConns(cfg.Database.MaxIdle)
+	}
 	engine.ShowSQL(false) // Disable SQL logging to reduce console output
 	engine.TZLocation = time.Local
 
 	if err := engine.Sync(
 		new(models.User),
+		new(models.RevokedToken),
+		new(models.APIKey),
 		new(models.Device),
 		new(models.SmsMessage),
 		new(models.CallLog),
 		new(models.Contact),
+		new(models.ContactGroup),
+		new(models.ContactGroupMember),
 		new(models.Command),
+		new(models.BatteryHistory),
+		new(models.LocationHistory),
+		new(models.ForwardRule),
+		new(models.Blocklist),
+		new(models.AuditLog),
+		new(models.Setting),
 	); err != nil {
 		return nil, fmt.Errorf("sync schema: %w", err)
 	}
+	if err := backfillPhoneKeys(engine); err != nil {
+		return nil, err
+	}
+	// Sent messages stored before delivery tracking count as sent
+	if _, err := engine.Exec("UPDATE sms_message SET delivery_status = ? WHERE type = 2 AND delivery_status = ''", models.DeliveryStatusSent); err != nil {
+		return nil, fmt.Errorf("backfill sms_message.delivery_status: %w", err)
+	}
 
 	return engine, nil
 }
 
+// driverName maps a configured driver to the registered database/sql driver name.
+// Returns an empty string for unsupported drivers.
 func driverName(driver string) string {
-	return "mysql"
+	switch driver {
+	case "mysql":
+		return "mysql"
+	case "sqlite", "sqlite3":
+		return "sqlite3"
+	}
+	return ""
+}
+
+// backfillBatch is how many rows backfillPhoneKeys updates per transaction.
+const backfillBatch = 500
+
+// backfillPhoneKeys fills the normalized number columns of rows stored before
+// they existed (including soft-deleted ones), then merges contacts that turn
+// out to share a number, so contact JOINs match each message at most once.
+func backfillPhoneKeys(engine *xorm.Engine) error {
+	for _, col := range []struct{ table, source, key string }{
+		{"sms_message", "address", "address_key"},
+		{"call_log", "number", "number_key"},
+		{"contact", "phone", "phone_key"},
+	} {
+		if err := backfillKeyColumn(engine, col.table, col.source, col.key); err != nil {
+			return fmt.Errorf("backfill %s.%s: %w", col.table, col.key, err)
+		}
+	}
+	return mergeDuplicateContacts(engine)
+}
+
+// backfillKeyColumn sets key = NormalizePhone(source) wherever key is empty.
+func backfillKeyColumn(engine *xorm.Engine, table, source, key string) error {
+	query := fmt.Sprintf("SELECT id, %s FROM %s WHERE id > ? AND (%s IS NULL OR %s = '') ORDER BY id LIMIT %d",
+		source, table, key, key, backfillBatch)
+	update := fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", table, key)
+
+	var lastID int64
+	for {
+		rows, err := engine.QueryString(query, lastID)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		session := engine.NewSession()
+		if err := session.Begin(); err != nil {
+			session.Close()
+			return err
+		}
+		for _, row := range rows {
+			lastID, _ = strconv.ParseInt(row["id"], 10, 64)
+			if _, err := session.Exec(update, smsutil.NormalizePhone(row[source]), lastID); err != nil {
+				session.Rollback()
+				session.Close()
+				return err
+			}
+		}
+		err = session.Commit()
+		session.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// mergeDuplicateContacts keeps one contact per device and normalized phone,
+// preferring a real (not hidden) contact, then the oldest, and deletes the rest
+// with their group memberships.
+func mergeDuplicateContacts(engine *xorm.Engine) error {
+	dups, err := engine.QueryString(`SELECT device_id, phone_key FROM contact
+		WHERE phone_key <> '' GROUP BY device_id, phone_key HAVING COUNT(*) > 1`)
+	if err != nil {
+		return err
+	}
+	for _, dup := range dups {
+		var contacts []models.Contact
+		if err := engine.Where("device_id = ? AND phone_key = ?", dup["device_id"], dup["phone_key"]).
+			Asc("is_hidden", "id").Find(&contacts); err != nil {
+			return err
+		}
+		for _, extra := range contacts[1:] {
+			if _, err := engine.Where("contact_id = ?", extra.ID).Delete(&models.ContactGroupMember{}); err != nil {
+				return err
+			}
+			if _, err := engine.ID(extra.ID).Delete(&models.Contact{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"backend/config"
+	"backend/internal/models"
+)
+
+func TestNewEngineSQLiteMemory(t *testing.T) {
+	cfg := &config.Config{
+		Database: config.Database{Driver: "sqlite", DSN: ":memory:"},
+	}
+	engine, err := NewEngine(cfg)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	defer engine.Close()
+
+	device := models.Device{
+		Name:      "test phone",
+		PhoneAddr: "http://192.168.1.100:5000",
+		SM4Key:    "0123456789abcdef0123456789abcdef",
+		Status:    "unknown",
+		SimInfo:   "text column",
+	}
+	if _, err := engine.Insert(&device); err != nil {
+		t.Fatalf("insert device failed: %v", err)
+	}
+	if device.ID == 0 {
+		t.Fatal("Expected autoincrement ID to be set")
+	}
+
+	// bigint and text columns should round-trip
+	sms := models.SmsMessage{
+		DeviceID: device.ID,
+		Address:  "10086",
+		Body:     "hello from sqlite",
+		Type:     1,
+		SmsTime:  1700000000123,
+	}
+	if _, err := engine.Insert(&sms); err != nil {
+		t.Fatalf("insert sms failed: %v", err)
+	}
+
+	var got models.SmsMessage
+	has, err := engine.ID(sms.ID).Get(&got)
+	if err != nil || !has {
+		t.Fatalf("get sms failed: has=%v err=%v", has, err)
+	}
+	if got.SmsTime != sms.SmsTime {
+		t.Errorf("Expected sms_time %d, got %d", sms.SmsTime, got.SmsTime)
+	}
+	if got.Body != sms.Body {
+		t.Errorf("Expected body %q, got %q", sms.Body, got.Body)
+	}
+}
+
+func TestNewEngineUnsupportedDriver(t *testing.T) {
+	cfg := &config.Config{
+		Database: config.Database{Driver: "postgres", DSN: "whatever"},
+	}
+	if _, err := NewEngine(cfg); err == nil {
+		t.Fatal("Expected error for unsupported driver, got nil")
+	}
+}
+
+func TestNewEngineMigratesSoftDeleteColumns(t *testing.T) {
+	cfg := &config.Config{
+		Database: config.Database{Driver: "sqlite", DSN: ":memory:"},
+	}
+	engine, err := NewEngine(cfg)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	defer engine.Close()
+
+	tables, err := engine.DBMetas()
+	if err != nil {
+		t.Fatalf("DBMetas failed: %v", err)
+	}
+	want := map[string]bool{"sms_message": false, "call_log": false}
+	for _, table := range tables {
+		if _, ok := want[table.Name]; ok && table.GetColumn("deleted_at") != nil {
+			want[table.Name] = true
+		}
+	}
+	for name, found := range want {
+		if !found {
+			t.Errorf("Expected %s to have a deleted_at column", name)
+		}
+	}
+}
+
+func TestNewEngineBackfillsPhoneKeys(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "sm.db")
+	cfg := &config.Config{Database: config.Database{Driver: "sqlite", DSN: dsn}}
+	engine, err := NewEngine(cfg)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	// Rows written before the key columns existed
+	engine.Exec("INSERT INTO contact (device_id, name, phone, is_hidden) VALUES (1, 'Alice', '+8613800138000', 0)")
+	engine.Exec("INSERT INTO contact (device_id, name, phone, is_hidden) VALUES (1, '13800138000', '13800138000', 1)")
+	engine.Exec("INSERT INTO sms_message (device_id, address, type, sms_time) VALUES (1, '138 0013 8000', 1, 1)")
+	engine.Close()
+
+	engine, err = NewEngine(cfg)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	defer engine.Close()
+
+	var sms models.SmsMessage
+	engine.Get(&sms)
+	if sms.AddressKey != "13800138000" {
+		t.Errorf("Expected the SMS address key backfilled, got %q", sms.AddressKey)
+	}
+	var contacts []models.Contact
+	engine.Find(&contacts)
+	if len(contacts) != 1 || contacts[0].Name != "Alice" || contacts[0].PhoneKey != "13800138000" {
+		t.Errorf("Expected duplicates merged into the real contact, got %+v", contacts)
+	}
+}
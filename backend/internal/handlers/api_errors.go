@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes shared by the handlers and the server middleware. Clients
+// branch on the code; the message is for people and may change.
+const (
+	CodeInvalidRequest = "invalid_request" // Malformed body or query, or a value that failed validation
+	CodeInvalidID      = "invalid_id"      // A path ID that isn't a number
+	CodeUnauthorized   = "unauthorized"    // Missing, invalid or revoked credentials
+	CodeForbidden      = "forbidden"       // The role or API key scopes don't allow the request
+	CodeConflict       = "conflict"        // The request conflicts with the current state
+	CodeRateLimited    = "rate_limited"
+	CodeBodyTooLarge   = "body_too_large"
+	CodeInternal       = "internal_error"
+)
+
+// Codes for a missing resource (404).
+const (
+	codeDeviceNotFound    = "device_not_found"
+	codeSmsNotFound       = "sms_not_found"
+	codeContactNotFound   = "contact_not_found"
+	codeGroupNotFound     = "contact_group_not_found"
+	codeRuleNotFound      = "forward_rule_not_found"
+	codeBlocklistNotFound = "blocklist_entry_not_found"
+	codeCommandNotFound   = "command_not_found"
+	codeUserNotFound      = "user_not_found"
+	codeAPIKeyNotFound    = "api_key_not_found"
+)
+
+// Codes for specific validation failures that clients handle differently.
+const (
+	codeWeakPassword         = "weak_password"          // With failed_rules
+	codeSmsTooLong           = "sms_too_long"           // With segments, max_segments, encoding and units
+	codeSimSelectionRequired = "sim_selection_required" // sim_slot 0 could not pick a SIM
+	codeSendQuotaExceeded    = "send_quota_exceeded"    // With window, limit, remaining and reset_at
+)
+
+// ErrorBody builds the JSON body of an error response:
+//
+//	{"error": {"code": "device_not_found", "message": "device not found"}}
+//
+// Fields of details are added to the error object next to code and message.
+func ErrorBody(code, message string, details ...gin.H) gin.H {
+	body := gin.H{"code": code, "message": message}
+	for _, d := range details {
+		for k, v := range d {
+			body[k] = v
+		}
+	}
+	return gin.H{"error": body}
+}
+
+// respondError writes an error response with the ErrorBody envelope.
+func respondError(c *gin.Context, status int, code, message string, details ...gin.H) {
+	c.JSON(status, ErrorBody(code, message, details...))
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/internal/models"
+	"backend/internal/repository"
+	"backend/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// CreateAPIKeyRequest is the body of POST /api/api-keys.
+type CreateAPIKeyRequest struct {
+	Label  string   `json:"label" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"` // *, read, sms:send
+}
+
+// ListAPIKeys returns all API keys, without the keys themselves.
+func ListAPIKeys(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := repository.NewAPIKeyRepository(engine).FindAll()
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"items": keys})
+	}
+}
+
+// CreateAPIKey issues an API key owned by the current user, so it acts with
+// that user's role, limited to the given scopes. The key is only returned
+// here; afterwards just its hash is kept.
+func CreateAPIKey(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		req.Label = strings.TrimSpace(req.Label)
+		if req.Label == "" || len(req.Label) > 50 {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "label must be 1 to 50 characters")
+			return
+		}
+		if len(req.Scopes) == 0 {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "at least one scope is required")
+			return
+		}
+		for _, scope := range req.Scopes {
+			switch scope {
+			case models.APIScopeAll, models.APIScopeRead, models.APIScopeSmsSend:
+			default:
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("unknown scope %q (want *, read or sms:send)", scope))
+				return
+			}
+		}
+		userID, ok := currentUserID(c)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid claims")
+			return
+		}
+
+		plain, err := security.GenerateAPIKey()
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		key := models.APIKey{
+			UserID:  userID,
+			Label:   req.Label,
+			Prefix:  security.APIKeyLookup(plain),
+			KeyHash: security.HashAPIKey(plain),
+			Scopes:  req.Scopes,
+		}
+		if err := repository.NewAPIKeyRepository(engine).Insert(&key); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		recordAudit(c, engine, models.AuditAPIKeyCreate, "api_key", key.ID,
+			fmt.Sprintf("label=%s scopes=%s", key.Label, strings.Join(key.Scopes, ",")))
+		c.JSON(http.StatusCreated, gin.H{"api_key": key, "key": plain})
+	}
+}
+
+// RevokeAPIKey deletes an API key; requests using it are rejected from then on.
+func RevokeAPIKey(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid API key id")
+			return
+		}
+		deleted, err := repository.NewAPIKeyRepository(engine).Delete(id)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if !deleted {
+			respondError(c, http.StatusNotFound, codeAPIKeyNotFound, "API key not found")
+			return
+		}
+		recordAudit(c, engine, models.AuditAPIKeyRevoke, "api_key", id, "")
+		c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+	}
+}
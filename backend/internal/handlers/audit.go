@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"backend/internal/models"
+	"backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"xorm.io/xorm"
+)
+
+// recordAudit stores who performed a mutating action. The acting user comes
+// from the JWT claims set by AuthMiddleware. Failures are logged rather than
+// returned so a full audit table never blocks the action itself.
+func recordAudit(c *gin.Context, engine *xorm.Engine, action, targetType string, targetID int64, detail string) {
+	entry := &models.AuditLog{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Detail:     detail,
+	}
+	if claims, ok := c.Get("claims"); ok {
+		if userClaims, ok := claims.(*jwt.MapClaims); ok {
+			if id, ok := (*userClaims)["sub"].(float64); ok {
+				entry.UserID = int64(id)
+			}
+			entry.Username, _ = (*userClaims)["u"].(string)
+		}
+	}
+	if err := repository.NewAuditLogRepository(engine).Insert(entry); err != nil {
+		log.Printf("[Audit] record %s by %q error: %v", action, entry.Username, err)
+	}
+}
+
+// ListAuditLogs returns audit entries, newest first, optionally filtered by action.
+func ListAuditLogs(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page := parsePage(c)
+
+		items, total, err := repository.NewAuditLogRepository(engine).FindAll(c.Query("action"), page.Num, page.Size)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, page.body(items, total))
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"net/http"
 
 	"backend/config"
+	"backend/internal/metrics"
 	"backend/internal/models"
+	"backend/internal/repository"
 	"backend/internal/security"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"xorm.io/xorm"
 )
 
@@ -21,24 +24,156 @@ func Login(cfg *config.Config, engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req LoginRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 		var user models.User
 		has, err := engine.Where("username = ?", req.Username).Get(&user)
 		if err != nil || !has {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+			metrics.LoginAttempts.WithLabelValues("failure").Inc()
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid credentials")
 			return
 		}
 		if !security.CheckPassword(user.Password, req.Password) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+			metrics.LoginAttempts.WithLabelValues("failure").Inc()
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid credentials")
 			return
 		}
+		metrics.LoginAttempts.WithLabelValues("success").Inc()
 		token, err := security.CreateToken(cfg, &user)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"token": token, "user": gin.H{"id": user.ID, "username": user.Username}})
+		refreshToken, err := security.CreateRefreshToken(cfg, &user)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"token":         token,
+			"refresh_token": refreshToken,
+			"expires_in":    cfg.App.AccessTokenMinutes * 60,
+			"user":          gin.H{"id": user.ID, "username": user.Username, "role": user.Role},
+		})
+	}
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh exchanges a valid, unrevoked refresh token for a new access token.
+func Refresh(cfg *config.Config, engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RefreshRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		claims, jti, _, err := security.ParseTokenOfType(cfg, req.RefreshToken, security.TokenTypeRefresh)
+		if err != nil {
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid refresh token")
+			return
+		}
+		revoked, err := repository.NewRevokedTokenRepository(engine).IsRevoked(jti)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if revoked {
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "refresh token has been revoked")
+			return
+		}
+
+		// The user may have been removed since the refresh token was issued
+		idFloat, _ := (*claims)["sub"].(float64)
+		var user models.User
+		has, err := engine.ID(int64(idFloat)).Get(&user)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if !has {
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid refresh token")
+			return
+		}
+
+		token, err := security.CreateToken(cfg, &user)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"token": token, "expires_in": cfg.App.AccessTokenMinutes * 60})
+	}
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Logout revokes the access token of the current request and, if provided,
+// the refresh token issued with it.
+func Logout(cfg *config.Config, engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LogoutRequest
+		// Body is optional; an empty body only revokes the access token
+		_ = c.ShouldBindJSON(&req)
+
+		repo := repository.NewRevokedTokenRepository(engine)
+
+		claims, _ := c.Get("claims")
+		userClaims, ok := claims.(*jwt.MapClaims)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid claims")
+			return
+		}
+		jti, _ := (*userClaims)["jti"].(string)
+		exp, err := userClaims.GetExpirationTime()
+		if jti == "" || err != nil || exp == nil {
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid claims")
+			return
+		}
+		if err := repo.Revoke(jti, exp.Time); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		if req.RefreshToken != "" {
+			if _, refreshJTI, refreshExp, err := security.ParseTokenOfType(cfg, req.RefreshToken, security.TokenTypeRefresh); err == nil {
+				if err := repo.Revoke(refreshJTI, refreshExp); err != nil {
+					respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+					return
+				}
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+	}
+}
+
+// RotateJWTSecret replaces the JWT signing secret with a new random one and
+// stores it so it survives restarts. Every issued access and refresh token,
+// including the caller's, stops validating, so all users must log in again.
+// The new secret is returned only in this response.
+func RotateJWTSecret(cfg *config.Config, engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret, err := security.RandomKey(32)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if err := repository.NewSettingRepository(engine).Set(models.SettingJWTSecret, secret); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		// Audit before the switch; the entry needs nothing from the old token
+		recordAudit(c, engine, models.AuditJWTRotate, "", 0, "")
+		cfg.SetJWTSecret(secret)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":    "JWT secret rotated; all users must log in again",
+			"jwt_secret": secret,
+		})
 	}
 }
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/internal/models"
+	"backend/internal/repository"
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// BlocklistRequest is the body of POST/PUT /api/blocklist.
+type BlocklistRequest struct {
+	DeviceID  int64  `json:"device_id"`                     // 0 = all devices
+	MatchType string `json:"match_type" binding:"required"` // exact, prefix, regex
+	Pattern   string `json:"pattern" binding:"required"`
+	Action    string `json:"action" binding:"required"` // hide, delete
+	Enabled   *bool  `json:"enabled"`                   // default true
+}
+
+// apply copies the request onto an entry and validates it, returning a
+// client-facing error message if the entry is invalid.
+func (req *BlocklistRequest) apply(engine *xorm.Engine, entry *models.Blocklist) (string, error) {
+	entry.DeviceID = req.DeviceID
+	entry.MatchType = strings.TrimSpace(req.MatchType)
+	entry.Pattern = strings.TrimSpace(req.Pattern)
+	entry.Action = strings.TrimSpace(req.Action)
+	entry.Enabled = req.Enabled == nil || *req.Enabled
+
+	if err := services.ValidateBlocklist(entry); err != nil {
+		return err.Error(), nil
+	}
+	if entry.DeviceID != 0 {
+		exists, err := engine.ID(entry.DeviceID).Exist(&models.Device{})
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return "device not found", nil
+		}
+	}
+	return "", nil
+}
+
+// ListBlocklist returns all blocklist entries.
+func ListBlocklist(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entries, err := repository.NewBlocklistRepository(engine).FindAll()
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"items": entries})
+	}
+}
+
+// CreateBlocklist adds a blocklist entry. It applies to messages synced from
+// now on; already stored messages are left alone.
+func CreateBlocklist(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req BlocklistRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		var entry models.Blocklist
+		msg, err := req.apply(engine, &entry)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if msg != "" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, msg)
+			return
+		}
+
+		if err := repository.NewBlocklistRepository(engine).Insert(&entry); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusCreated, entry)
+	}
+}
+
+// UpdateBlocklist replaces a blocklist entry.
+func UpdateBlocklist(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid blocklist id")
+			return
+		}
+		var req BlocklistRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		repo := repository.NewBlocklistRepository(engine)
+		entry, err := repo.FindByID(id)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if entry == nil {
+			respondError(c, http.StatusNotFound, codeBlocklistNotFound, "blocklist entry not found")
+			return
+		}
+
+		msg, err := req.apply(engine, entry)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if msg != "" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, msg)
+			return
+		}
+
+		if err := repo.Update(entry); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, entry)
+	}
+}
+
+// DeleteBlocklist removes a blocklist entry. Messages it already hid stay
+// hidden until unblocked.
+func DeleteBlocklist(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid blocklist id")
+			return
+		}
+
+		repo := repository.NewBlocklistRepository(engine)
+		entry, err := repo.FindByID(id)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if entry == nil {
+			respondError(c, http.StatusNotFound, codeBlocklistNotFound, "blocklist entry not found")
+			return
+		}
+
+		if err := repo.Delete(id); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Blocklist entry deleted successfully"})
+	}
+}
+
+// ListBlockedSms returns SMS hidden by the blocklist, newest first.
+// Query params: device_id (optional), page_num, page_size
+func ListBlockedSms(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID, _ := strconv.ParseInt(c.Query("device_id"), 10, 64)
+		page := parsePage(c)
+
+		items, total, err := repository.NewSmsRepository(engine).FindBlocked(deviceID, page.Num, page.Size)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, page.body(items, total))
+	}
+}
+
+// UnblockSms returns a hidden SMS to the normal lists.
+func UnblockSms(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid SMS id")
+			return
+		}
+
+		unblocked, err := repository.NewSmsRepository(engine).Unblock(id)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if !unblocked {
+			respondError(c, http.StatusNotFound, codeSmsNotFound, "blocked SMS not found")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "SMS unblocked successfully"})
+	}
+}
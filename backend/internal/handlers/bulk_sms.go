@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+	"backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// maxBulkRecipients caps how many messages one bulk request may send
+const maxBulkRecipients = 200
+
+// bulkSendWorkers limits concurrent sends to the phone during a bulk request
+const bulkSendWorkers = 3
+
+// BulkSmsMessage is one recipient of a bulk send.
+type BulkSmsMessage struct {
+	Number string `json:"number"`
+	Body   string `json:"body"`
+}
+
+// BulkSmsRequest is the body of POST /api/devices/:id/sms/bulk.
+// Either give per-recipient messages, or numbers and/or a contact group plus
+// one shared body.
+type BulkSmsRequest struct {
+	SimSlot  int              `json:"sim_slot" binding:"required"` // 1=SIM1, 2=SIM2
+	Messages []BulkSmsMessage `json:"messages"`
+	Numbers  []string         `json:"numbers"`
+	GroupID  int64            `json:"group_id"` // Contact group of this device; adds each member's number
+	Body     string           `json:"body"`     // Shared body for numbers and group members
+}
+
+// BulkSmsResult reports the outcome for one recipient.
+type BulkSmsResult struct {
+	Number  string `json:"number"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	Code    string `json:"code,omitempty"` // Phone error code, as in single-send errors
+}
+
+// SendBulkSMS sends a message to each recipient individually and reports
+// per-recipient success, so one failing number doesn't hide the others.
+// The request is refused as a whole if the recipients don't fit in the
+// device's send quota.
+func SendBulkSMS(cfg *config.Config, engine *xorm.Engine, quota *SendQuota) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		device, err := getDevice(engine, c.Param("id"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		var req BulkSmsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		messages := req.Messages
+		for _, number := range req.Numbers {
+			messages = append(messages, BulkSmsMessage{Number: number, Body: req.Body})
+		}
+		if req.GroupID != 0 {
+			groups := repository.NewContactGroupRepository(engine)
+			group, err := groups.FindByDeviceAndID(device.ID, req.GroupID)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+				return
+			}
+			if group == nil {
+				respondError(c, http.StatusNotFound, codeGroupNotFound, "contact group not found")
+				return
+			}
+			members, err := groups.FindMembers(group.ID)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+				return
+			}
+			// Members whose number is already a recipient get one message only
+			seen := make(map[string]bool, len(messages))
+			for _, msg := range messages {
+				seen[strings.TrimSpace(msg.Number)] = true
+			}
+			for _, member := range members {
+				if !seen[member.Phone] {
+					seen[member.Phone] = true
+					messages = append(messages, BulkSmsMessage{Number: member.Phone, Body: req.Body})
+				}
+			}
+		}
+		if len(messages) == 0 {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "messages, numbers or a non-empty group_id is required")
+			return
+		}
+		if len(messages) > maxBulkRecipients {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "too many recipients (max 200)")
+			return
+		}
+		for i := range messages {
+			messages[i].Number = strings.TrimSpace(messages[i].Number)
+			if messages[i].Number == "" || messages[i].Body == "" {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, "every recipient needs a number and a body")
+				return
+			}
+			if tooLong := oversizedSmsBody(cfg, messages[i].Body, gin.H{"number": messages[i].Number}); tooLong != nil {
+				c.JSON(http.StatusBadRequest, tooLong)
+				return
+			}
+		}
+
+		if rejectDisabledFeature(c, engine, device, models.CapabilitySmsSend) {
+			return
+		}
+		if !takeSendQuota(c, quota, device, len(messages)) {
+			return
+		}
+
+		client := phoneclient.NewClient(device)
+		sentAt := time.Now()
+		results := make([]BulkSmsResult, len(messages))
+		sem := make(chan struct{}, bulkSendWorkers)
+		var wg sync.WaitGroup
+		for i, msg := range messages {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, msg BulkSmsMessage) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				result := BulkSmsResult{Number: msg.Number, Success: true}
+				err := client.SendSms(c.Request.Context(), phoneclient.SmsSendRequest{
+					SimSlot:      req.SimSlot,
+					PhoneNumbers: msg.Number,
+					MsgContent:   msg.Body,
+				})
+				if err != nil {
+					result.Success = false
+					result.Error = err.Error()
+					_, result.Code = classifyPhoneError(err)
+				}
+				results[i] = result
+			}(i, msg)
+		}
+		wg.Wait()
+
+		succeeded := 0
+		var sent, failed []sentSms
+		for i, result := range results {
+			msg := sentSms{Number: messages[i].Number, Body: messages[i].Body}
+			if result.Success {
+				succeeded++
+				sent = append(sent, msg)
+			} else {
+				failed = append(failed, msg)
+			}
+		}
+		if len(sent) > 0 {
+			go recordSentSms(engine, client, device, sent, sentAt)
+		}
+		if len(failed) > 0 {
+			quota.refund(device.ID, len(failed))
+			recordFailedSms(engine, device, req.SimSlot, failed)
+		}
+		recordAudit(c, engine, models.AuditSmsBulkSend, "device", device.ID,
+			fmt.Sprintf("%d of %d recipients via SIM%d", succeeded, len(results), req.SimSlot))
+
+		c.JSON(http.StatusOK, gin.H{
+			"results": results,
+			"success": succeeded,
+			"failed":  len(results) - succeeded,
+		})
+	}
+}
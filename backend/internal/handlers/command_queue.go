@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"backend/config"
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+	"backend/internal/repository"
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// EnqueueCommandRequest is the body of POST /api/devices/:id/commands.
+type EnqueueCommandRequest struct {
+	Type    string          `json:"type" binding:"required"`
+	Payload json.RawMessage `json:"payload" binding:"required"`
+}
+
+// EnqueueCommand queues a command for asynchronous execution on the phone.
+// Supported types: send_sms, wol, add_contact. The payload uses the same
+// fields as the corresponding direct endpoint. send_sms is held to the same
+// rules as POST /devices/:id/sms/send, see admitQueuedSms.
+func EnqueueCommand(cfg *config.Config, engine *xorm.Engine, quota *SendQuota) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.Param("id")
+		device, err := getDevice(engine, deviceID)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		var req EnqueueCommandRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		// Validate payload up front so bad commands never reach the queue
+		payload, err := services.DecodeCommandPayload(req.Type, string(req.Payload))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		counted, ok := admitQueuedSms(c, cfg, engine, quota, device, payload)
+		if !ok {
+			return
+		}
+
+		cmd := models.Command{
+			DeviceID: device.ID,
+			Type:     req.Type,
+			Payload:  string(req.Payload),
+			Status:   models.CommandStatusPending,
+		}
+		repo := repository.NewCommandRepository(engine)
+		if err := repo.Insert(&cmd); err != nil {
+			quota.refund(device.ID, counted)
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusAccepted, cmd)
+	}
+}
+
+// ListCommands lists queued commands for a device, optionally filtered by status
+func ListCommands(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.Param("id")
+		device, err := getDevice(engine, deviceID)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		// Parse query parameters
+		status := c.Query("status")
+		page := parsePage(c)
+
+		switch status {
+		case "", models.CommandStatusPending, models.CommandStatusSent,
+			models.CommandStatusDone, models.CommandStatusFailed:
+		default:
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "status must be one of: pending, sent, done, failed")
+			return
+		}
+
+		repo := repository.NewCommandRepository(engine)
+		items, total, err := repo.FindByDevice(device.ID, status, page.Num, page.Size)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, page.body(items, total))
+	}
+}
+
+// GetCommand returns a single command, so callers can poll its status and result.
+// SMS sent through POST /devices/:id/sms/send are tracked the same way: sent
+// means the phone accepted it, done that it was also saved to the database,
+// failed that the phone rejected it.
+func GetCommand(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid command id")
+			return
+		}
+
+		cmd, err := repository.NewCommandRepository(engine).FindByID(id)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if cmd == nil {
+			respondError(c, http.StatusNotFound, codeCommandNotFound, "command not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, cmd)
+	}
+}
+
+// admitQueuedSms holds a send_sms command to the rules of a direct send: the
+// body must fit app.sms_max_segments, the phone must allow sending, and each
+// recipient counts against the device's send quota when queued (a later
+// failure isn't refunded). Other payloads pass. Returns how many sends were
+// counted, or false once it has responded with the error.
+func admitQueuedSms(c *gin.Context, cfg *config.Config, engine *xorm.Engine, quota *SendQuota, device *models.Device, payload interface{}) (int, bool) {
+	req, ok := payload.(*phoneclient.SmsSendRequest)
+	if !ok {
+		return 0, true
+	}
+	if tooLong := oversizedSmsBody(cfg, req.MsgContent); tooLong != nil {
+		c.JSON(http.StatusBadRequest, tooLong)
+		return 0, false
+	}
+	if rejectDisabledFeature(c, engine, device, models.CapabilitySmsSend) {
+		return 0, false
+	}
+	n := len(services.SmsRecipients(req.PhoneNumbers))
+	if !takeSendQuota(c, quota, device, n) {
+		return 0, false
+	}
+	return n, true
+}
+
+// RetryCommand puts a failed command back into the queue. A send_sms command
+// is checked again as by EnqueueCommand.
+func RetryCommand(cfg *config.Config, engine *xorm.Engine, quota *SendQuota) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid command id")
+			return
+		}
+
+		repo := repository.NewCommandRepository(engine)
+		cmd, err := repo.FindByID(id)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if cmd == nil {
+			respondError(c, http.StatusNotFound, codeCommandNotFound, "command not found")
+			return
+		}
+
+		if cmd.Status != models.CommandStatusFailed {
+			respondError(c, http.StatusConflict, CodeConflict, "only failed commands can be retried")
+			return
+		}
+		device, err := getDevice(engine, strconv.FormatInt(cmd.DeviceID, 10))
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+		payload, err := services.DecodeCommandPayload(cmd.Type, cmd.Payload)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		counted, ok := admitQueuedSms(c, cfg, engine, quota, device, payload)
+		if !ok {
+			return
+		}
+
+		retried, err := repo.Retry(id)
+		if err != nil {
+			quota.refund(device.ID, counted)
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if !retried {
+			quota.refund(device.ID, counted)
+			respondError(c, http.StatusConflict, CodeConflict, "only failed commands can be retried")
+			return
+		}
+
+		cmd.Status = models.CommandStatusPending
+		cmd.Result = ""
+		c.JSON(http.StatusOK, cmd)
+	}
+}
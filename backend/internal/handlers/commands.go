@@ -1,21 +1,44 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"backend/config"
 	"backend/internal/models"
 	"backend/internal/phoneclient"
 	"backend/internal/repository"
 	"backend/internal/services"
+	"backend/internal/smsutil"
 
 	"github.com/gin-gonic/gin"
 	"xorm.io/xorm"
 )
 
+// oversizedSmsBody returns a 400 body if msg would take more segments than
+// app.sms_max_segments allows, or nil if it may be sent. details are added to
+// the error as in ErrorBody.
+func oversizedSmsBody(cfg *config.Config, msg string, details ...gin.H) gin.H {
+	limit := cfg.App.SmsMaxSegments
+	seg := smsutil.Estimate(msg)
+	if limit <= 0 || seg.Count <= limit {
+		return nil
+	}
+	size := gin.H{
+		"segments":     seg.Count,
+		"max_segments": limit,
+		"encoding":     seg.Encoding,
+		"units":        seg.Units,
+	}
+	return ErrorBody(codeSmsTooLong, fmt.Sprintf("message too long: %d segments, at most %d allowed", seg.Count, limit),
+		append([]gin.H{size}, details...)...)
+}
+
 // getDevice fetches a device by ID from the database
 func getDevice(engine *xorm.Engine, idStr string) (*models.Device, error) {
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -34,151 +57,358 @@ func getDevice(engine *xorm.Engine, idStr string) (*models.Device, error) {
 	return &device, nil
 }
 
-// SendSMS sends SMS via phone's SmsForwarder API
-func SendSMS(engine *xorm.Engine) gin.HandlerFunc {
-	type sendRequest struct {
-		SimSlot      int    `json:"sim_slot" binding:"required"` // 1=SIM1, 2=SIM2
-		PhoneNumbers string `json:"phone_numbers" binding:"required"`
-		MsgContent   string `json:"msg_content" binding:"required"`
-	}
+// SendSmsRequest is the body of POST /api/devices/:id/sms/send.
+type SendSmsRequest struct {
+	SimSlot      *int   `json:"sim_slot" binding:"required"` // 1=SIM1, 2=SIM2, 0=auto
+	PhoneNumbers string `json:"phone_numbers" binding:"required"`
+	MsgContent   string `json:"msg_content" binding:"required"`
+}
 
+// SendSMS sends SMS via phone's SmsForwarder API, each recipient counting
+// against the device's send quota
+func SendSMS(cfg *config.Config, engine *xorm.Engine, quota *SendQuota) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
-		var req sendRequest
+		var req SendSmsRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		if tooLong := oversizedSmsBody(cfg, req.MsgContent); tooLong != nil {
+			c.JSON(http.StatusBadRequest, tooLong)
+			return
+		}
+		if rejectDisabledFeature(c, engine, device, models.CapabilitySmsSend) {
 			return
 		}
 
-		// Call phone API directly
-		client := phoneclient.NewClient(device)
-		err = client.SendSms(phoneclient.SmsSendRequest{
-			SimSlot:      req.SimSlot,
+		var sent []sentSms
+		var numbers []string
+		for _, phoneNum := range strings.Split(req.PhoneNumbers, ";") {
+			if number := strings.TrimSpace(phoneNum); number != "" {
+				sent = append(sent, sentSms{Number: number, Body: req.MsgContent})
+				numbers = append(numbers, number)
+			}
+		}
+
+		simSlot, simAuto := *req.SimSlot, ""
+		switch simSlot {
+		case 1, 2:
+		case 0:
+			simSlot, simAuto, err = autoSimSlot(repository.NewSmsRepository(engine), device, numbers)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+				return
+			}
+			if simSlot == 0 {
+				respondError(c, http.StatusBadRequest, codeSimSelectionRequired, "could not choose a SIM card automatically, please set sim_slot to 1 or 2")
+				return
+			}
+		default:
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "sim_slot must be 0 (auto), 1 or 2")
+			return
+		}
+
+		if !takeSendQuota(c, quota, device, len(sent)) {
+			return
+		}
+
+		smsReq := phoneclient.SmsSendRequest{
+			SimSlot:      simSlot,
 			PhoneNumbers: req.PhoneNumbers,
 			MsgContent:   req.MsgContent,
-		})
+		}
+
+		// Track the send as a command so its outcome can be polled
+		cmdRepo := repository.NewCommandRepository(engine)
+		payload, _ := json.Marshal(smsReq)
+		cmd := models.Command{
+			DeviceID: device.ID,
+			Type:     models.CommandTypeSendSms,
+			Payload:  string(payload),
+			Status:   models.CommandStatusSent,
+		}
+		if err := cmdRepo.Insert(&cmd); err != nil {
+			quota.refund(device.ID, len(sent))
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		// Call phone API directly
+		client := phoneclient.NewClient(device)
+		sentAt := time.Now()
+		err = client.SendSms(c.Request.Context(), smsReq)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			if err := cmdRepo.Complete(cmd.ID, models.CommandStatusFailed, err.Error()); err != nil {
+				log.Printf("[SendSMS] failed to record command %d: %v", cmd.ID, err)
+			}
+			quota.refund(device.ID, len(sent))
+			recordFailedSms(engine, device, simSlot, sent)
+			respondPhoneError(c, err)
 			return
 		}
 
 		// After successful send, sync the sent message to avoid duplicate sync later
-		// Query recent sent messages (type=2) from phone
-		go func() {
-			// Use goroutine to avoid blocking the response
-			time.Sleep(1 * time.Second) // Wait 1 second for phone to save the message
-
-			items, err := client.QuerySms(phoneclient.SmsQueryRequest{
-				Type:     2, // Sent messages
-				PageNum:  1,
-				PageSize: 20, // Get recent 20 sent messages
-			})
+		go func() { // Use goroutine to avoid blocking the response
+			saved, err := recordSentSms(engine, client, device, sent, sentAt)
+			status, result := models.CommandStatusDone, "SMS sent and saved"
 			if err != nil {
-				log.Printf("[SendSMS] failed to query sent messages after send: %v", err)
-				return
+				status, result = models.CommandStatusSent, "SMS sent, but saving it failed: "+err.Error()
+			} else if saved < len(sent) {
+				status, result = models.CommandStatusSent, "SMS sent, but not found in the phone's sent messages yet; the next sync saves it"
 			}
-
-			// Find matching message(s) by content and address
-			// Split phone numbers in case multiple were sent
-			phoneNumbers := strings.Split(req.PhoneNumbers, ";")
-			repo := repository.NewSmsRepository(engine)
-			contactRepo := repository.NewContactRepository(engine)
-
-			for _, phoneNum := range phoneNumbers {
-				phoneNum = strings.TrimSpace(phoneNum)
-				if phoneNum == "" {
-					continue
-				}
-
-				// Find the matching sent message
-				for _, item := range items {
-					if item.Number == phoneNum && item.Content == req.MsgContent && item.Type == 2 {
-						// Check if already exists
-						exists, err := repo.ExistsIncludingDeleted(device.ID, item.Number, item.Date, item.Type)
-						if err != nil {
-							log.Printf("[SendSMS] check exists error: %v", err)
-							continue
-						}
-
-						if !exists {
-							// Ensure hidden contact exists
-							_, err := contactRepo.EnsureHiddenContact(device.ID, item.Number, item.Name)
-							if err != nil {
-								log.Printf("[SendSMS] ensure hidden contact error: %v", err)
-							}
-
-							// Save to database with is_read=true (since user just sent it)
-							sms := &models.SmsMessage{
-								DeviceID: device.ID,
-								Address:  item.Number,
-								Name:     item.Name,
-								Body:     item.Content,
-								Type:     item.Type,
-								SimID:    item.SimID,
-								SmsTime:  item.Date,
-								IsRead:   true, // Mark as read since user sent it
-							}
-
-							err = repo.Insert(sms)
-							if err != nil {
-								log.Printf("[SendSMS] failed to insert sent message: %v", err)
-							} else {
-								log.Printf("[SendSMS] saved sent message to database: %s -> %s", device.Name, phoneNum)
-							}
-						}
-						break // Found the matching message
-					}
-				}
+			if err := cmdRepo.Complete(cmd.ID, status, result); err != nil {
+				log.Printf("[SendSMS] failed to record command %d: %v", cmd.ID, err)
 			}
 		}()
+		recordAudit(c, engine, models.AuditSmsSend, "device", device.ID, fmt.Sprintf("to %s via SIM%d", req.PhoneNumbers, simSlot))
 
-		c.JSON(http.StatusOK, gin.H{"message": "SMS sent successfully"})
+		resp := gin.H{"message": "SMS sent successfully", "command_id": cmd.ID, "sim_slot": simSlot}
+		if simAuto != "" {
+			resp["sim_auto"] = simAuto
+		}
+		c.JSON(http.StatusOK, resp)
 	}
 }
 
-// AddContact adds a contact via phone's SmsForwarder API
-func AddContact(engine *xorm.Engine) gin.HandlerFunc {
-	type addRequest struct {
-		Name        string `json:"name" binding:"required"`
-		PhoneNumber string `json:"phone_number" binding:"required"` // Semicolon-separated phone numbers
+// ResendSms sends a stored sent or failed SMS again to the same address,
+// through the SIM it was originally sent from (SIM1 if unknown). It counts
+// against the device's send quota like SendSMS.
+func ResendSms(engine *xorm.Engine, quota *SendQuota) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid SMS id")
+			return
+		}
+
+		sms, err := repository.NewSmsRepository(engine).FindByID(id)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if sms == nil {
+			respondError(c, http.StatusNotFound, codeSmsNotFound, "SMS not found")
+			return
+		}
+		if sms.Type == 1 {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "received SMS cannot be resent")
+			return
+		}
+
+		device, err := getDevice(engine, strconv.FormatInt(sms.DeviceID, 10))
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		simSlot := 1
+		if sms.SimID == 1 {
+			simSlot = 2
+		}
+		if rejectDisabledFeature(c, engine, device, models.CapabilitySmsSend) {
+			return
+		}
+		if !takeSendQuota(c, quota, device, 1) {
+			return
+		}
+
+		client := phoneclient.NewClient(device)
+		sentAt := time.Now()
+		err = client.SendSms(c.Request.Context(), phoneclient.SmsSendRequest{
+			SimSlot:      simSlot,
+			PhoneNumbers: sms.Address,
+			MsgContent:   sms.Body,
+		})
+		if err != nil {
+			quota.refund(device.ID, 1)
+			// A failed message that fails again is already on record
+			if sms.DeliveryStatus != models.DeliveryStatusFailed {
+				recordFailedSms(engine, device, simSlot, []sentSms{{Number: sms.Address, Body: sms.Body}})
+			}
+			respondPhoneError(c, err)
+			return
+		}
+
+		go recordSentSms(engine, client, device, []sentSms{{Number: sms.Address, Body: sms.Body}}, sentAt)
+		recordAudit(c, engine, models.AuditSmsSend, "sms", sms.ID, fmt.Sprintf("resend to %s via SIM%d", sms.Address, simSlot))
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":   "SMS sent successfully",
+			"device_id": device.ID,
+			"address":   sms.Address,
+			"sim_slot":  simSlot,
+		})
+	}
+}
+
+// sentSms is a message just sent through the phone, used to match it in the phone's sent box.
+type sentSms = services.OutgoingSms
+
+// sentSmsPollInterval is how often recordSentSms checks the phone's sent box.
+const sentSmsPollInterval = 500 * time.Millisecond
+
+// sentSmsPollTimeout bounds how long recordSentSms waits for sent messages to appear.
+const sentSmsPollTimeout = 5 * time.Second
+
+// sentSmsClockSkew is how far the phone's clock may lag the server's when
+// matching sent messages by their phone-side date.
+const sentSmsClockSkew = time.Minute
+
+// recordSentSms stores just-sent messages so a later sync doesn't report them as new.
+// The phone may take a moment to save a message, so it polls the phone's recent
+// sent messages every sentSmsPollInterval, saving each match as read, until all
+// are found or sentSmsPollTimeout passes. Only messages dated from sentAt (less
+// sentSmsClockSkew) match, so an earlier identical message isn't taken for them.
+// Returns how many of sent are now in the database.
+func recordSentSms(engine *xorm.Engine, client *phoneclient.Client, device *models.Device, sent []sentSms, sentAt time.Time) (int, error) {
+	pageSize := 20 // Get recent 20 sent messages
+	if len(sent) > pageSize {
+		pageSize = len(sent)
 	}
 
+	saved := 0
+	pending := sent
+	var lastErr error
+	deadline := time.Now().Add(sentSmsPollTimeout)
+	for len(pending) > 0 && time.Now().Before(deadline) {
+		time.Sleep(sentSmsPollInterval)
+
+		items, err := client.QuerySms(services.DeviceContext(device.ID), phoneclient.SmsQueryRequest{
+			Type:     2, // Sent messages
+			PageNum:  1,
+			PageSize: pageSize,
+		})
+		if err != nil {
+			log.Printf("[SendSMS] failed to query sent messages after send: %v", err)
+			lastErr = err
+			continue
+		}
+		lastErr = nil
+
+		var missing []sentSms
+		for _, msg := range pending {
+			if saveSentSms(engine, device, msg, items, sentAt.Add(-sentSmsClockSkew).UnixMilli()) {
+				saved++
+			} else {
+				missing = append(missing, msg)
+			}
+		}
+		pending = missing
+	}
+	if len(pending) > 0 {
+		log.Printf("[SendSMS] %d sent message(s) on %s not found in the phone's sent box after %s", len(pending), device.Name, sentSmsPollTimeout)
+	}
+	return saved, lastErr
+}
+
+// saveSentSms finds msg among the phone's sent items dated since (Unix ms) and
+// saves it as read if it isn't stored yet. Returns true once msg is in the
+// database.
+func saveSentSms(engine *xorm.Engine, device *models.Device, msg sentSms, items []phoneclient.SmsItem, since int64) bool {
+	repo := repository.NewSmsRepository(engine)
+	stored := false
+	for _, item := range items {
+		if item.Number != msg.Number || item.Content != msg.Body || item.Type != 2 || item.Date < since {
+			continue
+		}
+
+		// Already saved, e.g. by a sync; keep looking in case a newer copy isn't
+		exists, err := repo.ExistsIncludingDeleted(device.ID, item.Number, item.Date, item.Type)
+		if err != nil {
+			log.Printf("[SendSMS] check exists error: %v", err)
+			return false
+		}
+		if exists {
+			stored = true
+			continue
+		}
+
+		// Ensure hidden contact exists
+		if _, err := repository.NewContactRepository(engine).EnsureHiddenContact(device.ID, item.Number, item.Name); err != nil {
+			log.Printf("[SendSMS] ensure hidden contact error: %v", err)
+		}
+
+		// Save to database with is_read=true (since user just sent it)
+		sms := &models.SmsMessage{
+			DeviceID: device.ID,
+			Address:  item.Number,
+			Name:     item.Name,
+			Body:     item.Content,
+			Type:     item.Type,
+			SimID:    item.SimID,
+			SmsTime:  item.Date,
+			IsRead:   true, // Mark as read since user sent it
+			// Empty (no report yet) is stored as sent
+			DeliveryStatus: item.DeliveryStatus(),
+		}
+		if err := repo.Insert(sms); err != nil {
+			log.Printf("[SendSMS] failed to insert sent message: %v", err)
+			return false
+		}
+		log.Printf("[SendSMS] saved sent message to database: %s -> %s", device.Name, msg.Number)
+		return true
+	}
+	return stored
+}
+
+// recordFailedSms records messages the phone refused to send; see
+// services.RecordFailedSms.
+func recordFailedSms(engine *xorm.Engine, device *models.Device, simSlot int, failed []sentSms) {
+	services.RecordFailedSms(engine, device, simSlot, failed)
+}
+
+// AddContactRequest is the body of POST /api/devices/:id/contacts/add.
+type AddContactRequest struct {
+	Name        string `json:"name" binding:"required"`
+	PhoneNumber string `json:"phone_number" binding:"required"` // Semicolon-separated phone numbers
+}
+
+// AddContact adds a contact via phone's SmsForwarder API
+func AddContact(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
-		var req addRequest
+		var req AddContactRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		if rejectDisabledFeature(c, engine, device, models.CapabilityContactAdd) {
 			return
 		}
 
 		// Call phone API directly
 		client := phoneclient.NewClient(device)
-		err = client.AddContact(phoneclient.ContactAddRequest{
+		err = client.AddContact(c.Request.Context(), phoneclient.ContactAddRequest{
 			Name:        req.Name,
 			PhoneNumber: req.PhoneNumber,
 		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondPhoneError(c, err)
 			return
 		}
 
@@ -186,44 +416,49 @@ func AddContact(engine *xorm.Engine) gin.HandlerFunc {
 	}
 }
 
+// WolRequest is the body of POST /api/devices/:id/wol.
+type WolRequest struct {
+	Mac  string `json:"mac" binding:"required"`
+	IP   string `json:"ip,omitempty"`
+	Port int    `json:"port,omitempty"`
+}
+
 // WakeOnLan sends WOL packet via phone's SmsForwarder API
 func WakeOnLan(engine *xorm.Engine) gin.HandlerFunc {
-	type wolRequest struct {
-		Mac  string `json:"mac" binding:"required"`
-		IP   string `json:"ip,omitempty"`
-		Port int    `json:"port,omitempty"`
-	}
-
 	return func(c *gin.Context) {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
-		var req wolRequest
+		var req WolRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		if rejectDisabledFeature(c, engine, device, models.CapabilityWol) {
 			return
 		}
 
 		// Call phone API directly
 		client := phoneclient.NewClient(device)
-		err = client.SendWol(phoneclient.WolRequest{
+		err = client.SendWol(c.Request.Context(), phoneclient.WolRequest{
 			Mac:  req.Mac,
 			IP:   req.IP,
 			Port: req.Port,
 		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondPhoneError(c, err)
 			return
 		}
 
+		recordAudit(c, engine, models.AuditWol, "device", device.ID, "mac "+req.Mac)
 		c.JSON(http.StatusOK, gin.H{"message": "WOL packet sent successfully"})
 	}
 }
@@ -234,19 +469,19 @@ func QueryBattery(engine *xorm.Engine) gin.HandlerFunc {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
 		// Call phone API directly
 		client := phoneclient.NewClient(device)
-		battery, err := client.QueryBattery()
+		battery, err := client.QueryBattery(c.Request.Context())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondPhoneError(c, err)
 			return
 		}
 
@@ -255,50 +490,64 @@ func QueryBattery(engine *xorm.Engine) gin.HandlerFunc {
 }
 
 // QuerySms queries SMS messages from local database with background sync
+// Optional from/to (unix millis or RFC3339, inclusive) restrict the record time
+// and sim_id (0, 1 or -1=unknown) the SIM slot;
+// sort=asc|desc (default desc) and sort_by pick the order.
+// mark_read=true marks the returned page as read and adds unread_count;
+// include_archived=true also returns messages of archived conversations;
+// unread_only=true limits the list (and total) to unread messages.
 func QuerySms(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
 		// Parse query parameters
 		smsType, _ := strconv.Atoi(c.DefaultQuery("type", "0"))
-		pageNum, _ := strconv.Atoi(c.DefaultQuery("page_num", "1"))
-		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		page := parsePage(c)
 		keyword := c.Query("keyword")
 		forceSync := c.Query("sync") == "true"
+		opts, err := parseListOptions(c, repository.SmsSortColumns)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		opts.IncludeArchived = c.Query("include_archived") == "true"
 
 		// Trigger sync
 		syncService := services.NewSyncService(engine)
 		var syncResult *services.SyncResult
 		if forceSync {
 			// Blocking sync
-			syncResult, _ = syncService.SyncSms(device, smsType)
+			syncResult, _ = syncService.SyncSms(c.Request.Context(), device, smsType, services.SyncOptions{Force: true})
 		} else {
-			// Background sync
-			go syncService.SyncSms(device, smsType)
+			// Background sync, detached from the request but canceled if the device is deleted
+			go syncService.SyncSms(services.DeviceContext(device.ID), device, smsType, services.SyncOptions{})
 		}
 
 		// Query from database
 		repo := repository.NewSmsRepository(engine)
-		items, total, err := repo.FindByDevice(device.ID, smsType, pageNum, pageSize, keyword)
+		items, total, err := repo.FindByDevice(device.ID, smsType, page.Num, page.Size, keyword, opts)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
-		response := gin.H{
-			"items": items,
-			"total": total,
-			"page":  pageNum,
-			"size":  pageSize,
+		response := page.body(items, total)
+		if c.Query("mark_read") == "true" {
+			unread, err := markPageRead(repo, device.ID, items)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+				return
+			}
+			response["unread_count"] = unread
 		}
 		if syncResult != nil {
 			response["sync"] = syncResult
@@ -308,52 +557,70 @@ func QuerySms(engine *xorm.Engine) gin.HandlerFunc {
 	}
 }
 
+// markPageRead marks the unread messages among items as read in one UPDATE,
+// updates items to match, and returns the device's remaining unread count.
+func markPageRead(repo *repository.SmsRepository, deviceID int64, items []repository.SmsWithContactName) (int64, error) {
+	var ids []int64
+	for i := range items {
+		if !items[i].IsRead {
+			ids = append(ids, items[i].ID)
+			items[i].IsRead = true
+		}
+	}
+	if err := repo.MarkMultipleAsRead(ids); err != nil {
+		return 0, err
+	}
+	return repo.CountUnread(0, deviceID, nil)
+}
+
 // QueryCalls queries call logs from local database with background sync
+// Optional from/to (unix millis or RFC3339, inclusive) restrict the record time
+// and sim_id (0, 1 or -1=unknown) the SIM slot;
+// sort=asc|desc (default desc) and sort_by pick the order.
 func QueryCalls(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
 		// Parse query parameters
 		callType, _ := strconv.Atoi(c.DefaultQuery("type", "0"))
-		pageNum, _ := strconv.Atoi(c.DefaultQuery("page_num", "1"))
-		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		page := parsePage(c)
 		phoneNumber := c.Query("phone_number")
 		forceSync := c.Query("sync") == "true"
+		opts, err := parseListOptions(c, repository.CallSortColumns)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
 
 		// Trigger sync
 		syncService := services.NewSyncService(engine)
 		var syncResult *services.SyncResult
 		if forceSync {
 			// Blocking sync
-			syncResult, _ = syncService.SyncCalls(device, callType)
+			syncResult, _ = syncService.SyncCalls(c.Request.Context(), device, callType, services.SyncOptions{})
 		} else {
-			// Background sync
-			go syncService.SyncCalls(device, callType)
+			// Background sync, detached from the request but canceled if the device is deleted
+			go syncService.SyncCalls(services.DeviceContext(device.ID), device, callType, services.SyncOptions{})
 		}
 
 		// Query from database
 		repo := repository.NewCallRepository(engine)
-		items, total, err := repo.FindByDevice(device.ID, callType, pageNum, pageSize, phoneNumber)
+		items, total, err := repo.FindByDevice(device.ID, callType, page.Num, page.Size, phoneNumber, opts)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
-		response := gin.H{
-			"items": items,
-			"total": total,
-			"page":  pageNum,
-			"size":  pageSize,
-		}
+		response := page.body(items, total)
 		if syncResult != nil {
 			response["sync"] = syncResult
 		}
@@ -363,21 +630,23 @@ func QueryCalls(engine *xorm.Engine) gin.HandlerFunc {
 }
 
 // QueryContacts queries contacts from local database with background sync
+// include_hidden=true also returns the hidden contacts auto-created from SMS/Calls.
 func QueryContacts(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
 		// Parse query parameters
 		keyword := c.Query("keyword")
+		includeHidden := c.Query("include_hidden") == "true"
 		forceSync := c.Query("sync") == "true"
 
 		// Trigger sync
@@ -385,17 +654,17 @@ func QueryContacts(engine *xorm.Engine) gin.HandlerFunc {
 		var syncResult *services.SyncResult
 		if forceSync {
 			// Blocking sync
-			syncResult, _ = syncService.SyncContacts(device)
+			syncResult, _ = syncService.SyncContacts(c.Request.Context(), device)
 		} else {
-			// Background sync
-			go syncService.SyncContacts(device)
+			// Background sync, detached from the request but canceled if the device is deleted
+			go syncService.SyncContacts(services.DeviceContext(device.ID), device)
 		}
 
 		// Query from database
 		repo := repository.NewContactRepository(engine)
-		items, total, err := repo.FindByDevice(device.ID, keyword)
+		items, total, err := repo.FindByDevice(device.ID, keyword, includeHidden)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
@@ -417,22 +686,31 @@ func QueryLocation(engine *xorm.Engine) gin.HandlerFunc {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		if rejectDisabledFeature(c, engine, device, models.CapabilityLocation) {
 			return
 		}
 
 		// Call phone API directly
 		client := phoneclient.NewClient(device)
-		location, err := client.QueryLocation()
+		location, err := client.QueryLocation(c.Request.Context())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondPhoneError(c, err)
 			return
 		}
 
+		// Keep the fix in the location history; a storage failure shouldn't hide the fix
+		if _, err := services.NewLocationService(engine).Record(device, location); err != nil {
+			log.Printf("[QueryLocation] device %d: failed to record location: %v", device.ID, err)
+		}
+
 		c.JSON(http.StatusOK, location)
 	}
 }
@@ -444,19 +722,19 @@ func QueryConfig(engine *xorm.Engine) gin.HandlerFunc {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
 		// Call phone API directly
 		client := phoneclient.NewClient(device)
-		config, err := client.QueryConfig()
+		config, err := client.QueryConfig(c.Request.Context())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondPhoneError(c, err)
 			return
 		}
 
@@ -464,11 +742,13 @@ func QueryConfig(engine *xorm.Engine) gin.HandlerFunc {
 		device.DeviceMark = config.ExtraDeviceMark
 		device.ExtraSim1 = config.ExtraSim1
 		device.ExtraSim2 = config.ExtraSim2
+		device.SimInfo = config.SimInfoJSON()
+		device.Capabilities = config.Capabilities()
 		device.Status = "online"
 
 		// Query battery if enabled
 		if config.EnableAPIBatteryQuery {
-			battery, err := client.QueryBattery()
+			battery, err := client.QueryBattery(c.Request.Context())
 			if err == nil {
 				device.BatteryLevel = battery.Level
 				device.BatteryStatus = battery.Status
@@ -478,7 +758,7 @@ func QueryConfig(engine *xorm.Engine) gin.HandlerFunc {
 
 		// Update device with all info including battery
 		engine.ID(device.ID).Cols(
-			"device_mark", "extra_sim1", "extra_sim2", "status", "last_seen",
+			"device_mark", "extra_sim1", "extra_sim2", "sim_info", "capabilities", "status", "last_seen",
 			"battery_level", "battery_status", "battery_plugged",
 		).Update(device)
 
@@ -492,37 +772,43 @@ func parseID(s string) int64 {
 	return id
 }
 
-// ClonePull pulls configuration from phone via SmsForwarder API
-func ClonePull(engine *xorm.Engine) gin.HandlerFunc {
-	type pullRequest struct {
-		VersionCode int `json:"version_code"` // App version code
-	}
+// ClonePullRequest is the body of POST /api/devices/:id/clone/pull.
+type ClonePullRequest struct {
+	VersionCode int `json:"version_code"` // App version code
+}
 
+// ClonePull pulls configuration from phone via SmsForwarder API and records
+// the app version it reports on the device
+func ClonePull(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
-		var req pullRequest
+		var req ClonePullRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 
 		// Call phone API directly
 		client := phoneclient.NewClient(device)
-		config, err := client.ClonePull(req.VersionCode)
+		config, err := client.ClonePull(c.Request.Context(), req.VersionCode)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondPhoneError(c, err)
 			return
 		}
+		if version := config.VersionName(); version != "" && version != device.AppVersion {
+			device.AppVersion = version
+			engine.ID(device.ID).Cols("app_version").Update(device)
+		}
 
 		c.JSON(http.StatusOK, config)
 	}
@@ -534,58 +820,97 @@ func ClonePush(engine *xorm.Engine) gin.HandlerFunc {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
 		// Parse the config from request body
 		var config phoneclient.CloneConfig
 		if err := c.ShouldBindJSON(&config); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 
 		// Call phone API directly
 		client := phoneclient.NewClient(device)
-		err = client.ClonePush(config)
+		err = client.ClonePush(c.Request.Context(), config)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondPhoneError(c, err)
 			return
 		}
 
+		recordAudit(c, engine, models.AuditClonePush, "device", device.ID, "")
 		c.JSON(http.StatusOK, gin.H{"message": "Configuration pushed successfully"})
 	}
 }
 
-// SyncSms manually triggers SMS sync from phone
-func SyncSms(engine *xorm.Engine) gin.HandlerFunc {
-	type syncRequest struct {
-		Type int `json:"type"` // 0=all, 1=received, 2=sent
+// Upper bounds for the per-request sync limits of the manual sync endpoints
+const (
+	maxSyncPageSize = 500
+	maxSyncPages    = 1000
+)
+
+// syncLimits lets a manual sync override the configured page size and page cap.
+type syncLimits struct {
+	PageSize int `json:"page_size"` // 0 = app.sync_page_size
+	MaxPages int `json:"max_pages"` // 0 = app.sync_max_pages
+}
+
+// validate returns an error message if the limits are out of range, or "".
+func (l syncLimits) validate() string {
+	if l.PageSize < 0 || l.PageSize > maxSyncPageSize {
+		return fmt.Sprintf("page_size must be between 0 and %d", maxSyncPageSize)
 	}
+	if l.MaxPages < 0 || l.MaxPages > maxSyncPages {
+		return fmt.Sprintf("max_pages must be between 0 and %d", maxSyncPages)
+	}
+	return ""
+}
 
+// SyncSmsRequest is the body of POST /api/devices/:id/sms/sync.
+type SyncSmsRequest struct {
+	Type  int  `json:"type"`  // 0=all, 1=received, 2=sent
+	Force bool `json:"force"` // Walk pages even if the newest message is already stored
+	Full  bool `json:"full"`  // Walk every page, not just until nothing is new
+	syncLimits
+}
+
+// SyncSms manually triggers SMS sync from phone
+// Optional page_size and max_pages override the configured sync limits, and
+// full=true walks every page up to the cap; follow it with SyncProgress.
+func SyncSms(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
-		var req syncRequest
+		var req SyncSmsRequest
 		c.ShouldBindJSON(&req) // Optional, defaults to 0
+		if msg := req.validate(); msg != "" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, msg)
+			return
+		}
 
 		syncService := services.NewSyncService(engine)
-		result, err := syncService.SyncSms(device, req.Type)
+		result, err := syncService.SyncSms(c.Request.Context(), device, req.Type, services.SyncOptions{
+			Force:    req.Force,
+			Full:     req.Full,
+			PageSize: req.PageSize,
+			MaxPages: req.MaxPages,
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondPhoneError(c, err)
 			return
 		}
 
@@ -593,31 +918,44 @@ func SyncSms(engine *xorm.Engine) gin.HandlerFunc {
 	}
 }
 
+// SyncCallsRequest is the body of POST /api/devices/:id/calls/sync.
+type SyncCallsRequest struct {
+	Type int  `json:"type"` // 0=all, 1=incoming, 2=outgoing, 3=missed
+	Full bool `json:"full"` // Walk every page, not just until nothing is new
+	syncLimits
+}
+
 // SyncCalls manually triggers call log sync from phone
+// Optional page_size and max_pages override the configured sync limits, and
+// full=true walks every page up to the cap; follow it with SyncProgress.
 func SyncCalls(engine *xorm.Engine) gin.HandlerFunc {
-	type syncRequest struct {
-		Type int `json:"type"` // 0=all, 1=incoming, 2=outgoing, 3=missed
-	}
-
 	return func(c *gin.Context) {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
-		var req syncRequest
+		var req SyncCallsRequest
 		c.ShouldBindJSON(&req) // Optional, defaults to 0
+		if msg := req.validate(); msg != "" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, msg)
+			return
+		}
 
 		syncService := services.NewSyncService(engine)
-		result, err := syncService.SyncCalls(device, req.Type)
+		result, err := syncService.SyncCalls(c.Request.Context(), device, req.Type, services.SyncOptions{
+			Full:     req.Full,
+			PageSize: req.PageSize,
+			MaxPages: req.MaxPages,
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondPhoneError(c, err)
 			return
 		}
 
@@ -625,24 +963,46 @@ func SyncCalls(engine *xorm.Engine) gin.HandlerFunc {
 	}
 }
 
+// SyncProgress reports the device's running syncs: pages fetched and records
+// inserted so far. A sync request blocks until it finishes, so clients poll
+// this from a separate request to show a long full sync making progress.
+func SyncProgress(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		device, err := getDevice(engine, c.Param("id"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"device_id": device.ID,
+			"running":   services.SyncProgressOf(device.ID),
+		})
+	}
+}
+
 // SyncContacts manually triggers contact sync from phone
 func SyncContacts(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
 		syncService := services.NewSyncService(engine)
-		result, err := syncService.SyncContacts(device)
+		result, err := syncService.SyncContacts(c.Request.Context(), device)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondPhoneError(c, err)
 			return
 		}
 
@@ -650,65 +1010,122 @@ func SyncContacts(engine *xorm.Engine) gin.HandlerFunc {
 	}
 }
 
+// resolveTagFilter maps the optional "tag" query param to the IDs of the devices
+// carrying it. It returns nil when no tag is given and writes an error response
+// (returning ok=false) if the lookup fails.
+func resolveTagFilter(c *gin.Context, engine *xorm.Engine) (deviceIDs []int64, ok bool) {
+	tag := c.Query("tag")
+	if tag == "" {
+		return nil, true
+	}
+	ids, err := repository.NewDeviceRepository(engine).IDsByTag(tag)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+		return nil, false
+	}
+	return ids, true
+}
+
 // QueryAllSms queries SMS messages from all devices with pagination
+// Optional from/to (unix millis or RFC3339, inclusive) restrict the record time
+// and sim_id (0, 1 or -1=unknown) the SIM slot;
+// sort=asc|desc (default desc) and sort_by pick the order;
+// include_archived=true also returns messages of archived conversations.
 func QueryAllSms(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Parse query parameters
 		smsType, _ := strconv.Atoi(c.DefaultQuery("type", "0"))
-		pageNum, _ := strconv.Atoi(c.DefaultQuery("page_num", "1"))
-		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		page := parsePage(c)
 		keyword := c.Query("keyword")
 		deviceID, _ := strconv.ParseInt(c.Query("device_id"), 10, 64)
+		opts, err := parseListOptions(c, repository.SmsSortColumns)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		opts.IncludeArchived = c.Query("include_archived") == "true"
+		opts.UnreadOnly = c.Query("unread_only") == "true"
+
+		deviceIDs, ok := resolveTagFilter(c, engine)
+		if !ok {
+			return
+		}
+		if deviceIDs != nil && len(deviceIDs) == 0 {
+			response := page.body([]any{}, 0)
+			response["unread_count"] = 0
+			c.JSON(http.StatusOK, response)
+			return
+		}
 
 		// Query from database
 		repo := repository.NewSmsRepository(engine)
-		items, total, err := repo.FindAll(smsType, pageNum, pageSize, keyword, deviceID)
+		items, total, err := repo.FindAll(smsType, page.Num, page.Size, keyword, deviceID, deviceIDs, opts)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
 		// Get unread count with same filters
-		unreadCount, err := repo.CountUnread(smsType, deviceID)
+		unreadCount, err := repo.CountUnread(smsType, deviceID, deviceIDs)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"items":        items,
-			"total":        total,
-			"unread_count": unreadCount,
-			"page":         pageNum,
-			"size":         pageSize,
-		})
+		response := page.body(items, total)
+		response["unread_count"] = unreadCount
+		c.JSON(http.StatusOK, response)
 	}
 }
 
 // QueryAllCalls queries call logs from all devices with pagination
+// Optional from/to (unix millis or RFC3339, inclusive) restrict the record time
+// and sim_id (0, 1 or -1=unknown) the SIM slot;
+// sort=asc|desc (default desc) and sort_by pick the order;
+// unread_only=true limits the list (and total) to unread calls.
 func QueryAllCalls(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Parse query parameters
 		callType, _ := strconv.Atoi(c.DefaultQuery("type", "0"))
-		pageNum, _ := strconv.Atoi(c.DefaultQuery("page_num", "1"))
-		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		page := parsePage(c)
 		phoneNumber := c.Query("phone_number")
 		deviceID, _ := strconv.ParseInt(c.Query("device_id"), 10, 64)
+		opts, err := parseListOptions(c, repository.CallSortColumns)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		opts.UnreadOnly = c.Query("unread_only") == "true"
+
+		deviceIDs, ok := resolveTagFilter(c, engine)
+		if !ok {
+			return
+		}
+		if deviceIDs != nil && len(deviceIDs) == 0 {
+			response := page.body([]any{}, 0)
+			response["unread_count"] = 0
+			c.JSON(http.StatusOK, response)
+			return
+		}
 
 		// Query from database
 		repo := repository.NewCallRepository(engine)
-		items, total, err := repo.FindAll(callType, pageNum, pageSize, phoneNumber, deviceID)
+		items, total, err := repo.FindAll(callType, page.Num, page.Size, phoneNumber, deviceID, deviceIDs, opts)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"items": items,
-			"total": total,
-			"page":  pageNum,
-			"size":  pageSize,
-		})
+		// Get unread count with same filters
+		unreadCount, err := repo.CountUnread(callType, deviceID, deviceIDs)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		response := page.body(items, total)
+		response["unread_count"] = unreadCount
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -717,13 +1134,13 @@ func MarkSmsAsRead(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid SMS id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid SMS id")
 			return
 		}
 
 		repo := repository.NewSmsRepository(engine)
 		if err := repo.MarkAsRead(id); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
@@ -731,30 +1148,31 @@ func MarkSmsAsRead(engine *xorm.Engine) gin.HandlerFunc {
 	}
 }
 
+// MarkSmsReadRequest is the body of POST /api/devices/:id/sms/mark-read.
+type MarkSmsReadRequest struct {
+	Type int `json:"type"` // 0=all, 1=received, 2=sent
+}
+
 // MarkAllSmsAsRead marks all SMS messages as read for a device
 func MarkAllSmsAsRead(engine *xorm.Engine) gin.HandlerFunc {
-	type markRequest struct {
-		Type int `json:"type"` // 0=all, 1=received, 2=sent
-	}
-
 	return func(c *gin.Context) {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
-		var req markRequest
+		var req MarkSmsReadRequest
 		c.ShouldBindJSON(&req) // Optional, defaults to 0 (all)
 
 		repo := repository.NewSmsRepository(engine)
 		if err := repo.MarkAllAsRead(device.ID, req.Type); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
@@ -767,13 +1185,13 @@ func MarkCallAsRead(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid call id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid call id")
 			return
 		}
 
 		repo := repository.NewCallRepository(engine)
 		if err := repo.MarkAsRead(id); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
@@ -781,30 +1199,31 @@ func MarkCallAsRead(engine *xorm.Engine) gin.HandlerFunc {
 	}
 }
 
+// MarkCallsReadRequest is the body of POST /api/devices/:id/calls/mark-read.
+type MarkCallsReadRequest struct {
+	Type int `json:"type"` // 0=all, 1=incoming, 2=outgoing, 3=missed
+}
+
 // MarkAllCallsAsRead marks all call logs as read for a device
 func MarkAllCallsAsRead(engine *xorm.Engine) gin.HandlerFunc {
-	type markRequest struct {
-		Type int `json:"type"` // 0=all, 1=incoming, 2=outgoing, 3=missed
-	}
-
 	return func(c *gin.Context) {
 		deviceID := c.Param("id")
 		device, err := getDevice(engine, deviceID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
 		if device == nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
-		var req markRequest
+		var req MarkCallsReadRequest
 		c.ShouldBindJSON(&req) // Optional, defaults to 0 (all)
 
 		repo := repository.NewCallRepository(engine)
 		if err := repo.MarkAllAsRead(device.ID, req.Type); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
@@ -817,39 +1236,93 @@ func DeleteSms(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid SMS id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid SMS id")
 			return
 		}
 
 		repo := repository.NewSmsRepository(engine)
 		if err := repo.Delete(id); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
+		recordAudit(c, engine, models.AuditSmsDelete, "sms", id, "")
 		c.JSON(http.StatusOK, gin.H{"message": "SMS deleted successfully"})
 	}
 }
 
-// DeleteMultipleSms deletes multiple SMS messages by IDs
-func DeleteMultipleSms(engine *xorm.Engine) gin.HandlerFunc {
-	type deleteRequest struct {
-		IDs []int64 `json:"ids" binding:"required"`
+// QuerySmsTrash lists soft-deleted SMS messages of a device so they can be restored
+func QuerySmsTrash(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.Param("id")
+		device, err := getDevice(engine, deviceID)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		page := parsePage(c)
+
+		repo := repository.NewSmsRepository(engine)
+		items, total, err := repo.FindDeletedByDevice(device.ID, page.Num, page.Size)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, page.body(items, total))
+	}
+}
+
+// RestoreSms restores a soft-deleted SMS message
+func RestoreSms(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid SMS id")
+			return
+		}
+
+		repo := repository.NewSmsRepository(engine)
+		restored, err := repo.Restore(id)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if !restored {
+			respondError(c, http.StatusNotFound, codeSmsNotFound, "deleted SMS not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "SMS restored successfully"})
 	}
+}
+
+// DeleteIDsRequest is the body of POST /api/sms/delete and /api/calls/delete.
+type DeleteIDsRequest struct {
+	IDs []int64 `json:"ids" binding:"required"`
+}
 
+// DeleteMultipleSms deletes multiple SMS messages by IDs
+func DeleteMultipleSms(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req deleteRequest
+		var req DeleteIDsRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 
 		repo := repository.NewSmsRepository(engine)
 		if err := repo.DeleteBatch(req.IDs); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
+		recordAudit(c, engine, models.AuditSmsDelete, "sms", 0, fmt.Sprintf("ids %v", req.IDs))
 		c.JSON(http.StatusOK, gin.H{"message": "SMS deleted successfully", "count": len(req.IDs)})
 	}
 }
@@ -859,57 +1332,56 @@ func DeleteCall(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid call id"})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid call id")
 			return
 		}
 
 		repo := repository.NewCallRepository(engine)
 		if err := repo.Delete(id); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
+		recordAudit(c, engine, models.AuditCallDelete, "call", id, "")
 		c.JSON(http.StatusOK, gin.H{"message": "Call deleted successfully"})
 	}
 }
 
 // DeleteMultipleCalls deletes multiple call logs by IDs
 func DeleteMultipleCalls(engine *xorm.Engine) gin.HandlerFunc {
-	type deleteRequest struct {
-		IDs []int64 `json:"ids" binding:"required"`
-	}
-
 	return func(c *gin.Context) {
-		var req deleteRequest
+		var req DeleteIDsRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 
 		repo := repository.NewCallRepository(engine)
 		if err := repo.DeleteBatch(req.IDs); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
+		recordAudit(c, engine, models.AuditCallDelete, "call", 0, fmt.Sprintf("ids %v", req.IDs))
 		c.JSON(http.StatusOK, gin.H{"message": "Calls deleted successfully", "count": len(req.IDs)})
 	}
 }
 
+// MarkAllSmsReadRequest is the optional body of POST /api/sms/mark-read-all.
+type MarkAllSmsReadRequest struct {
+	Type     int   `json:"type"`      // 0=all, 1=received, 2=sent
+	DeviceID int64 `json:"device_id"` // 0=all devices
+}
+
 // MarkAllSmsAsReadGlobally marks all unread SMS messages as read across all devices
 func MarkAllSmsAsReadGlobally(engine *xorm.Engine) gin.HandlerFunc {
-	type markRequest struct {
-		Type     int   `json:"type"`      // 0=all, 1=received, 2=sent
-		DeviceID int64 `json:"device_id"` // 0=all devices
-	}
-
 	return func(c *gin.Context) {
-		var req markRequest
+		var req MarkAllSmsReadRequest
 		c.ShouldBindJSON(&req) // Optional, defaults to 0
 
 		repo := repository.NewSmsRepository(engine)
 		if err := repo.MarkAllAsReadGlobally(req.Type, req.DeviceID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
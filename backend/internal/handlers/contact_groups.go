@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/internal/models"
+	"backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// maxGroupMembersPerRequest caps how many contacts one add-members request may name
+const maxGroupMembersPerRequest = 200
+
+// ContactGroupRequest is the body of POST /api/devices/:id/contact-groups.
+type ContactGroupRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// ContactGroupMembersRequest is the body of POST /api/devices/:id/contact-groups/:groupId/members.
+type ContactGroupMembersRequest struct {
+	ContactIDs []int64 `json:"contact_ids" binding:"required"`
+}
+
+// getDeviceGroup loads the group named by :groupId on the device named by :id,
+// writing the error response and returning a nil group if either is invalid or missing.
+func getDeviceGroup(c *gin.Context, engine *xorm.Engine) (*repository.ContactGroupRepository, *models.ContactGroup) {
+	device, err := getDevice(engine, c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+		return nil, nil
+	}
+	if device == nil {
+		respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+		return nil, nil
+	}
+	groupID, err := strconv.ParseInt(c.Param("groupId"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid group id")
+		return nil, nil
+	}
+
+	repo := repository.NewContactGroupRepository(engine)
+	group, err := repo.FindByDeviceAndID(device.ID, groupID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+		return nil, nil
+	}
+	if group == nil {
+		respondError(c, http.StatusNotFound, codeGroupNotFound, "contact group not found")
+		return nil, nil
+	}
+	return repo, group
+}
+
+// ListContactGroups returns a device's contact groups with their member counts.
+func ListContactGroups(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		device, err := getDevice(engine, c.Param("id"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		groups, err := repository.NewContactGroupRepository(engine).FindByDevice(device.ID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"items": groups})
+	}
+}
+
+// CreateContactGroup adds an empty contact group to a device. Names are unique per device.
+func CreateContactGroup(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		device, err := getDevice(engine, c.Param("id"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		var req ContactGroupRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "name is required")
+			return
+		}
+
+		repo := repository.NewContactGroupRepository(engine)
+		exists, err := repo.ExistsByName(device.ID, name)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if exists {
+			respondError(c, http.StatusConflict, CodeConflict, "a group with this name already exists")
+			return
+		}
+
+		group := models.ContactGroup{DeviceID: device.ID, Name: name}
+		if err := repo.Insert(&group); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusCreated, group)
+	}
+}
+
+// DeleteContactGroup removes a group and its memberships; the contacts stay.
+func DeleteContactGroup(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repo, group := getDeviceGroup(c, engine)
+		if group == nil {
+			return
+		}
+
+		if err := repo.Delete(group.ID); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Contact group deleted successfully"})
+	}
+}
+
+// ListContactGroupMembers returns the contacts in a group.
+func ListContactGroupMembers(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repo, group := getDeviceGroup(c, engine)
+		if group == nil {
+			return
+		}
+
+		members, err := repo.FindMembers(group.ID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"group": group, "items": members, "total": len(members)})
+	}
+}
+
+// AddContactGroupMembers puts contacts of the same device in a group. Contacts
+// already in the group are skipped; an ID that isn't one of the device's
+// contacts fails the whole request.
+func AddContactGroupMembers(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repo, group := getDeviceGroup(c, engine)
+		if group == nil {
+			return
+		}
+
+		var req ContactGroupMembersRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		if len(req.ContactIDs) == 0 {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "contact_ids is required")
+			return
+		}
+		if len(req.ContactIDs) > maxGroupMembersPerRequest {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("too many contacts (max %d)", maxGroupMembersPerRequest))
+			return
+		}
+
+		contacts := repository.NewContactRepository(engine)
+		for _, id := range req.ContactIDs {
+			contact, err := contacts.FindByDeviceAndID(group.DeviceID, id)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+				return
+			}
+			if contact == nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("contact %d not found on this device", id))
+				return
+			}
+		}
+
+		added := 0
+		for _, id := range req.ContactIDs {
+			ok, err := repo.AddMember(group.ID, id)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+				return
+			}
+			if ok {
+				added++
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"added": added})
+	}
+}
+
+// RemoveContactGroupMember takes a contact out of a group.
+func RemoveContactGroupMember(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repo, group := getDeviceGroup(c, engine)
+		if group == nil {
+			return
+		}
+		contactID, err := strconv.ParseInt(c.Param("contactId"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid contact id")
+			return
+		}
+
+		removed, err := repo.RemoveMember(group.ID, contactID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if !removed {
+			respondError(c, http.StatusNotFound, codeContactNotFound, "contact is not in this group")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Contact removed from group"})
+	}
+}
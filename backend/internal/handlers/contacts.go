@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/internal/models"
+	"backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// ContactUpdateRequest is the body of PUT /api/devices/:id/contacts/:contactId.
+type ContactUpdateRequest struct {
+	Name  string `json:"name" binding:"required"`
+	Email string `json:"email"`
+	Note  string `json:"note"`
+}
+
+// QueryAllContacts returns contacts from every device, merged by normalized
+// phone number, each with the device_ids it is stored on. Unlike the
+// per-device list it never syncs. Query params: keyword, include_hidden,
+// page_num, page_size (pages count numbers, not contacts)
+func QueryAllContacts(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page := parsePage(c)
+		items, total, err := repository.NewContactRepository(engine).FindAll(
+			strings.TrimSpace(c.Query("keyword")), c.Query("include_hidden") == "true", page.Num, page.Size)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, page.body(items, total))
+	}
+}
+
+// getDeviceContact loads the contact named by :contactId on the device named by
+// :id, writing the error response and returning nil if either is invalid or missing.
+func getDeviceContact(c *gin.Context, engine *xorm.Engine) (*repository.ContactRepository, *models.Contact) {
+	device, err := getDevice(engine, c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+		return nil, nil
+	}
+	if device == nil {
+		respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+		return nil, nil
+	}
+	contactID, err := strconv.ParseInt(c.Param("contactId"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid contact id")
+		return nil, nil
+	}
+
+	repo := repository.NewContactRepository(engine)
+	contact, err := repo.FindByDeviceAndID(device.ID, contactID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+		return nil, nil
+	}
+	if contact == nil {
+		respondError(c, http.StatusNotFound, codeContactNotFound, "contact not found")
+		return nil, nil
+	}
+	return repo, contact
+}
+
+// UpdateContact edits a contact stored in the local database without
+// contacting the phone. Editing a hidden (auto-created) contact unhides it,
+// since it now carries a name the user chose. A later contact sync from the
+// phone still overwrites the name if the phone has the number saved.
+func UpdateContact(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repo, contact := getDeviceContact(c, engine)
+		if contact == nil {
+			return
+		}
+
+		var req ContactUpdateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "name is required")
+			return
+		}
+
+		contact.Name = name
+		contact.Email = strings.TrimSpace(req.Email)
+		contact.Note = req.Note
+		contact.IsHidden = false
+		if err := repo.UpdateDetails(contact); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, contact)
+	}
+}
+
+// DeleteContact removes a contact from the local database only. SMS and calls
+// with that number fall back to their stored name.
+func DeleteContact(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repo, contact := getDeviceContact(c, engine)
+		if contact == nil {
+			return
+		}
+
+		if err := repo.Delete(contact.ID); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Contact deleted successfully"})
+	}
+}
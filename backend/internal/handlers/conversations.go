@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"net/http"
+
+	"backend/internal/repository"
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// ListConversations returns one entry per address with the latest message preview,
+// unread count and resolved contact name, most recent activity first.
+// Query params: page_num (default 1), page_size (default 20, max 200),
+// include_archived=true to also list archived conversations
+func ListConversations(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.Param("id")
+		device, err := getDevice(engine, deviceID)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		page := parsePage(c)
+		includeArchived := c.Query("include_archived") == "true"
+
+		items, total, err := repository.NewSmsRepository(engine).FindConversations(device.ID, page.Num, page.Size, includeArchived)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, page.body(items, total))
+	}
+}
+
+// ConversationThread returns all SMS (sent and received) with one address,
+// oldest first, for a chat-style view.
+// Query params: page_num (default 1), page_size (default 20, max 200),
+// mark_read=true to mark the returned page as read and add unread_count
+func ConversationThread(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.Param("id")
+		device, err := getDevice(engine, deviceID)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		address := c.Param("address")
+		page := parsePage(c)
+
+		repo := repository.NewSmsRepository(engine)
+		items, total, err := repo.FindThread(device.ID, address, page.Num, page.Size)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		response := page.body(items, total)
+		response["address"] = address
+		if c.Query("mark_read") == "true" {
+			unread, err := markPageRead(repo, device.ID, items)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+				return
+			}
+			response["unread_count"] = unread
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// SyncConversationRequest is the body of POST /api/devices/:id/conversations/:address/sync.
+type SyncConversationRequest struct {
+	Force bool `json:"force"` // Walk pages even if the newest message is already stored
+	Full  bool `json:"full"`  // Walk every page, not just until nothing is new
+	syncLimits
+}
+
+// SyncConversation syncs only the SMS with one address from the phone, far
+// cheaper than a full SMS sync when the phone can filter by number. The body
+// is optional; client_filtered in the result reports a phone that couldn't.
+func SyncConversation(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.Param("id")
+		device, err := getDevice(engine, deviceID)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		var req SyncConversationRequest
+		c.ShouldBindJSON(&req) // Optional
+		if msg := req.validate(); msg != "" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, msg)
+			return
+		}
+
+		result, err := services.NewSyncService(engine).SyncConversation(c.Request.Context(), device, c.Param("address"), services.SyncOptions{
+			Force:    req.Force,
+			Full:     req.Full,
+			PageSize: req.PageSize,
+			MaxPages: req.MaxPages,
+		})
+		if err != nil {
+			respondPhoneError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// ArchiveConversation hides a conversation from the default SMS and
+// conversation lists without deleting it. Messages synced later start
+// unarchived, so new activity brings the conversation back.
+func ArchiveConversation(engine *xorm.Engine) gin.HandlerFunc {
+	return setConversationArchived(engine, true)
+}
+
+// UnarchiveConversation returns an archived conversation to the default lists.
+func UnarchiveConversation(engine *xorm.Engine) gin.HandlerFunc {
+	return setConversationArchived(engine, false)
+}
+
+func setConversationArchived(engine *xorm.Engine, archived bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.Param("id")
+		device, err := getDevice(engine, deviceID)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		address := c.Param("address")
+		updated, err := repository.NewSmsRepository(engine).SetArchived(device.ID, address, archived)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		message := "Conversation archived"
+		if !archived {
+			message = "Conversation unarchived"
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message, "address": address, "updated": updated})
+	}
+}
@@ -1,11 +1,20 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"backend/config"
+	"backend/internal/metrics"
 	"backend/internal/models"
 	"backend/internal/phoneclient"
+	"backend/internal/repository"
+	"backend/internal/security"
+	"backend/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"xorm.io/xorm"
@@ -15,19 +24,139 @@ type CreateDeviceRequest struct {
 	Name            string `json:"name" binding:"required"`
 	PhoneAddr       string `json:"phone_addr" binding:"required"` // Phone HTTP server address, e.g., "http://192.168.1.100:5000"
 	SM4Key          string `json:"sm4_key" binding:"required"`    // SM4 encryption key from phone (32 hex chars)
+	SM4IV           string `json:"sm4_iv"`                        // Optional SM4 IV (32 hex chars, empty = default)
+	SignEnabled     bool   `json:"sign_enabled"`                  // Sign requests with SignSecret
+	SignSecret      string `json:"sign_secret"`                   // SmsForwarder server signing secret
 	Remark          string `json:"remark"`
 	PollingInterval int    `json:"polling_interval"` // Polling interval in seconds (0=disabled, 5/10/15/30/60)
+	Timeout         int    `json:"timeout"`          // Phone API timeout in seconds (0=default 30, max 300)
+	Tags            string `json:"tags"`             // Comma-separated group tags, e.g. "office,test"
+	// Optional network settings
+	ProxyURL           string `json:"proxy_url"`            // http(s)/socks5 proxy for reaching the phone
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` // Accept any HTTPS certificate (insecure, LAN use only)
+	TLSCert            string `json:"tls_cert"`             // PEM certificate or CA to pin
+	// Optional send quotas (0 = unlimited)
+	SendLimitHour int `json:"send_limit_hour"` // SMS per rolling hour
+	SendLimitDay  int `json:"send_limit_day"`  // SMS per rolling day
+}
+
+// maxDeviceTimeout is the upper bound for a device's phone API timeout in seconds
+const maxDeviceTimeout = 300
+
+// isValidTimeout reports whether a device timeout is 0 (default) or within 1..maxDeviceTimeout seconds
+func isValidTimeout(timeout int) bool {
+	return timeout >= 0 && timeout <= maxDeviceTimeout
+}
+
+// validate checks a new device's settings and returns a client-facing error
+// message, or "" if they are valid. phone_addr is normalized in place.
+func (req *CreateDeviceRequest) validate() string {
+	if req.Name == "" || req.PhoneAddr == "" || req.SM4Key == "" {
+		return "name, phone_addr and sm4_key are required"
+	}
+	addr, err := phoneclient.NormalizePhoneAddr(req.PhoneAddr)
+	if err != nil {
+		return err.Error()
+	}
+	req.PhoneAddr = addr
+	// Validate SM4 key format (should be 32 hex characters)
+	if err := security.ValidateSM4Key(req.SM4Key); err != nil {
+		return err.Error()
+	}
+	if err := security.ValidateSM4IV(req.SM4IV); err != nil {
+		return err.Error()
+	}
+	if req.SignEnabled && req.SignSecret == "" {
+		return "sign_secret is required when sign_enabled is true"
+	}
+	if err := phoneclient.ValidateProxyURL(req.ProxyURL); err != nil {
+		return err.Error()
+	}
+	if err := phoneclient.ValidateCertPEM(req.TLSCert); err != nil {
+		return "tls_cert: " + err.Error()
+	}
+
+	// Validate polling interval (must be 0 or one of: 5, 10, 15, 30, 60)
+	validIntervals := []int{0, 5, 10, 15, 30, 60}
+	validInterval := false
+	for _, v := range validIntervals {
+		if req.PollingInterval == v {
+			validInterval = true
+			break
+		}
+	}
+	if !validInterval {
+		return "Polling interval must be 0 (disabled) or one of: 5, 10, 15, 30, 60 seconds"
+	}
+
+	// Validate timeout (0 = default)
+	if !isValidTimeout(req.Timeout) {
+		return "Timeout must be 0 (default 30) or between 1 and 300 seconds"
+	}
+	if req.SendLimitHour < 0 || req.SendLimitDay < 0 {
+		return "send_limit_hour and send_limit_day must be 0 (unlimited) or positive"
+	}
+	return ""
+}
+
+// device builds the device to insert from a validated request.
+func (req *CreateDeviceRequest) device() models.Device {
+	return models.Device{
+		Name:               req.Name,
+		PhoneAddr:          req.PhoneAddr,
+		SM4Key:             req.SM4Key,
+		SM4IV:              req.SM4IV,
+		SignEnabled:        req.SignEnabled,
+		SignSecret:         req.SignSecret,
+		Status:             "unknown",
+		Remark:             req.Remark,
+		PollingInterval:    req.PollingInterval,
+		Timeout:            req.Timeout,
+		Tags:               repository.NormalizeTags(req.Tags),
+		ProxyURL:           req.ProxyURL,
+		InsecureSkipVerify: req.InsecureSkipVerify,
+		TLSCert:            req.TLSCert,
+		SendLimitHour:      req.SendLimitHour,
+		SendLimitDay:       req.SendLimitDay,
+		LastSeen:           time.Now(),
+	}
+}
+
+// DeviceResponse is a device as returned by the API. The SM4 key, signing
+// secret, proxy URL and pinned certificate are never sent back (they can only
+// be read through ExportDevices); flags report which of them are set.
+type DeviceResponse struct {
+	models.Device
+	HasSM4Key     bool `json:"has_sm4_key"`
+	HasSignSecret bool `json:"has_sign_secret"`
+	HasProxyURL   bool `json:"has_proxy_url"`
+	HasTLSCert    bool `json:"has_tls_cert"`
+}
+
+func deviceResponse(d models.Device) DeviceResponse {
+	return DeviceResponse{
+		Device:        d,
+		HasSM4Key:     d.SM4Key != "",
+		HasSignSecret: d.SignSecret != "",
+		HasProxyURL:   d.ProxyURL != "",
+		HasTLSCert:    d.TLSCert != "",
+	}
 }
 
 // ListDevices returns all registered devices.
+// Query params: tag (optional, only devices carrying this tag)
 func ListDevices(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var devices []models.Device
-		if err := engine.Find(&devices); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		devices, err := repository.NewDeviceRepository(engine).FindByTag(c.Query("tag"))
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"items": devices})
+		items := make([]DeviceResponse, len(devices))
+		for i, d := range devices {
+			items[i] = deviceResponse(d)
+		}
+		c.JSON(http.StatusOK, gin.H{"items": items})
 	}
 }
 
@@ -37,55 +166,42 @@ func CreateDevice(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req CreateDeviceRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 
-		// Validate SM4 key format (should be 32 hex characters)
-		if len(req.SM4Key) != 32 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "SM4 key must be 32 hex characters"})
+		if msg := req.validate(); msg != "" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, msg)
 			return
 		}
 
-		// Validate polling interval (must be 0 or one of: 5, 10, 15, 30, 60)
-		validIntervals := []int{0, 5, 10, 15, 30, 60}
-		validInterval := false
-		for _, v := range validIntervals {
-			if req.PollingInterval == v {
-				validInterval = true
-				break
-			}
-		}
-		if !validInterval {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Polling interval must be 0 (disabled) or one of: 5, 10, 15, 30, 60 seconds"})
-			return
-		}
-
-		device := models.Device{
-			Name:            req.Name,
-			PhoneAddr:       req.PhoneAddr,
-			SM4Key:          req.SM4Key,
-			Status:          "unknown",
-			Remark:          req.Remark,
-			PollingInterval: req.PollingInterval,
-			LastSeen:        time.Now(),
-		}
+		device := req.device()
 		if _, err := engine.Insert(&device); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
-		c.JSON(http.StatusOK, device)
+		recordAudit(c, engine, models.AuditDeviceCreate, "device", device.ID, device.Name)
+		c.JSON(http.StatusOK, deviceResponse(device))
 	}
 }
 
 // DeleteDevice removes a device and its related data.
+// Any background sync or poll still running against the device is canceled,
+// and its gauges are removed from /metrics.
 func DeleteDevice(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
+		// Looked up first so its metrics can be dropped by label after deletion
+		device, _ := getDevice(engine, id)
 		if _, err := engine.ID(id).Delete(&models.Device{}); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
+		services.CancelDeviceWork(parseID(id))
+		if device != nil {
+			metrics.ForgetDevice(device)
+			recordAudit(c, engine, models.AuditDeviceDelete, "device", device.ID, device.Name)
+		}
 		c.Status(http.StatusNoContent)
 	}
 }
@@ -100,40 +216,42 @@ func Heartbeat(engine *xorm.Engine) gin.HandlerFunc {
 		id := c.Param("id")
 		var req hbRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 		device := models.Device{}
 		if _, err := engine.ID(id).Get(&device); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 		device.Battery = req.Battery
 		device.Status = req.Status
 		device.LastSeen = time.Now()
 		if _, err := engine.ID(id).Cols("battery", "status", "last_seen").Update(&device); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
-		c.JSON(http.StatusOK, device)
+		c.JSON(http.StatusOK, deviceResponse(device))
 	}
 }
 
-// DeviceDetail returns a single device info.
+// DeviceDetail returns a single device info, with the SIM cards last reported
+// by the phone parsed from sim_info into sims.
 func DeviceDetail(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-		var device models.Device
-		has, err := engine.ID(id).Get(&device)
+		device, err := getDevice(engine, c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
-		if !has {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
-		c.JSON(http.StatusOK, device)
+		c.JSON(http.StatusOK, struct {
+			DeviceResponse
+			Sims []phoneclient.SimInfo `json:"sims"`
+		}{deviceResponse(*device), phoneclient.ParseSimInfo(device.SimInfo)})
 	}
 }
 
@@ -142,29 +260,38 @@ type UpdateDeviceRequest struct {
 	Name            *string `json:"name"`
 	PhoneAddr       *string `json:"phone_addr"`
 	SM4Key          *string `json:"sm4_key"`
+	SM4IV           *string `json:"sm4_iv"`
+	SignEnabled     *bool   `json:"sign_enabled"`
+	SignSecret      *string `json:"sign_secret"`
 	Remark          *string `json:"remark"`
 	PollingInterval *int    `json:"polling_interval"`
+	Timeout         *int    `json:"timeout"`
+	Tags            *string `json:"tags"`
+	// Optional network settings
+	ProxyURL           *string `json:"proxy_url"`
+	InsecureSkipVerify *bool   `json:"insecure_skip_verify"`
+	TLSCert            *string `json:"tls_cert"`
+	// Optional send quotas
+	SendLimitHour *int `json:"send_limit_hour"`
+	SendLimitDay  *int `json:"send_limit_day"`
 }
 
-// UpdateDevice updates device information (name, phone_addr, sm4_key, remark)
+// UpdateDevice updates device information (name, phone_addr, sm4_key, sm4_iv, sign_enabled, sign_secret, remark, polling_interval, timeout, tags, proxy_url, insecure_skip_verify, tls_cert, send_limit_hour, send_limit_day)
 func UpdateDevice(engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id := c.Param("id")
-
-		var device models.Device
-		has, err := engine.ID(id).Get(&device)
+		device, err := getDevice(engine, c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
 			return
 		}
-		if !has {
-			c.JSON(http.StatusNotFound, gin.H{"error": "device not found"})
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
 			return
 		}
 
 		var req UpdateDeviceRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 
@@ -175,17 +302,42 @@ func UpdateDevice(engine *xorm.Engine) gin.HandlerFunc {
 			cols = append(cols, "name")
 		}
 		if req.PhoneAddr != nil {
-			device.PhoneAddr = *req.PhoneAddr
+			addr, err := phoneclient.NormalizePhoneAddr(*req.PhoneAddr)
+			if err != nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+				return
+			}
+			device.PhoneAddr = addr
 			cols = append(cols, "phone_addr")
 		}
 		if req.SM4Key != nil {
-			if len(*req.SM4Key) != 32 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "SM4 key must be 32 hex characters"})
+			if err := security.ValidateSM4Key(*req.SM4Key); err != nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 				return
 			}
 			device.SM4Key = *req.SM4Key
 			cols = append(cols, "sm4_key")
 		}
+		if req.SM4IV != nil {
+			if err := security.ValidateSM4IV(*req.SM4IV); err != nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+				return
+			}
+			device.SM4IV = *req.SM4IV
+			cols = append(cols, "sm4_iv")
+		}
+		if req.SignEnabled != nil {
+			device.SignEnabled = *req.SignEnabled
+			cols = append(cols, "sign_enabled")
+		}
+		if req.SignSecret != nil {
+			device.SignSecret = *req.SignSecret
+			cols = append(cols, "sign_secret")
+		}
+		if device.SignEnabled && device.SignSecret == "" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "sign_secret is required when sign_enabled is true")
+			return
+		}
 		if req.Remark != nil {
 			device.Remark = *req.Remark
 			cols = append(cols, "remark")
@@ -201,45 +353,123 @@ func UpdateDevice(engine *xorm.Engine) gin.HandlerFunc {
 				}
 			}
 			if !validInterval {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Polling interval must be 0 (disabled) or one of: 5, 10, 15, 30, 60 seconds"})
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Polling interval must be 0 (disabled) or one of: 5, 10, 15, 30, 60 seconds")
 				return
 			}
 			device.PollingInterval = *req.PollingInterval
 			cols = append(cols, "polling_interval")
 		}
+		if req.Timeout != nil {
+			if !isValidTimeout(*req.Timeout) {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Timeout must be 0 (default 30) or between 1 and 300 seconds")
+				return
+			}
+			device.Timeout = *req.Timeout
+			cols = append(cols, "timeout")
+		}
+		if req.Tags != nil {
+			device.Tags = repository.NormalizeTags(*req.Tags)
+			cols = append(cols, "tags")
+		}
+		if req.ProxyURL != nil {
+			if err := phoneclient.ValidateProxyURL(*req.ProxyURL); err != nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+				return
+			}
+			device.ProxyURL = *req.ProxyURL
+			cols = append(cols, "proxy_url")
+		}
+		if req.InsecureSkipVerify != nil {
+			device.InsecureSkipVerify = *req.InsecureSkipVerify
+			cols = append(cols, "insecure_skip_verify")
+		}
+		if req.TLSCert != nil {
+			if err := phoneclient.ValidateCertPEM(*req.TLSCert); err != nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, "tls_cert: "+err.Error())
+				return
+			}
+			device.TLSCert = *req.TLSCert
+			cols = append(cols, "tls_cert")
+		}
+		if req.SendLimitHour != nil {
+			if *req.SendLimitHour < 0 {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, "send_limit_hour must be 0 (unlimited) or positive")
+				return
+			}
+			device.SendLimitHour = *req.SendLimitHour
+			cols = append(cols, "send_limit_hour")
+		}
+		if req.SendLimitDay != nil {
+			if *req.SendLimitDay < 0 {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, "send_limit_day must be 0 (unlimited) or positive")
+				return
+			}
+			device.SendLimitDay = *req.SendLimitDay
+			cols = append(cols, "send_limit_day")
+		}
 
 		if len(cols) == 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "no fields to update")
 			return
 		}
 
-		if _, err := engine.ID(id).Cols(cols...).Update(&device); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if _, err := engine.ID(device.ID).Cols(cols...).Update(device); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
+		recordAudit(c, engine, models.AuditDeviceUpdate, "device", device.ID, "changed "+strings.Join(cols, ", "))
 
-		c.JSON(http.StatusOK, device)
+		c.JSON(http.StatusOK, deviceResponse(*device))
 	}
 }
 
-// RefreshAllDevices refreshes status and battery info for all devices
-func RefreshAllDevices(engine *xorm.Engine) gin.HandlerFunc {
+// RefreshDevicesRequest optionally limits a refresh to some devices.
+type RefreshDevicesRequest struct {
+	DeviceIDs []int64 `json:"device_ids"` // Empty = all devices; unknown IDs are skipped
+}
+
+// RefreshAllDevices refreshes status and battery info for all devices, or
+// only for the device_ids given in the optional body
+func RefreshAllDevices(cfg *config.Config, engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		var req RefreshDevicesRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+				return
+			}
+		}
+		// newSession selects the requested devices, or all of them
+		newSession := func() *xorm.Session {
+			session := engine.NewSession()
+			if len(req.DeviceIDs) > 0 {
+				session = session.In("id", req.DeviceIDs)
+			}
+			return session
+		}
+
 		var devices []models.Device
-		if err := engine.Find(&devices); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := newSession().Find(&devices); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
-		// Refresh each device in parallel
+		// Refresh devices in parallel, at most MaxConcurrentPolls at a time
 		results := make(chan struct {
 			id      int64
 			success bool
 		}, len(devices))
+		limit := cfg.App.MaxConcurrentPolls
+		if limit < 1 {
+			limit = 1
+		}
+		sem := make(chan struct{}, limit)
 
 		for _, device := range devices {
 			go func(d models.Device) {
-				success := refreshDeviceStatus(engine, &d)
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				success := refreshDeviceStatus(c.Request.Context(), engine, &d)
 				results <- struct {
 					id      int64
 					success bool
@@ -258,8 +488,8 @@ func RefreshAllDevices(engine *xorm.Engine) gin.HandlerFunc {
 
 		// Fetch updated devices
 		var updatedDevices []models.Device
-		if err := engine.Find(&updatedDevices); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := newSession().Find(&updatedDevices); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 
@@ -272,11 +502,11 @@ func RefreshAllDevices(engine *xorm.Engine) gin.HandlerFunc {
 }
 
 // refreshDeviceStatus queries device config and battery, updates database
-func refreshDeviceStatus(engine *xorm.Engine, device *models.Device) bool {
+func refreshDeviceStatus(ctx context.Context, engine *xorm.Engine, device *models.Device) bool {
 	client := phoneclient.NewClient(device)
 
 	// Query config to check if device is online
-	config, err := client.QueryConfig()
+	config, err := client.QueryConfig(ctx)
 	if err != nil {
 		// Device is offline
 		device.Status = "offline"
@@ -289,11 +519,13 @@ func refreshDeviceStatus(engine *xorm.Engine, device *models.Device) bool {
 	device.DeviceMark = config.ExtraDeviceMark
 	device.ExtraSim1 = config.ExtraSim1
 	device.ExtraSim2 = config.ExtraSim2
+	device.SimInfo = config.SimInfoJSON()
+	device.Capabilities = config.Capabilities()
 	device.LastSeen = time.Now()
 
 	// Query battery if enabled
 	if config.EnableAPIBatteryQuery {
-		battery, err := client.QueryBattery()
+		battery, err := client.QueryBattery(ctx)
 		if err == nil {
 			device.BatteryLevel = battery.Level
 			device.BatteryStatus = battery.Status
@@ -303,9 +535,192 @@ func refreshDeviceStatus(engine *xorm.Engine, device *models.Device) bool {
 
 	// Update device
 	engine.ID(device.ID).Cols(
-		"status", "device_mark", "extra_sim1", "extra_sim2", "last_seen",
+		"status", "device_mark", "extra_sim1", "extra_sim2", "sim_info", "capabilities", "last_seen",
 		"battery_level", "battery_status", "battery_plugged",
 	).Update(device)
 
 	return true
 }
+
+// ResetDeviceDataRequest is the body of POST /api/devices/:id/reset-data.
+type ResetDeviceDataRequest struct {
+	Confirm         bool `json:"confirm"`          // Must be true
+	IncludeContacts bool `json:"include_contacts"` // Also delete the device's contacts
+}
+
+// ResetDeviceData deletes every stored SMS and call of a device for good,
+// including soft-deleted ones, and optionally its contacts, e.g. after the
+// phone was factory reset. Nothing on the phone is touched. Refused with 409
+// while a sync of the device is running.
+func ResetDeviceData(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		device, err := getDevice(engine, c.Param("id"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		var req ResetDeviceDataRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		if !req.Confirm {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "this permanently deletes the device's SMS and calls; set confirm: true to proceed")
+			return
+		}
+		if len(services.SyncProgressOf(device.ID)) > 0 {
+			respondError(c, http.StatusConflict, CodeConflict, "a sync of this device is running; try again when it finishes")
+			return
+		}
+
+		counts, err := repository.NewDeviceRepository(engine).ResetData(device.ID, req.IncludeContacts)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		recordAudit(c, engine, models.AuditDeviceReset, "device", device.ID,
+			fmt.Sprintf("removed %d sms, %d calls, %d contacts", counts.Sms, counts.Calls, counts.Contacts))
+		c.JSON(http.StatusOK, gin.H{"removed": counts})
+	}
+}
+
+// pingTimeout bounds a ping, so an unreachable phone is reported quickly.
+const pingTimeout = 5 * time.Second
+
+// PingDevice checks whether the phone answers and how fast, with one config
+// query bounded by pingTimeout and no retries. Nothing is written to the
+// database, so it suits "test connection" buttons and uptime monitors.
+// reachable is false only when the phone could not be reached; a phone that
+// answers with an error (e.g. a wrong key) is reachable, with the phone error in error.
+func PingDevice(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		device, err := getDevice(engine, c.Param("id"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), pingTimeout)
+		defer cancel()
+		latency, err := phoneclient.NewClient(device).Ping(ctx)
+		body := gin.H{"reachable": true}
+		if err != nil {
+			body = phoneErrorBody(err)
+			body["reachable"] = !errors.Is(err, phoneclient.ErrPhoneUnreachable)
+		}
+		body["latency_ms"] = latency.Milliseconds()
+		c.JSON(http.StatusOK, body)
+	}
+}
+
+// TestDeviceRequest optionally overrides the saved connection settings so
+// new values can be checked before they are saved with UpdateDevice.
+type TestDeviceRequest struct {
+	PhoneAddr   *string `json:"phone_addr"`
+	SM4Key      *string `json:"sm4_key"`
+	SM4IV       *string `json:"sm4_iv"`
+	SignEnabled *bool   `json:"sign_enabled"`
+	SignSecret  *string `json:"sign_secret"`
+	Timeout     *int    `json:"timeout"`
+	ProxyURL    *string `json:"proxy_url"`
+	Insecure    *bool   `json:"insecure_skip_verify"`
+	TLSCert     *string `json:"tls_cert"`
+}
+
+// TestDevice calls the phone's /config/query and reports the decrypted config
+// and round-trip latency. Unlike QueryConfig it never writes to the database.
+func TestDevice(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		device, err := getDevice(engine, c.Param("id"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		// Body is optional; an empty body tests the saved settings
+		var req TestDeviceRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+				return
+			}
+		}
+		if req.PhoneAddr != nil {
+			addr, err := phoneclient.NormalizePhoneAddr(*req.PhoneAddr)
+			if err != nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+				return
+			}
+			device.PhoneAddr = addr
+		}
+		if req.SM4Key != nil {
+			if err := security.ValidateSM4Key(*req.SM4Key); err != nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+				return
+			}
+			device.SM4Key = *req.SM4Key
+		}
+		if req.SM4IV != nil {
+			if err := security.ValidateSM4IV(*req.SM4IV); err != nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+				return
+			}
+			device.SM4IV = *req.SM4IV
+		}
+		if req.SignEnabled != nil {
+			device.SignEnabled = *req.SignEnabled
+		}
+		if req.SignSecret != nil {
+			device.SignSecret = *req.SignSecret
+		}
+		if req.Timeout != nil {
+			if !isValidTimeout(*req.Timeout) {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Timeout must be 0 (default 30) or between 1 and 300 seconds")
+				return
+			}
+			device.Timeout = *req.Timeout
+		}
+		if req.ProxyURL != nil {
+			if err := phoneclient.ValidateProxyURL(*req.ProxyURL); err != nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+				return
+			}
+			device.ProxyURL = *req.ProxyURL
+		}
+		if req.Insecure != nil {
+			device.InsecureSkipVerify = *req.Insecure
+		}
+		if req.TLSCert != nil {
+			if err := phoneclient.ValidateCertPEM(*req.TLSCert); err != nil {
+				respondError(c, http.StatusBadRequest, CodeInvalidRequest, "tls_cert: "+err.Error())
+				return
+			}
+			device.TLSCert = *req.TLSCert
+		}
+
+		start := time.Now()
+		config, err := phoneclient.NewClient(device).QueryConfig(c.Request.Context())
+		latency := time.Since(start).Milliseconds()
+		if err != nil {
+			body := phoneErrorBody(err)
+			body["success"] = false
+			body["latency_ms"] = latency
+			c.JSON(http.StatusOK, body)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "config": config, "latency_ms": latency})
+	}
+}
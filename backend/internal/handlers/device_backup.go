@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// deviceBackupVersion is the format version written by ExportDevices.
+const deviceBackupVersion = 1
+
+// DeviceBackup is the body of GET /api/devices/export and POST /api/devices/import.
+type DeviceBackup struct {
+	Version        int                   `json:"version"`
+	ExportedAt     time.Time             `json:"exported_at"`
+	IncludeSecrets bool                  `json:"include_secrets"` // false = sm4_key and sign_secret are blank
+	Devices        []CreateDeviceRequest `json:"devices"`
+}
+
+// DeviceImportResult reports what happened to one imported device.
+type DeviceImportResult struct {
+	Name      string `json:"name"`
+	PhoneAddr string `json:"phone_addr"`
+	Status    string `json:"status"`          // created, skipped, failed
+	ID        int64  `json:"id,omitempty"`    // New device ID when created
+	Error     string `json:"error,omitempty"` // Why the device was skipped or failed
+}
+
+// ExportDevices returns the settings of every device for backup or migration
+// to another server. SM4 keys and signing secrets are only included with
+// include_secrets=true; the export is audited when they are.
+func ExportDevices(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		includeSecrets := c.Query("include_secrets") == "true"
+		var devices []models.Device
+		if err := engine.Asc("id").Find(&devices); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		backup := DeviceBackup{
+			Version:        deviceBackupVersion,
+			ExportedAt:     time.Now(),
+			IncludeSecrets: includeSecrets,
+			Devices:        make([]CreateDeviceRequest, len(devices)),
+		}
+		for i, d := range devices {
+			backup.Devices[i] = CreateDeviceRequest{
+				Name:               d.Name,
+				PhoneAddr:          d.PhoneAddr,
+				SM4IV:              d.SM4IV,
+				SignEnabled:        d.SignEnabled,
+				Remark:             d.Remark,
+				PollingInterval:    d.PollingInterval,
+				Timeout:            d.Timeout,
+				Tags:               d.Tags,
+				ProxyURL:           d.ProxyURL,
+				InsecureSkipVerify: d.InsecureSkipVerify,
+				TLSCert:            d.TLSCert,
+				SendLimitHour:      d.SendLimitHour,
+				SendLimitDay:       d.SendLimitDay,
+			}
+			if includeSecrets {
+				backup.Devices[i].SM4Key = d.SM4Key
+				backup.Devices[i].SignSecret = d.SignSecret
+			}
+		}
+		if includeSecrets {
+			recordAudit(c, engine, models.AuditDeviceExport, "device", 0,
+				fmt.Sprintf("%d devices with secrets", len(devices)))
+		}
+		c.Header("Content-Disposition", `attachment; filename="devices.json"`)
+		c.JSON(http.StatusOK, backup)
+	}
+}
+
+// ImportDevices creates the devices of a backup produced by ExportDevices.
+// Devices whose phone_addr already exists, on the server or earlier in the
+// same backup, are skipped. Each device is validated like POST /api/devices,
+// so a backup exported without secrets fails for lack of SM4 keys.
+func ImportDevices(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var backup DeviceBackup
+		if err := c.ShouldBindJSON(&backup); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		if backup.Version > deviceBackupVersion {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("unsupported backup version %d", backup.Version))
+			return
+		}
+
+		var existing []models.Device
+		if err := engine.Cols("phone_addr").Find(&existing); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		seen := make(map[string]bool, len(existing))
+		for _, d := range existing {
+			seen[normalizePhoneAddr(d.PhoneAddr)] = true
+		}
+
+		results := make([]DeviceImportResult, len(backup.Devices))
+		created, skipped := 0, 0
+		for i := range backup.Devices {
+			req := &backup.Devices[i]
+			req.Name = strings.TrimSpace(req.Name)
+			req.PhoneAddr = strings.TrimSpace(req.PhoneAddr)
+			result := DeviceImportResult{Name: req.Name, PhoneAddr: req.PhoneAddr}
+
+			key := normalizePhoneAddr(req.PhoneAddr)
+			if msg := req.validate(); msg != "" {
+				result.Status, result.Error = "failed", msg
+			} else if seen[key] {
+				result.Status, result.Error = "skipped", "a device with this phone_addr already exists"
+				skipped++
+			} else {
+				device := req.device()
+				if _, err := engine.Insert(&device); err != nil {
+					result.Status, result.Error = "failed", err.Error()
+				} else {
+					seen[key] = true
+					result.Status, result.ID = "created", device.ID
+					created++
+					recordAudit(c, engine, models.AuditDeviceCreate, "device", device.ID, device.Name+" (import)")
+				}
+			}
+			results[i] = result
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"results": results,
+			"created": created,
+			"skipped": skipped,
+			"failed":  len(results) - created - skipped,
+		})
+	}
+}
+
+// normalizePhoneAddr makes phone addresses that differ only in case or a
+// trailing slash compare equal.
+func normalizePhoneAddr(addr string) string {
+	return strings.ToLower(strings.TrimRight(strings.TrimSpace(addr), "/"))
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// exportFlushEvery controls how many rows are buffered before flushing to the client
+const exportFlushEvery = 200
+
+// formatMillis formats a millisecond timestamp as RFC3339 in local time
+func formatMillis(ms int64) string {
+	return time.UnixMilli(ms).In(time.Local).Format(time.RFC3339)
+}
+
+// jsonArrayStream writes a JSON array one element at a time
+type jsonArrayStream struct {
+	w     http.ResponseWriter
+	enc   *json.Encoder
+	count int
+}
+
+func newJSONArrayStream(w http.ResponseWriter) *jsonArrayStream {
+	w.Write([]byte("["))
+	return &jsonArrayStream{w: w, enc: json.NewEncoder(w)}
+}
+
+func (s *jsonArrayStream) Write(v interface{}) error {
+	if s.count > 0 {
+		if _, err := s.w.Write([]byte(",")); err != nil {
+			return err
+		}
+	}
+	s.count++
+	if err := s.enc.Encode(v); err != nil {
+		return err
+	}
+	if s.count%exportFlushEvery == 0 {
+		if f, ok := s.w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	return nil
+}
+
+func (s *jsonArrayStream) Close() {
+	s.w.Write([]byte("]"))
+}
+
+// setAttachment sets download headers for an export file
+func setAttachment(c *gin.Context, filename, contentType string) {
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+}
+
+// ExportSms streams all SMS of a device as CSV or JSON for backup.
+// Query params: format=csv|json (default csv), type=0|1|2
+func ExportSms(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.Param("id")
+		device, err := getDevice(engine, deviceID)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		format := c.DefaultQuery("format", "csv")
+		if format != "csv" && format != "json" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "format must be csv or json")
+			return
+		}
+		smsType, _ := strconv.Atoi(c.DefaultQuery("type", "0"))
+
+		repo := repository.NewSmsRepository(engine)
+		filename := fmt.Sprintf("sms_device_%d.%s", device.ID, format)
+
+		// Headers are sent before streaming; errors after this point can only be logged
+		if format == "json" {
+			setAttachment(c, filename, "application/json; charset=utf-8")
+			stream := newJSONArrayStream(c.Writer)
+			err = repo.IterateByDevice(device.ID, smsType, func(item *repository.SmsWithContactName) error {
+				return stream.Write(item)
+			})
+			stream.Close()
+		} else {
+			setAttachment(c, filename, "text/csv; charset=utf-8")
+			w := csv.NewWriter(c.Writer)
+			w.Write([]string{"address", "contact_name", "body", "type", "sim_id", "sms_time", "is_read"})
+			rows := 0
+			err = repo.IterateByDevice(device.ID, smsType, func(item *repository.SmsWithContactName) error {
+				if err := w.Write([]string{
+					item.Address,
+					item.ContactName,
+					item.Body,
+					strconv.Itoa(item.Type),
+					strconv.Itoa(item.SimID),
+					formatMillis(item.SmsTime),
+					strconv.FormatBool(item.IsRead),
+				}); err != nil {
+					return err
+				}
+				rows++
+				if rows%exportFlushEvery == 0 {
+					w.Flush()
+					c.Writer.Flush()
+				}
+				return w.Error()
+			})
+			w.Flush()
+		}
+		if err != nil {
+			log.Printf("[ExportSms] device %d export error: %v", device.ID, err)
+		}
+	}
+}
+
+// callTypeName returns a readable name for a call type
+func callTypeName(callType int) string {
+	switch callType {
+	case 1:
+		return "incoming"
+	case 2:
+		return "outgoing"
+	case 3:
+		return "missed"
+	}
+	return strconv.Itoa(callType)
+}
+
+// ExportCalls streams all call logs of a device as CSV or JSON for backup.
+// Query params: format=csv|json (default csv), type=0|1|2|3, from/to (unix millis, inclusive)
+func ExportCalls(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.Param("id")
+		device, err := getDevice(engine, deviceID)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		format := c.DefaultQuery("format", "csv")
+		if format != "csv" && format != "json" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "format must be csv or json")
+			return
+		}
+		callType, _ := strconv.Atoi(c.DefaultQuery("type", "0"))
+		from, err := strconv.ParseInt(c.DefaultQuery("from", "0"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "from must be a unix timestamp in milliseconds")
+			return
+		}
+		to, err := strconv.ParseInt(c.DefaultQuery("to", "0"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "to must be a unix timestamp in milliseconds")
+			return
+		}
+		if from > 0 && to > 0 && from > to {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "from must not be after to")
+			return
+		}
+
+		repo := repository.NewCallRepository(engine)
+		filename := fmt.Sprintf("calls_device_%d.%s", device.ID, format)
+
+		// Headers are sent before streaming; errors after this point can only be logged
+		if format == "json" {
+			setAttachment(c, filename, "application/json; charset=utf-8")
+			stream := newJSONArrayStream(c.Writer)
+			err = repo.IterateByDevice(device.ID, callType, from, to, func(item *repository.CallWithContactName) error {
+				return stream.Write(item)
+			})
+			stream.Close()
+		} else {
+			setAttachment(c, filename, "text/csv; charset=utf-8")
+			w := csv.NewWriter(c.Writer)
+			w.Write([]string{"number", "contact_name", "type", "duration", "sim_id", "call_time"})
+			rows := 0
+			err = repo.IterateByDevice(device.ID, callType, from, to, func(item *repository.CallWithContactName) error {
+				if err := w.Write([]string{
+					item.Number,
+					item.ContactName,
+					callTypeName(item.Type),
+					strconv.Itoa(item.Duration),
+					strconv.Itoa(item.SimID),
+					formatMillis(item.CallTime),
+				}); err != nil {
+					return err
+				}
+				rows++
+				if rows%exportFlushEvery == 0 {
+					w.Flush()
+					c.Writer.Flush()
+				}
+				return w.Error()
+			})
+			w.Flush()
+		}
+		if err != nil {
+			log.Printf("[ExportCalls] device %d export error: %v", device.ID, err)
+		}
+	}
+}
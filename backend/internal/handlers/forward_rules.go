@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/internal/models"
+	"backend/internal/repository"
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// ForwardRuleRequest is the body of POST/PUT /api/forward-rules.
+type ForwardRuleRequest struct {
+	DeviceID  int64  `json:"device_id"` // 0 = all devices
+	Name      string `json:"name"`
+	MatchType string `json:"match_type" binding:"required"` // sender, contains, regex, sim
+	Pattern   string `json:"pattern"`
+	TargetURL string `json:"target_url" binding:"required"`
+	Secret    string `json:"secret"`
+	Enabled   *bool  `json:"enabled"` // default true
+}
+
+// apply copies the request onto a rule and validates it, returning a
+// client-facing error message if the rule is invalid.
+func (req *ForwardRuleRequest) apply(engine *xorm.Engine, rule *models.ForwardRule) (string, error) {
+	rule.DeviceID = req.DeviceID
+	rule.Name = strings.TrimSpace(req.Name)
+	rule.MatchType = strings.TrimSpace(req.MatchType)
+	rule.Pattern = req.Pattern
+	rule.TargetURL = strings.TrimSpace(req.TargetURL)
+	rule.Secret = req.Secret
+	rule.Enabled = req.Enabled == nil || *req.Enabled
+
+	if err := services.ValidateForwardRule(rule); err != nil {
+		return err.Error(), nil
+	}
+	if rule.DeviceID != 0 {
+		exists, err := engine.ID(rule.DeviceID).Exist(&models.Device{})
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return "device not found", nil
+		}
+	}
+	return "", nil
+}
+
+// ListForwardRules returns all SMS forwarding rules.
+func ListForwardRules(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, err := repository.NewForwardRuleRepository(engine).FindAll()
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"items": rules})
+	}
+}
+
+// CreateForwardRule adds an SMS forwarding rule. Invalid match types, regex
+// patterns and target URLs are rejected with 400.
+func CreateForwardRule(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ForwardRuleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		var rule models.ForwardRule
+		msg, err := req.apply(engine, &rule)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if msg != "" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, msg)
+			return
+		}
+
+		if err := repository.NewForwardRuleRepository(engine).Insert(&rule); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusCreated, rule)
+	}
+}
+
+// UpdateForwardRule replaces an SMS forwarding rule.
+func UpdateForwardRule(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid rule id")
+			return
+		}
+		var req ForwardRuleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+
+		repo := repository.NewForwardRuleRepository(engine)
+		rule, err := repo.FindByID(id)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if rule == nil {
+			respondError(c, http.StatusNotFound, codeRuleNotFound, "rule not found")
+			return
+		}
+
+		msg, err := req.apply(engine, rule)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if msg != "" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, msg)
+			return
+		}
+
+		if err := repo.Update(rule); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// DeleteForwardRule removes an SMS forwarding rule.
+func DeleteForwardRule(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid rule id")
+			return
+		}
+
+		repo := repository.NewForwardRuleRepository(engine)
+		rule, err := repo.FindByID(id)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if rule == nil {
+			respondError(c, http.StatusNotFound, codeRuleNotFound, "rule not found")
+			return
+		}
+
+		if err := repo.Delete(id); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Rule deleted successfully"})
+	}
+}
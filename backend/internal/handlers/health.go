@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// Health reports whether the server can reach its database.
+// It stays cheap for load balancer probes: a single ping, no phone calls.
+func Health(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := engine.PingContext(c.Request.Context()); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "error", "database": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// DeviceHealth is one device's connectivity as last recorded by the poller.
+type DeviceHealth struct {
+	ID       int64     `json:"id"`
+	Name     string    `json:"name"`
+	Status   string    `json:"status"` // online, offline
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// DevicesHealth returns every device's last-seen time and online status from
+// the database, without contacting the phones.
+func DevicesHealth(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var devices []models.Device
+		if err := engine.Cols("id", "name", "status", "last_seen").Asc("id").Find(&devices); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		items := make([]DeviceHealth, 0, len(devices))
+		online := 0
+		for _, d := range devices {
+			if d.Status == "online" {
+				online++
+			}
+			items = append(items, DeviceHealth{ID: d.ID, Name: d.Name, Status: d.Status, LastSeen: d.LastSeen})
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"items":   items,
+			"total":   len(items),
+			"online":  online,
+			"offline": len(items) - online,
+		})
+	}
+}
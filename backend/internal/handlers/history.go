@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// maxBatteryHistoryHours caps the battery history window (one year)
+const maxBatteryHistoryHours = 24 * 365
+
+// BatteryHistory returns battery readings of a device for the last N hours, oldest first.
+// Query params: hours (default 24, max 8760)
+func BatteryHistory(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.Param("id")
+		device, err := getDevice(engine, deviceID)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+		if err != nil || hours < 1 || hours > maxBatteryHistoryHours {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "hours must be between 1 and 8760")
+			return
+		}
+
+		since := time.Now().Add(-time.Duration(hours) * time.Hour)
+		items, err := repository.NewBatteryHistoryRepository(engine).FindSince(device.ID, since)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"items": items})
+	}
+}
+
+// LocationHistory returns the recorded location fixes of a device, oldest first,
+// so the track can be drawn on a map.
+// Query params: from/to (unix millis, inclusive, optional)
+func LocationHistory(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.Param("id")
+		device, err := getDevice(engine, deviceID)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		fromMs, err := strconv.ParseInt(c.DefaultQuery("from", "0"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "from must be a unix timestamp in milliseconds")
+			return
+		}
+		toMs, err := strconv.ParseInt(c.DefaultQuery("to", "0"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "to must be a unix timestamp in milliseconds")
+			return
+		}
+		if fromMs > 0 && toMs > 0 && fromMs > toMs {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "from must not be after to")
+			return
+		}
+
+		var from, to time.Time
+		if fromMs > 0 {
+			from = time.UnixMilli(fromMs)
+		}
+		if toMs > 0 {
+			to = time.UnixMilli(toMs)
+		}
+
+		items, err := repository.NewLocationHistoryRepository(engine).FindRange(device.ID, from, to)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"items": items})
+	}
+}
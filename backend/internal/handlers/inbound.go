@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/internal/phoneclient"
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// maxPushBody bounds inbound push bodies; MMS attachments make them larger
+// than a plain SMS.
+const maxPushBody = 1 << 20
+
+// ReceivePushedSms stores an SMS the phone pushed as it arrived, so it shows
+// up without waiting for a sync. The route takes no JWT: the body must be
+// SM4-encrypted with the device's key, and signed if the device has a signing
+// secret. Messages already stored are acknowledged without being stored again,
+// so the phone can safely retry.
+func ReceivePushedSms(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		device, err := getDevice(engine, c.Param("id"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+			return
+		}
+		if device == nil {
+			respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPushBody))
+		if err != nil {
+			respondError(c, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "push body too large")
+			return
+		}
+		item, err := phoneclient.DecodePush(device, string(body), time.Now())
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "inbound push rejected", "operation", "inbound_sms", "device_id", device.ID, "error", err)
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "push could not be verified with the device key")
+			return
+		}
+		item.Number = strings.TrimSpace(item.Number)
+		if item.Number == "" || item.Content == "" && len(item.Attachments) == 0 {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "number and content are required")
+			return
+		}
+		if item.Type != 1 && item.Type != 2 {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "type must be 1 (received) or 2 (sent)")
+			return
+		}
+
+		result, err := services.NewSyncService(engine).ReceiveSms(c.Request.Context(), device, *item)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"new_count": result.NewCount, "updated_count": result.UpdatedCount, "blocked": result.Blocked})
+	}
+}
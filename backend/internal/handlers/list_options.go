@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseTimeParam reads a query param given as unix milliseconds or RFC3339.
+// An absent param yields 0 (unbounded).
+func parseTimeParam(c *gin.Context, name string) (int64, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ms, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be unix milliseconds or an RFC3339 time", name)
+	}
+	return t.UnixMilli(), nil
+}
+
+// parseListOptions reads the optional from/to range, sim_id slot and sort/sort_by
+// order shared by the SMS and call list endpoints. sort_by must be a key of
+// sortColumns. The returned error is meant for the client (400).
+func parseListOptions(c *gin.Context, sortColumns map[string]string) (repository.ListOptions, error) {
+	var opts repository.ListOptions
+	var err error
+	switch c.DefaultQuery("sort", "desc") {
+	case "desc":
+	case "asc":
+		opts.Ascending = true
+	default:
+		return opts, fmt.Errorf("sort must be asc or desc")
+	}
+	opts.SortBy = c.DefaultQuery("sort_by", "time")
+	if _, ok := sortColumns[opts.SortBy]; !ok {
+		return opts, fmt.Errorf("sort_by must be one of %s", strings.Join(sortKeys(sortColumns), ", "))
+	}
+	if opts.From, err = parseTimeParam(c, "from"); err != nil {
+		return opts, err
+	}
+	if opts.To, err = parseTimeParam(c, "to"); err != nil {
+		return opts, err
+	}
+	if opts.From > 0 && opts.To > 0 && opts.From > opts.To {
+		return opts, fmt.Errorf("from must not be after to")
+	}
+	if raw := c.Query("sim_id"); raw != "" {
+		// -1 is a real stored value (phone didn't report a slot), not "any"
+		simID, err := strconv.Atoi(raw)
+		if err != nil || simID < -1 || simID > 1 {
+			return opts, fmt.Errorf("sim_id must be 0 (SIM1), 1 (SIM2) or -1 (unknown)")
+		}
+		opts.SimID = &simID
+	}
+	return opts, nil
+}
+
+// sortKeys returns the accepted sort_by values in a stable order for error messages.
+func sortKeys(sortColumns map[string]string) []string {
+	keys := make([]string, 0, len(sortColumns))
+	for key := range sortColumns {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
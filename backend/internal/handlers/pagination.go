@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page size bounds for list endpoints. maxPageSize keeps a single request
+// from loading a whole table.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 200
+)
+
+// pageParams is a parsed page_num/page_size pair.
+type pageParams struct {
+	Num  int
+	Size int
+}
+
+// parsePage reads page_num (default 1) and page_size (default 20, max 200).
+// Out-of-range values are clamped rather than rejected.
+func parsePage(c *gin.Context) pageParams {
+	num, _ := strconv.Atoi(c.DefaultQuery("page_num", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)))
+	if num < 1 {
+		num = 1
+	}
+	if size < 1 {
+		size = defaultPageSize
+	}
+	if size > maxPageSize {
+		size = maxPageSize
+	}
+	return pageParams{Num: num, Size: size}
+}
+
+// body builds the standard paginated response. Callers may add extra keys.
+func (p pageParams) body(items interface{}, total int64) gin.H {
+	totalPages := (total + int64(p.Size) - 1) / int64(p.Size)
+	return gin.H{
+		"items":       items,
+		"total":       total,
+		"page":        p.Num,
+		"size":        p.Size,
+		"total_pages": totalPages,
+		"has_next":    int64(p.Num) < totalPages,
+	}
+}
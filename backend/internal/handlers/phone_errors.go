@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// Machine-readable codes for failed phone calls, returned as "code" so the UI
+// can show an actionable message.
+const (
+	codePhoneFeatureDisabled = "phone_feature_disabled"
+	codePhoneAuth            = "phone_auth_failed"
+	codePhoneDecrypt         = "phone_decrypt_failed"
+	codePhoneUnreachable     = "phone_unreachable"
+	codePhoneRejected        = "phone_error"
+)
+
+// classifyPhoneError maps a phone client error to an HTTP status and code.
+// Errors that didn't come from the phone are a 500 with no code.
+func classifyPhoneError(err error) (int, string) {
+	switch {
+	case errors.Is(err, phoneclient.ErrPhoneFeatureDisabled):
+		return http.StatusConflict, codePhoneFeatureDisabled
+	case errors.Is(err, phoneclient.ErrPhoneAuth):
+		return http.StatusBadGateway, codePhoneAuth
+	case errors.Is(err, phoneclient.ErrPhoneDecrypt):
+		return http.StatusBadGateway, codePhoneDecrypt
+	case errors.Is(err, phoneclient.ErrPhoneUnreachable):
+		return http.StatusBadGateway, codePhoneUnreachable
+	case errors.Is(err, phoneclient.ErrPhoneRejected):
+		return http.StatusBadGateway, codePhoneRejected
+	}
+	return http.StatusInternalServerError, ""
+}
+
+// phoneErrorHints suggest a fix for failures caused by device settings.
+var phoneErrorHints = map[string]string{
+	codePhoneDecrypt: "Check that the device's SM4 key and IV match the ones set in SmsForwarder",
+	codePhoneAuth:    "Check the sign secret and that the server and phone clocks agree",
+}
+
+// phoneErrorBody builds the JSON error for a failed phone call, including the
+// phone's own business code when it returned one.
+func phoneErrorBody(err error) gin.H {
+	_, code := classifyPhoneError(err)
+	details := gin.H{}
+	if code == "" {
+		code = CodeInternal
+	} else if hint, ok := phoneErrorHints[code]; ok {
+		details["hint"] = hint
+	}
+	var pe *phoneclient.PhoneError
+	if errors.As(err, &pe) && pe.Code != 0 {
+		details["phone_code"] = pe.Code
+	}
+	return ErrorBody(code, err.Error(), details)
+}
+
+// respondPhoneError writes the response for a failed phone call.
+func respondPhoneError(c *gin.Context, err error) {
+	status, _ := classifyPhoneError(err)
+	c.JSON(status, phoneErrorBody(err))
+}
+
+// featureSettings names the SmsForwarder setting that turns on each capability.
+var featureSettings = map[string]string{
+	models.CapabilitySmsSend:    "enable_api_sms_send",
+	models.CapabilityContactAdd: "enable_api_contact_add",
+	models.CapabilityWol:        "enable_api_wol",
+	models.CapabilityLocation:   "enable_api_location",
+}
+
+// rejectDisabledFeature responds 409 and returns true if the device's
+// capabilities show the feature is turned off in SmsForwarder, so known
+// failures don't cost a round-trip to the phone. Capabilities that were never
+// stored are fetched with a config query first; if that fails the caller goes
+// on and the phone reports the real error.
+func rejectDisabledFeature(c *gin.Context, engine *xorm.Engine, device *models.Device, capability string) bool {
+	if device.Capabilities == nil {
+		refreshCapabilities(c.Request.Context(), engine, device)
+	}
+	if !device.Capabilities.Disabled(capability) {
+		return false
+	}
+	setting := featureSettings[capability]
+	respondError(c, http.StatusConflict, codePhoneFeatureDisabled,
+		fmt.Sprintf("feature not enabled on phone: %s; turn on %s in SmsForwarder", capability, setting),
+		gin.H{"capability": capability, "setting": setting})
+	return true
+}
+
+// refreshCapabilities queries the phone's config and stores its capabilities.
+func refreshCapabilities(ctx context.Context, engine *xorm.Engine, device *models.Device) {
+	config, err := phoneclient.NewClient(device).QueryConfig(ctx)
+	if err != nil {
+		return
+	}
+	device.Capabilities = config.Capabilities()
+	engine.ID(device.ID).Cols("capabilities").Update(device)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+)
+
+// SearchResult is a single type-tagged hit of the global search.
+// Time is the SMS/call timestamp in milliseconds (0 for contacts).
+type SearchResult struct {
+	Kind       string      `json:"kind"` // sms, call, contact
+	DeviceID   int64       `json:"device_id"`
+	DeviceName string      `json:"device_name"`
+	Time       int64       `json:"time,omitempty"`
+	Item       interface{} `json:"item"`
+}
+
+// Search runs a keyword against SMS, call logs and contacts of all devices.
+// Query params: q (required), limit (per category, default 10, max 50)
+// Contacts come first, followed by SMS and calls merged newest first.
+// "totals" reports the full match count per category, which may exceed limit.
+func Search(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := strings.TrimSpace(c.Query("q"))
+		if q == "" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "q is required")
+			return
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSearchLimit)))
+		if limit <= 0 {
+			limit = defaultSearchLimit
+		}
+		if limit > maxSearchLimit {
+			limit = maxSearchLimit
+		}
+
+		contacts, contactTotal, err := repository.NewContactRepository(engine).Search(q, limit)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		// Archived conversations stay searchable
+		smsOpts := repository.ListOptions{IncludeArchived: true}
+		smsItems, smsTotal, err := repository.NewSmsRepository(engine).FindAll(0, 1, limit, q, 0, nil, smsOpts)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		callItems, callTotal, err := repository.NewCallRepository(engine).FindAll(0, 1, limit, q, 0, nil, repository.ListOptions{})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		results := make([]SearchResult, 0, len(contacts)+len(smsItems)+len(callItems))
+		for i := range contacts {
+			results = append(results, SearchResult{
+				Kind:       "contact",
+				DeviceID:   contacts[i].DeviceID,
+				DeviceName: contacts[i].DeviceName,
+				Item:       contacts[i],
+			})
+		}
+
+		timed := make([]SearchResult, 0, len(smsItems)+len(callItems))
+		for i := range smsItems {
+			timed = append(timed, SearchResult{
+				Kind:       "sms",
+				DeviceID:   smsItems[i].DeviceID,
+				DeviceName: smsItems[i].DeviceName,
+				Time:       smsItems[i].SmsTime,
+				Item:       smsItems[i],
+			})
+		}
+		for i := range callItems {
+			timed = append(timed, SearchResult{
+				Kind:       "call",
+				DeviceID:   callItems[i].DeviceID,
+				DeviceName: callItems[i].DeviceName,
+				Time:       callItems[i].CallTime,
+				Item:       callItems[i],
+			})
+		}
+		sort.SliceStable(timed, func(i, j int) bool { return timed[i].Time > timed[j].Time })
+		results = append(results, timed...)
+
+		c.JSON(http.StatusOK, gin.H{
+			"items": results,
+			"totals": gin.H{
+				"sms":     smsTotal,
+				"call":    callTotal,
+				"contact": contactTotal,
+			},
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quotaWindow is one rolling window of a device's send quota.
+type quotaWindow struct {
+	name   string // hour or day
+	header string // Suffix of the X-Quota-* headers
+	length time.Duration
+	limit  func(*models.Device) int
+}
+
+var quotaWindows = []*quotaWindow{
+	{"hour", "Hour", time.Hour, func(d *models.Device) int { return d.SendLimitHour }},
+	{"day", "Day", 24 * time.Hour, func(d *models.Device) int { return d.SendLimitDay }},
+}
+
+// SendQuota counts the SMS sent through each device over the last day, to
+// enforce Device.SendLimitHour and SendLimitDay. Counts are kept in memory
+// and start over when the server restarts.
+type SendQuota struct {
+	now func() time.Time
+
+	mu   sync.Mutex
+	sent map[int64][]time.Time // Send times per device, ascending
+}
+
+// NewSendQuota returns an empty SendQuota; share one between every handler
+// that sends SMS.
+func NewSendQuota() *SendQuota {
+	return &SendQuota{now: time.Now, sent: make(map[int64][]time.Time)}
+}
+
+// quotaUsage is a device's use of one limited window.
+type quotaUsage struct {
+	window    *quotaWindow
+	limit     int
+	remaining int
+	resetAt   time.Time // When the oldest counted send leaves the window, freeing room
+}
+
+// take counts n sends through device if every limited window has room for
+// them, and returns the usage of each limited window. Otherwise nothing is
+// counted and it returns the first full window as full, whose resetAt is when
+// there will be room for n sends.
+func (q *SendQuota) take(device *models.Device, n int) (usage []quotaUsage, full *quotaUsage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	times := pruneSends(q.sent[device.ID], now.Add(-24*time.Hour))
+	for _, w := range quotaWindows {
+		limit := w.limit(device)
+		if limit <= 0 {
+			continue
+		}
+		inWindow := pruneSends(times, now.Add(-w.length))
+		if used := len(inWindow); used+n > limit {
+			// Room opens once the oldest used+n-limit sends leave the window
+			resetAt := now.Add(w.length)
+			if i := used + n - limit - 1; i < used {
+				resetAt = inWindow[i].Add(w.length)
+			}
+			q.sent[device.ID] = times
+			return nil, &quotaUsage{window: w, limit: limit, remaining: max(limit-used, 0), resetAt: resetAt}
+		}
+	}
+
+	for range n {
+		times = append(times, now)
+	}
+	q.sent[device.ID] = times
+	for _, w := range quotaWindows {
+		if limit := w.limit(device); limit > 0 {
+			inWindow := pruneSends(times, now.Add(-w.length))
+			usage = append(usage, quotaUsage{
+				window:    w,
+				limit:     limit,
+				remaining: max(limit-len(inWindow), 0),
+				resetAt:   inWindow[0].Add(w.length),
+			})
+		}
+	}
+	return usage, nil
+}
+
+// refund uncounts n sends that take counted but the phone didn't make.
+func (q *SendQuota) refund(deviceID int64, n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	times := q.sent[deviceID]
+	q.sent[deviceID] = times[:max(len(times)-n, 0)]
+}
+
+// pruneSends drops send times older than cutoff; times are in ascending order.
+func pruneSends(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// takeSendQuota counts n sends through device and sets the X-Quota-Limit-,
+// X-Quota-Remaining- and X-Quota-Reset- headers of each limited window
+// (reset as Unix seconds). If a quota is exhausted it responds 429 with the
+// window's reset time and returns false.
+func takeSendQuota(c *gin.Context, quota *SendQuota, device *models.Device, n int) bool {
+	usage, full := quota.take(device, n)
+	if full != nil {
+		setQuotaHeaders(c, *full)
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(full.resetAt).Seconds()+0.5)))
+		respondError(c, http.StatusTooManyRequests, codeSendQuotaExceeded,
+			fmt.Sprintf("send quota of %d SMS per %s exceeded for this device", full.limit, full.window.name), gin.H{
+				"window":    full.window.name,
+				"limit":     full.limit,
+				"remaining": full.remaining,
+				"reset_at":  full.resetAt,
+			})
+		return false
+	}
+	for _, u := range usage {
+		setQuotaHeaders(c, u)
+	}
+	return true
+}
+
+func setQuotaHeaders(c *gin.Context, u quotaUsage) {
+	c.Header("X-Quota-Limit-"+u.window.header, strconv.Itoa(u.limit))
+	c.Header("X-Quota-Remaining-"+u.window.header, strconv.Itoa(u.remaining))
+	c.Header("X-Quota-Reset-"+u.window.header, strconv.FormatInt(u.resetAt.Unix(), 10))
+}
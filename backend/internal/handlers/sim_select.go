@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+	"backend/internal/repository"
+)
+
+// How an automatic SIM slot was chosen, reported as sim_auto.
+const (
+	simAutoOnlySim   = "only_sim"   // The phone reports a single SIM card
+	simAutoLastUsed  = "last_used"  // The newest message with the recipient went through it
+	simAutoHasNumber = "has_number" // The only SIM card that reports its own number
+)
+
+// autoSimSlot picks the SIM slot (1 or 2) to send to numbers from when the
+// request leaves it to the server, using the SIM cards stored from the
+// device's last status refresh and the stored messages:
+//  1. the only SIM card, if the phone reports exactly one;
+//  2. the slot of the newest message to or from any recipient, if that SIM
+//     is still installed (or the phone reports no SIM cards);
+//  3. the only SIM card that reports its own number.
+//
+// Returns 0 if none applies, and how the slot was chosen otherwise.
+func autoSimSlot(repo *repository.SmsRepository, device *models.Device, numbers []string) (int, string, error) {
+	sims := phoneclient.ParseSimInfo(device.SimInfo)
+	if len(sims) == 1 {
+		return sims[0].Slot, simAutoOnlySim, nil
+	}
+	installed := func(slot int) bool {
+		if len(sims) == 0 {
+			return slot == 1 || slot == 2
+		}
+		for _, sim := range sims {
+			if sim.Slot == slot {
+				return true
+			}
+		}
+		return false
+	}
+
+	simID, err := repo.LatestSimID(device.ID, numbers)
+	if err != nil {
+		return 0, "", err
+	}
+	if slot := simID + 1; simID >= 0 && installed(slot) {
+		return slot, simAutoLastUsed, nil
+	}
+
+	withNumber := 0
+	for _, sim := range sims {
+		if sim.Number != "" {
+			if withNumber != 0 {
+				return 0, "", nil
+			}
+			withNumber = sim.Slot
+		}
+	}
+	if withNumber != 0 {
+		return withNumber, simAutoHasNumber, nil
+	}
+	return 0, "", nil
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// Default and maximum number of devices in the stats top_devices list
+const (
+	defaultStatsTop = 5
+	maxStatsTop     = 50
+)
+
+// Stats returns dashboard totals in one call: devices by status, SMS by type,
+// calls by type, contacts, unread counts, the devices with the most SMS and
+// SMS/call counts per SIM slot of each device.
+// Every figure comes from a COUNT/GROUP BY query; no rows are loaded.
+// Query params: device_id (optional, scopes everything to one device),
+// top (size of top_devices, default 5, max 50)
+func Stats(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		device, ok := statsDevice(c, engine)
+		if !ok {
+			return
+		}
+		var deviceID int64
+		if device != nil {
+			deviceID = device.ID
+		}
+		top, _ := strconv.Atoi(c.DefaultQuery("top", strconv.Itoa(defaultStatsTop)))
+		if top < 1 {
+			top = defaultStatsTop
+		}
+		if top > maxStatsTop {
+			top = maxStatsTop
+		}
+
+		devices, err := deviceStats(engine, device)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		smsRepo := repository.NewSmsRepository(engine)
+		smsByType, err := smsRepo.CountByType(deviceID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		smsUnread, err := smsRepo.CountUnread(0, deviceID, nil)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		callRepo := repository.NewCallRepository(engine)
+		callsByType, err := callRepo.CountByType(deviceID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		callsUnread, err := callRepo.CountUnread(0, deviceID, nil)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		contacts, err := repository.NewContactRepository(engine).CountVisible(deviceID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		sims, err := simStats(smsRepo, callRepo, deviceID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		var topDevices []repository.DeviceCount
+		if device != nil {
+			topDevices = []repository.DeviceCount{{DeviceID: device.ID, DeviceName: device.Name, Count: sumCounts(smsByType)}}
+		} else if topDevices, err = smsRepo.TopDevices(top); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"devices": devices,
+			"sms": gin.H{
+				"total":    sumCounts(smsByType),
+				"received": smsByType[1],
+				"sent":     smsByType[2],
+				"unread":   smsUnread,
+			},
+			"calls": gin.H{
+				"total":    sumCounts(callsByType),
+				"incoming": callsByType[1],
+				"outgoing": callsByType[2],
+				"missed":   callsByType[3],
+				"unread":   callsUnread,
+			},
+			"contacts":    contacts,
+			"top_devices": topDevices,
+			"sims":        sims,
+		})
+	}
+}
+
+// statsDevice returns the device named by the optional device_id query param,
+// or nil if there is none. On a bad or unknown ID it responds and returns false.
+func statsDevice(c *gin.Context, engine *xorm.Engine) (*models.Device, bool) {
+	raw := c.Query("device_id")
+	if raw == "" {
+		return nil, true
+	}
+	device, err := getDevice(engine, raw)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid device id")
+		return nil, false
+	}
+	if device == nil {
+		respondError(c, http.StatusNotFound, codeDeviceNotFound, "device not found")
+		return nil, false
+	}
+	return device, true
+}
+
+// Default and maximum number of days in the stats timeline, today included
+const (
+	defaultTimelineDays = 30
+	maxTimelineDays     = 366
+)
+
+// StatsTimeline returns SMS or call counts per day for charting, oldest first,
+// with a row for every day of the range (zeros when there was nothing).
+// Days follow the engine's TZLocation. SMS rows carry received and sent, call
+// rows incoming, outgoing and missed. The counts come from one GROUP BY query.
+// Query params: kind (sms or call, default sms), device_id (optional),
+// days (default 30, max 366)
+func StatsTimeline(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kind := c.DefaultQuery("kind", "sms")
+		if kind != "sms" && kind != "call" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "kind must be sms or call")
+			return
+		}
+		device, ok := statsDevice(c, engine)
+		if !ok {
+			return
+		}
+		var deviceID int64
+		if device != nil {
+			deviceID = device.ID
+		}
+		days, _ := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(defaultTimelineDays)))
+		if days < 1 {
+			days = defaultTimelineDays
+		}
+		if days > maxTimelineDays {
+			days = maxTimelineDays
+		}
+
+		now := time.Now().In(engine.TZLocation)
+		since := time.Date(now.Year(), now.Month(), now.Day()-(days-1), 0, 0, 0, 0, now.Location())
+		var counts []repository.DayCount
+		var err error
+		if kind == "sms" {
+			counts, err = repository.NewSmsRepository(engine).CountByDay(deviceID, since)
+		} else {
+			counts, err = repository.NewCallRepository(engine).CountByDay(deviceID, since)
+		}
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+
+		// SMS types 1=received, 2=sent; call types 1=incoming, 2=outgoing, 3=missed
+		fields := map[int]string{1: "received", 2: "sent"}
+		if kind == "call" {
+			fields = map[int]string{1: "incoming", 2: "outgoing", 3: "missed"}
+		}
+		items := make([]gin.H, days)
+		byDate := make(map[string]gin.H, days)
+		for i := range items {
+			date := since.AddDate(0, 0, i).Format("2006-01-02")
+			items[i] = gin.H{"date": date}
+			for _, field := range fields {
+				items[i][field] = int64(0)
+			}
+			byDate[date] = items[i]
+		}
+		for _, dc := range counts {
+			if item, field := byDate[dc.Date], fields[dc.Type]; item != nil && field != "" {
+				item[field] = dc.Count
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"kind": kind, "days": days, "items": items})
+	}
+}
+
+// deviceStats counts devices by status, or reports just the scoped device.
+func deviceStats(engine *xorm.Engine, device *models.Device) (gin.H, error) {
+	var total, online int64
+	if device != nil {
+		total = 1
+		if device.Status == "online" {
+			online = 1
+		}
+	} else {
+		byStatus, err := repository.NewDeviceRepository(engine).CountByStatus()
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range byStatus {
+			total += n
+		}
+		online = byStatus["online"]
+	}
+	return gin.H{"total": total, "online": online, "offline": total - online}, nil
+}
+
+// SimStats is the SMS and call count of one SIM slot of a device.
+type SimStats struct {
+	DeviceID int64  `json:"device_id"`
+	SimID    int    `json:"sim_id"` // 0=SIM1, 1=SIM2, -1=unknown
+	Sim      string `json:"sim"`    // SIM1, SIM2, unknown
+	Sms      int64  `json:"sms"`
+	Calls    int64  `json:"calls"`
+}
+
+// simLabel names a stored SIM slot. -1 means the phone didn't report one.
+func simLabel(simID int) string {
+	if simID < 0 {
+		return "unknown"
+	}
+	return "SIM" + strconv.Itoa(simID+1)
+}
+
+// simStats merges the per-SIM SMS and call counts into one row per device and slot.
+func simStats(smsRepo *repository.SmsRepository, callRepo *repository.CallRepository, deviceID int64) ([]SimStats, error) {
+	smsCounts, err := smsRepo.CountBySim(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	callCounts, err := callRepo.CountBySim(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	type simKey struct {
+		deviceID int64
+		simID    int
+	}
+	byKey := make(map[simKey]*SimStats)
+	row := func(deviceID int64, simID int) *SimStats {
+		key := simKey{deviceID, simID}
+		if byKey[key] == nil {
+			byKey[key] = &SimStats{DeviceID: deviceID, SimID: simID, Sim: simLabel(simID)}
+		}
+		return byKey[key]
+	}
+	for _, sc := range smsCounts {
+		row(sc.DeviceID, sc.SimID).Sms = sc.Count
+	}
+	for _, cc := range callCounts {
+		row(cc.DeviceID, cc.SimID).Calls = cc.Count
+	}
+	items := make([]SimStats, 0, len(byKey))
+	for _, s := range byKey {
+		items = append(items, *s)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].DeviceID != items[j].DeviceID {
+			return items[i].DeviceID < items[j].DeviceID
+		}
+		return items[i].SimID < items[j].SimID
+	})
+	return items, nil
+}
+
+// sumCounts adds up the values of a per-group count map.
+func sumCounts(counts map[int]int64) int64 {
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
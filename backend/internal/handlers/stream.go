@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamHeartbeat keeps idle SSE connections from being closed by proxies
+const streamHeartbeat = 30 * time.Second
+
+// Stream pushes newly synced SMS and calls to the client as Server-Sent Events.
+// Each event is named after its kind ("sms" or "call") and carries a services.Event.
+// The subscription is released when the client disconnects.
+func Stream() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		events, unsubscribe := services.SubscribeEvents()
+		defer unsubscribe()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no") // Disable nginx response buffering
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		// Send headers right away so EventSource reports the connection as open
+		c.Writer.WriteHeader(http.StatusOK)
+		c.Writer.Flush()
+
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case ev, ok := <-events:
+				if !ok {
+					return false
+				}
+				c.SSEvent(ev.Kind, ev)
+				return true
+			case <-heartbeat.C:
+				io.WriteString(w, ": ping\n\n")
+				return true
+			case <-c.Request.Context().Done():
+				return false
+			}
+		})
+	}
+}
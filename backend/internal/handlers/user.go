@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 
+	"backend/config"
 	"backend/internal/models"
 	"backend/internal/security"
 
@@ -17,65 +20,218 @@ func Profile(engine *xorm.Engine) gin.HandlerFunc {
 		claims, _ := c.Get("claims")
 		userClaims, ok := claims.(*jwt.MapClaims)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid claims"})
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid claims")
 			return
 		}
 		idFloat, ok := (*userClaims)["sub"].(float64)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid claims"})
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid claims")
 			return
 		}
 		var user models.User
 		if _, err := engine.ID(int64(idFloat)).Get(&user); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"id": user.ID, "username": user.Username})
+		c.JSON(http.StatusOK, gin.H{"id": user.ID, "username": user.Username, "role": user.Role})
 	}
 }
 
-// UpdatePassword lets authenticated user change password.
-func UpdatePassword(engine *xorm.Engine) gin.HandlerFunc {
-	type req struct {
-		Old string `json:"old"`
-		New string `json:"new"`
-	}
+// UpdatePasswordRequest is the body of POST /api/users/password.
+type UpdatePasswordRequest struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// UpdatePassword lets authenticated user change password. The new password
+// must satisfy the configured password policy.
+func UpdatePassword(cfg *config.Config, engine *xorm.Engine) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		claims, _ := c.Get("claims")
 		userClaims, ok := claims.(*jwt.MapClaims)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid claims"})
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid claims")
 			return
 		}
 		idFloat, ok := (*userClaims)["sub"].(float64)
 		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid claims"})
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid claims")
 			return
 		}
-		var body req
+		var body UpdatePasswordRequest
 		if err := c.ShouldBindJSON(&body); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
 			return
 		}
 		var user models.User
 		if _, err := engine.ID(int64(idFloat)).Get(&user); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 		if !security.CheckPassword(user.Password, body.Old) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "旧密码错误"})
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "旧密码错误")
+			return
+		}
+		if rejectWeakPassword(c, cfg, body.New) {
 			return
 		}
 		hash, err := security.HashPassword(body.New)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 		user.Password = hash
 		if _, err := engine.ID(user.ID).Cols("password").Update(&user); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
 			return
 		}
 		c.Status(http.StatusOK)
 	}
 }
+
+// rejectWeakPassword responds 400 with the failed rules and returns true if
+// password doesn't satisfy the configured password policy.
+func rejectWeakPassword(c *gin.Context, cfg *config.Config, password string) bool {
+	failed := security.ValidatePassword(cfg.Security.PasswordPolicy, password)
+	if len(failed) == 0 {
+		return false
+	}
+	respondError(c, http.StatusBadRequest, codeWeakPassword, "password does not meet the policy: "+strings.Join(failed, ", "),
+		gin.H{"failed_rules": failed})
+	return true
+}
+
+// currentUserID returns the user ID from the JWT claims set by AuthMiddleware.
+func currentUserID(c *gin.Context) (int64, bool) {
+	claims, _ := c.Get("claims")
+	userClaims, ok := claims.(*jwt.MapClaims)
+	if !ok {
+		return 0, false
+	}
+	idFloat, ok := (*userClaims)["sub"].(float64)
+	if !ok {
+		return 0, false
+	}
+	return int64(idFloat), true
+}
+
+// ListUsers returns all panel users.
+func ListUsers(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var users []models.User
+		if err := engine.Asc("id").Find(&users); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"items": users})
+	}
+}
+
+// CreateUserRequest is the body of POST /api/users.
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role"` // admin or viewer (default viewer)
+}
+
+// CreateUser adds a panel user with a bcrypt-hashed password.
+// New users are read-only viewers unless role is "admin", and the password
+// must satisfy the configured password policy.
+func CreateUser(cfg *config.Config, engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		req.Username = strings.TrimSpace(req.Username)
+		if req.Username == "" {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "username is required")
+			return
+		}
+
+		if req.Role == "" {
+			req.Role = models.RoleViewer
+		}
+		if req.Role != models.RoleAdmin && req.Role != models.RoleViewer {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "role must be admin or viewer")
+			return
+		}
+		if rejectWeakPassword(c, cfg, req.Password) {
+			return
+		}
+
+		exists, err := engine.Where("username = ?", req.Username).Exist(&models.User{})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if exists {
+			respondError(c, http.StatusConflict, CodeConflict, "username already exists")
+			return
+		}
+
+		hash, err := security.HashPassword(req.Password)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		user := models.User{Username: req.Username, Password: hash, Role: req.Role}
+		if _, err := engine.Insert(&user); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusCreated, user)
+	}
+}
+
+// DeleteUser removes a panel user. Users can't delete themselves, and the last
+// remaining user can't be deleted so the panel never locks everyone out.
+func DeleteUser(engine *xorm.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidID, "invalid user id")
+			return
+		}
+		selfID, ok := currentUserID(c)
+		if !ok {
+			respondError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid claims")
+			return
+		}
+		if id == selfID {
+			respondError(c, http.StatusConflict, CodeConflict, "cannot delete yourself")
+			return
+		}
+
+		exists, err := engine.ID(id).Exist(&models.User{})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if !exists {
+			respondError(c, http.StatusNotFound, codeUserNotFound, "user not found")
+			return
+		}
+		count, err := engine.Count(&models.User{})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		if count <= 1 {
+			respondError(c, http.StatusConflict, CodeConflict, "cannot delete the last user")
+			return
+		}
+
+		if _, err := engine.ID(id).Delete(&models.User{}); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		// The user's API keys would stop working anyway; don't leave them behind
+		if _, err := engine.Where("user_id = ?", id).Delete(&models.APIKey{}); err != nil {
+			respondError(c, http.StatusInternalServerError, CodeInternal, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+	}
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestNewHandlerJSONAndLevel(t *testing.T) {
+	var buf bytes.Buffer
+	h, err := NewHandler(&buf, "warn", "json")
+	if err != nil {
+		t.Fatalf("NewHandler failed: %v", err)
+	}
+	logger := slog.New(h)
+	logger.Info("dropped")
+	logger.Warn("sync failed", "device_id", 7, "operation", "sync_sms")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected one JSON line, got %q: %v", buf.String(), err)
+	}
+	if entry["msg"] != "sync failed" || entry["device_id"] != float64(7) || entry["operation"] != "sync_sms" {
+		t.Errorf("Unexpected entry %v", entry)
+	}
+
+	if _, err := NewHandler(&buf, "verbose", "text"); err == nil {
+		t.Error("Expected an unknown level to be rejected")
+	}
+	if _, err := NewHandler(&buf, "info", "xml"); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
+
+func TestHandlerAddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	h, _ := NewHandler(&buf, "info", "json")
+	logger := slog.New(h).With("operation", "phone_request")
+	logger.InfoContext(WithRequestID(context.Background(), "abc123"), "phone API error")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected one JSON line, got %q: %v", buf.String(), err)
+	}
+	if entry["request_id"] != "abc123" || entry["operation"] != "phone_request" {
+		t.Errorf("Expected request_id and operation fields, got %v", entry)
+	}
+}
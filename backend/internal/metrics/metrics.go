@@ -0,0 +1,72 @@
+// Package metrics exposes Prometheus metrics for devices, syncs, phone API calls and logins.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"backend/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// DeviceOnline is 1 if the device answered the last poll, 0 otherwise.
+	DeviceOnline = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "smserver_device_online",
+		Help: "Whether the device answered the last battery poll (1=online, 0=offline).",
+	}, []string{"device"})
+
+	// DeviceBattery is the last polled battery percentage.
+	DeviceBattery = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "smserver_device_battery_level",
+		Help: "Last polled battery level in percent.",
+	}, []string{"device"})
+
+	// SyncedRecords counts new SMS/calls stored by sync.
+	SyncedRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "smserver_synced_records_total",
+		Help: "New records stored by sync, by kind (sms, call).",
+	}, []string{"device", "kind"})
+
+	// PhoneRequestDuration observes phone API latency, including retries.
+	PhoneRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "smserver_phone_request_duration_seconds",
+		Help:    "Latency of phone API requests, including retries.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"device", "endpoint"})
+
+	// PhoneRequestErrors counts phone API requests that failed after all retries.
+	PhoneRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "smserver_phone_request_errors_total",
+		Help: "Phone API requests that failed after all retries.",
+	}, []string{"device", "endpoint"})
+
+	// LoginAttempts counts logins by result (success, failure).
+	LoginAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "smserver_login_attempts_total",
+		Help: "Login attempts by result (success, failure).",
+	}, []string{"result"})
+)
+
+// DeviceLabel returns the device label value: the device name, or its ID if unnamed.
+func DeviceLabel(device *models.Device) string {
+	if device.Name != "" {
+		return device.Name
+	}
+	return strconv.FormatInt(device.ID, 10)
+}
+
+// ForgetDevice drops the gauges of a deleted device so it stops being reported.
+func ForgetDevice(device *models.Device) {
+	label := DeviceLabel(device)
+	DeviceOnline.DeleteLabelValues(label)
+	DeviceBattery.DeleteLabelValues(label)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"backend/internal/smsutil"
 )
 
 // User represents an admin user for the web panel.
@@ -9,10 +11,46 @@ type User struct {
 	ID        int64     `xorm:"pk autoincr 'id'" json:"id"`
 	Username  string    `xorm:"unique notnull 'username'" json:"username"`
 	Password  string    `xorm:"varchar(255) notnull 'password'" json:"-"`
+	Role      string    `xorm:"varchar(20) notnull default 'admin' 'role'" json:"role"` // admin, viewer
 	CreatedAt time.Time `xorm:"created" json:"created_at"`
 	UpdatedAt time.Time `xorm:"updated" json:"updated_at"`
 }
 
+// User roles. Viewers can read everything but can't send, delete or reconfigure.
+const (
+	RoleAdmin  = "admin"
+	RoleViewer = "viewer"
+)
+
+// RevokedToken records a revoked JWT by its jti until the token would have expired anyway.
+type RevokedToken struct {
+	ID        int64     `xorm:"pk autoincr 'id'" json:"id"`
+	JTI       string    `xorm:"varchar(64) unique notnull 'jti'" json:"jti"`
+	ExpiresAt time.Time `xorm:"index 'expires_at'" json:"expires_at"`
+	CreatedAt time.Time `xorm:"created" json:"created_at"`
+}
+
+// APIKey lets a machine client call the API without logging in. Only the
+// key's SHA-256 hash is stored; the key itself is shown once, on creation.
+type APIKey struct {
+	ID         int64      `xorm:"pk autoincr 'id'" json:"id"`
+	UserID     int64      `xorm:"index notnull 'user_id'" json:"user_id"` // The key acts with this user's role
+	Label      string     `xorm:"varchar(64) notnull 'label'" json:"label"`
+	Prefix     string     `xorm:"varchar(16) index notnull 'prefix'" json:"prefix"` // Leading characters of the key, to look it up and tell keys apart
+	KeyHash    string     `xorm:"varchar(64) unique notnull 'key_hash'" json:"-"`
+	Scopes     []string   `xorm:"text json 'scopes'" json:"scopes"`
+	CreatedAt  time.Time  `xorm:"created" json:"created_at"`
+	LastUsedAt *time.Time `xorm:"'last_used_at'" json:"last_used_at"`
+}
+
+// API key scopes. A key may only call the routes its scopes cover, and never
+// the API key management routes themselves.
+const (
+	APIScopeAll     = "*"        // Everything the owning user can do
+	APIScopeRead    = "read"     // GET requests
+	APIScopeSmsSend = "sms:send" // Send single and bulk SMS
+)
+
 // Device represents a client device (phone running SmsForwarder).
 // SMServer acts as client, phone acts as server.
 // PhoneAddr: phone's HTTP server address (e.g., "http://192.168.1.100:5000" or "http://smsf.demo.com")
@@ -21,7 +59,10 @@ type Device struct {
 	ID              int64     `xorm:"pk autoincr 'id'" json:"id"`
 	Name            string    `xorm:"varchar(100) notnull 'name'" json:"name"`
 	PhoneAddr       string    `xorm:"varchar(255) notnull 'phone_addr'" json:"phone_addr"`  // Phone HTTP server address
-	SM4Key          string    `xorm:"varchar(64) notnull 'sm4_key'" json:"sm4_key"`         // User-provided SM4 key (32 hex chars)
+	SM4Key          string    `xorm:"varchar(64) notnull 'sm4_key'" json:"-"`               // User-provided SM4 key (32 hex chars), never returned by the API
+	SM4IV           string    `xorm:"varchar(32) 'sm4_iv'" json:"sm4_iv"`                   // Optional SM4 IV (32 hex chars, empty = SmsForwarder default)
+	SignEnabled     bool      `xorm:"bool default(0) 'sign_enabled'" json:"sign_enabled"`   // Sign requests and verify response signs
+	SignSecret      string    `xorm:"varchar(255) 'sign_secret'" json:"-"`                  // SmsForwarder server signing secret, never returned by the API
 	Status          string    `xorm:"varchar(32) 'status'" json:"status"`                   // online, offline
 	Battery         int       `xorm:"int 'battery'" json:"battery"`                         // Deprecated: use BatteryLevel
 	BatteryLevel    string    `xorm:"varchar(10) 'battery_level'" json:"battery_level"`     // e.g., "85%"
@@ -34,25 +75,118 @@ type Device struct {
 	ExtraSim1       string    `xorm:"varchar(255) 'extra_sim1'" json:"extra_sim1"`              // SIM1 info
 	ExtraSim2       string    `xorm:"varchar(255) 'extra_sim2'" json:"extra_sim2"`              // SIM2 info
 	PollingInterval int       `xorm:"int default 0 'polling_interval'" json:"polling_interval"` // Polling interval in seconds (0=disabled, 5/10/15/30/60)
+	Timeout         int       `xorm:"int default 0 'timeout'" json:"timeout"`                   // Phone API HTTP timeout in seconds (0=default 30)
 	LastSeen        time.Time `xorm:"'last_seen'" json:"last_seen"`
 	Remark          string    `xorm:"varchar(255) 'remark'" json:"remark"`
-	CreatedAt       time.Time `xorm:"created" json:"created_at"`
+	Tags            string    `xorm:"varchar(255) 'tags'" json:"tags"` // Comma-separated group tags, e.g. "office,test"
+	// Network path to the phone
+	ProxyURL           string `xorm:"varchar(255) 'proxy_url'" json:"-"`                                  // http(s)/socks5 proxy (empty = app.phone_proxy); may hold credentials, never returned
+	InsecureSkipVerify bool   `xorm:"bool default(0) 'insecure_skip_verify'" json:"insecure_skip_verify"` // Accept any HTTPS certificate (LAN use only)
+	TLSCert            string `xorm:"text 'tls_cert'" json:"-"`                                           // PEM certificate or CA to pin for HTTPS phones, never returned
+	// Send quotas: SMS the server may send through the phone per rolling hour/day (0 = unlimited)
+	SendLimitHour int `xorm:"int default 0 'send_limit_hour'" json:"send_limit_hour"`
+	SendLimitDay  int `xorm:"int default 0 'send_limit_day'" json:"send_limit_day"`
+	// Phone app state, refreshed whenever the phone's config is queried (null/empty = not known yet)
+	Capabilities *DeviceCapabilities `xorm:"text json 'capabilities'" json:"capabilities"`
+	AppVersion   string              `xorm:"varchar(50) 'app_version'" json:"app_version"` // SmsForwarder version name, from clone pull
+	// Last known location, kept from the latest fix with a position (null = never located)
+	LocationAddress string     `xorm:"varchar(255) 'location_address'" json:"location_address"`
+	LocationAt      *time.Time `xorm:"'location_at'" json:"location_at"` // When the fix was received
+	// Last successful sync per data type (null = never synced)
+	SmsSyncedAt      *time.Time `xorm:"'sms_synced_at'" json:"sms_synced_at"`
+	CallsSyncedAt    *time.Time `xorm:"'calls_synced_at'" json:"calls_synced_at"`
+	ContactsSyncedAt *time.Time `xorm:"'contacts_synced_at'" json:"contacts_synced_at"`
+	CreatedAt        time.Time  `xorm:"created" json:"created_at"`
+}
+
+// DeviceCapabilities are the SmsForwarder API features enabled on a phone, as
+// reported by /config/query. Nil pointers are features the phone's app
+// version doesn't report.
+type DeviceCapabilities struct {
+	SmsSend      bool  `json:"sms_send"`
+	SmsQuery     bool  `json:"sms_query"`
+	CallQuery    bool  `json:"call_query"`
+	ContactQuery bool  `json:"contact_query"`
+	ContactAdd   *bool `json:"contact_add,omitempty"`
+	BatteryQuery bool  `json:"battery_query"`
+	Wol          bool  `json:"wol"`
+	Location     *bool `json:"location,omitempty"`
+	Clone        bool  `json:"clone"`
+}
+
+// Capability names, matching the JSON keys of DeviceCapabilities.
+const (
+	CapabilitySmsSend    = "sms_send"
+	CapabilityContactAdd = "contact_add"
+	CapabilityWol        = "wol"
+	CapabilityLocation   = "location"
+)
+
+// Disabled reports whether the phone is known to have capability turned off.
+// Unknown capabilities, including all of them on a nil receiver, are not
+// disabled, so callers still try the phone.
+func (c *DeviceCapabilities) Disabled(capability string) bool {
+	if c == nil {
+		return false
+	}
+	switch capability {
+	case CapabilitySmsSend:
+		return !c.SmsSend
+	case CapabilityContactAdd:
+		return c.ContactAdd != nil && !*c.ContactAdd
+	case CapabilityWol:
+		return !c.Wol
+	case CapabilityLocation:
+		return c.Location != nil && !*c.Location
+	}
+	return false
 }
 
 // SmsMessage stores SMS history per device.
 // Unique constraint: (device_id, address, sms_time, type)
 type SmsMessage struct {
-	ID        int64      `xorm:"pk autoincr 'id'" json:"id"`
-	DeviceID  int64      `xorm:"unique(device_sms_unique) index notnull 'device_id'" json:"device_id"`
-	Address   string     `xorm:"unique(device_sms_unique) varchar(100) 'address'" json:"address"` // Phone number
-	Name      string     `xorm:"varchar(100) 'name'" json:"name"`                                 // Contact name
-	Body      string     `xorm:"text 'body'" json:"body"`                                         // SMS content
-	Type      int        `xorm:"unique(device_sms_unique) int 'type'" json:"type"`                // 1=received, 2=sent
-	SimID     int        `xorm:"int 'sim_id'" json:"sim_id"`                                      // 0=SIM1, 1=SIM2, -1=unknown
-	SmsTime   int64      `xorm:"unique(device_sms_unique) bigint 'sms_time'" json:"sms_time"`     // Timestamp in milliseconds
-	IsRead    bool       `xorm:"bool default(0) 'is_read'" json:"is_read"`                        // Read status
-	DeletedAt *time.Time `xorm:"deleted index" json:"deleted_at,omitempty"`                       // Soft delete timestamp
-	CreatedAt time.Time  `xorm:"created" json:"created_at"`
+	ID          int64           `xorm:"pk autoincr 'id'" json:"id"`
+	DeviceID    int64           `xorm:"unique(device_sms_unique) index notnull 'device_id'" json:"device_id"`
+	Address     string          `xorm:"unique(device_sms_unique) varchar(100) 'address'" json:"address"` // Phone number
+	AddressKey  string          `xorm:"varchar(100) index 'address_key'" json:"-"`                       // Normalized address, matched against contact.phone_key
+	Name        string          `xorm:"varchar(100) 'name'" json:"name"`                                 // Contact name
+	Body        string          `xorm:"text 'body'" json:"body"`                                         // SMS content
+	Type        int             `xorm:"unique(device_sms_unique) int 'type'" json:"type"`                // 1=received, 2=sent
+	SimID       int             `xorm:"int 'sim_id'" json:"sim_id"`                                      // 0=SIM1, 1=SIM2, -1=unknown
+	SmsTime     int64           `xorm:"unique(device_sms_unique) bigint 'sms_time'" json:"sms_time"`     // Timestamp in milliseconds
+	IsRead      bool            `xorm:"bool default(0) 'is_read'" json:"is_read"`                        // Read status
+	Blocked     bool            `xorm:"bool default(0) index 'blocked'" json:"blocked"`                  // Hidden by a blocklist rule
+	Archived    bool            `xorm:"bool default(0) index 'archived'" json:"archived"`                // Conversation archived by the user
+	Attachments []SmsAttachment `xorm:"text json 'attachments'" json:"attachments,omitempty"`            // MMS attachments, stored as JSON text
+	Pushed      bool            `xorm:"bool default(0) 'pushed'" json:"pushed"`                          // Pushed by the phone on arrival rather than synced
+	DeletedAt   *time.Time      `xorm:"deleted index" json:"deleted_at,omitempty"`                       // Soft delete timestamp
+	CreatedAt   time.Time       `xorm:"created" json:"created_at"`
+	// Delivery of sent messages: sent, delivered or failed (empty for received)
+	DeliveryStatus string `xorm:"varchar(10) default '' 'delivery_status'" json:"delivery_status,omitempty"`
+}
+
+// BeforeInsert fills the normalized address, and marks sent messages without
+// a delivery status as sent.
+func (m *SmsMessage) BeforeInsert() {
+	m.AddressKey = smsutil.NormalizePhone(m.Address)
+	if m.Type == 2 && m.DeliveryStatus == "" {
+		m.DeliveryStatus = DeliveryStatusSent
+	}
+}
+
+// SMS delivery statuses.
+const (
+	DeliveryStatusSent      = "sent"      // Accepted by the phone; no delivery report yet
+	DeliveryStatusDelivered = "delivered" // The recipient's network confirmed delivery
+	DeliveryStatusFailed    = "failed"    // The phone couldn't send it
+)
+
+// SmsAttachment describes a media attachment of an MMS message as reported by the phone.
+type SmsAttachment struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type,omitempty"` // e.g., "image/jpeg"
+	Name        string `json:"name,omitempty"`
+	Size        int64  `json:"size,omitempty"` // Size in bytes
 }
 
 // CallLog stores call history.
@@ -61,6 +195,7 @@ type CallLog struct {
 	ID        int64      `xorm:"pk autoincr 'id'" json:"id"`
 	DeviceID  int64      `xorm:"unique(device_call_unique) index notnull 'device_id'" json:"device_id"`
 	Number    string     `xorm:"unique(device_call_unique) varchar(40) 'number'" json:"number"`
+	NumberKey string     `xorm:"varchar(40) index 'number_key'" json:"-"` // Normalized number, matched against contact.phone_key
 	Name      string     `xorm:"varchar(100) 'name'" json:"name"`
 	Type      int        `xorm:"unique(device_call_unique) int 'type'" json:"type"`              // 1=incoming, 2=outgoing, 3=missed
 	Duration  int        `xorm:"int 'duration'" json:"duration"`                                 // Duration in seconds
@@ -71,6 +206,11 @@ type CallLog struct {
 	CreatedAt time.Time  `xorm:"created" json:"created_at"`
 }
 
+// BeforeInsert fills the normalized number.
+func (c *CallLog) BeforeInsert() {
+	c.NumberKey = smsutil.NormalizePhone(c.Number)
+}
+
 // Contact represents a device contact entry.
 // Unique constraint: (device_id, phone)
 // IsHidden: true for auto-created contacts from SMS/Calls (contact name = phone number)
@@ -81,12 +221,149 @@ type Contact struct {
 	DeviceID  int64     `xorm:"unique(device_contact_unique) index notnull 'device_id'" json:"device_id"`
 	Name      string    `xorm:"varchar(100) 'name'" json:"name"`
 	Phone     string    `xorm:"unique(device_contact_unique) varchar(40) 'phone'" json:"phone"`
+	PhoneKey  string    `xorm:"varchar(40) index 'phone_key'" json:"-"` // Normalized phone, used to match numbers written differently
 	Email     string    `xorm:"varchar(120) 'email'" json:"email,omitempty"`
 	Note      string    `xorm:"varchar(255) 'note'" json:"note,omitempty"`
 	IsHidden  bool      `xorm:"bool default(0) 'is_hidden'" json:"is_hidden"` // Hidden contact created from SMS/Calls
 	CreatedAt time.Time `xorm:"created" json:"created_at"`
 }
 
+// BeforeInsert fills the normalized phone.
+func (c *Contact) BeforeInsert() {
+	c.PhoneKey = smsutil.NormalizePhone(c.Phone)
+}
+
+// ContactGroup is a named set of one device's contacts, e.g. "family", that
+// bulk SMS can send to.
+type ContactGroup struct {
+	ID        int64     `xorm:"pk autoincr 'id'" json:"id"`
+	DeviceID  int64     `xorm:"unique(device_group_name) index notnull 'device_id'" json:"device_id"`
+	Name      string    `xorm:"unique(device_group_name) varchar(100) notnull 'name'" json:"name"`
+	CreatedAt time.Time `xorm:"created" json:"created_at"`
+}
+
+// ContactGroupMember puts a contact in a group.
+type ContactGroupMember struct {
+	ID        int64     `xorm:"pk autoincr 'id'" json:"id"`
+	GroupID   int64     `xorm:"unique(group_contact) index notnull 'group_id'" json:"group_id"`
+	ContactID int64     `xorm:"unique(group_contact) index notnull 'contact_id'" json:"contact_id"`
+	CreatedAt time.Time `xorm:"created" json:"created_at"`
+}
+
+// BatteryHistory records one battery reading per poll so discharge trends can be charted.
+type BatteryHistory struct {
+	ID         int64     `xorm:"pk autoincr 'id'" json:"id"`
+	DeviceID   int64     `xorm:"index(device_recorded) notnull 'device_id'" json:"device_id"`
+	Level      int       `xorm:"int 'level'" json:"level"`             // Battery percentage, 0-100
+	Status     string    `xorm:"varchar(50) 'status'" json:"status"`   // e.g., "充电中", "未充电"
+	Plugged    string    `xorm:"varchar(20) 'plugged'" json:"plugged"` // e.g., "AC", "USB", "无"
+	RecordedAt time.Time `xorm:"index(device_recorded) 'recorded_at'" json:"recorded_at"`
+}
+
+// LocationHistory records a location fix reported by the phone.
+// Consecutive identical fixes are not stored twice.
+type LocationHistory struct {
+	ID         int64     `xorm:"pk autoincr 'id'" json:"id"`
+	DeviceID   int64     `xorm:"index(device_recorded) notnull 'device_id'" json:"device_id"`
+	Latitude   float64   `xorm:"double 'latitude'" json:"latitude"`
+	Longitude  float64   `xorm:"double 'longitude'" json:"longitude"`
+	Address    string    `xorm:"varchar(255) 'address'" json:"address"`
+	Provider   string    `xorm:"varchar(40) 'provider'" json:"provider"` // e.g., "gps", "network"
+	FixTime    string    `xorm:"varchar(40) 'fix_time'" json:"fix_time"` // Fix time as reported by the phone
+	RecordedAt time.Time `xorm:"index(device_recorded) 'recorded_at'" json:"recorded_at"`
+}
+
+// ForwardRule forwards newly received SMS matching a condition to a webhook.
+// DeviceID 0 applies the rule to every device.
+type ForwardRule struct {
+	ID        int64     `xorm:"pk autoincr 'id'" json:"id"`
+	DeviceID  int64     `xorm:"index default 0 'device_id'" json:"device_id"`
+	Name      string    `xorm:"varchar(100) 'name'" json:"name"`
+	MatchType string    `xorm:"varchar(20) notnull 'match_type'" json:"match_type"` // sender, contains, regex, sim
+	Pattern   string    `xorm:"varchar(500) 'pattern'" json:"pattern"`              // Substring, regex, or SIM slot (0=SIM1, 1=SIM2)
+	TargetURL string    `xorm:"varchar(500) notnull 'target_url'" json:"target_url"`
+	Secret    string    `xorm:"varchar(255) 'secret'" json:"secret"` // Optional HMAC key for the signature header
+	Enabled   bool      `xorm:"bool default(1) 'enabled'" json:"enabled"`
+	CreatedAt time.Time `xorm:"created" json:"created_at"`
+	UpdatedAt time.Time `xorm:"updated" json:"updated_at"`
+}
+
+// Forward rule match types.
+const (
+	ForwardMatchSender   = "sender"   // Sender address contains the pattern
+	ForwardMatchContains = "contains" // Body contains the pattern (case-insensitive)
+	ForwardMatchRegex    = "regex"    // Body matches the regular expression
+	ForwardMatchSim      = "sim"      // Received on the SIM slot given by the pattern
+)
+
+// Blocklist hides or drops newly received SMS from matching senders.
+// DeviceID 0 applies the entry to every device.
+type Blocklist struct {
+	ID        int64     `xorm:"pk autoincr 'id'" json:"id"`
+	DeviceID  int64     `xorm:"index default 0 'device_id'" json:"device_id"`
+	MatchType string    `xorm:"varchar(20) notnull 'match_type'" json:"match_type"` // exact, prefix, regex
+	Pattern   string    `xorm:"varchar(500) notnull 'pattern'" json:"pattern"`      // Sender number, number prefix, or regex
+	Action    string    `xorm:"varchar(20) notnull 'action'" json:"action"`         // hide, delete
+	Enabled   bool      `xorm:"bool default(1) 'enabled'" json:"enabled"`
+	CreatedAt time.Time `xorm:"created" json:"created_at"`
+	UpdatedAt time.Time `xorm:"updated" json:"updated_at"`
+}
+
+// Blocklist match types.
+const (
+	BlockMatchExact  = "exact"  // Sender equals the pattern
+	BlockMatchPrefix = "prefix" // Sender starts with the pattern
+	BlockMatchRegex  = "regex"  // Sender matches the regular expression
+)
+
+// Blocklist actions.
+const (
+	BlockActionHide   = "hide"   // Store the message flagged as blocked, out of normal lists
+	BlockActionDelete = "delete" // Don't store the message at all
+)
+
+// AuditLog records a mutating action taken by a panel user.
+type AuditLog struct {
+	ID         int64     `xorm:"pk autoincr 'id'" json:"id"`
+	UserID     int64     `xorm:"index 'user_id'" json:"user_id"`
+	Username   string    `xorm:"varchar(64) 'username'" json:"username"`
+	Action     string    `xorm:"varchar(40) index notnull 'action'" json:"action"`
+	TargetType string    `xorm:"varchar(20) 'target_type'" json:"target_type"` // device, sms, call
+	TargetID   int64     `xorm:"'target_id'" json:"target_id"`                 // 0 when the action spans several targets
+	Detail     string    `xorm:"text 'detail'" json:"detail"`
+	CreatedAt  time.Time `xorm:"created index" json:"created_at"`
+}
+
+// Audit actions.
+const (
+	AuditSmsSend      = "sms.send"
+	AuditSmsBulkSend  = "sms.bulk_send"
+	AuditSmsDelete    = "sms.delete"
+	AuditCallDelete   = "call.delete"
+	AuditWol          = "wol.send"
+	AuditClonePush    = "clone.push"
+	AuditDeviceCreate = "device.create"
+	AuditDeviceUpdate = "device.update"
+	AuditDeviceDelete = "device.delete"
+	AuditDeviceExport = "device.export"
+	AuditDeviceReset  = "device.reset_data"
+	AuditJWTRotate    = "security.jwt_rotate"
+	AuditAPIKeyCreate = "api_key.create"
+	AuditAPIKeyRevoke = "api_key.revoke"
+)
+
+// Setting is a server-managed value persisted across restarts.
+type Setting struct {
+	Name      string    `xorm:"pk varchar(64) 'name'" json:"name"`
+	Value     string    `xorm:"text 'value'" json:"-"`
+	UpdatedAt time.Time `xorm:"updated" json:"updated_at"`
+}
+
+// Setting names.
+const (
+	SettingJWTSecret = "jwt_secret" // Rotated JWT secret; overrides app.jwt_secret
+)
+
 // Command represents a task server asks device to execute.
 type Command struct {
 	ID        int64     `xorm:"pk autoincr 'id'" json:"id"`
@@ -98,3 +375,18 @@ type Command struct {
 	CreatedAt time.Time `xorm:"created" json:"created_at"`
 	UpdatedAt time.Time `xorm:"updated" json:"updated_at"`
 }
+
+// Command statuses.
+const (
+	CommandStatusPending = "pending"
+	CommandStatusSent    = "sent"
+	CommandStatusDone    = "done"
+	CommandStatusFailed  = "failed"
+)
+
+// Command types supported by the command worker.
+const (
+	CommandTypeSendSms    = "send_sms"
+	CommandTypeWol        = "wol"
+	CommandTypeAddContact = "add_contact"
+)
@@ -2,46 +2,106 @@ package phoneclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"backend/internal/metrics"
 	"backend/internal/models"
 	"backend/internal/security"
+	"backend/internal/smsutil"
 )
 
 // Client is a client for calling SmsForwarder API on phone
 type Client struct {
 	device     *models.Device
 	httpClient *http.Client
+	noRetry    bool // Make a single attempt regardless of Options.MaxRetries
 }
 
-// NewClient creates a new phone client for the given device
+// DefaultTimeout is used when the device has no timeout configured
+const DefaultTimeout = 30 * time.Second
+
+// DefaultMaxResponseBytes caps a phone response when Options.MaxResponseBytes
+// is 0. Even a full sync page is far smaller.
+const DefaultMaxResponseBytes = 8 << 20
+
+// Options holds process-wide settings applied to every Client
+type Options struct {
+	MaxRetries   int           // Retries after the first attempt for transient failures (0=no retry)
+	RetryBackoff time.Duration // Delay before the first retry, doubled after each retry
+	DebugIO      bool          // Log each request's URL, ciphertext and decrypted response (never the key)
+	// ProxyURL routes phone requests through an http(s) or socks5 proxy unless
+	// the device sets its own (empty = direct, or HTTP_PROXY from the environment).
+	ProxyURL string
+	// InsecureSkipVerify accepts self-signed certificates from every phone.
+	InsecureSkipVerify bool
+	// MaxResponseBytes is the largest response body read from a phone
+	// (0 = DefaultMaxResponseBytes, negative = no limit).
+	MaxResponseBytes int64
+}
+
+var (
+	optionsMu sync.RWMutex
+	options   = Options{
+		MaxRetries:   3,
+		RetryBackoff: 500 * time.Millisecond,
+	}
+)
+
+// SetOptions replaces the process-wide client options. Call once at startup.
+func SetOptions(opts Options) {
+	optionsMu.Lock()
+	defer optionsMu.Unlock()
+	options = opts
+}
+
+func currentOptions() Options {
+	optionsMu.RLock()
+	defer optionsMu.RUnlock()
+	return options
+}
+
+// NewClient creates a new phone client for the given device.
+// Uses the device's Timeout (seconds) if set, otherwise DefaultTimeout.
 func NewClient(device *models.Device) *Client {
+	timeout := DefaultTimeout
+	if device.Timeout > 0 {
+		timeout = time.Duration(device.Timeout) * time.Second
+	}
+	opts := currentOptions()
+	proxy := device.ProxyURL
+	if proxy == "" {
+		proxy = opts.ProxyURL
+	}
+	transport := transportFor(transportKey{
+		proxy:    proxy,
+		insecure: opts.InsecureSkipVerify || device.InsecureSkipVerify,
+		certPEM:  device.TLSCert,
+	})
 	return &Client{
 		device: device,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   timeout,
+			Transport: transport,
 		},
 	}
 }
 
-// min returns the smaller of two integers
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 // Request represents the standard SmsForwarder request format
 type Request struct {
 	Data      interface{} `json:"data"`
 	Timestamp int64       `json:"timestamp"`
-	Sign      string      `json:"sign"`
+	Sign      string      `json:"sign"` // Set when the device has SignEnabled
 }
 
 // Response represents the standard SmsForwarder response format
@@ -53,13 +113,31 @@ type Response struct {
 	Sign      string      `json:"sign,omitempty"`
 }
 
-// doRequest sends an SM4-encrypted request to the phone and decrypts the response
-func (c *Client) doRequest(uri string, data interface{}) (*Response, error) {
+// nonIdempotentURIs lists endpoints with side effects on the phone.
+// These are only retried when the connection could not be established,
+// since a timeout after the request was sent may mean the phone already acted.
+var nonIdempotentURIs = map[string]bool{
+	"/sms/send":    true,
+	"/wol/send":    true,
+	"/contact/add": true,
+	"/clone/push":  true,
+}
+
+// doRequest sends an SM4-encrypted request to the phone and decrypts the response.
+// Transient failures (network errors, HTTP 5xx) are retried with exponential backoff;
+// business errors returned by the phone are never retried.
+// A status other than 200 is reported with the start of the body, without decrypting.
+// Transport, auth and business failures are returned as *PhoneError so callers
+// can tell their kind apart.
+// The context bounds the whole call including retries and backoff sleeps.
+func (c *Client) doRequest(ctx context.Context, uri string, data interface{}) (*Response, error) {
 	// Build request
 	req := Request{
 		Data:      data,
 		Timestamp: time.Now().UnixMilli(),
-		Sign:      "",
+	}
+	if c.device.SignEnabled {
+		req.Sign = security.SmsForwarderSign(req.Timestamp, c.device.SignSecret)
 	}
 
 	// Marshal and encrypt
@@ -68,60 +146,160 @@ func (c *Client) doRequest(uri string, data interface{}) (*Response, error) {
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
-	// Disabled verbose logging
-	// log.Printf("[PhoneClient] %s request: %s", uri, string(reqBytes))
-
-	encryptedReq, err := security.SM4EncryptHex(c.device.SM4Key, reqBytes)
+	encryptedReq, err := security.SM4EncryptHexWithIV(c.device.SM4Key, c.device.SM4IV, reqBytes)
 	if err != nil {
 		return nil, fmt.Errorf("encrypt request: %w", err)
 	}
 
+	label := metrics.DeviceLabel(c.device)
+	start := time.Now()
+	defer func() {
+		metrics.PhoneRequestDuration.WithLabelValues(label, uri).Observe(time.Since(start).Seconds())
+	}()
+
+	opts := currentOptions()
+	if opts.DebugIO {
+		slog.InfoContext(ctx, "phone request", "operation", "phone_request", "device_id", c.device.ID, "url", c.device.PhoneAddr+uri, "body", encryptedReq)
+	}
+	backoff := opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, retryable, err := c.send(ctx, uri, encryptedReq)
+		if err == nil || !retryable || attempt >= opts.MaxRetries || c.noRetry || ctx.Err() != nil {
+			if err != nil {
+				metrics.PhoneRequestErrors.WithLabelValues(label, uri).Inc()
+			}
+			return resp, err
+		}
+		slog.WarnContext(ctx, "phone request failed, retrying", "operation", "phone_request", "device_id", c.device.ID, "uri", uri, "attempt", attempt+1, "backoff", backoff, "error", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			metrics.PhoneRequestErrors.WithLabelValues(label, uri).Inc()
+			return nil, unreachable(fmt.Errorf("send request: %w", ctx.Err()))
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// send performs a single HTTP round-trip with an already encrypted body.
+// The returned bool reports whether the failure is transient and may be retried.
+func (c *Client) send(ctx context.Context, uri, encryptedReq string) (*Response, bool, error) {
 	// Send request
 	url := c.device.PhoneAddr + uri
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBufferString(encryptedReq))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString(encryptedReq))
 	if err != nil {
-		return nil, fmt.Errorf("create http request: %w", err)
+		return nil, false, fmt.Errorf("create http request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json; charset=utf-8")
 
 	httpResp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		log.Printf("[PhoneClient] %s HTTP error: %v", uri, err)
-		return nil, fmt.Errorf("send request: %w", err)
+		slog.WarnContext(ctx, "phone HTTP error", "operation", "phone_request", "device_id", c.device.ID, "uri", uri, "error", err)
+		return nil, !nonIdempotentURIs[uri] || isDialError(err), unreachable(fmt.Errorf("send request: %w", err))
 	}
 	defer httpResp.Body.Close()
 
-	// Read response
-	respBody, err := io.ReadAll(httpResp.Body)
+	// Read response, at most one byte past the limit to tell an oversized body apart
+	limit := currentOptions().MaxResponseBytes
+	if limit == 0 {
+		limit = DefaultMaxResponseBytes
+	}
+	var body io.Reader = httpResp.Body
+	if limit > 0 {
+		body = io.LimitReader(httpResp.Body, limit+1)
+	}
+	respBody, err := io.ReadAll(body)
 	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+		return nil, !nonIdempotentURIs[uri], unreachable(fmt.Errorf("read response: %w", err))
+	}
+	if limit > 0 && int64(len(respBody)) > limit {
+		slog.WarnContext(ctx, "phone response too large", "operation", "phone_request", "device_id", c.device.ID, "uri", uri, "limit", limit)
+		return nil, false, &PhoneError{Kind: ErrPhoneRejected, Err: fmt.Errorf("phone response exceeds %d bytes", limit)}
+	}
+
+	if currentOptions().DebugIO {
+		slog.InfoContext(ctx, "phone response", "operation", "phone_request", "device_id", c.device.ID, "url", url, "status", httpResp.StatusCode, "body", string(respBody))
 	}
 
-	// Disabled verbose logging
-	// log.Printf("[PhoneClient] %s response status: %d, body length: %d", uri, httpResp.StatusCode, len(respBody))
+	// Check the status before decrypting: a wrong port or a stopped app
+	// answers with a plain error page that would only fail to decrypt
+	if httpResp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("phone returned HTTP %s%s", httpResp.Status, bodySnippet(respBody))
+		slog.WarnContext(ctx, "phone HTTP status", "operation", "phone_request", "device_id", c.device.ID, "uri", uri, "error", err)
+		switch {
+		case httpResp.StatusCode >= 500:
+			// Server-side failure, the phone may recover shortly
+			return nil, !nonIdempotentURIs[uri], unreachable(err)
+		case httpResp.StatusCode == http.StatusBadRequest:
+			// SmsForwarder rejects requests it can't decrypt with a bare 400
+			return nil, false, decryptFailed(err)
+		default:
+			return nil, false, &PhoneError{Kind: ErrPhoneRejected, Err: err}
+		}
+	}
 
 	// Decrypt response
-	decryptedResp, err := security.SM4DecryptHex(c.device.SM4Key, string(respBody))
+	decryptedResp, err := security.SM4DecryptHexWithIV(c.device.SM4Key, c.device.SM4IV, string(respBody))
 	if err != nil {
-		log.Printf("[PhoneClient] %s decrypt error: %v, raw response: %s", uri, err, string(respBody)[:min(200, len(respBody))])
-		return nil, fmt.Errorf("decrypt response: %w", err)
+		slog.WarnContext(ctx, "phone response decrypt failed", "operation", "phone_request", "device_id", c.device.ID, "uri", uri, "error", err, "raw", bodySnippet(respBody))
+		if errors.Is(err, security.ErrInvalidPadding) {
+			return nil, false, decryptFailed(err)
+		}
+		// Not hex or not whole blocks: whatever answered isn't speaking the SM4 protocol
+		return nil, false, &PhoneError{Kind: ErrPhoneRejected, Err: fmt.Errorf("decrypt response: %w", err)}
 	}
 
-	// Disabled verbose logging
-	// log.Printf("[PhoneClient] %s decrypted response: %s", uri, string(decryptedResp)[:min(500, len(decryptedResp))])
+	if currentOptions().DebugIO {
+		slog.InfoContext(ctx, "phone decrypted response", "operation", "phone_request", "device_id", c.device.ID, "url", url, "body", string(decryptedResp))
+	}
 
 	// Parse response
 	var resp Response
 	if err := json.Unmarshal(decryptedResp, &resp); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+		// Decrypting with the wrong key yields garbage that happens to have valid padding
+		return nil, false, decryptFailed(fmt.Errorf("unmarshal response: %w", err))
+	}
+
+	// Verify the response sign when the phone sends one
+	if c.device.SignEnabled && resp.Sign != "" && resp.Sign != security.SmsForwarderSign(resp.Timestamp, c.device.SignSecret) {
+		return nil, false, &PhoneError{Kind: ErrPhoneAuth, Err: errors.New("response sign mismatch")}
 	}
 
 	if resp.Code != 200 {
-		log.Printf("[PhoneClient] %s API error: code=%d, msg=%s", uri, resp.Code, resp.Msg)
-		return &resp, fmt.Errorf("phone returned error: %s", resp.Msg)
+		slog.WarnContext(ctx, "phone API error", "operation", "phone_request", "device_id", c.device.ID, "uri", uri, "code", resp.Code, "msg", resp.Msg)
+		return &resp, false, businessError(&resp)
 	}
 
-	return &resp, nil
+	return &resp, false, nil
+}
+
+// maxBodySnippet is how much of an unexpected response body goes into errors.
+const maxBodySnippet = 200
+
+// bodySnippet returns the start of body for an error message, prefixed with
+// ": ", with runs of whitespace collapsed. It is empty for an empty body.
+func bodySnippet(body []byte) string {
+	s := strings.Join(strings.Fields(string(body)), " ")
+	if s == "" {
+		return ""
+	}
+	if len(s) > maxBodySnippet {
+		cut := maxBodySnippet
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut] + "…"
+	}
+	return ": " + s
+}
+
+// isDialError reports whether err happened while establishing the connection,
+// meaning the request never reached the phone.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
 }
 
 // ConfigQueryResponse represents the response from /config/query
@@ -133,15 +311,32 @@ type ConfigQueryResponse struct {
 	EnableAPISmsQuery     bool                   `json:"enable_api_sms_query"`
 	EnableAPISmsSend      bool                   `json:"enable_api_sms_send"`
 	EnableAPIWol          bool                   `json:"enable_api_wol"`
+	EnableAPIContactAdd   *bool                  `json:"enable_api_contact_add,omitempty"` // Not reported by older app versions
+	EnableAPILocation     *bool                  `json:"enable_api_location,omitempty"`    // Not reported by older app versions
 	ExtraDeviceMark       string                 `json:"extra_device_mark,omitempty"`
 	ExtraSim1             string                 `json:"extra_sim1,omitempty"`
 	ExtraSim2             string                 `json:"extra_sim2,omitempty"`
 	SimInfoList           map[string]interface{} `json:"sim_info_list,omitempty"`
 }
 
+// Capabilities returns the enabled API features for storing on the device.
+func (c *ConfigQueryResponse) Capabilities() *models.DeviceCapabilities {
+	return &models.DeviceCapabilities{
+		SmsSend:      c.EnableAPISmsSend,
+		SmsQuery:     c.EnableAPISmsQuery,
+		CallQuery:    c.EnableAPICallQuery,
+		ContactQuery: c.EnableAPIContactQuery,
+		ContactAdd:   c.EnableAPIContactAdd,
+		BatteryQuery: c.EnableAPIBatteryQuery,
+		Wol:          c.EnableAPIWol,
+		Location:     c.EnableAPILocation,
+		Clone:        c.EnableAPIClone,
+	}
+}
+
 // QueryConfig calls /config/query to get phone configuration
-func (c *Client) QueryConfig() (*ConfigQueryResponse, error) {
-	resp, err := c.doRequest("/config/query", map[string]interface{}{})
+func (c *Client) QueryConfig(ctx context.Context) (*ConfigQueryResponse, error) {
+	resp, err := c.doRequest(ctx, "/config/query", map[string]interface{}{})
 	if err != nil {
 		return nil, err
 	}
@@ -160,6 +355,16 @@ func (c *Client) QueryConfig() (*ConfigQueryResponse, error) {
 	return &config, nil
 }
 
+// Ping makes a single /config/query attempt, without retries, and returns its
+// round-trip time. It only checks that the phone answers; the config is discarded.
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+	single := *c
+	single.noRetry = true
+	start := time.Now()
+	_, err := single.doRequest(ctx, "/config/query", map[string]interface{}{})
+	return time.Since(start), err
+}
+
 // SmsSendRequest represents parameters for sending SMS
 type SmsSendRequest struct {
 	SimSlot      int    `json:"sim_slot"`      // 1=SIM1, 2=SIM2
@@ -168,8 +373,8 @@ type SmsSendRequest struct {
 }
 
 // SendSms calls /sms/send to send SMS via phone
-func (c *Client) SendSms(req SmsSendRequest) error {
-	_, err := c.doRequest("/sms/send", req)
+func (c *Client) SendSms(ctx context.Context, req SmsSendRequest) error {
+	_, err := c.doRequest(ctx, "/sms/send", req)
 	return err
 }
 
@@ -190,10 +395,32 @@ type SmsItem struct {
 	Date    int64  `json:"date"`   // Timestamp in milliseconds
 	SimID   int    `json:"sim_id"` // 0=SIM1, 1=SIM2, -1=unknown
 	SubID   int    `json:"sub_id"`
+	// Attachments of MMS messages; absent on SmsForwarder versions without MMS support
+	Attachments []models.SmsAttachment `json:"attachments,omitempty"`
+	// Android delivery status of a sent message (-1=none, 0=delivered,
+	// 32=pending, 64=failed); absent unless the app reports it
+	Status *int `json:"status,omitempty"`
+}
+
+// DeliveryStatus maps the item's Android status to a models.DeliveryStatus*
+// value, or "" if the phone reported none.
+func (i SmsItem) DeliveryStatus() string {
+	if i.Status == nil {
+		return ""
+	}
+	switch *i.Status {
+	case 0:
+		return models.DeliveryStatusDelivered
+	case 32:
+		return models.DeliveryStatusSent
+	case 64:
+		return models.DeliveryStatusFailed
+	}
+	return ""
 }
 
 // QuerySms calls /sms/query to query SMS messages
-func (c *Client) QuerySms(req SmsQueryRequest) ([]SmsItem, error) {
+func (c *Client) QuerySms(ctx context.Context, req SmsQueryRequest) ([]SmsItem, error) {
 	if req.PageNum <= 0 {
 		req.PageNum = 1
 	}
@@ -201,7 +428,7 @@ func (c *Client) QuerySms(req SmsQueryRequest) ([]SmsItem, error) {
 		req.PageSize = 10
 	}
 
-	resp, err := c.doRequest("/sms/query", req)
+	resp, err := c.doRequest(ctx, "/sms/query", req)
 	if err != nil {
 		return nil, err
 	}
@@ -219,6 +446,45 @@ func (c *Client) QuerySms(req SmsQueryRequest) ([]SmsItem, error) {
 	return items, nil
 }
 
+// QuerySmsByAddress calls /sms/query for one page of the messages exchanged
+// with address. The phone is asked to filter by passing the number as keyword,
+// and the page is filtered again here, since SmsForwarder versions differ in
+// what the keyword matches. supported is false unless the page shows the
+// phone filtered by number: it has messages with the address and only
+// messages matching the keyword. An empty page proves nothing, as a phone
+// matching the keyword only against content returns one too. The caller then
+// has to filter unfiltered pages with FilterSmsByAddress instead.
+func (c *Client) QuerySmsByAddress(ctx context.Context, address string, req SmsQueryRequest) (items []SmsItem, supported bool, err error) {
+	req.Keyword = smsutil.NormalizePhone(address)
+	page, err := c.QuerySms(ctx, req)
+	if err != nil {
+		return nil, false, err
+	}
+	items = FilterSmsByAddress(page, address)
+	if len(items) == 0 {
+		return items, false, nil
+	}
+	for _, item := range page {
+		if smsutil.NormalizePhone(item.Number) != req.Keyword && !strings.Contains(item.Number, req.Keyword) && !strings.Contains(item.Content, req.Keyword) {
+			return items, false, nil
+		}
+	}
+	return items, true, nil
+}
+
+// FilterSmsByAddress returns the items whose number matches address, compared
+// in normalized form so "+8613800138000" matches "13800138000".
+func FilterSmsByAddress(items []SmsItem, address string) []SmsItem {
+	key := smsutil.NormalizePhone(address)
+	var matched []SmsItem
+	for _, item := range items {
+		if smsutil.NormalizePhone(item.Number) == key {
+			matched = append(matched, item)
+		}
+	}
+	return matched
+}
+
 // CallQueryRequest represents parameters for querying call logs
 type CallQueryRequest struct {
 	Type        int    `json:"type"`         // 0=all, 1=incoming, 2=outgoing, 3=missed
@@ -238,7 +504,7 @@ type CallItem struct {
 }
 
 // QueryCalls calls /call/query to query call logs
-func (c *Client) QueryCalls(req CallQueryRequest) ([]CallItem, error) {
+func (c *Client) QueryCalls(ctx context.Context, req CallQueryRequest) ([]CallItem, error) {
 	if req.PageNum <= 0 {
 		req.PageNum = 1
 	}
@@ -246,7 +512,7 @@ func (c *Client) QueryCalls(req CallQueryRequest) ([]CallItem, error) {
 		req.PageSize = 10
 	}
 
-	resp, err := c.doRequest("/call/query", req)
+	resp, err := c.doRequest(ctx, "/call/query", req)
 	if err != nil {
 		return nil, err
 	}
@@ -277,8 +543,8 @@ type ContactItem struct {
 }
 
 // QueryContacts calls /contact/query to query contacts
-func (c *Client) QueryContacts(req ContactQueryRequest) ([]ContactItem, error) {
-	resp, err := c.doRequest("/contact/query", req)
+func (c *Client) QueryContacts(ctx context.Context, req ContactQueryRequest) ([]ContactItem, error) {
+	resp, err := c.doRequest(ctx, "/contact/query", req)
 	if err != nil {
 		return nil, err
 	}
@@ -303,8 +569,8 @@ type ContactAddRequest struct {
 }
 
 // AddContact calls /contact/add to add a contact to the phone
-func (c *Client) AddContact(req ContactAddRequest) error {
-	_, err := c.doRequest("/contact/add", req)
+func (c *Client) AddContact(ctx context.Context, req ContactAddRequest) error {
+	_, err := c.doRequest(ctx, "/contact/add", req)
 	return err
 }
 
@@ -320,8 +586,8 @@ type BatteryResponse struct {
 }
 
 // QueryBattery calls /battery/query to get battery status
-func (c *Client) QueryBattery() (*BatteryResponse, error) {
-	resp, err := c.doRequest("/battery/query", map[string]interface{}{})
+func (c *Client) QueryBattery(ctx context.Context) (*BatteryResponse, error) {
+	resp, err := c.doRequest(ctx, "/battery/query", map[string]interface{}{})
 	if err != nil {
 		return nil, err
 	}
@@ -347,8 +613,8 @@ type WolRequest struct {
 }
 
 // SendWol calls /wol/send to send Wake-on-LAN packet
-func (c *Client) SendWol(req WolRequest) error {
-	_, err := c.doRequest("/wol/send", req)
+func (c *Client) SendWol(ctx context.Context, req WolRequest) error {
+	_, err := c.doRequest(ctx, "/wol/send", req)
 	return err
 }
 
@@ -362,8 +628,8 @@ type LocationResponse struct {
 }
 
 // QueryLocation calls /location/query to get phone location
-func (c *Client) QueryLocation() (*LocationResponse, error) {
-	resp, err := c.doRequest("/location/query", map[string]interface{}{})
+func (c *Client) QueryLocation(ctx context.Context) (*LocationResponse, error) {
+	resp, err := c.doRequest(ctx, "/location/query", map[string]interface{}{})
 	if err != nil {
 		return nil, err
 	}
@@ -390,13 +656,20 @@ type ClonePullRequest struct {
 // Using map[string]interface{} for flexibility as the config has many optional fields
 type CloneConfig map[string]interface{}
 
+// VersionName returns the SmsForwarder version name in the clone config, or
+// "" if it has none.
+func (c CloneConfig) VersionName() string {
+	v, _ := c["version_name"].(string)
+	return v
+}
+
 // ClonePull calls /clone/pull to pull configuration from phone
-func (c *Client) ClonePull(versionCode int) (CloneConfig, error) {
+func (c *Client) ClonePull(ctx context.Context, versionCode int) (CloneConfig, error) {
 	req := ClonePullRequest{
 		VersionCode: versionCode,
 	}
 
-	resp, err := c.doRequest("/clone/pull", req)
+	resp, err := c.doRequest(ctx, "/clone/pull", req)
 	if err != nil {
 		return nil, err
 	}
@@ -416,7 +689,7 @@ func (c *Client) ClonePull(versionCode int) (CloneConfig, error) {
 }
 
 // ClonePush calls /clone/push to push configuration to phone
-func (c *Client) ClonePush(config CloneConfig) error {
-	_, err := c.doRequest("/clone/push", config)
+func (c *Client) ClonePush(ctx context.Context, config CloneConfig) error {
+	_, err := c.doRequest(ctx, "/clone/push", config)
 	return err
 }
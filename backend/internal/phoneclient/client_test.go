@@ -0,0 +1,324 @@
+package phoneclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"backend/internal/models"
+	"backend/internal/security"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+// writeEncrypted writes an SM4-encrypted SmsForwarder response.
+func writeEncrypted(t *testing.T, w http.ResponseWriter, resp Response) {
+	t.Helper()
+	plain, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("marshal response: %v", err)
+	}
+	cipherHex, err := security.SM4EncryptHex(testKey, plain)
+	if err != nil {
+		t.Fatalf("encrypt response: %v", err)
+	}
+	w.Write([]byte(cipherHex))
+}
+
+// withFastRetries shortens backoff for the duration of a test.
+func withFastRetries(t *testing.T, maxRetries int) {
+	t.Helper()
+	prev := currentOptions()
+	SetOptions(Options{MaxRetries: maxRetries, RetryBackoff: time.Millisecond})
+	t.Cleanup(func() { SetOptions(prev) })
+}
+
+func TestDoRequestRetriesTransientFailures(t *testing.T) {
+	withFastRetries(t, 3)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writeEncrypted(t, w, Response{Code: 200, Msg: "success", Data: map[string]interface{}{"level": "85%"}})
+	}))
+	defer server.Close()
+
+	client := NewClient(&models.Device{PhoneAddr: server.URL, SM4Key: testKey})
+	battery, err := client.QueryBattery(context.Background())
+	if err != nil {
+		t.Fatalf("Expected success after retries, got: %v", err)
+	}
+	if battery.Level != "85%" {
+		t.Errorf("Expected level 85%%, got %s", battery.Level)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("Expected 3 attempts, got %d", got)
+	}
+}
+
+func TestDoRequestDoesNotRetryBusinessError(t *testing.T) {
+	withFastRetries(t, 3)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writeEncrypted(t, w, Response{Code: 403, Msg: "feature disabled"})
+	}))
+	defer server.Close()
+
+	client := NewClient(&models.Device{PhoneAddr: server.URL, SM4Key: testKey})
+	if _, err := client.QueryBattery(context.Background()); err == nil {
+		t.Fatal("Expected business error, got nil")
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Expected exactly 1 attempt for business error, got %d", got)
+	}
+}
+
+func TestDoRequestClassifiesErrors(t *testing.T) {
+	withFastRetries(t, 0)
+
+	tests := []struct {
+		name string
+		resp Response
+		kind error
+	}{
+		{"feature disabled", Response{Code: 500, Msg: "短信发送接口未开启"}, ErrPhoneFeatureDisabled},
+		{"bad sign", Response{Code: 500, Msg: "签名校验失败"}, ErrPhoneAuth},
+		{"forbidden", Response{Code: 403, Msg: "forbidden"}, ErrPhoneAuth},
+		{"other", Response{Code: 500, Msg: "sim card not ready"}, ErrPhoneRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeEncrypted(t, w, tt.resp)
+			}))
+			defer server.Close()
+
+			_, err := NewClient(&models.Device{PhoneAddr: server.URL, SM4Key: testKey}).QueryBattery(context.Background())
+			var pe *PhoneError
+			if !errors.Is(err, tt.kind) || !errors.As(err, &pe) || pe.Code != tt.resp.Code {
+				t.Errorf("Expected %v with code %d, got %v", tt.kind, tt.resp.Code, err)
+			}
+		})
+	}
+
+	// Nothing listening on the port
+	_, err := NewClient(&models.Device{PhoneAddr: "http://127.0.0.1:1", SM4Key: testKey}).QueryBattery(context.Background())
+	if !errors.Is(err, ErrPhoneUnreachable) {
+		t.Errorf("Expected ErrPhoneUnreachable, got %v", err)
+	}
+}
+
+func TestDoRequestReportsWrongKey(t *testing.T) {
+	withFastRetries(t, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeEncrypted(t, w, Response{Code: 200, Msg: "success"})
+	}))
+	defer server.Close()
+
+	wrongKey := "fedcba9876543210fedcba9876543210"
+	_, err := NewClient(&models.Device{PhoneAddr: server.URL, SM4Key: wrongKey}).QueryBattery(context.Background())
+	if !errors.Is(err, ErrPhoneDecrypt) {
+		t.Errorf("Expected ErrPhoneDecrypt for a mismatched key, got %v", err)
+	}
+}
+
+func TestDoRequestReportsHTTPStatus(t *testing.T) {
+	withFastRetries(t, 0)
+
+	tests := []struct {
+		name   string
+		status int
+		kind   error
+	}{
+		{"server error", http.StatusInternalServerError, ErrPhoneUnreachable},
+		{"wrong port", http.StatusNotFound, ErrPhoneRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte("<html>\n  <body>Something went wrong</body>\n</html>"))
+			}))
+			defer server.Close()
+
+			_, err := NewClient(&models.Device{PhoneAddr: server.URL, SM4Key: testKey}).QueryBattery(context.Background())
+			if !errors.Is(err, tt.kind) || errors.Is(err, ErrPhoneDecrypt) {
+				t.Fatalf("Expected %v without a decrypt error, got %v", tt.kind, err)
+			}
+			want := "phone returned HTTP " + strconv.Itoa(tt.status) + " " + http.StatusText(tt.status) + ": <html> <body>Something went wrong</body> </html>"
+			if err.Error() != want {
+				t.Errorf("Expected error %q, got %q", want, err.Error())
+			}
+		})
+	}
+}
+
+func TestDoRequestLimitsResponseSize(t *testing.T) {
+	prev := currentOptions()
+	SetOptions(Options{MaxResponseBytes: 1024})
+	t.Cleanup(func() { SetOptions(prev) })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/battery/query" {
+			w.Write([]byte(strings.Repeat("0", 4096)))
+			return
+		}
+		writeEncrypted(t, w, Response{Code: 200, Msg: "success", Data: map[string]interface{}{"level": "85%"}})
+	}))
+	defer server.Close()
+
+	client := NewClient(&models.Device{PhoneAddr: server.URL, SM4Key: testKey})
+	_, err := client.QueryBattery(context.Background())
+	if !errors.Is(err, ErrPhoneRejected) || !strings.Contains(err.Error(), "exceeds 1024 bytes") {
+		t.Errorf("Expected an oversized response to be rejected, got %v", err)
+	}
+	if _, err := client.QueryConfig(context.Background()); err != nil {
+		t.Errorf("Expected a response under the limit to succeed, got %v", err)
+	}
+}
+
+func TestBodySnippet(t *testing.T) {
+	if got := bodySnippet(nil); got != "" {
+		t.Errorf("Expected no snippet for an empty body, got %q", got)
+	}
+	long := strings.Repeat("短", maxBodySnippet)
+	got := bodySnippet([]byte(long))
+	if !strings.HasSuffix(got, "…") || len(got) > maxBodySnippet+len(": …") || !utf8.ValidString(got) {
+		t.Errorf("Expected a valid truncated snippet, got %q", got)
+	}
+}
+
+func TestDoRequestGivesUpAfterMaxRetries(t *testing.T) {
+	withFastRetries(t, 2)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewClient(&models.Device{PhoneAddr: server.URL, SM4Key: testKey})
+	if _, err := client.QueryBattery(context.Background()); err == nil {
+		t.Fatal("Expected error after exhausting retries, got nil")
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("Expected 3 attempts (1 + 2 retries), got %d", got)
+	}
+}
+
+func TestDoRequestStopsOnCanceledContext(t *testing.T) {
+	withFastRetries(t, 3)
+
+	var calls int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	client := NewClient(&models.Device{PhoneAddr: server.URL, SM4Key: testKey})
+	start := time.Now()
+	if _, err := client.QueryBattery(ctx); err == nil {
+		t.Fatal("Expected error for canceled context, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected prompt return after cancel, took %v", elapsed)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Expected no retries after cancel, got %d attempts", got)
+	}
+}
+
+func TestDoRequestSignsWhenEnabled(t *testing.T) {
+	const secret = "sign-secret"
+	var gotSign string
+	var gotTimestamp int64
+	var forge atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		plain, _ := security.SM4DecryptHex(testKey, string(body))
+		var req Request
+		json.Unmarshal(plain, &req)
+		gotSign, gotTimestamp = req.Sign, req.Timestamp
+
+		ts := time.Now().UnixMilli()
+		sign := security.SmsForwarderSign(ts, secret)
+		if forge.Load() {
+			sign = "forged"
+		}
+		writeEncrypted(t, w, Response{Code: 200, Msg: "success", Data: map[string]interface{}{}, Timestamp: ts, Sign: sign})
+	}))
+	defer server.Close()
+
+	device := &models.Device{PhoneAddr: server.URL, SM4Key: testKey, SignEnabled: true, SignSecret: secret}
+	if _, err := NewClient(device).doRequest(context.Background(), "/config/query", map[string]interface{}{}); err != nil {
+		t.Fatalf("Signed request failed: %v", err)
+	}
+	if gotSign == "" || gotSign != security.SmsForwarderSign(gotTimestamp, secret) {
+		t.Errorf("Expected request sign for timestamp %d, got %q", gotTimestamp, gotSign)
+	}
+
+	forge.Store(true)
+	if _, err := NewClient(device).doRequest(context.Background(), "/config/query", map[string]interface{}{}); err == nil {
+		t.Error("Expected a forged response sign to be rejected")
+	}
+	forge.Store(false)
+
+	unsigned := &models.Device{PhoneAddr: server.URL, SM4Key: testKey}
+	if _, err := NewClient(unsigned).doRequest(context.Background(), "/config/query", map[string]interface{}{}); err != nil {
+		t.Fatalf("Unsigned request failed: %v", err)
+	}
+	if gotSign != "" {
+		t.Errorf("Expected no sign without SignEnabled, got %q", gotSign)
+	}
+}
+
+func TestConfigSimInfos(t *testing.T) {
+	var config ConfigQueryResponse
+	raw := `{"sim_info_list": {
+		"1": {"carrier_name": "CUCC", "number": "", "sim_slot_index": 1, "country_iso": "cn", "subscription_id": 2},
+		"0": {"carrier_name": "CMCC", "number": "+8613800000000", "sim_slot_index": 0, "country_iso": "cn", "subscription_id": 1},
+		"bad": "not an object"
+	}}`
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		t.Fatalf("unmarshal config: %v", err)
+	}
+
+	sims := ParseSimInfo(config.SimInfoJSON())
+	if len(sims) != 2 {
+		t.Fatalf("Expected 2 SIM cards, got %+v", sims)
+	}
+	if sims[0].Slot != 1 || sims[0].Carrier != "CMCC" || sims[0].Number != "+8613800000000" {
+		t.Errorf("Expected SIM1 to be CMCC, got %+v", sims[0])
+	}
+	if sims[1].Slot != 2 || sims[1].Carrier != "CUCC" {
+		t.Errorf("Expected SIM2 to be CUCC, got %+v", sims[1])
+	}
+	if got := (&ConfigQueryResponse{}).SimInfoJSON(); got != "" {
+		t.Errorf("Expected no SIM info without a list, got %q", got)
+	}
+}
@@ -0,0 +1,81 @@
+package phoneclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error kinds for failed phone requests. Match them with errors.Is; use
+// errors.As with *PhoneError to get the phone's business code.
+var (
+	ErrPhoneFeatureDisabled = errors.New("feature disabled on phone")
+	ErrPhoneAuth            = errors.New("phone rejected credentials")
+	ErrPhoneUnreachable     = errors.New("phone unreachable")
+	ErrPhoneDecrypt         = errors.New("decryption failed — SM4 key may be incorrect")
+	ErrPhoneRejected        = errors.New("phone rejected request")
+)
+
+// PhoneError is a classified failure talking to the phone.
+type PhoneError struct {
+	Kind error  // One of the ErrPhone* kinds
+	Code int    // Business code returned by the phone, 0 if it never answered
+	Msg  string // Message returned by the phone, if any
+	Err  error  // Underlying cause for transport and decoding failures
+}
+
+func (e *PhoneError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("phone returned error: %s", e.Msg)
+}
+
+// Unwrap exposes both the kind and the underlying cause to errors.Is/As.
+func (e *PhoneError) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// decryptFailed wraps a response that decoded as ciphertext but didn't decrypt
+// to valid JSON, the usual symptom of a mismatched SM4 key or IV.
+func decryptFailed(err error) error {
+	return &PhoneError{Kind: ErrPhoneDecrypt, Err: fmt.Errorf("%w: %v", ErrPhoneDecrypt, err)}
+}
+
+// unreachable wraps a transport failure.
+func unreachable(err error) error {
+	return &PhoneError{Kind: ErrPhoneUnreachable, Err: err}
+}
+
+// featureDisabledHints and authHints are substrings of SmsForwarder's error
+// messages (Chinese and English builds) that identify the failure kind.
+var (
+	featureDisabledHints = []string{"未开启", "未启用", "禁用", "disabled", "not enabled"}
+	authHints            = []string{"签名", "时间戳", "sign", "timestamp", "unauthorized"}
+)
+
+// businessError classifies a non-200 business code returned by the phone.
+func businessError(resp *Response) error {
+	kind := ErrPhoneRejected
+	msg := strings.ToLower(resp.Msg)
+	switch {
+	case containsAny(msg, featureDisabledHints):
+		kind = ErrPhoneFeatureDisabled
+	case resp.Code == http.StatusUnauthorized || resp.Code == http.StatusForbidden || containsAny(msg, authHints):
+		kind = ErrPhoneAuth
+	}
+	return &PhoneError{Kind: kind, Code: resp.Code, Msg: resp.Msg}
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package phoneclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/security"
+)
+
+// MaxPushSkew is how far a signed push's timestamp may be from the server's
+// clock before it is rejected as a replay.
+const MaxPushSkew = 10 * time.Minute
+
+// PushRequest is what the phone sends to the inbound endpoint: the same
+// envelope as an API request, with one SMS as data, SM4-encrypted with the
+// device's key and IV and hex encoded.
+type PushRequest struct {
+	Data      SmsItem `json:"data"`
+	Timestamp int64   `json:"timestamp"` // Milliseconds
+	Sign      string  `json:"sign"`      // Required when the device has SignEnabled
+}
+
+// DecodePush decrypts a push body from device and checks its sign. An SMS
+// without a type counts as received, and one without a date gets the push
+// timestamp. Any error means the body didn't come from the device.
+func DecodePush(device *models.Device, body string, now time.Time) (*SmsItem, error) {
+	plain, err := security.SM4DecryptHexWithIV(device.SM4Key, device.SM4IV, strings.TrimSpace(body))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt push: %w", err)
+	}
+	var req PushRequest
+	if err := json.Unmarshal(plain, &req); err != nil {
+		// Decrypting with the wrong key yields garbage that happens to have valid padding
+		return nil, fmt.Errorf("unmarshal push: %w", err)
+	}
+	if device.SignEnabled {
+		if req.Sign != security.SmsForwarderSign(req.Timestamp, device.SignSecret) {
+			return nil, errors.New("push sign mismatch")
+		}
+		if skew := now.Sub(time.UnixMilli(req.Timestamp)); skew > MaxPushSkew || skew < -MaxPushSkew {
+			return nil, errors.New("push timestamp too far from server time")
+		}
+	}
+	item := req.Data
+	if item.Type == 0 {
+		item.Type = 1
+	}
+	if item.Date == 0 {
+		item.Date = req.Timestamp
+	}
+	return &item, nil
+}
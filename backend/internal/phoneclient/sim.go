@@ -0,0 +1,71 @@
+package phoneclient
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// SimInfo describes one SIM card installed in the phone. SmsForwarder doesn't
+// report signal strength, so none is included.
+type SimInfo struct {
+	Slot           int    `json:"slot"` // 1=SIM1, 2=SIM2, as in SmsSendRequest.SimSlot
+	Carrier        string `json:"carrier"`
+	Number         string `json:"number"` // Often empty: many carriers don't store it on the SIM
+	CountryISO     string `json:"country_iso,omitempty"`
+	SubscriptionID int    `json:"subscription_id,omitempty"`
+}
+
+// simInfoEntry is one value of sim_info_list as sent by SmsForwarder.
+type simInfoEntry struct {
+	CarrierName    string `json:"carrier_name"`
+	Number         string `json:"number"`
+	SimSlotIndex   int    `json:"sim_slot_index"` // 0-based
+	CountryISO     string `json:"country_iso"`
+	SubscriptionID int    `json:"subscription_id"`
+}
+
+// SimInfos parses SimInfoList into SIM cards ordered by slot. Entries that
+// don't have the expected shape are skipped.
+func (c *ConfigQueryResponse) SimInfos() []SimInfo {
+	var sims []SimInfo
+	for _, v := range c.SimInfoList {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		var entry simInfoEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			continue
+		}
+		sims = append(sims, SimInfo{
+			Slot:           entry.SimSlotIndex + 1,
+			Carrier:        entry.CarrierName,
+			Number:         entry.Number,
+			CountryISO:     entry.CountryISO,
+			SubscriptionID: entry.SubscriptionID,
+		})
+	}
+	sort.Slice(sims, func(i, j int) bool { return sims[i].Slot < sims[j].Slot })
+	return sims
+}
+
+// SimInfoJSON returns SimInfos encoded for models.Device.SimInfo, or "" if
+// the phone reported no SIM cards.
+func (c *ConfigQueryResponse) SimInfoJSON() string {
+	sims := c.SimInfos()
+	if len(sims) == 0 {
+		return ""
+	}
+	raw, _ := json.Marshal(sims)
+	return string(raw)
+}
+
+// ParseSimInfo decodes a models.Device.SimInfo value written by SimInfoJSON.
+// Empty or unreadable values yield no SIM cards.
+func ParseSimInfo(s string) []SimInfo {
+	var sims []SimInfo
+	if s != "" {
+		json.Unmarshal([]byte(s), &sims)
+	}
+	return sims
+}
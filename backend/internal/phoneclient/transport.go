@@ -0,0 +1,173 @@
+package phoneclient
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// transportKey identifies a shared transport configuration.
+type transportKey struct {
+	proxy    string
+	insecure bool
+	certPEM  string // Pinned certificate(s), takes precedence over insecure
+}
+
+// transports caches one transport per configuration so clients keep reusing
+// pooled connections instead of dialing the phone afresh on every request.
+var transports sync.Map // transportKey -> *http.Transport
+
+// ValidateProxyURL checks that s is empty or an absolute http, https or socks5 URL.
+func ValidateProxyURL(s string) error {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("proxy URL must use http, https or socks5, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("proxy URL %q has no host", s)
+	}
+	return nil
+}
+
+// NormalizePhoneAddr checks that s is an absolute http or https URL and returns
+// it without surrounding spaces or trailing slashes, since request paths such
+// as /sms/send are appended to it. A path prefix (e.g. behind a reverse proxy)
+// is kept.
+func NormalizePhoneAddr(s string) (string, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "/")
+	if !strings.Contains(s, "://") {
+		return "", fmt.Errorf("phone_addr %q must start with http:// or https://, e.g. http://192.168.1.100:5000", s)
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid phone_addr: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("phone_addr must use http or https, got %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("phone_addr %q has no host", s)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("phone_addr %q must not have a query or fragment", s)
+	}
+	return s, nil
+}
+
+// parseCertPEM decodes every CERTIFICATE block in s.
+func parseCertPEM(s string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(s)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificate found")
+	}
+	return certs, nil
+}
+
+// ValidateCertPEM checks that s is empty or holds at least one PEM certificate.
+func ValidateCertPEM(s string) error {
+	if s == "" {
+		return nil
+	}
+	_, err := parseCertPEM(s)
+	return err
+}
+
+// pinnedTLSConfig trusts only the given certificates: the phone must present
+// one of them, or a certificate they signed (a private CA). The host name is
+// not checked since phones are usually reached by IP address.
+func pinnedTLSConfig(pinned []*x509.Certificate) *tls.Config {
+	roots := x509.NewCertPool()
+	for _, cert := range pinned {
+		roots.AddCert(cert)
+	}
+	return &tls.Config{
+		InsecureSkipVerify: true, // Replaced by the pin check below
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("phone presented no certificate")
+			}
+			for _, cert := range pinned {
+				if bytes.Equal(rawCerts[0], cert.Raw) {
+					return nil
+				}
+			}
+			leaf, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			intermediates := x509.NewCertPool()
+			for _, raw := range rawCerts[1:] {
+				if cert, err := x509.ParseCertificate(raw); err == nil {
+					intermediates.AddCert(cert)
+				}
+			}
+			if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+				return fmt.Errorf("phone certificate doesn't match the pinned certificate: %w", err)
+			}
+			return nil
+		},
+	}
+}
+
+// transportFor returns the shared transport for a proxy URL and TLS setting.
+// An empty proxy falls back to the environment's HTTP_PROXY/HTTPS_PROXY.
+func transportFor(key transportKey) *http.Transport {
+	if t, ok := transports.Load(key); ok {
+		return t.(*http.Transport)
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if key.proxy != "" {
+		// Validated when saved; a bad value falls back to a direct connection
+		if u, err := url.Parse(key.proxy); err == nil && ValidateProxyURL(key.proxy) == nil {
+			t.Proxy = http.ProxyURL(u)
+		} else {
+			slog.Warn("ignoring invalid proxy URL", "operation", "phone_transport", "proxy", key.proxy)
+		}
+	}
+	if key.certPEM != "" {
+		if pinned, err := parseCertPEM(key.certPEM); err == nil {
+			t.TLSClientConfig = pinnedTLSConfig(pinned)
+		} else {
+			// Fail closed: an unusable pin must not fall back to the system roots
+			slog.Warn("ignoring invalid pinned certificate", "operation", "phone_transport", "error", err)
+			t.TLSClientConfig = pinnedTLSConfig(nil)
+		}
+	} else if key.insecure {
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	actual, _ := transports.LoadOrStore(key, t)
+	return actual.(*http.Transport)
+}
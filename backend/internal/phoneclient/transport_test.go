@@ -0,0 +1,143 @@
+package phoneclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+)
+
+func TestValidateProxyURL(t *testing.T) {
+	for _, ok := range []string{"", "http://proxy:3128", "https://proxy", "socks5://127.0.0.1:1080"} {
+		if err := ValidateProxyURL(ok); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"proxy:3128", "ftp://proxy", "http://", "://x"} {
+		if err := ValidateProxyURL(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestNormalizePhoneAddr(t *testing.T) {
+	for in, want := range map[string]string{
+		"http://192.168.1.100:5000": "http://192.168.1.100:5000",
+		" https://smsf.demo.com/ ":  "https://smsf.demo.com",
+		"http://proxy.lan/phone1//": "http://proxy.lan/phone1",
+		"HTTP://192.168.1.100:5000": "HTTP://192.168.1.100:5000",
+		"https://[fe80::1]:5000":    "https://[fe80::1]:5000",
+	} {
+		if got, err := NormalizePhoneAddr(in); err != nil || got != want {
+			t.Errorf("NormalizePhoneAddr(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "192.168.1.100:5000", "smsf.demo.com", "ftp://phone", "http://", "http://phone?x=1", "http://phone#top"} {
+		if _, err := NormalizePhoneAddr(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestClientUsesDeviceProxy(t *testing.T) {
+	withFastRetries(t, 0)
+
+	// An HTTP proxy receives the absolute target URL and answers on the phone's behalf
+	var target string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target = r.URL.String()
+		writeEncrypted(t, w, Response{Code: 200, Msg: "success", Data: map[string]interface{}{"level": "50%"}})
+	}))
+	defer proxy.Close()
+
+	device := &models.Device{PhoneAddr: "http://phone.internal:5000", SM4Key: testKey, ProxyURL: proxy.URL}
+	if _, err := NewClient(device).QueryBattery(context.Background()); err != nil {
+		t.Fatalf("Expected request through the proxy to succeed, got %v", err)
+	}
+	if target != "http://phone.internal:5000/battery/query" {
+		t.Errorf("Expected proxy to receive the phone URL, got %q", target)
+	}
+}
+
+func TestClientInsecureSkipVerify(t *testing.T) {
+	withFastRetries(t, 0)
+
+	phone := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeEncrypted(t, w, Response{Code: 200, Msg: "success"})
+	}))
+	defer phone.Close()
+
+	device := &models.Device{PhoneAddr: phone.URL, SM4Key: testKey}
+	if _, err := NewClient(device).QueryBattery(context.Background()); err == nil {
+		t.Error("Expected a self-signed certificate to be rejected by default")
+	}
+	device.InsecureSkipVerify = true
+	if _, err := NewClient(device).QueryBattery(context.Background()); err != nil {
+		t.Errorf("Expected insecure_skip_verify to accept the certificate, got %v", err)
+	}
+}
+
+func TestClientPinnedCertificate(t *testing.T) {
+	withFastRetries(t, 0)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeEncrypted(t, w, Response{Code: 200, Msg: "success"})
+	})
+	phone := httptest.NewTLSServer(handler)
+	defer phone.Close()
+	// httptest shares one certificate between servers, so give this one its own
+	other := httptest.NewUnstartedServer(handler)
+	other.TLS = &tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}}
+	other.StartTLS()
+	defer other.Close()
+
+	certPEM := func(s *httptest.Server) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw}))
+	}
+	if err := ValidateCertPEM(certPEM(phone)); err != nil {
+		t.Fatalf("Expected server certificate to validate, got %v", err)
+	}
+	if err := ValidateCertPEM("-----BEGIN CERTIFICATE-----\nnope\n-----END CERTIFICATE-----\n"); err == nil {
+		t.Error("Expected garbage PEM to be rejected")
+	}
+
+	device := &models.Device{PhoneAddr: phone.URL, SM4Key: testKey, TLSCert: certPEM(phone)}
+	if _, err := NewClient(device).QueryBattery(context.Background()); err != nil {
+		t.Errorf("Expected the pinned certificate to be accepted, got %v", err)
+	}
+	device.PhoneAddr = other.URL
+	if _, err := NewClient(device).QueryBattery(context.Background()); err == nil {
+		t.Error("Expected a different certificate to be rejected")
+	}
+}
+
+// selfSignedCert makes a throwaway certificate for 127.0.0.1.
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"time"
+
+	"backend/internal/models"
+
+	"xorm.io/xorm"
+)
+
+// APIKeyRepository handles API key records.
+type APIKeyRepository struct {
+	engine *xorm.Engine
+}
+
+// NewAPIKeyRepository creates a new APIKeyRepository.
+func NewAPIKeyRepository(engine *xorm.Engine) *APIKeyRepository {
+	return &APIKeyRepository{engine: engine}
+}
+
+// FindAll returns all API keys, newest first.
+func (r *APIKeyRepository) FindAll() ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.engine.Desc("id").Find(&keys)
+	return keys, err
+}
+
+// FindByPrefix returns the keys whose stored prefix matches. Callers compare
+// the hash themselves; prefixes are not guaranteed unique.
+func (r *APIKeyRepository) FindByPrefix(prefix string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.engine.Where("prefix = ?", prefix).Find(&keys)
+	return keys, err
+}
+
+// Insert creates an API key.
+func (r *APIKeyRepository) Insert(key *models.APIKey) error {
+	_, err := r.engine.Insert(key)
+	return err
+}
+
+// Delete removes an API key, reporting whether it existed.
+func (r *APIKeyRepository) Delete(id int64) (bool, error) {
+	affected, err := r.engine.ID(id).Delete(new(models.APIKey))
+	return affected > 0, err
+}
+
+// TouchLastUsed records when a key was last used.
+func (r *APIKeyRepository) TouchLastUsed(id int64, at time.Time) error {
+	_, err := r.engine.ID(id).Cols("last_used_at").Update(&models.APIKey{LastUsedAt: &at})
+	return err
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"backend/internal/models"
+
+	"xorm.io/xorm"
+)
+
+// AuditLogRepository handles audit log data access.
+type AuditLogRepository struct {
+	engine *xorm.Engine
+}
+
+// NewAuditLogRepository creates a new AuditLogRepository.
+func NewAuditLogRepository(engine *xorm.Engine) *AuditLogRepository {
+	return &AuditLogRepository{engine: engine}
+}
+
+// Insert inserts a single audit entry.
+func (r *AuditLogRepository) Insert(entry *models.AuditLog) error {
+	_, err := r.engine.Insert(entry)
+	return err
+}
+
+// FindAll returns audit entries with pagination, newest first.
+// action: empty string means all actions.
+func (r *AuditLogRepository) FindAll(action string, page, pageSize int) ([]models.AuditLog, int64, error) {
+	var items []models.AuditLog
+
+	newSession := func() *xorm.Session {
+		session := r.engine.NewSession()
+		if action != "" {
+			session = session.Where("action = ?", action)
+		}
+		return session
+	}
+
+	// Get total count
+	total, err := newSession().Count(&models.AuditLog{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Apply pagination and ordering
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	offset := (page - 1) * pageSize
+
+	err = newSession().Desc("id").Limit(pageSize, offset).Find(&items)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return items, total, nil
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"time"
+
+	"backend/internal/models"
+
+	"xorm.io/xorm"
+)
+
+// BatteryHistoryRepository handles battery history data access.
+type BatteryHistoryRepository struct {
+	engine *xorm.Engine
+}
+
+// NewBatteryHistoryRepository creates a new BatteryHistoryRepository.
+func NewBatteryHistoryRepository(engine *xorm.Engine) *BatteryHistoryRepository {
+	return &BatteryHistoryRepository{engine: engine}
+}
+
+// Insert inserts a single battery reading.
+func (r *BatteryHistoryRepository) Insert(record *models.BatteryHistory) error {
+	_, err := r.engine.Insert(record)
+	return err
+}
+
+// FindSince returns the readings of a device recorded at or after since, oldest first.
+func (r *BatteryHistoryRepository) FindSince(deviceID int64, since time.Time) ([]models.BatteryHistory, error) {
+	var items []models.BatteryHistory
+	err := r.engine.Where("device_id = ? AND recorded_at >= ?", deviceID, since).
+		Asc("recorded_at").
+		Find(&items)
+	return items, err
+}
+
+// DeleteBefore removes readings of all devices recorded before cutoff.
+// Returns the number of rows deleted.
+func (r *BatteryHistoryRepository) DeleteBefore(cutoff time.Time) (int64, error) {
+	return r.engine.Where("recorded_at < ?", cutoff).Delete(new(models.BatteryHistory))
+}
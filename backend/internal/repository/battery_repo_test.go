@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"backend/internal/models"
+)
+
+func TestBatteryHistoryFindSinceAndDeleteBefore(t *testing.T) {
+	repo := NewBatteryHistoryRepository(newTestEngine(t))
+
+	now := time.Now()
+	records := []*models.BatteryHistory{
+		{DeviceID: 1, Level: 90, RecordedAt: now.Add(-48 * time.Hour)},
+		{DeviceID: 1, Level: 70, RecordedAt: now.Add(-2 * time.Hour)},
+		{DeviceID: 1, Level: 80, RecordedAt: now.Add(-3 * time.Hour)},
+		{DeviceID: 2, Level: 50, RecordedAt: now.Add(-1 * time.Hour)},
+	}
+	for _, r := range records {
+		if err := repo.Insert(r); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	items, err := repo.FindSince(1, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("FindSince failed: %v", err)
+	}
+	if len(items) != 2 || items[0].Level != 80 || items[1].Level != 70 {
+		t.Fatalf("Expected levels [80 70] in time order, got %+v", items)
+	}
+
+	deleted, err := repo.DeleteBefore(now.Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("DeleteBefore failed: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("Expected 1 expired record deleted, got %d", deleted)
+	}
+	items, err = repo.FindSince(1, time.Time{})
+	if err != nil {
+		t.Fatalf("FindSince failed: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 records left for device 1, got %d", len(items))
+	}
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"backend/internal/models"
+
+	"xorm.io/xorm"
+)
+
+// BlocklistRepository handles blocklist entry data access.
+type BlocklistRepository struct {
+	engine *xorm.Engine
+}
+
+// NewBlocklistRepository creates a new BlocklistRepository.
+func NewBlocklistRepository(engine *xorm.Engine) *BlocklistRepository {
+	return &BlocklistRepository{engine: engine}
+}
+
+// FindAll returns all entries, oldest first.
+func (r *BlocklistRepository) FindAll() ([]models.Blocklist, error) {
+	var entries []models.Blocklist
+	err := r.engine.Asc("id").Find(&entries)
+	return entries, err
+}
+
+// FindActive returns the enabled entries that apply to a device,
+// including global entries (device_id = 0).
+func (r *BlocklistRepository) FindActive(deviceID int64) ([]models.Blocklist, error) {
+	var entries []models.Blocklist
+	err := r.engine.Where("enabled = ?", true).
+		And("(device_id = 0 OR device_id = ?)", deviceID).
+		Asc("id").
+		Find(&entries)
+	return entries, err
+}
+
+// FindByID returns an entry by ID, or nil if it doesn't exist.
+func (r *BlocklistRepository) FindByID(id int64) (*models.Blocklist, error) {
+	entry := &models.Blocklist{}
+	has, err := r.engine.ID(id).Get(entry)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, nil
+	}
+	return entry, nil
+}
+
+// Insert inserts a single entry.
+func (r *BlocklistRepository) Insert(entry *models.Blocklist) error {
+	_, err := r.engine.Insert(entry)
+	return err
+}
+
+// Update saves all editable columns of an entry.
+func (r *BlocklistRepository) Update(entry *models.Blocklist) error {
+	_, err := r.engine.ID(entry.ID).
+		Cols("device_id", "match_type", "pattern", "action", "enabled").
+		Update(entry)
+	return err
+}
+
+// Delete deletes an entry by ID.
+func (r *BlocklistRepository) Delete(id int64) error {
+	_, err := r.engine.ID(id).Delete(&models.Blocklist{})
+	return err
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"backend/internal/models"
 
 	"xorm.io/xorm"
@@ -31,6 +33,48 @@ func (r *CallRepository) ExistsIncludingDeleted(deviceID int64, number string, c
 		deviceID, number, callTime, callType).Exist(&models.CallLog{})
 }
 
+// CallKey is the unique key of a call record within a device.
+type CallKey struct {
+	Number   string
+	CallTime int64
+	Type     int
+}
+
+// FilterNewCalls returns the keys that don't exist yet for a device, including soft-deleted
+// records, in input order and without duplicates. Uses a single query instead of one per key.
+func (r *CallRepository) FilterNewCalls(deviceID int64, keys []CallKey) ([]CallKey, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	times := make([]int64, 0, len(keys))
+	for _, key := range keys {
+		times = append(times, key.CallTime)
+	}
+
+	// Narrow by timestamp in SQL, then match the full key in Go
+	var existing []models.CallLog
+	err := r.engine.Unscoped().Cols("number", "call_time", "type").
+		Where("device_id = ?", deviceID).In("call_time", times).Find(&existing)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[CallKey]bool, len(existing)+len(keys))
+	for _, call := range existing {
+		seen[CallKey{Number: call.Number, CallTime: call.CallTime, Type: call.Type}] = true
+	}
+
+	var newKeys []CallKey
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			newKeys = append(newKeys, key)
+		}
+	}
+	return newKeys, nil
+}
+
 // Insert inserts a single call record.
 func (r *CallRepository) Insert(call *models.CallLog) error {
 	_, err := r.engine.Insert(call)
@@ -54,7 +98,7 @@ type CallWithContactName struct {
 // FindByDevice returns call logs for a device with pagination.
 // callType: 0=all, 1=incoming, 2=outgoing, 3=missed
 // Uses contact name from contact list if available, otherwise falls back to CallLog.Name or "Unknown Number".
-func (r *CallRepository) FindByDevice(deviceID int64, callType, page, pageSize int, phoneNumber string) ([]CallWithContactName, int64, error) {
+func (r *CallRepository) FindByDevice(deviceID int64, callType, page, pageSize int, phoneNumber string, opts ListOptions) ([]CallWithContactName, int64, error) {
 	var items []CallWithContactName
 
 	// Count query
@@ -67,6 +111,8 @@ func (r *CallRepository) FindByDevice(deviceID int64, callType, page, pageSize i
 		countSession = countSession.And("(number LIKE ? OR name LIKE ?)",
 			"%"+phoneNumber+"%", "%"+phoneNumber+"%")
 	}
+	countSession = opts.applyTimeRange(countSession, "call_time")
+	countSession = opts.applySim(countSession, "sim_id")
 
 	// Get total count
 	total, err := countSession.Count(&models.CallLog{})
@@ -76,7 +122,7 @@ func (r *CallRepository) FindByDevice(deviceID int64, callType, page, pageSize i
 
 	// Data query with LEFT JOIN to contact table
 	session := r.engine.Table("call_log").
-		Join("LEFT", "contact", "call_log.device_id = contact.device_id AND call_log.number = contact.phone").
+		Join("LEFT", "contact", "call_log.device_id = contact.device_id AND call_log.number_key = contact.phone_key").
 		Select("call_log.*, COALESCE(contact.name, call_log.name, 'Unknown Number') as contact_name").
 		Where("call_log.device_id = ?", deviceID)
 
@@ -88,6 +134,8 @@ func (r *CallRepository) FindByDevice(deviceID int64, callType, page, pageSize i
 		session = session.And("(call_log.number LIKE ? OR call_log.name LIKE ? OR contact.name LIKE ?)",
 			"%"+phoneNumber+"%", "%"+phoneNumber+"%", "%"+phoneNumber+"%")
 	}
+	session = opts.applyTimeRange(session, "call_log.call_time")
+	session = opts.applySim(session, "call_log.sim_id")
 
 	// Apply pagination and ordering
 	if page <= 0 {
@@ -98,7 +146,7 @@ func (r *CallRepository) FindByDevice(deviceID int64, callType, page, pageSize i
 	}
 	offset := (page - 1) * pageSize
 
-	err = session.Desc("call_log.call_time").Limit(pageSize, offset).Find(&items)
+	err = opts.applyOrder(session, "call_log", CallSortColumns).Limit(pageSize, offset).Find(&items)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -111,6 +159,48 @@ func (r *CallRepository) FindByDevice(deviceID int64, callType, page, pageSize i
 	return items, total, nil
 }
 
+// IterateByDevice streams all call logs for a device in ascending time order,
+// with the same contact name resolution as FindByDevice. Rows are read in
+// batches like SmsRepository.IterateByDevice, keyed on (call_time, id).
+// callType: 0=all, 1=incoming, 2=outgoing, 3=missed
+// from/to: optional call_time bounds in milliseconds (0=unbounded), inclusive
+func (r *CallRepository) IterateByDevice(deviceID int64, callType int, from, to int64, fn func(*CallWithContactName) error) error {
+	var last *CallWithContactName
+	for {
+		session := r.engine.Table("call_log").
+			Join("LEFT", "contact", "call_log.device_id = contact.device_id AND call_log.number_key = contact.phone_key").
+			Select("call_log.*, COALESCE(contact.name, call_log.name, 'Unknown Number') as contact_name").
+			Where("call_log.device_id = ?", deviceID)
+		if callType > 0 {
+			session = session.And("call_log.type = ?", callType)
+		}
+		if from > 0 {
+			session = session.And("call_log.call_time >= ?", from)
+		}
+		if to > 0 {
+			session = session.And("call_log.call_time <= ?", to)
+		}
+		if last != nil {
+			session = session.And("(call_log.call_time > ? OR (call_log.call_time = ? AND call_log.id > ?))", last.CallTime, last.CallTime, last.ID)
+		}
+
+		var batch []CallWithContactName
+		if err := session.Asc("call_log.call_time", "call_log.id").Limit(iterateBatchSize).Find(&batch); err != nil {
+			return err
+		}
+		for i := range batch {
+			batch[i].Name = batch[i].ContactName
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		if len(batch) < iterateBatchSize {
+			return nil
+		}
+		last = &batch[len(batch)-1]
+	}
+}
+
 // GetLatestCallTime returns the latest call timestamp for a device.
 func (r *CallRepository) GetLatestCallTime(deviceID int64, callType int) (int64, error) {
 	var call models.CallLog
@@ -137,8 +227,10 @@ type CallWithDevice struct {
 
 // FindAll returns call logs from all devices with pagination.
 // callType: 0=all, 1=incoming, 2=outgoing, 3=missed
+// deviceIDs: nil=no restriction, otherwise only records from these devices
+// opts.UnreadOnly keeps only unread calls.
 // Uses contact name from contact list if available, otherwise falls back to CallLog.Name or "Unknown Number".
-func (r *CallRepository) FindAll(callType, page, pageSize int, phoneNumber string, deviceID int64) ([]CallWithDevice, int64, error) {
+func (r *CallRepository) FindAll(callType, page, pageSize int, phoneNumber string, deviceID int64, deviceIDs []int64, opts ListOptions) ([]CallWithDevice, int64, error) {
 	var items []CallWithDevice
 
 	// Build count query
@@ -146,6 +238,9 @@ func (r *CallRepository) FindAll(callType, page, pageSize int, phoneNumber strin
 	if deviceID > 0 {
 		countSession = countSession.Where("device_id = ?", deviceID)
 	}
+	if deviceIDs != nil {
+		countSession = countSession.In("device_id", deviceIDs)
+	}
 	if callType > 0 {
 		countSession = countSession.And("type = ?", callType)
 	}
@@ -153,6 +248,9 @@ func (r *CallRepository) FindAll(callType, page, pageSize int, phoneNumber strin
 		countSession = countSession.And("(number LIKE ? OR name LIKE ?)",
 			"%"+phoneNumber+"%", "%"+phoneNumber+"%")
 	}
+	countSession = opts.applyTimeRange(countSession, "call_time")
+	countSession = opts.applySim(countSession, "sim_id")
+	countSession = opts.applyUnread(countSession, "is_read")
 
 	// Get total count
 	total, err := countSession.Count(&models.CallLog{})
@@ -163,12 +261,15 @@ func (r *CallRepository) FindAll(callType, page, pageSize int, phoneNumber strin
 	// Build data query with JOINs (device and contact)
 	session := r.engine.Table("call_log").
 		Join("LEFT", "device", "call_log.device_id = device.id").
-		Join("LEFT", "contact", "call_log.device_id = contact.device_id AND call_log.number = contact.phone").
+		Join("LEFT", "contact", "call_log.device_id = contact.device_id AND call_log.number_key = contact.phone_key").
 		Select("call_log.*, device.name as device_name, COALESCE(contact.name, call_log.name, 'Unknown Number') as contact_name")
 
 	if deviceID > 0 {
 		session = session.Where("call_log.device_id = ?", deviceID)
 	}
+	if deviceIDs != nil {
+		session = session.In("call_log.device_id", deviceIDs)
+	}
 	if callType > 0 {
 		session = session.And("call_log.type = ?", callType)
 	}
@@ -176,6 +277,9 @@ func (r *CallRepository) FindAll(callType, page, pageSize int, phoneNumber strin
 		session = session.And("(call_log.number LIKE ? OR call_log.name LIKE ? OR contact.name LIKE ?)",
 			"%"+phoneNumber+"%", "%"+phoneNumber+"%", "%"+phoneNumber+"%")
 	}
+	session = opts.applyTimeRange(session, "call_log.call_time")
+	session = opts.applySim(session, "call_log.sim_id")
+	session = opts.applyUnread(session, "call_log.is_read")
 
 	// Apply pagination and ordering
 	if page <= 0 {
@@ -186,7 +290,7 @@ func (r *CallRepository) FindAll(callType, page, pageSize int, phoneNumber strin
 	}
 	offset := (page - 1) * pageSize
 
-	err = session.Desc("call_log.call_time").Limit(pageSize, offset).Find(&items)
+	err = opts.applyOrder(session, "call_log", CallSortColumns).Limit(pageSize, offset).Find(&items)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -224,6 +328,21 @@ func (r *CallRepository) MarkAllAsRead(deviceID int64, callType int) error {
 	return err
 }
 
+// CountUnread returns the total number of unread call logs (optionally filtered by type, device and device set).
+func (r *CallRepository) CountUnread(callType int, deviceID int64, deviceIDs []int64) (int64, error) {
+	session := r.engine.Where("is_read = ?", false)
+	if deviceID > 0 {
+		session = session.And("device_id = ?", deviceID)
+	}
+	if deviceIDs != nil {
+		session = session.In("device_id", deviceIDs)
+	}
+	if callType > 0 {
+		session = session.And("type = ?", callType)
+	}
+	return session.Count(&models.CallLog{})
+}
+
 // Delete deletes a single call log by ID.
 func (r *CallRepository) Delete(id int64) error {
 	_, err := r.engine.ID(id).Delete(&models.CallLog{})
@@ -238,3 +357,21 @@ func (r *CallRepository) DeleteBatch(ids []int64) error {
 	_, err := r.engine.In("id", ids).Delete(&models.CallLog{})
 	return err
 }
+
+// CountByType returns the number of call logs per type (1=incoming, 2=outgoing, 3=missed),
+// optionally for one device (deviceID 0 = all devices).
+func (r *CallRepository) CountByType(deviceID int64) (map[int]int64, error) {
+	return countGroupedBy(r.engine, "call_log", "type", deviceID)
+}
+
+// CountByDay returns the number of call logs per day and type from since on,
+// in since's location, optionally for one device (deviceID 0 = all devices).
+func (r *CallRepository) CountByDay(deviceID int64, since time.Time) ([]DayCount, error) {
+	return countByDay(r.engine, "call_log", "call_time", deviceID, since)
+}
+
+// CountBySim returns the number of call logs per device and SIM slot,
+// optionally for one device (deviceID 0 = all devices).
+func (r *CallRepository) CountBySim(deviceID int64) ([]SimCount, error) {
+	return countBySim(r.engine, "call_log", deviceID)
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"backend/internal/models"
+
+	"xorm.io/xorm"
+)
+
+// CommandRepository handles command queue data access.
+type CommandRepository struct {
+	engine *xorm.Engine
+}
+
+// NewCommandRepository creates a new CommandRepository.
+func NewCommandRepository(engine *xorm.Engine) *CommandRepository {
+	return &CommandRepository{engine: engine}
+}
+
+// Insert inserts a single command.
+func (r *CommandRepository) Insert(cmd *models.Command) error {
+	_, err := r.engine.Insert(cmd)
+	return err
+}
+
+// FindByID returns a command by ID, or nil if it doesn't exist.
+func (r *CommandRepository) FindByID(id int64) (*models.Command, error) {
+	cmd := &models.Command{}
+	has, err := r.engine.ID(id).Get(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, nil
+	}
+	return cmd, nil
+}
+
+// FindByDevice returns commands for a device with pagination, newest first.
+// status: empty string means all statuses.
+func (r *CommandRepository) FindByDevice(deviceID int64, status string, page, pageSize int) ([]models.Command, int64, error) {
+	var items []models.Command
+
+	session := r.engine.Where("device_id = ?", deviceID)
+	if status != "" {
+		session = session.And("status = ?", status)
+	}
+
+	// Get total count
+	total, err := session.Count(&models.Command{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Reset session for actual query
+	session = r.engine.Where("device_id = ?", deviceID)
+	if status != "" {
+		session = session.And("status = ?", status)
+	}
+
+	// Apply pagination and ordering
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	offset := (page - 1) * pageSize
+
+	err = session.Desc("id").Limit(pageSize, offset).Find(&items)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return items, total, nil
+}
+
+// FindPending returns up to limit pending commands, oldest first.
+func (r *CommandRepository) FindPending(limit int) ([]models.Command, error) {
+	var items []models.Command
+	err := r.engine.Where("status = ?", models.CommandStatusPending).
+		Asc("id").Limit(limit).Find(&items)
+	return items, err
+}
+
+// Claim atomically moves a pending command to sent.
+// Returns false if the command was already claimed or is no longer pending.
+func (r *CommandRepository) Claim(id int64) (bool, error) {
+	affected, err := r.engine.ID(id).Where("status = ?", models.CommandStatusPending).
+		Cols("status").Update(&models.Command{Status: models.CommandStatusSent})
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// FailInterrupted marks sent commands that have no result yet as failed with
+// the given result. Dispatch always records a result, so before the server
+// takes requests such commands were interrupted by a crash. They fail rather
+// than go back to pending because the phone may already have carried them
+// out; users can retry them.
+func (r *CommandRepository) FailInterrupted(result string) (int64, error) {
+	return r.engine.Where("status = ? AND result = ''", models.CommandStatusSent).
+		Cols("status", "result").Update(&models.Command{Status: models.CommandStatusFailed, Result: result})
+}
+
+// Complete records the final status and result of a command.
+func (r *CommandRepository) Complete(id int64, status, result string) error {
+	_, err := r.engine.ID(id).Cols("status", "result").
+		Update(&models.Command{Status: status, Result: result})
+	return err
+}
+
+// Retry moves a failed command back to pending and clears its result.
+// Returns false if the command is not in failed status.
+func (r *CommandRepository) Retry(id int64) (bool, error) {
+	affected, err := r.engine.ID(id).Where("status = ?", models.CommandStatusFailed).
+		Cols("status", "result").Update(&models.Command{Status: models.CommandStatusPending})
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
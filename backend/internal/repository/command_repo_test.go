@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"testing"
+
+	"backend/internal/models"
+)
+
+func TestCommandClaimAndRetry(t *testing.T) {
+	repo := NewCommandRepository(newTestEngine(t))
+
+	cmd := &models.Command{
+		DeviceID: 1,
+		Type:     models.CommandTypeWol,
+		Payload:  `{"mac":"00:11:22:33:44:55"}`,
+		Status:   models.CommandStatusPending,
+	}
+	if err := repo.Insert(cmd); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	claimed, err := repo.Claim(cmd.ID)
+	if err != nil || !claimed {
+		t.Fatalf("Expected first claim to succeed, got claimed=%v err=%v", claimed, err)
+	}
+	claimed, err = repo.Claim(cmd.ID)
+	if err != nil || claimed {
+		t.Fatalf("Expected second claim to be rejected, got claimed=%v err=%v", claimed, err)
+	}
+
+	// Only failed commands can be retried
+	if retried, _ := repo.Retry(cmd.ID); retried {
+		t.Fatal("Expected retry of sent command to be rejected")
+	}
+
+	if err := repo.Complete(cmd.ID, models.CommandStatusFailed, "send request: timeout"); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	retried, err := repo.Retry(cmd.ID)
+	if err != nil || !retried {
+		t.Fatalf("Expected retry of failed command to succeed, got retried=%v err=%v", retried, err)
+	}
+
+	got, err := repo.FindByID(cmd.ID)
+	if err != nil || got == nil {
+		t.Fatalf("FindByID failed: %v", err)
+	}
+	if got.Status != models.CommandStatusPending || got.Result != "" {
+		t.Errorf("Expected pending with empty result, got status=%s result=%q", got.Status, got.Result)
+	}
+
+	pending, err := repo.FindPending(10)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("Expected 1 pending command, got %d (err=%v)", len(pending), err)
+	}
+}
+
+func TestCommandFailInterrupted(t *testing.T) {
+	repo := NewCommandRepository(newTestEngine(t))
+
+	sent := &models.Command{DeviceID: 1, Type: models.CommandTypeWol, Status: models.CommandStatusSent}
+	pending := &models.Command{DeviceID: 1, Type: models.CommandTypeWol, Status: models.CommandStatusPending}
+	// A direct send the phone accepted but that wasn't found in its sent messages
+	accepted := &models.Command{DeviceID: 1, Type: models.CommandTypeSendSms, Status: models.CommandStatusSent, Result: "SMS sent, but not found"}
+	for _, cmd := range []*models.Command{sent, pending, accepted} {
+		if err := repo.Insert(cmd); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	n, err := repo.FailInterrupted("interrupted by server restart")
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 interrupted command, got %d (err=%v)", n, err)
+	}
+	got, _ := repo.FindByID(sent.ID)
+	if got.Status != models.CommandStatusFailed || got.Result != "interrupted by server restart" {
+		t.Errorf("Expected the sent command to fail, got status=%s result=%q", got.Status, got.Result)
+	}
+	if retried, _ := repo.Retry(sent.ID); !retried {
+		t.Error("Expected an interrupted command to be retryable")
+	}
+	if got, _ := repo.FindByID(pending.ID); got.Status != models.CommandStatusPending {
+		t.Errorf("Expected the pending command to be untouched, got %s", got.Status)
+	}
+	if got, _ := repo.FindByID(accepted.ID); got.Status != models.CommandStatusSent {
+		t.Errorf("Expected a finished send to stay sent, got %s", got.Status)
+	}
+}
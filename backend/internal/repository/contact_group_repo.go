@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"backend/internal/models"
+
+	"xorm.io/xorm"
+)
+
+// ContactGroupRepository handles contact group and membership data access.
+type ContactGroupRepository struct {
+	engine *xorm.Engine
+}
+
+// NewContactGroupRepository creates a new ContactGroupRepository.
+func NewContactGroupRepository(engine *xorm.Engine) *ContactGroupRepository {
+	return &ContactGroupRepository{engine: engine}
+}
+
+// ContactGroupWithCount is a group with its number of members.
+type ContactGroupWithCount struct {
+	models.ContactGroup `xorm:"extends"`
+	MemberCount         int64 `xorm:"'member_count'" json:"member_count"`
+}
+
+// FindByDevice returns a device's groups with their member counts, by name.
+func (r *ContactGroupRepository) FindByDevice(deviceID int64) ([]ContactGroupWithCount, error) {
+	var items []ContactGroupWithCount
+	err := r.engine.Table("contact_group").
+		Select("contact_group.*, (SELECT COUNT(*) FROM contact_group_member WHERE contact_group_member.group_id = contact_group.id) AS member_count").
+		Where("contact_group.device_id = ?", deviceID).
+		Asc("contact_group.name").
+		Find(&items)
+	return items, err
+}
+
+// FindByDeviceAndID finds a group by ID within a device.
+// Returns nil if the group doesn't exist or belongs to another device.
+func (r *ContactGroupRepository) FindByDeviceAndID(deviceID, id int64) (*models.ContactGroup, error) {
+	group := &models.ContactGroup{}
+	has, err := r.engine.Where("id = ? AND device_id = ?", id, deviceID).Get(group)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, nil
+	}
+	return group, nil
+}
+
+// ExistsByName checks whether the device already has a group with this name.
+func (r *ContactGroupRepository) ExistsByName(deviceID int64, name string) (bool, error) {
+	return r.engine.Where("device_id = ? AND name = ?", deviceID, name).Exist(&models.ContactGroup{})
+}
+
+// Insert inserts a single group.
+func (r *ContactGroupRepository) Insert(group *models.ContactGroup) error {
+	_, err := r.engine.Insert(group)
+	return err
+}
+
+// Delete removes a group and its memberships; the contacts themselves stay.
+func (r *ContactGroupRepository) Delete(id int64) error {
+	if _, err := r.engine.Where("group_id = ?", id).Delete(&models.ContactGroupMember{}); err != nil {
+		return err
+	}
+	_, err := r.engine.ID(id).Delete(&models.ContactGroup{})
+	return err
+}
+
+// FindMembers returns the group's contacts, by name.
+func (r *ContactGroupRepository) FindMembers(groupID int64) ([]models.Contact, error) {
+	var items []models.Contact
+	err := r.engine.Table("contact").
+		Join("INNER", "contact_group_member", "contact_group_member.contact_id = contact.id").
+		Where("contact_group_member.group_id = ?", groupID).
+		Asc("contact.name").
+		Find(&items)
+	return items, err
+}
+
+// AddMember puts a contact in a group. Returns false if it already was a member.
+func (r *ContactGroupRepository) AddMember(groupID, contactID int64) (bool, error) {
+	exists, err := r.engine.Where("group_id = ? AND contact_id = ?", groupID, contactID).Exist(&models.ContactGroupMember{})
+	if err != nil || exists {
+		return false, err
+	}
+	_, err = r.engine.Insert(&models.ContactGroupMember{GroupID: groupID, ContactID: contactID})
+	return err == nil, err
+}
+
+// RemoveMember takes a contact out of a group. Returns false if it wasn't a member.
+func (r *ContactGroupRepository) RemoveMember(groupID, contactID int64) (bool, error) {
+	n, err := r.engine.Where("group_id = ? AND contact_id = ?", groupID, contactID).Delete(&models.ContactGroupMember{})
+	return n > 0, err
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"backend/internal/models"
+	"backend/internal/smsutil"
 
 	"xorm.io/xorm"
 )
@@ -16,15 +17,30 @@ func NewContactRepository(engine *xorm.Engine) *ContactRepository {
 	return &ContactRepository{engine: engine}
 }
 
-// Exists checks if a contact exists by unique key.
+// Exists checks if a contact exists for the phone number, however it is written.
 func (r *ContactRepository) Exists(deviceID int64, phone string) (bool, error) {
-	return r.engine.Where("device_id = ? AND phone = ?", deviceID, phone).Exist(&models.Contact{})
+	return r.engine.Where("device_id = ? AND phone_key = ?", deviceID, smsutil.NormalizePhone(phone)).Exist(&models.Contact{})
 }
 
-// FindByDeviceAndPhone finds a contact by device and phone.
+// FindByDeviceAndPhone finds a contact by device and phone number, comparing
+// normalized numbers so "+86 138 0013 8000" finds the contact "13800138000".
 func (r *ContactRepository) FindByDeviceAndPhone(deviceID int64, phone string) (*models.Contact, error) {
 	contact := &models.Contact{}
-	has, err := r.engine.Where("device_id = ? AND phone = ?", deviceID, phone).Get(contact)
+	has, err := r.engine.Where("device_id = ? AND phone_key = ?", deviceID, smsutil.NormalizePhone(phone)).Asc("id").Get(contact)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, nil
+	}
+	return contact, nil
+}
+
+// FindByDeviceAndID finds a contact by ID within a device.
+// Returns nil if the contact doesn't exist or belongs to another device.
+func (r *ContactRepository) FindByDeviceAndID(deviceID, id int64) (*models.Contact, error) {
+	contact := &models.Contact{}
+	has, err := r.engine.Where("id = ? AND device_id = ?", id, deviceID).Get(contact)
 	if err != nil {
 		return nil, err
 	}
@@ -46,6 +62,22 @@ func (r *ContactRepository) Update(contact *models.Contact) error {
 	return err
 }
 
+// UpdateDetails saves a locally edited contact's name, email, note and hidden flag.
+func (r *ContactRepository) UpdateDetails(contact *models.Contact) error {
+	_, err := r.engine.ID(contact.ID).Cols("name", "email", "note", "is_hidden").Update(contact)
+	return err
+}
+
+// Delete removes a contact from the local database, and from its groups. SMS
+// and calls only LEFT JOIN contacts, so they fall back to their stored name afterwards.
+func (r *ContactRepository) Delete(id int64) error {
+	if _, err := r.engine.Where("contact_id = ?", id).Delete(&models.ContactGroupMember{}); err != nil {
+		return err
+	}
+	_, err := r.engine.ID(id).Delete(&models.Contact{})
+	return err
+}
+
 // Upsert inserts or updates a contact from device sync.
 // If the contact exists (even if hidden), update the name and mark as not hidden.
 // Otherwise, insert a new record (not hidden).
@@ -123,35 +155,147 @@ func (r *ContactRepository) EnsureHiddenContact(deviceID int64, phone, name stri
 }
 
 // FindByDevice returns contacts for a device.
-// By default, only returns non-hidden contacts (real contacts from device).
-func (r *ContactRepository) FindByDevice(deviceID int64, keyword string) ([]models.Contact, int64, error) {
+// By default, only returns non-hidden contacts (real contacts from device);
+// includeHidden also returns the hidden contacts auto-created from SMS/Calls.
+func (r *ContactRepository) FindByDevice(deviceID int64, keyword string, includeHidden bool) ([]models.Contact, int64, error) {
 	var items []models.Contact
 
-	session := r.engine.Where("device_id = ? AND is_hidden = ?", deviceID, false)
-
-	if keyword != "" {
-		session = session.And("(name LIKE ? OR phone LIKE ?)",
-			"%"+keyword+"%", "%"+keyword+"%")
+	newSession := func() *xorm.Session {
+		session := r.engine.Where("device_id = ?", deviceID)
+		if !includeHidden {
+			session = session.And("is_hidden = ?", false)
+		}
+		if keyword != "" {
+			session = session.And("(name LIKE ? OR phone LIKE ?)",
+				"%"+keyword+"%", "%"+keyword+"%")
+		}
+		return session
 	}
 
 	// Get total count
-	total, err := session.Count(&models.Contact{})
+	total, err := newSession().Count(&models.Contact{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = newSession().Asc("name").Find(&items)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return items, total, nil
+}
+
+// ContactWithDevice represents a contact with its device name.
+type ContactWithDevice struct {
+	models.Contact `xorm:"extends"`
+	DeviceName     string `xorm:"'device_name'" json:"device_name"`
+}
+
+// Search returns non-hidden contacts from all devices whose name or phone matches
+// the keyword, ordered by name. limit caps the returned items; total is the full match count.
+func (r *ContactRepository) Search(keyword string, limit int) ([]ContactWithDevice, int64, error) {
+	var items []ContactWithDevice
+
+	total, err := r.engine.Where("is_hidden = ?", false).
+		And("(name LIKE ? OR phone LIKE ?)", "%"+keyword+"%", "%"+keyword+"%").
+		Count(&models.Contact{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = r.engine.Table("contact").
+		Join("LEFT", "device", "contact.device_id = device.id").
+		Select("contact.*, device.name as device_name").
+		Where("contact.is_hidden = ?", false).
+		And("(contact.name LIKE ? OR contact.phone LIKE ?)", "%"+keyword+"%", "%"+keyword+"%").
+		Asc("contact.name").
+		Limit(limit).
+		Find(&items)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	// Reset session for actual query
-	session = r.engine.Where("device_id = ? AND is_hidden = ?", deviceID, false)
+	return items, total, nil
+}
+
+// UnifiedContact is one phone number across all devices: the contacts stored
+// for it, whose phones normalize to the same key, merged into one entry.
+type UnifiedContact struct {
+	PhoneKey  string              `json:"phone_key"` // Normalized phone number
+	Name      string              `json:"name"`      // Alphabetically first name among the matching contacts
+	DeviceIDs []int64             `json:"device_ids"`
+	Contacts  []ContactWithDevice `json:"contacts"` // One per device, as stored
+}
+
+// FindAll returns contacts of all devices merged by normalized phone number,
+// ordered by name and paginated by number; total counts numbers. keyword
+// matches name or phone (includeHidden as in FindByDevice), and a matching
+// number lists every device it is stored on.
+func (r *ContactRepository) FindAll(keyword string, includeHidden bool, page, pageSize int) ([]UnifiedContact, int64, error) {
+	where := "phone_key <> ''"
+	var args []interface{}
+	if !includeHidden {
+		where += " AND is_hidden = ?"
+		args = append(args, false)
+	}
 	if keyword != "" {
-		session = session.And("(name LIKE ? OR phone LIKE ?)",
-			"%"+keyword+"%", "%"+keyword+"%")
+		where += " AND (name LIKE ? OR phone LIKE ? OR phone_key LIKE ?)"
+		args = append(args, "%"+keyword+"%", "%"+keyword+"%", "%"+smsutil.NormalizePhone(keyword)+"%")
 	}
 
-	err = session.Asc("name").Find(&items)
+	var counts []struct {
+		Count int64 `xorm:"'count'"`
+	}
+	if err := r.engine.SQL("SELECT COUNT(DISTINCT phone_key) AS count FROM contact WHERE "+where, args...).Find(&counts); err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	if len(counts) > 0 {
+		total = counts[0].Count
+	}
+
+	var keys []struct {
+		PhoneKey string `xorm:"'phone_key'"`
+		Name     string `xorm:"'name'"`
+	}
+	pageArgs := append(append([]interface{}{}, args...), pageSize, (page-1)*pageSize)
+	err := r.engine.SQL("SELECT phone_key, MIN(name) AS name FROM contact WHERE "+where+
+		" GROUP BY phone_key ORDER BY name, phone_key LIMIT ? OFFSET ?", pageArgs...).Find(&keys)
 	if err != nil {
 		return nil, 0, err
 	}
+	items := make([]UnifiedContact, len(keys))
+	if len(keys) == 0 {
+		return items, total, nil
+	}
+
+	byKey := make(map[string]*UnifiedContact, len(keys))
+	phoneKeys := make([]string, len(keys))
+	for i, k := range keys {
+		items[i] = UnifiedContact{PhoneKey: k.PhoneKey, Name: k.Name, DeviceIDs: []int64{}, Contacts: []ContactWithDevice{}}
+		byKey[k.PhoneKey] = &items[i]
+		phoneKeys[i] = k.PhoneKey
+	}
 
+	var contacts []ContactWithDevice
+	session := r.engine.Table("contact").
+		Join("LEFT", "device", "contact.device_id = device.id").
+		Select("contact.*, device.name as device_name").
+		In("contact.phone_key", phoneKeys)
+	if !includeHidden {
+		session = session.And("contact.is_hidden = ?", false)
+	}
+	if err := session.Asc("contact.device_id", "contact.id").Find(&contacts); err != nil {
+		return nil, 0, err
+	}
+	for _, contact := range contacts {
+		item := byKey[contact.PhoneKey]
+		if n := len(item.DeviceIDs); n == 0 || item.DeviceIDs[n-1] != contact.DeviceID {
+			item.DeviceIDs = append(item.DeviceIDs, contact.DeviceID)
+		}
+		item.Contacts = append(item.Contacts, contact)
+	}
 	return items, total, nil
 }
 
@@ -169,3 +313,13 @@ func (r *ContactRepository) HasAnySynced(deviceID int64) (bool, error) {
 	}
 	return count > 0, nil
 }
+
+// CountVisible returns the number of non-hidden contacts, optionally for one
+// device (deviceID 0 = all devices).
+func (r *ContactRepository) CountVisible(deviceID int64) (int64, error) {
+	session := r.engine.Where("is_hidden = ?", false)
+	if deviceID > 0 {
+		session = session.And("device_id = ?", deviceID)
+	}
+	return session.Count(&models.Contact{})
+}
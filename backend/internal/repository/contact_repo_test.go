@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"testing"
+
+	"backend/internal/models"
+)
+
+func TestContactSearchAcrossDevices(t *testing.T) {
+	engine := newTestEngine(t)
+	repo := NewContactRepository(engine)
+
+	engine.Insert(&models.Device{ID: 1, Name: "phone-a", PhoneAddr: "a", SM4Key: "k"})
+	engine.Insert(&models.Device{ID: 2, Name: "phone-b", PhoneAddr: "b", SM4Key: "k"})
+	engine.Insert(&models.Contact{DeviceID: 1, Name: "Alice", Phone: "111"})
+	engine.Insert(&models.Contact{DeviceID: 2, Name: "Alicia", Phone: "222"})
+	engine.Insert(&models.Contact{DeviceID: 2, Name: "Bob", Phone: "333"})
+	engine.Insert(&models.Contact{DeviceID: 1, Name: "alice-hidden", Phone: "444", IsHidden: true})
+
+	items, total, err := repo.Search("Ali", 1)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("Expected 2 visible matches, got %d", total)
+	}
+	if len(items) != 1 || items[0].Name != "Alice" || items[0].DeviceName != "phone-a" {
+		t.Errorf("Expected limited result [Alice@phone-a], got %+v", items)
+	}
+}
+
+func TestContactFindByDeviceIncludeHidden(t *testing.T) {
+	engine := newTestEngine(t)
+	repo := NewContactRepository(engine)
+
+	engine.Insert(&models.Contact{DeviceID: 1, Name: "Alice", Phone: "111"})
+	if _, err := repo.EnsureHiddenContact(1, "10086", ""); err != nil {
+		t.Fatalf("EnsureHiddenContact failed: %v", err)
+	}
+
+	_, total, err := repo.FindByDevice(1, "", false)
+	if err != nil || total != 1 {
+		t.Fatalf("Expected only the visible contact by default, got total=%d err=%v", total, err)
+	}
+	items, total, err := repo.FindByDevice(1, "", true)
+	if err != nil || total != 2 {
+		t.Fatalf("Expected hidden contacts with includeHidden, got total=%d err=%v", total, err)
+	}
+	if items[0].Phone != "10086" || !items[0].IsHidden {
+		t.Errorf("Expected the hidden contact flagged in results, got %+v", items)
+	}
+}
+
+func TestHiddenContactUnhiddenBySync(t *testing.T) {
+	engine := newTestEngine(t)
+	repo := NewContactRepository(engine)
+
+	hidden, err := repo.EnsureHiddenContact(1, "10086", "Unknown Number")
+	if err != nil {
+		t.Fatalf("EnsureHiddenContact failed: %v", err)
+	}
+	if !hidden.IsHidden || hidden.Name != "10086" {
+		t.Fatalf("Expected a hidden contact named after the number, got %+v", hidden)
+	}
+
+	isNew, err := repo.Upsert(&models.Contact{DeviceID: 1, Name: "China Mobile", Phone: "10086"})
+	if err != nil || isNew {
+		t.Fatalf("Expected Upsert to update the existing contact, got isNew=%v err=%v", isNew, err)
+	}
+	synced, _ := repo.FindByDeviceAndPhone(1, "10086")
+	if synced.IsHidden || synced.Name != "China Mobile" {
+		t.Errorf("Expected device sync to unhide and rename the contact, got %+v", synced)
+	}
+}
+
+func TestContactMatchesDifferentlyWrittenNumbers(t *testing.T) {
+	engine := newTestEngine(t)
+	repo := NewContactRepository(engine)
+
+	engine.Insert(&models.Contact{DeviceID: 1, Name: "Alice", Phone: "+86 138 0013 8000"})
+	contact, err := repo.EnsureHiddenContact(1, "13800138000", "")
+	if err != nil {
+		t.Fatalf("EnsureHiddenContact failed: %v", err)
+	}
+	if contact.Name != "Alice" {
+		t.Errorf("Expected the existing contact, got %+v", contact)
+	}
+	if isNew, err := repo.Upsert(&models.Contact{DeviceID: 1, Name: "Alice W", Phone: "138-0013-8000"}); err != nil || isNew {
+		t.Errorf("Expected Upsert to update the existing contact, got isNew=%v err=%v", isNew, err)
+	}
+	if n, _ := repo.CountByDevice(1); n != 1 {
+		t.Errorf("Expected one contact for the number, got %d", n)
+	}
+
+	engine.Insert(&models.SmsMessage{DeviceID: 1, Address: "+8613800138000", Name: "x", Type: 1, SmsTime: 1})
+	items, _, err := NewSmsRepository(engine).FindByDevice(1, 0, 1, 20, "", ListOptions{})
+	if err != nil {
+		t.Fatalf("FindByDevice failed: %v", err)
+	}
+	if len(items) != 1 || items[0].ContactName != "Alice W" {
+		t.Errorf("Expected the SMS to show the contact name, got %+v", items)
+	}
+}
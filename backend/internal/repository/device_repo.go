@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"strings"
+
+	"backend/internal/models"
+
+	"xorm.io/xorm"
+)
+
+// DeviceRepository handles device data access.
+type DeviceRepository struct {
+	engine *xorm.Engine
+}
+
+// NewDeviceRepository creates a new DeviceRepository.
+func NewDeviceRepository(engine *xorm.Engine) *DeviceRepository {
+	return &DeviceRepository{engine: engine}
+}
+
+// NormalizeTags cleans a comma-separated tag list: trims whitespace, drops empty
+// and duplicate (case-insensitive) tags, and keeps the first spelling of each.
+func NormalizeTags(tags string) string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, tag)
+	}
+	return strings.Join(out, ",")
+}
+
+// hasTag reports whether a comma-separated tag list contains tag (case-insensitive).
+func hasTag(tags, tag string) bool {
+	for _, t := range strings.Split(tags, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindByTag returns all devices carrying the tag. An empty tag returns all devices.
+// Tags are matched in Go rather than SQL: the device table is small and this
+// avoids dialect-specific string concatenation for exact list matching.
+func (r *DeviceRepository) FindByTag(tag string) ([]models.Device, error) {
+	var devices []models.Device
+	if err := r.engine.Find(&devices); err != nil {
+		return nil, err
+	}
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return devices, nil
+	}
+
+	matched := devices[:0]
+	for _, d := range devices {
+		if hasTag(d.Tags, tag) {
+			matched = append(matched, d)
+		}
+	}
+	return matched, nil
+}
+
+// IDsByTag resolves a tag to the IDs of the devices carrying it.
+func (r *DeviceRepository) IDsByTag(tag string) ([]int64, error) {
+	devices, err := r.FindByTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(devices))
+	for _, d := range devices {
+		ids = append(ids, d.ID)
+	}
+	return ids, nil
+}
+
+// CountByStatus returns the number of devices per status (online, offline).
+func (r *DeviceRepository) CountByStatus() (map[string]int64, error) {
+	var rows []struct {
+		Status string `xorm:"'status'"`
+		Count  int64  `xorm:"'count'"`
+	}
+	if err := r.engine.SQL("SELECT status, COUNT(*) AS count FROM device GROUP BY status").Find(&rows); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// ResetCounts reports what ResetData removed.
+type ResetCounts struct {
+	Sms      int64 `json:"sms"`
+	Calls    int64 `json:"calls"`
+	Contacts int64 `json:"contacts"`
+}
+
+// ResetData hard-deletes every SMS and call of a device, soft-deleted ones
+// included, and with includeContacts its contacts and their group memberships.
+// The device's sync times are cleared so the next sync starts from scratch.
+// Everything happens in one transaction.
+func (r *DeviceRepository) ResetData(deviceID int64, includeContacts bool) (ResetCounts, error) {
+	var counts ResetCounts
+	session := r.engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return counts, err
+	}
+
+	var err error
+	if counts.Sms, err = session.Unscoped().Where("device_id = ?", deviceID).Delete(&models.SmsMessage{}); err != nil {
+		session.Rollback()
+		return ResetCounts{}, err
+	}
+	if counts.Calls, err = session.Unscoped().Where("device_id = ?", deviceID).Delete(&models.CallLog{}); err != nil {
+		session.Rollback()
+		return ResetCounts{}, err
+	}
+	cols := []string{"sms_synced_at", "calls_synced_at"}
+	if includeContacts {
+		if _, err = session.Where("contact_id IN (SELECT id FROM contact WHERE device_id = ?)", deviceID).
+			Delete(&models.ContactGroupMember{}); err != nil {
+			session.Rollback()
+			return ResetCounts{}, err
+		}
+		if counts.Contacts, err = session.Where("device_id = ?", deviceID).Delete(&models.Contact{}); err != nil {
+			session.Rollback()
+			return ResetCounts{}, err
+		}
+		cols = append(cols, "contacts_synced_at")
+	}
+	if _, err = session.ID(deviceID).Cols(cols...).Update(&models.Device{}); err != nil {
+		session.Rollback()
+		return ResetCounts{}, err
+	}
+	return counts, session.Commit()
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"testing"
+
+	"backend/internal/models"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got := NormalizeTags(" office, ,Test,office ,OFFICE,lab")
+	if got != "office,Test,lab" {
+		t.Fatalf("NormalizeTags = %q", got)
+	}
+}
+
+func TestFindAllFiltersByDeviceTag(t *testing.T) {
+	engine := newTestEngine(t)
+
+	office := models.Device{Name: "a", PhoneAddr: "http://a", Tags: "office,test"}
+	lab := models.Device{Name: "b", PhoneAddr: "http://b", Tags: "lab"}
+	for _, d := range []*models.Device{&office, &lab} {
+		if _, err := engine.Insert(d); err != nil {
+			t.Fatalf("insert device: %v", err)
+		}
+	}
+	for _, m := range []models.SmsMessage{
+		{DeviceID: office.ID, Address: "1", Body: "x", Type: 1, SmsTime: 1},
+		{DeviceID: lab.ID, Address: "2", Body: "y", Type: 1, SmsTime: 2},
+	} {
+		if _, err := engine.Insert(&m); err != nil {
+			t.Fatalf("insert sms: %v", err)
+		}
+	}
+
+	devRepo := NewDeviceRepository(engine)
+	ids, err := devRepo.IDsByTag("OFFICE")
+	if err != nil {
+		t.Fatalf("IDsByTag: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != office.ID {
+		t.Fatalf("IDsByTag = %v, want [%d]", ids, office.ID)
+	}
+
+	smsRepo := NewSmsRepository(engine)
+	items, total, err := smsRepo.FindAll(0, 1, 20, "", 0, ids, ListOptions{})
+	if err != nil {
+		t.Fatalf("FindAll: %v", err)
+	}
+	if total != 1 || len(items) != 1 || items[0].DeviceID != office.ID {
+		t.Fatalf("FindAll by tag = %d items (total %d)", len(items), total)
+	}
+	unread, err := smsRepo.CountUnread(0, 0, ids)
+	if err != nil {
+		t.Fatalf("CountUnread: %v", err)
+	}
+	if unread != 1 {
+		t.Fatalf("CountUnread by tag = %d, want 1", unread)
+	}
+
+	_, total, err = smsRepo.FindAll(0, 1, 20, "", 0, nil, ListOptions{})
+	if err != nil {
+		t.Fatalf("FindAll: %v", err)
+	}
+	if total != 2 {
+		t.Fatalf("FindAll without tag total = %d, want 2", total)
+	}
+}
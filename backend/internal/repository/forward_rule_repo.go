@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"backend/internal/models"
+
+	"xorm.io/xorm"
+)
+
+// ForwardRuleRepository handles SMS forwarding rule data access.
+type ForwardRuleRepository struct {
+	engine *xorm.Engine
+}
+
+// NewForwardRuleRepository creates a new ForwardRuleRepository.
+func NewForwardRuleRepository(engine *xorm.Engine) *ForwardRuleRepository {
+	return &ForwardRuleRepository{engine: engine}
+}
+
+// FindAll returns all rules, oldest first.
+func (r *ForwardRuleRepository) FindAll() ([]models.ForwardRule, error) {
+	var rules []models.ForwardRule
+	err := r.engine.Asc("id").Find(&rules)
+	return rules, err
+}
+
+// FindActive returns the enabled rules that apply to a device,
+// including global rules (device_id = 0).
+func (r *ForwardRuleRepository) FindActive(deviceID int64) ([]models.ForwardRule, error) {
+	var rules []models.ForwardRule
+	err := r.engine.Where("enabled = ?", true).
+		And("(device_id = 0 OR device_id = ?)", deviceID).
+		Asc("id").
+		Find(&rules)
+	return rules, err
+}
+
+// FindByID returns a rule by ID, or nil if it doesn't exist.
+func (r *ForwardRuleRepository) FindByID(id int64) (*models.ForwardRule, error) {
+	rule := &models.ForwardRule{}
+	has, err := r.engine.ID(id).Get(rule)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, nil
+	}
+	return rule, nil
+}
+
+// Insert inserts a single rule.
+func (r *ForwardRuleRepository) Insert(rule *models.ForwardRule) error {
+	_, err := r.engine.Insert(rule)
+	return err
+}
+
+// Update saves all editable columns of a rule.
+func (r *ForwardRuleRepository) Update(rule *models.ForwardRule) error {
+	_, err := r.engine.ID(rule.ID).
+		Cols("device_id", "name", "match_type", "pattern", "target_url", "secret", "enabled").
+		Update(rule)
+	return err
+}
+
+// Delete deletes a rule by ID.
+func (r *ForwardRuleRepository) Delete(id int64) error {
+	_, err := r.engine.ID(id).Delete(&models.ForwardRule{})
+	return err
+}
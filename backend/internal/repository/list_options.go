@@ -0,0 +1,81 @@
+package repository
+
+import "xorm.io/xorm"
+
+// SmsSortColumns maps the sort_by values accepted by SMS lists to columns.
+// Only these keys may reach ORDER BY, so user input never names a column.
+// relevance ranks body matches first, then falls back to time.
+var SmsSortColumns = map[string]string{
+	"time":        "sms_time",
+	"address":     "address",
+	SortRelevance: "sms_time",
+}
+
+// CallSortColumns maps the sort_by values accepted by call lists to columns.
+var CallSortColumns = map[string]string{
+	"time":     "call_time",
+	"number":   "number",
+	"duration": "duration",
+}
+
+// ListOptions holds optional filters shared by the SMS and call list queries.
+// Zero values apply no restriction and sort newest first.
+type ListOptions struct {
+	From      int64  // Earliest record time in milliseconds, inclusive (0=unbounded)
+	To        int64  // Latest record time in milliseconds, inclusive (0=unbounded)
+	SortBy    string // Key of SmsSortColumns/CallSortColumns (empty=time)
+	Ascending bool   // Sort ascending instead of descending
+	SimID     *int   // Only records from this SIM slot: 0=SIM1, 1=SIM2, -1=unknown (nil=any)
+
+	IncludeArchived bool // SMS only: also return messages of archived conversations
+	UnreadOnly      bool // Only unread records; honored by the FindAll lists
+}
+
+// applyUnread restricts the session to unread rows if UnreadOnly is set.
+func (o ListOptions) applyUnread(session *xorm.Session, readColumn string) *xorm.Session {
+	if o.UnreadOnly {
+		session = session.And(readColumn+" = ?", false)
+	}
+	return session
+}
+
+// applyArchived leaves out archived rows unless IncludeArchived is set.
+func (o ListOptions) applyArchived(session *xorm.Session, archivedColumn string) *xorm.Session {
+	if !o.IncludeArchived {
+		session = session.And(archivedColumn+" = ?", false)
+	}
+	return session
+}
+
+// applySim restricts the session to rows from the SimID slot, if set.
+func (o ListOptions) applySim(session *xorm.Session, simColumn string) *xorm.Session {
+	if o.SimID != nil {
+		session = session.And(simColumn+" = ?", *o.SimID)
+	}
+	return session
+}
+
+// applyTimeRange restricts the session to rows whose timeColumn lies within From/To.
+func (o ListOptions) applyTimeRange(session *xorm.Session, timeColumn string) *xorm.Session {
+	if o.From > 0 {
+		session = session.And(timeColumn+" >= ?", o.From)
+	}
+	if o.To > 0 {
+		session = session.And(timeColumn+" <= ?", o.To)
+	}
+	return session
+}
+
+// applyOrder orders the session by the whitelisted SortBy column of table,
+// falling back to the time column for unknown keys. The id breaks ties so
+// pages stay stable.
+func (o ListOptions) applyOrder(session *xorm.Session, table string, columns map[string]string) *xorm.Session {
+	column, ok := columns[o.SortBy]
+	if !ok {
+		column = columns["time"]
+	}
+	if o.Ascending {
+		return session.Asc(table+"."+column, table+".id")
+	}
+	return session.Desc(table+"."+column, table+".id")
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"time"
+
+	"backend/internal/models"
+
+	"xorm.io/xorm"
+)
+
+// LocationHistoryRepository handles location history data access.
+type LocationHistoryRepository struct {
+	engine *xorm.Engine
+}
+
+// NewLocationHistoryRepository creates a new LocationHistoryRepository.
+func NewLocationHistoryRepository(engine *xorm.Engine) *LocationHistoryRepository {
+	return &LocationHistoryRepository{engine: engine}
+}
+
+// Insert inserts a single location fix.
+func (r *LocationHistoryRepository) Insert(record *models.LocationHistory) error {
+	_, err := r.engine.Insert(record)
+	return err
+}
+
+// FindLatest returns the most recent fix of a device, or nil if there is none.
+func (r *LocationHistoryRepository) FindLatest(deviceID int64) (*models.LocationHistory, error) {
+	record := &models.LocationHistory{}
+	has, err := r.engine.Where("device_id = ?", deviceID).Desc("recorded_at", "id").Get(record)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, nil
+	}
+	return record, nil
+}
+
+// FindRange returns the fixes of a device recorded within [from, to], oldest first.
+// A zero from or to leaves that side unbounded.
+func (r *LocationHistoryRepository) FindRange(deviceID int64, from, to time.Time) ([]models.LocationHistory, error) {
+	session := r.engine.Where("device_id = ?", deviceID)
+	if !from.IsZero() {
+		session = session.And("recorded_at >= ?", from)
+	}
+	if !to.IsZero() {
+		session = session.And("recorded_at <= ?", to)
+	}
+
+	var items []models.LocationHistory
+	err := session.Asc("recorded_at", "id").Find(&items)
+	return items, err
+}
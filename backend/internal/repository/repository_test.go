@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"testing"
+
+	"backend/config"
+	"backend/internal/db"
+
+	"xorm.io/xorm"
+)
+
+// newTestEngine boots an in-memory SQLite engine with the full schema.
+func newTestEngine(t *testing.T) *xorm.Engine {
+	t.Helper()
+	cfg := &config.Config{
+		Database: config.Database{Driver: "sqlite", DSN: ":memory:"},
+	}
+	engine, err := db.NewEngine(cfg)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+	return engine
+}
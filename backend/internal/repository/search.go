@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"strings"
+
+	"xorm.io/xorm"
+)
+
+// SortRelevance is the sort_by key that ranks keyword matches in the SMS
+// body above matches that are only in the address or contact name.
+const SortRelevance = "relevance"
+
+// searchTerms splits a keyword into space-separated terms. A keyword without
+// spaces yields a single term, matching the old substring search.
+func searchTerms(keyword string) []string {
+	return strings.Fields(keyword)
+}
+
+// applyTerms requires every term to appear in at least one of columns.
+func applyTerms(session *xorm.Session, terms []string, columns ...string) *xorm.Session {
+	for _, term := range terms {
+		conds := make([]string, len(columns))
+		args := make([]interface{}, len(columns))
+		for i, column := range columns {
+			conds[i] = column + " LIKE ?"
+			args[i] = "%" + term + "%"
+		}
+		session = session.And("("+strings.Join(conds, " OR ")+")", args...)
+	}
+	return session
+}
+
+// orderByBodyMatches orders rows by how many terms appear in bodyColumn, most
+// first. Ties keep the order applied afterwards.
+func orderByBodyMatches(session *xorm.Session, terms []string, bodyColumn string) *xorm.Session {
+	cases := make([]string, len(terms))
+	args := make([]interface{}, len(terms))
+	for i, term := range terms {
+		cases[i] = "CASE WHEN " + bodyColumn + " LIKE ? THEN 1 ELSE 0 END"
+		args[i] = "%" + term + "%"
+	}
+	return session.OrderBy("("+strings.Join(cases, " + ")+") DESC", args...)
+}
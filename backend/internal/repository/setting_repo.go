@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"backend/internal/models"
+
+	"xorm.io/xorm"
+)
+
+// SettingRepository handles server-managed settings.
+type SettingRepository struct {
+	engine *xorm.Engine
+}
+
+// NewSettingRepository creates a new SettingRepository.
+func NewSettingRepository(engine *xorm.Engine) *SettingRepository {
+	return &SettingRepository{engine: engine}
+}
+
+// Get returns a setting's value, and false if it was never set.
+func (r *SettingRepository) Get(name string) (string, bool, error) {
+	var setting models.Setting
+	has, err := r.engine.ID(name).Get(&setting)
+	if err != nil || !has {
+		return "", false, err
+	}
+	return setting.Value, true, nil
+}
+
+// Set stores a setting, replacing any previous value.
+func (r *SettingRepository) Set(name, value string) error {
+	setting := &models.Setting{Name: name, Value: value}
+	exists, err := r.engine.ID(name).Exist(&models.Setting{})
+	if err != nil {
+		return err
+	}
+	if exists {
+		_, err = r.engine.ID(name).Cols("value").Update(setting)
+	} else {
+		_, err = r.engine.Insert(setting)
+	}
+	return err
+}
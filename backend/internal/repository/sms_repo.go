@@ -1,11 +1,17 @@
 package repository
 
 import (
+	"time"
+
 	"backend/internal/models"
+	"backend/internal/smsutil"
 
 	"xorm.io/xorm"
 )
 
+// iterateBatchSize is how many rows the IterateByDevice methods read per query.
+var iterateBatchSize = 500
+
 // SmsRepository handles SMS data access.
 type SmsRepository struct {
 	engine *xorm.Engine
@@ -31,6 +37,87 @@ func (r *SmsRepository) ExistsIncludingDeleted(deviceID int64, address string, s
 		deviceID, address, smsTime, smsType).Exist(&models.SmsMessage{})
 }
 
+// HasNearDuplicate reports whether a message with the same address, type and body
+// exists within window milliseconds of smsTime, including soft-deleted records.
+func (r *SmsRepository) HasNearDuplicate(deviceID int64, address string, smsType int, body string, smsTime, window int64) (bool, error) {
+	return r.engine.Unscoped().
+		Where("device_id = ? AND address = ? AND type = ? AND body = ?", deviceID, address, smsType, body).
+		And("sms_time BETWEEN ? AND ?", smsTime-window, smsTime+window).
+		Exist(&models.SmsMessage{})
+}
+
+// SmsKey is the unique key of an SMS record within a device.
+type SmsKey struct {
+	Address string
+	SmsTime int64
+	Type    int
+}
+
+// FilterNewSms returns the keys that don't exist yet for a device, including soft-deleted
+// records, in input order and without duplicates. Uses a single query instead of one per key.
+func (r *SmsRepository) FilterNewSms(deviceID int64, keys []SmsKey) ([]SmsKey, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	times := make([]int64, 0, len(keys))
+	for _, key := range keys {
+		times = append(times, key.SmsTime)
+	}
+
+	// Narrow by timestamp in SQL, then match the full key in Go
+	var existing []models.SmsMessage
+	err := r.engine.Unscoped().Cols("address", "sms_time", "type").
+		Where("device_id = ?", deviceID).In("sms_time", times).Find(&existing)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[SmsKey]bool, len(existing)+len(keys))
+	for _, sms := range existing {
+		seen[SmsKey{Address: sms.Address, SmsTime: sms.SmsTime, Type: sms.Type}] = true
+	}
+
+	var newKeys []SmsKey
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			newKeys = append(newKeys, key)
+		}
+	}
+	return newKeys, nil
+}
+
+// FindByID returns an SMS by ID, or nil if it doesn't exist or is deleted.
+func (r *SmsRepository) FindByID(id int64) (*models.SmsMessage, error) {
+	sms := &models.SmsMessage{}
+	has, err := r.engine.ID(id).Get(sms)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, nil
+	}
+	return sms, nil
+}
+
+// LatestSimID returns the SIM slot (0=SIM1, 1=SIM2) of the newest SMS to or
+// from any of addresses on a device, compared by normalized number, or -1 if
+// none has a known slot. Failed sends are ignored.
+func (r *SmsRepository) LatestSimID(deviceID int64, addresses []string) (int, error) {
+	keys := make([]string, len(addresses))
+	for i, address := range addresses {
+		keys[i] = smsutil.NormalizePhone(address)
+	}
+	var sms models.SmsMessage
+	has, err := r.engine.Where("device_id = ? AND sim_id >= 0 AND delivery_status <> ?", deviceID, models.DeliveryStatusFailed).
+		In("address_key", keys).Desc("sms_time").Get(&sms)
+	if err != nil || !has {
+		return -1, err
+	}
+	return sms.SimID, nil
+}
+
 // Insert inserts a single SMS record.
 func (r *SmsRepository) Insert(sms *models.SmsMessage) error {
 	_, err := r.engine.Insert(sms)
@@ -45,28 +132,60 @@ func (r *SmsRepository) InsertBatch(smsList []*models.SmsMessage) (int64, error)
 	return r.engine.Insert(&smsList)
 }
 
+// InsertDeleted inserts SMS records as already soft-deleted, in one
+// transaction. They count as existing for FilterNewSms without showing
+// anywhere, which makes them tombstones of messages that must not be stored.
+func (r *SmsRepository) InsertDeleted(smsList []*models.SmsMessage) error {
+	session := r.engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	for _, sms := range smsList {
+		if _, err := session.Insert(sms); err != nil {
+			session.Rollback()
+			return err
+		}
+		if _, err := session.ID(sms.ID).Delete(&models.SmsMessage{}); err != nil {
+			session.Rollback()
+			return err
+		}
+	}
+	return session.Commit()
+}
+
+// UpdateDeliveryStatus sets the delivery status of a stored sent message,
+// reporting whether it changed.
+func (r *SmsRepository) UpdateDeliveryStatus(deviceID int64, address string, smsTime int64, status string) (bool, error) {
+	affected, err := r.engine.Where("device_id = ? AND address = ? AND sms_time = ? AND type = 2 AND delivery_status <> ?", deviceID, address, smsTime, status).
+		Cols("delivery_status").Update(&models.SmsMessage{DeliveryStatus: status})
+	return affected > 0, err
+}
+
 // SmsWithContactName represents an SMS message with contact name from contact list.
 type SmsWithContactName struct {
 	models.SmsMessage `xorm:"extends"`
 	ContactName       string `json:"contact_name"` // Name from contact list (overrides SmsMessage.Name)
 }
 
-// FindByDevice returns SMS messages for a device with pagination.
+// FindByDevice returns SMS messages for a device with pagination, leaving out
+// blocked ones and, unless opts.IncludeArchived, archived ones.
 // smsType: 0=all, 1=received, 2=sent
+// keyword: space-separated terms that must all match (empty=no filter)
 // Uses contact name from contact list if available, otherwise falls back to SMS.Name or "Unknown Number".
-func (r *SmsRepository) FindByDevice(deviceID int64, smsType, page, pageSize int, keyword string) ([]SmsWithContactName, int64, error) {
+func (r *SmsRepository) FindByDevice(deviceID int64, smsType, page, pageSize int, keyword string, opts ListOptions) ([]SmsWithContactName, int64, error) {
 	var items []SmsWithContactName
 
 	// Count query
-	countSession := r.engine.Table("sms_message").Where("device_id = ?", deviceID)
+	countSession := r.engine.Table("sms_message").Where("device_id = ? AND blocked = ?", deviceID, false)
 	if smsType > 0 {
 		countSession = countSession.And("type = ?", smsType)
 	}
-	if keyword != "" {
-		// Search in both SMS name/address/body and contact name
-		countSession = countSession.And("(address LIKE ? OR name LIKE ? OR body LIKE ?)",
-			"%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%")
-	}
+	terms := searchTerms(keyword)
+	countSession = applyTerms(countSession, terms, "address", "name", "body")
+	countSession = opts.applyTimeRange(countSession, "sms_time")
+	countSession = opts.applySim(countSession, "sim_id")
+	countSession = opts.applyArchived(countSession, "archived")
 
 	// Get total count
 	total, err := countSession.Count(&models.SmsMessage{})
@@ -76,18 +195,18 @@ func (r *SmsRepository) FindByDevice(deviceID int64, smsType, page, pageSize int
 
 	// Data query with LEFT JOIN to contact table
 	session := r.engine.Table("sms_message").
-		Join("LEFT", "contact", "sms_message.device_id = contact.device_id AND sms_message.address = contact.phone").
+		Join("LEFT", "contact", "sms_message.device_id = contact.device_id AND sms_message.address_key = contact.phone_key").
 		Select("sms_message.*, COALESCE(contact.name, sms_message.name, 'Unknown Number') as contact_name").
-		Where("sms_message.device_id = ?", deviceID)
+		Where("sms_message.device_id = ? AND sms_message.blocked = ?", deviceID, false)
 
 	if smsType > 0 {
 		session = session.And("sms_message.type = ?", smsType)
 	}
-	if keyword != "" {
-		// Search in both SMS name/address/body and contact name
-		session = session.And("(sms_message.address LIKE ? OR sms_message.name LIKE ? OR sms_message.body LIKE ? OR contact.name LIKE ?)",
-			"%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%")
-	}
+	// Every term must appear in the SMS name/address/body or the contact name
+	session = applyTerms(session, terms, "sms_message.address", "sms_message.name", "sms_message.body", "contact.name")
+	session = opts.applyTimeRange(session, "sms_message.sms_time")
+	session = opts.applySim(session, "sms_message.sim_id")
+	session = opts.applyArchived(session, "sms_message.archived")
 
 	// Apply pagination and ordering
 	if page <= 0 {
@@ -98,7 +217,10 @@ func (r *SmsRepository) FindByDevice(deviceID int64, smsType, page, pageSize int
 	}
 	offset := (page - 1) * pageSize
 
-	err = session.Desc("sms_message.sms_time").Limit(pageSize, offset).Find(&items)
+	if opts.SortBy == SortRelevance && len(terms) > 0 {
+		session = orderByBodyMatches(session, terms, "sms_message.body")
+	}
+	err = opts.applyOrder(session, "sms_message", SmsSortColumns).Limit(pageSize, offset).Find(&items)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -111,6 +233,158 @@ func (r *SmsRepository) FindByDevice(deviceID int64, smsType, page, pageSize int
 	return items, total, nil
 }
 
+// Conversation summarizes all SMS exchanged with one address on a device.
+type Conversation struct {
+	Address      string `xorm:"'address'" json:"address"`
+	ContactName  string `xorm:"'contact_name'" json:"contact_name"`
+	LastBody     string `xorm:"'last_body'" json:"last_body"`
+	LastType     int    `xorm:"'last_type'" json:"last_type"` // 1=received, 2=sent
+	LastTime     int64  `xorm:"'last_time'" json:"last_time"` // Timestamp in milliseconds
+	UnreadCount  int64  `xorm:"'unread_count'" json:"unread_count"`
+	MessageCount int64  `xorm:"'message_count'" json:"message_count"`
+	Archived     bool   `xorm:"'archived'" json:"archived"`
+}
+
+// FindConversations returns one entry per distinct address on a device with the
+// latest message preview and unread count, most recent activity first.
+// Soft-deleted and blocked messages are ignored, and so are archived ones
+// unless includeArchived is set.
+func (r *SmsRepository) FindConversations(deviceID int64, page, pageSize int, includeArchived bool) ([]Conversation, int64, error) {
+	filter := "device_id = ? AND blocked = ? AND deleted_at IS NULL"
+	filterArgs := []interface{}{deviceID, false}
+	if !includeArchived {
+		filter += " AND archived = ?"
+		filterArgs = append(filterArgs, false)
+	}
+
+	var total int64
+	_, err := r.engine.SQL("SELECT COUNT(DISTINCT address) FROM sms_message WHERE "+filter, filterArgs...).Get(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	offset := (page - 1) * pageSize
+
+	// The correlated subquery picks a single latest row even if two messages share the same timestamp
+	var items []Conversation
+	// A conversation counts as archived when every message in it is
+	args := []interface{}{false, true}
+	args = append(args, filterArgs...)
+	args = append(args, filterArgs...)
+	args = append(args, deviceID, pageSize, offset)
+	err = r.engine.SQL(`SELECT g.address, g.last_time, g.unread_count, g.message_count, g.archived,
+		m.body AS last_body, m.type AS last_type,
+		COALESCE(contact.name, m.name, 'Unknown Number') AS contact_name
+	FROM (
+		SELECT address, MAX(sms_time) AS last_time,
+			SUM(CASE WHEN is_read = ? THEN 1 ELSE 0 END) AS unread_count,
+			MIN(CASE WHEN archived = ? THEN 1 ELSE 0 END) AS archived,
+			COUNT(*) AS message_count
+		FROM sms_message
+		WHERE `+filter+`
+		GROUP BY address
+	) g
+	JOIN sms_message m ON m.id = (
+		SELECT MAX(id) FROM sms_message
+		WHERE address = g.address AND sms_time = g.last_time AND `+filter+`
+	)
+	LEFT JOIN contact ON contact.device_id = ? AND contact.phone_key = m.address_key
+	ORDER BY g.last_time DESC
+	LIMIT ? OFFSET ?`, args...).Find(&items)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return items, total, nil
+}
+
+// FindThread returns all SMS (sent and received) exchanged with an address on a
+// device in ascending time order with pagination, leaving out blocked ones.
+func (r *SmsRepository) FindThread(deviceID int64, address string, page, pageSize int) ([]SmsWithContactName, int64, error) {
+	var items []SmsWithContactName
+
+	total, err := r.engine.Where("device_id = ? AND address = ? AND blocked = ?", deviceID, address, false).Count(&models.SmsMessage{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	offset := (page - 1) * pageSize
+
+	err = r.engine.Table("sms_message").
+		Join("LEFT", "contact", "sms_message.device_id = contact.device_id AND sms_message.address_key = contact.phone_key").
+		Select("sms_message.*, COALESCE(contact.name, sms_message.name, 'Unknown Number') as contact_name").
+		Where("sms_message.device_id = ? AND sms_message.address = ? AND sms_message.blocked = ?", deviceID, address, false).
+		Asc("sms_message.sms_time", "sms_message.id").
+		Limit(pageSize, offset).
+		Find(&items)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range items {
+		items[i].Name = items[i].ContactName
+	}
+
+	return items, total, nil
+}
+
+// SetArchived archives or unarchives every message exchanged with an address
+// on a device and returns how many rows were updated.
+func (r *SmsRepository) SetArchived(deviceID int64, address string, archived bool) (int64, error) {
+	return r.engine.Where("device_id = ? AND address = ?", deviceID, address).
+		Cols("archived").Update(&models.SmsMessage{Archived: archived})
+}
+
+// IterateByDevice streams all SMS messages for a device in ascending time order,
+// with the same contact name resolution as FindByDevice, leaving out messages
+// hidden by the blocklist. Rows are read iterateBatchSize at a time, each batch
+// picking up after the (sms_time, id) of the last, so large histories are never
+// loaded into memory at once and no connection is held while fn runs (SQLite
+// has only one).
+// smsType: 0=all, 1=received, 2=sent
+func (r *SmsRepository) IterateByDevice(deviceID int64, smsType int, fn func(*SmsWithContactName) error) error {
+	var last *SmsWithContactName
+	for {
+		session := r.engine.Table("sms_message").
+			Join("LEFT", "contact", "sms_message.device_id = contact.device_id AND sms_message.address_key = contact.phone_key").
+			Select("sms_message.*, COALESCE(contact.name, sms_message.name, 'Unknown Number') as contact_name").
+			Where("sms_message.device_id = ? AND sms_message.blocked = ?", deviceID, false)
+		if smsType > 0 {
+			session = session.And("sms_message.type = ?", smsType)
+		}
+		if last != nil {
+			session = session.And("(sms_message.sms_time > ? OR (sms_message.sms_time = ? AND sms_message.id > ?))", last.SmsTime, last.SmsTime, last.ID)
+		}
+
+		var batch []SmsWithContactName
+		if err := session.Asc("sms_message.sms_time", "sms_message.id").Limit(iterateBatchSize).Find(&batch); err != nil {
+			return err
+		}
+		for i := range batch {
+			batch[i].Name = batch[i].ContactName
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		if len(batch) < iterateBatchSize {
+			return nil
+		}
+		last = &batch[len(batch)-1]
+	}
+}
+
 // GetLatestSmsTime returns the latest SMS timestamp for a device.
 func (r *SmsRepository) GetLatestSmsTime(deviceID int64, smsType int) (int64, error) {
 	var sms models.SmsMessage
@@ -128,6 +402,45 @@ func (r *SmsRepository) GetLatestSmsTime(deviceID int64, smsType int) (int64, er
 	return sms.SmsTime, nil
 }
 
+// GetLatestSmsTimeIncludingDeleted returns the latest SMS timestamp for a device,
+// including soft-deleted records, so deleting the newest message doesn't make sync
+// think the phone has something new. Pushed messages are left out: older ones
+// whose push was lost must not look synced. So are failed sends, which were
+// recorded by the server and never reached the phone's sent box.
+func (r *SmsRepository) GetLatestSmsTimeIncludingDeleted(deviceID int64, smsType int) (int64, error) {
+	var sms models.SmsMessage
+	session := r.engine.Unscoped().Where("device_id = ? AND pushed = ? AND delivery_status <> ?", deviceID, false, models.DeliveryStatusFailed)
+	if smsType > 0 {
+		session = session.And("type = ?", smsType)
+	}
+	has, err := session.Desc("sms_time").Get(&sms)
+	if err != nil {
+		return 0, err
+	}
+	if !has {
+		return 0, nil
+	}
+	return sms.SmsTime, nil
+}
+
+// GetLatestAddressSmsTime is GetLatestSmsTimeIncludingDeleted for the messages
+// with one address, matched in normalized form.
+func (r *SmsRepository) GetLatestAddressSmsTime(deviceID int64, address string, smsType int) (int64, error) {
+	var sms models.SmsMessage
+	session := r.engine.Unscoped().Where("device_id = ? AND address_key = ? AND pushed = ? AND delivery_status <> ?", deviceID, smsutil.NormalizePhone(address), false, models.DeliveryStatusFailed)
+	if smsType > 0 {
+		session = session.And("type = ?", smsType)
+	}
+	has, err := session.Desc("sms_time").Get(&sms)
+	if err != nil {
+		return 0, err
+	}
+	if !has {
+		return 0, nil
+	}
+	return sms.SmsTime, nil
+}
+
 // SmsWithDevice represents an SMS message with device info and contact name.
 type SmsWithDevice struct {
 	models.SmsMessage `xorm:"extends"`
@@ -137,22 +450,31 @@ type SmsWithDevice struct {
 
 // FindAll returns SMS messages from all devices with pagination.
 // smsType: 0=all, 1=received, 2=sent
+// keyword: space-separated terms that must all match (empty=no filter)
+// deviceIDs: nil=no restriction, otherwise only records from these devices
+// Blocked messages are left out, and so are archived ones unless opts.IncludeArchived.
+// opts.UnreadOnly keeps only unread messages.
 // Uses contact name from contact list if available, otherwise falls back to SMS.Name or "Unknown Number".
-func (r *SmsRepository) FindAll(smsType, page, pageSize int, keyword string, deviceID int64) ([]SmsWithDevice, int64, error) {
+func (r *SmsRepository) FindAll(smsType, page, pageSize int, keyword string, deviceID int64, deviceIDs []int64, opts ListOptions) ([]SmsWithDevice, int64, error) {
 	var items []SmsWithDevice
 
 	// Build count query
-	countSession := r.engine.Table("sms_message")
+	countSession := r.engine.Table("sms_message").Where("blocked = ?", false)
 	if deviceID > 0 {
-		countSession = countSession.Where("device_id = ?", deviceID)
+		countSession = countSession.And("device_id = ?", deviceID)
+	}
+	if deviceIDs != nil {
+		countSession = countSession.In("device_id", deviceIDs)
 	}
 	if smsType > 0 {
 		countSession = countSession.And("type = ?", smsType)
 	}
-	if keyword != "" {
-		countSession = countSession.And("(address LIKE ? OR name LIKE ? OR body LIKE ?)",
-			"%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%")
-	}
+	terms := searchTerms(keyword)
+	countSession = applyTerms(countSession, terms, "address", "name", "body")
+	countSession = opts.applyTimeRange(countSession, "sms_time")
+	countSession = opts.applySim(countSession, "sim_id")
+	countSession = opts.applyArchived(countSession, "archived")
+	countSession = opts.applyUnread(countSession, "is_read")
 
 	// Get total count
 	total, err := countSession.Count(&models.SmsMessage{})
@@ -163,19 +485,25 @@ func (r *SmsRepository) FindAll(smsType, page, pageSize int, keyword string, dev
 	// Build data query with JOINs (device and contact)
 	session := r.engine.Table("sms_message").
 		Join("LEFT", "device", "sms_message.device_id = device.id").
-		Join("LEFT", "contact", "sms_message.device_id = contact.device_id AND sms_message.address = contact.phone").
-		Select("sms_message.*, device.name as device_name, COALESCE(contact.name, sms_message.name, 'Unknown Number') as contact_name")
+		Join("LEFT", "contact", "sms_message.device_id = contact.device_id AND sms_message.address_key = contact.phone_key").
+		Select("sms_message.*, device.name as device_name, COALESCE(contact.name, sms_message.name, 'Unknown Number') as contact_name").
+		Where("sms_message.blocked = ?", false)
 
 	if deviceID > 0 {
-		session = session.Where("sms_message.device_id = ?", deviceID)
+		session = session.And("sms_message.device_id = ?", deviceID)
+	}
+	if deviceIDs != nil {
+		session = session.In("sms_message.device_id", deviceIDs)
 	}
 	if smsType > 0 {
 		session = session.And("sms_message.type = ?", smsType)
 	}
-	if keyword != "" {
-		session = session.And("(sms_message.address LIKE ? OR sms_message.name LIKE ? OR sms_message.body LIKE ? OR contact.name LIKE ?)",
-			"%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%")
-	}
+	// Every term must appear in the SMS name/address/body or the contact name
+	session = applyTerms(session, terms, "sms_message.address", "sms_message.name", "sms_message.body", "contact.name")
+	session = opts.applyTimeRange(session, "sms_message.sms_time")
+	session = opts.applySim(session, "sms_message.sim_id")
+	session = opts.applyArchived(session, "sms_message.archived")
+	session = opts.applyUnread(session, "sms_message.is_read")
 
 	// Apply pagination and ordering
 	if page <= 0 {
@@ -186,7 +514,10 @@ func (r *SmsRepository) FindAll(smsType, page, pageSize int, keyword string, dev
 	}
 	offset := (page - 1) * pageSize
 
-	err = session.Desc("sms_message.sms_time").Limit(pageSize, offset).Find(&items)
+	if opts.SortBy == SortRelevance && len(terms) > 0 {
+		session = orderByBodyMatches(session, terms, "sms_message.body")
+	}
+	err = opts.applyOrder(session, "sms_message", SmsSortColumns).Limit(pageSize, offset).Find(&items)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -237,12 +568,15 @@ func (r *SmsRepository) MarkAllAsReadGlobally(smsType int, deviceID int64) error
 	return err
 }
 
-// CountUnread returns the total number of unread SMS messages (optionally filtered by type and device).
-func (r *SmsRepository) CountUnread(smsType int, deviceID int64) (int64, error) {
-	session := r.engine.Where("is_read = ?", false)
+// CountUnread returns the total number of unread SMS messages (optionally filtered by type, device and device set).
+func (r *SmsRepository) CountUnread(smsType int, deviceID int64, deviceIDs []int64) (int64, error) {
+	session := r.engine.Where("is_read = ? AND blocked = ?", false, false)
 	if deviceID > 0 {
 		session = session.And("device_id = ?", deviceID)
 	}
+	if deviceIDs != nil {
+		session = session.In("device_id", deviceIDs)
+	}
 	if smsType > 0 {
 		session = session.And("type = ?", smsType)
 	}
@@ -255,6 +589,110 @@ func (r *SmsRepository) Delete(id int64) error {
 	return err
 }
 
+// FindDeletedByDevice returns soft-deleted SMS messages for a device with pagination,
+// most recently deleted first. Blocked messages are left out, as the deleted
+// ones include the tombstones of messages dropped by the blocklist.
+func (r *SmsRepository) FindDeletedByDevice(deviceID int64, page, pageSize int) ([]SmsWithContactName, int64, error) {
+	var items []SmsWithContactName
+
+	total, err := r.engine.Unscoped().Where("device_id = ? AND deleted_at IS NOT NULL AND blocked = ?", deviceID, false).Count(&models.SmsMessage{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	offset := (page - 1) * pageSize
+
+	err = r.engine.Unscoped().Table("sms_message").
+		Join("LEFT", "contact", "sms_message.device_id = contact.device_id AND sms_message.address_key = contact.phone_key").
+		Select("sms_message.*, COALESCE(contact.name, sms_message.name, 'Unknown Number') as contact_name").
+		Where("sms_message.device_id = ? AND sms_message.deleted_at IS NOT NULL AND sms_message.blocked = ?", deviceID, false).
+		Desc("sms_message.deleted_at").
+		Limit(pageSize, offset).
+		Find(&items)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range items {
+		items[i].Name = items[i].ContactName
+	}
+
+	return items, total, nil
+}
+
+// Restore clears the soft-delete timestamp of an SMS message.
+// Returns false if the message doesn't exist, isn't deleted or is blocked (see
+// FindDeletedByDevice).
+func (r *SmsRepository) Restore(id int64) (bool, error) {
+	affected, err := r.engine.Unscoped().ID(id).Where("deleted_at IS NOT NULL AND blocked = ?", false).
+		Cols("deleted_at").Update(&models.SmsMessage{})
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// FindBlocked returns SMS hidden by a blocklist entry, newest first, optionally
+// for one device (deviceID 0 = all devices).
+func (r *SmsRepository) FindBlocked(deviceID int64, page, pageSize int) ([]SmsWithDevice, int64, error) {
+	var items []SmsWithDevice
+
+	newSession := func() *xorm.Session {
+		session := r.engine.Table("sms_message").Where("sms_message.blocked = ?", true)
+		if deviceID > 0 {
+			session = session.And("sms_message.device_id = ?", deviceID)
+		}
+		return session
+	}
+
+	total, err := newSession().Count(&models.SmsMessage{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	offset := (page - 1) * pageSize
+
+	err = newSession().
+		Join("LEFT", "device", "sms_message.device_id = device.id").
+		Join("LEFT", "contact", "sms_message.device_id = contact.device_id AND sms_message.address_key = contact.phone_key").
+		Select("sms_message.*, device.name as device_name, COALESCE(contact.name, sms_message.name, 'Unknown Number') as contact_name").
+		Desc("sms_message.sms_time", "sms_message.id").
+		Limit(pageSize, offset).
+		Find(&items)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range items {
+		items[i].Name = items[i].ContactName
+	}
+
+	return items, total, nil
+}
+
+// Unblock clears the blocked flag of an SMS so it shows in normal lists again.
+// Returns false if the message doesn't exist or isn't blocked.
+func (r *SmsRepository) Unblock(id int64) (bool, error) {
+	affected, err := r.engine.ID(id).Where("blocked = ?", true).
+		Cols("blocked").Update(&models.SmsMessage{})
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
 // DeleteBatch deletes multiple SMS messages by IDs.
 func (r *SmsRepository) DeleteBatch(ids []int64) error {
 	if len(ids) == 0 {
@@ -263,3 +701,26 @@ func (r *SmsRepository) DeleteBatch(ids []int64) error {
 	_, err := r.engine.In("id", ids).Delete(&models.SmsMessage{})
 	return err
 }
+
+// CountByType returns the number of SMS per type (1=received, 2=sent),
+// optionally for one device (deviceID 0 = all devices).
+func (r *SmsRepository) CountByType(deviceID int64) (map[int]int64, error) {
+	return countGroupedBy(r.engine, "sms_message", "type", deviceID)
+}
+
+// CountByDay returns the number of SMS per day and type from since on, in
+// since's location, optionally for one device (deviceID 0 = all devices).
+func (r *SmsRepository) CountByDay(deviceID int64, since time.Time) ([]DayCount, error) {
+	return countByDay(r.engine, "sms_message", "sms_time", deviceID, since)
+}
+
+// CountBySim returns the number of SMS per device and SIM slot,
+// optionally for one device (deviceID 0 = all devices).
+func (r *SmsRepository) CountBySim(deviceID int64) ([]SimCount, error) {
+	return countBySim(r.engine, "sms_message", deviceID)
+}
+
+// TopDevices returns the devices with the most SMS, largest first.
+func (r *SmsRepository) TopDevices(limit int) ([]DeviceCount, error) {
+	return topDevicesBy(r.engine, "sms_message", limit)
+}
@@ -0,0 +1,301 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+
+	"backend/internal/models"
+)
+
+func TestFilterNewSms(t *testing.T) {
+	repo := NewSmsRepository(newTestEngine(t))
+
+	existing := &models.SmsMessage{DeviceID: 1, Address: "10086", Type: 1, SmsTime: 1000}
+	deleted := &models.SmsMessage{DeviceID: 1, Address: "10010", Type: 1, SmsTime: 2000}
+	otherDevice := &models.SmsMessage{DeviceID: 2, Address: "10086", Type: 1, SmsTime: 3000}
+	for _, sms := range []*models.SmsMessage{existing, deleted, otherDevice} {
+		if err := repo.Insert(sms); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if err := repo.Delete(deleted.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	keys := []SmsKey{
+		{Address: "10086", SmsTime: 1000, Type: 1}, // existing
+		{Address: "10010", SmsTime: 2000, Type: 1}, // soft-deleted
+		{Address: "10086", SmsTime: 3000, Type: 1}, // exists only on another device
+		{Address: "10086", SmsTime: 1000, Type: 2}, // same address/time, different type
+		{Address: "95588", SmsTime: 4000, Type: 1}, // new
+		{Address: "95588", SmsTime: 4000, Type: 1}, // duplicate of new within the page
+	}
+	got, err := repo.FilterNewSms(1, keys)
+	if err != nil {
+		t.Fatalf("FilterNewSms failed: %v", err)
+	}
+
+	want := []SmsKey{
+		{Address: "10086", SmsTime: 3000, Type: 1},
+		{Address: "10086", SmsTime: 1000, Type: 2},
+		{Address: "95588", SmsTime: 4000, Type: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterNewSms mismatch.\nExpected: %+v\nGot: %+v", want, got)
+	}
+}
+
+func TestFilterNewCalls(t *testing.T) {
+	repo := NewCallRepository(newTestEngine(t))
+
+	existing := &models.CallLog{DeviceID: 1, Number: "10086", Type: 1, CallTime: 1000}
+	deleted := &models.CallLog{DeviceID: 1, Number: "10010", Type: 3, CallTime: 2000}
+	for _, call := range []*models.CallLog{existing, deleted} {
+		if err := repo.Insert(call); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if err := repo.Delete(deleted.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	got, err := repo.FilterNewCalls(1, []CallKey{
+		{Number: "10086", CallTime: 1000, Type: 1},
+		{Number: "10010", CallTime: 2000, Type: 3},
+		{Number: "95588", CallTime: 4000, Type: 2},
+	})
+	if err != nil {
+		t.Fatalf("FilterNewCalls failed: %v", err)
+	}
+
+	want := []CallKey{{Number: "95588", CallTime: 4000, Type: 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterNewCalls mismatch.\nExpected: %+v\nGot: %+v", want, got)
+	}
+}
+
+func TestFindConversationsAndThread(t *testing.T) {
+	engine := newTestEngine(t)
+	repo := NewSmsRepository(engine)
+
+	engine.Insert(&models.Contact{DeviceID: 1, Name: "Alice", Phone: "111"})
+	msgs := []*models.SmsMessage{
+		{DeviceID: 1, Address: "111", Body: "hi", Type: 1, SmsTime: 1000},
+		{DeviceID: 1, Address: "111", Body: "hello", Type: 2, SmsTime: 3000, IsRead: true},
+		{DeviceID: 1, Address: "222", Body: "code 1234", Type: 1, SmsTime: 2000},
+		{DeviceID: 1, Address: "222", Body: "deleted", Type: 1, SmsTime: 4000},
+		{DeviceID: 2, Address: "111", Body: "other device", Type: 1, SmsTime: 5000},
+	}
+	for _, m := range msgs {
+		if _, err := engine.Insert(m); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	if err := repo.Delete(msgs[3].ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	convs, total, err := repo.FindConversations(1, 1, 20, false)
+	if err != nil {
+		t.Fatalf("FindConversations failed: %v", err)
+	}
+	if total != 2 || len(convs) != 2 {
+		t.Fatalf("Expected 2 conversations, got total=%d items=%+v", total, convs)
+	}
+	if convs[0].Address != "111" || convs[0].ContactName != "Alice" || convs[0].LastBody != "hello" ||
+		convs[0].LastTime != 3000 || convs[0].UnreadCount != 1 || convs[0].MessageCount != 2 {
+		t.Errorf("Unexpected first conversation: %+v", convs[0])
+	}
+	if convs[1].Address != "222" || convs[1].LastBody != "code 1234" || convs[1].MessageCount != 1 {
+		t.Errorf("Expected soft-deleted message to be ignored, got %+v", convs[1])
+	}
+
+	thread, total, err := repo.FindThread(1, "111", 1, 20)
+	if err != nil {
+		t.Fatalf("FindThread failed: %v", err)
+	}
+	if total != 2 || len(thread) != 2 || thread[0].Body != "hi" || thread[1].Body != "hello" {
+		t.Errorf("Expected ascending thread [hi hello], got total=%d %+v", total, thread)
+	}
+}
+
+func TestSmsTrashAndRestore(t *testing.T) {
+	engine := newTestEngine(t)
+	repo := NewSmsRepository(engine)
+
+	msg := &models.SmsMessage{DeviceID: 1, Address: "10086", Body: "oops", Type: 1, SmsTime: 1000}
+	if _, err := engine.Insert(msg); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := repo.Delete(msg.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	items, total, err := repo.FindDeletedByDevice(1, 1, 20)
+	if err != nil {
+		t.Fatalf("FindDeletedByDevice failed: %v", err)
+	}
+	if total != 1 || len(items) != 1 || items[0].ID != msg.ID || items[0].DeletedAt == nil {
+		t.Fatalf("Expected deleted message in trash, got total=%d %+v", total, items)
+	}
+
+	restored, err := repo.Restore(msg.ID)
+	if err != nil || !restored {
+		t.Fatalf("Expected restore to succeed, got restored=%v err=%v", restored, err)
+	}
+	restored, err = repo.Restore(msg.ID)
+	if err != nil || restored {
+		t.Fatalf("Expected second restore to be a no-op, got restored=%v err=%v", restored, err)
+	}
+
+	_, total, err = repo.FindByDevice(1, 0, 1, 20, "", ListOptions{})
+	if err != nil {
+		t.Fatalf("FindByDevice failed: %v", err)
+	}
+	if total != 1 {
+		t.Errorf("Expected restored message to be visible again, got total=%d", total)
+	}
+	_, total, _ = repo.FindDeletedByDevice(1, 1, 20)
+	if total != 0 {
+		t.Errorf("Expected empty trash after restore, got %d", total)
+	}
+}
+
+func TestBlockedSmsTombstones(t *testing.T) {
+	engine := newTestEngine(t)
+	repo := NewSmsRepository(engine)
+
+	tombstone := &models.SmsMessage{DeviceID: 1, Address: "10690001", Type: 1, SmsTime: 1000, Blocked: true}
+	if err := repo.InsertDeleted([]*models.SmsMessage{tombstone}); err != nil {
+		t.Fatalf("InsertDeleted failed: %v", err)
+	}
+	hidden := &models.SmsMessage{DeviceID: 1, Address: "95555", Body: "loan offer", Type: 1, SmsTime: 2000, Blocked: true}
+	visible := &models.SmsMessage{DeviceID: 1, Address: "10086", Body: "code 1234", Type: 1, SmsTime: 3000}
+	for _, sms := range []*models.SmsMessage{hidden, visible} {
+		if err := repo.Insert(sms); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	if newKeys, _ := repo.FilterNewSms(1, []SmsKey{{Address: "10690001", SmsTime: 1000, Type: 1}}); len(newKeys) != 0 {
+		t.Errorf("Expected the tombstone to count as stored, got new %v", newKeys)
+	}
+	if _, total, _ := repo.FindDeletedByDevice(1, 1, 20); total != 0 {
+		t.Errorf("Expected tombstones to stay out of the trash, got %d", total)
+	}
+	if restored, _ := repo.Restore(tombstone.ID); restored {
+		t.Error("Expected a tombstone not to be restorable")
+	}
+
+	var exported []string
+	if err := repo.IterateByDevice(1, 0, func(sms *SmsWithContactName) error {
+		exported = append(exported, sms.Address)
+		return nil
+	}); err != nil {
+		t.Fatalf("IterateByDevice failed: %v", err)
+	}
+	if !reflect.DeepEqual(exported, []string{"10086"}) {
+		t.Errorf("Expected only the visible message to be exported, got %v", exported)
+	}
+}
+
+func TestFindByDeviceTimeRange(t *testing.T) {
+	engine := newTestEngine(t)
+	repo := NewSmsRepository(engine)
+	for _, ts := range []int64{1000, 2000, 3000, 4000} {
+		if err := repo.Insert(&models.SmsMessage{DeviceID: 1, Address: "10086", Body: "hi", Type: 1, SmsTime: ts}); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	items, total, err := repo.FindByDevice(1, 0, 1, 20, "", ListOptions{From: 2000, To: 3000})
+	if err != nil {
+		t.Fatalf("FindByDevice failed: %v", err)
+	}
+	if total != 2 || len(items) != 2 || items[0].SmsTime != 3000 || items[1].SmsTime != 2000 {
+		t.Fatalf("Expected the two messages in range newest first, got total=%d %+v", total, items)
+	}
+
+	_, total, _ = repo.FindAll(0, 1, 20, "", 0, nil, ListOptions{From: 2500})
+	if total != 2 {
+		t.Errorf("Expected an open-ended range to match 2 messages, got %d", total)
+	}
+}
+
+func TestFindByDeviceKeywordTerms(t *testing.T) {
+	repo := NewSmsRepository(newTestEngine(t))
+	for _, sms := range []*models.SmsMessage{
+		{DeviceID: 1, Address: "95588", Body: "your bank code is 1234", Type: 1, SmsTime: 1000},
+		{DeviceID: 1, Address: "bank", Body: "code 5678", Type: 1, SmsTime: 2000},
+		{DeviceID: 1, Address: "10086", Body: "your code is 9999", Type: 1, SmsTime: 3000},
+	} {
+		if err := repo.Insert(sms); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	bodies := func(keyword string, opts ListOptions) []string {
+		items, total, err := repo.FindByDevice(1, 0, 1, 20, keyword, opts)
+		if err != nil {
+			t.Fatalf("FindByDevice(%q) failed: %v", keyword, err)
+		}
+		if total != int64(len(items)) {
+			t.Errorf("FindByDevice(%q): total %d, got %d items", keyword, total, len(items))
+		}
+		var got []string
+		for _, item := range items {
+			got = append(got, item.Body)
+		}
+		return got
+	}
+
+	if got := bodies("code", ListOptions{}); len(got) != 3 {
+		t.Errorf("Expected a single term to match all three, got %v", got)
+	}
+	want := []string{"code 5678", "your bank code is 1234"}
+	if got := bodies("bank  code", ListOptions{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected both terms to be required, got %v, want %v", got, want)
+	}
+	want = []string{"your bank code is 1234", "code 5678"}
+	if got := bodies("bank code", ListOptions{SortBy: SortRelevance}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected body matches first, got %v, want %v", got, want)
+	}
+
+	all, _, err := repo.FindAll(0, 1, 20, "your code", 0, nil, ListOptions{})
+	if err != nil || len(all) != 2 {
+		t.Errorf("Expected FindAll to AND terms, got %d items (%v)", len(all), err)
+	}
+}
+
+func TestIterateByDeviceReadsInBatches(t *testing.T) {
+	engine := newTestEngine(t)
+	repo := NewSmsRepository(engine)
+	defer func(n int) { iterateBatchSize = n }(iterateBatchSize)
+	iterateBatchSize = 2
+
+	// Equal times straddling batches must be neither repeated nor skipped
+	var want []int64
+	for i, smsTime := range []int64{1000, 2000, 2000, 2000, 3000} {
+		sms := &models.SmsMessage{DeviceID: 1, Address: "1008" + string(rune('0'+i)), Type: 1, SmsTime: smsTime}
+		if err := repo.Insert(sms); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+		want = append(want, sms.ID)
+	}
+
+	var got []int64
+	err := repo.IterateByDevice(1, 0, func(sms *SmsWithContactName) error {
+		// Needs the only SQLite connection, so no batch may hold it while fn runs
+		if _, err := engine.Count(&models.SmsMessage{}); err != nil {
+			return err
+		}
+		got = append(got, sms.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("IterateByDevice failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected every message once in time order %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"xorm.io/xorm"
+)
+
+// groupCount is one row of a COUNT(*) ... GROUP BY query.
+type groupCount struct {
+	Key   int   `xorm:"'group_key'"`
+	Count int64 `xorm:"'count'"`
+}
+
+// countGroupedBy counts the non-deleted rows of table per value of column,
+// optionally restricted to one device (deviceID 0 = all devices).
+// table and column are always constants from this package, never user input.
+func countGroupedBy(engine *xorm.Engine, table, column string, deviceID int64) (map[int]int64, error) {
+	query := fmt.Sprintf("SELECT %s AS group_key, COUNT(*) AS count FROM %s WHERE deleted_at IS NULL", column, table)
+	args := []interface{}{}
+	if deviceID > 0 {
+		query += " AND device_id = ?"
+		args = append(args, deviceID)
+	}
+	query += " GROUP BY " + column
+
+	var rows []groupCount
+	if err := engine.SQL(query, args...).Find(&rows); err != nil {
+		return nil, err
+	}
+	counts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Key] = row.Count
+	}
+	return counts, nil
+}
+
+// DeviceCount is the number of records belonging to one device.
+type DeviceCount struct {
+	DeviceID   int64  `xorm:"'device_id'" json:"device_id"`
+	DeviceName string `xorm:"'device_name'" json:"device_name"`
+	Count      int64  `xorm:"'count'" json:"count"`
+}
+
+// topDevicesBy returns the devices with the most non-deleted rows in table,
+// largest first, capped at limit.
+func topDevicesBy(engine *xorm.Engine, table string, limit int) ([]DeviceCount, error) {
+	query := fmt.Sprintf(`SELECT t.device_id, COALESCE(device.name, '') AS device_name, COUNT(*) AS count
+	FROM %s t
+	LEFT JOIN device ON device.id = t.device_id
+	WHERE t.deleted_at IS NULL
+	GROUP BY t.device_id, device.name
+	ORDER BY count DESC, t.device_id ASC
+	LIMIT ?`, table)
+
+	items := []DeviceCount{}
+	if err := engine.SQL(query, limit).Find(&items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// SimCount is the number of records from one SIM slot of one device.
+type SimCount struct {
+	DeviceID int64 `xorm:"'device_id'"`
+	SimID    int   `xorm:"'sim_id'"` // 0=SIM1, 1=SIM2, -1=unknown
+	Count    int64 `xorm:"'count'"`
+}
+
+// countBySim counts the non-deleted rows of table per device and SIM slot,
+// optionally for one device (deviceID 0 = all devices).
+func countBySim(engine *xorm.Engine, table string, deviceID int64) ([]SimCount, error) {
+	query := fmt.Sprintf("SELECT device_id, sim_id, COUNT(*) AS count FROM %s WHERE deleted_at IS NULL", table)
+	args := []interface{}{}
+	if deviceID > 0 {
+		query += " AND device_id = ?"
+		args = append(args, deviceID)
+	}
+	query += " GROUP BY device_id, sim_id ORDER BY device_id, sim_id"
+
+	var rows []SimCount
+	if err := engine.SQL(query, args...).Find(&rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// DayCount is the number of records of one type on one local day.
+type DayCount struct {
+	Date  string // YYYY-MM-DD in the location of since
+	Type  int
+	Count int64
+}
+
+// countByDay counts the non-deleted rows of table per day and type from since
+// on, bucketing the millisecond timeColumn into days of since's location in
+// one GROUP BY query. The location's UTC offset at since is used for the whole
+// range, so days next to a DST change may be off by an hour.
+// table and timeColumn are always constants from this package.
+func countByDay(engine *xorm.Engine, table, timeColumn string, deviceID int64, since time.Time) ([]DayCount, error) {
+	_, offset := since.Zone()
+	offsetMs := int64(offset) * 1000
+	// Start of the local day, shifted by the offset; integer in both SQLite and MySQL
+	day := fmt.Sprintf("(%[1]s + ?) - ((%[1]s + ?) %% 86400000)", timeColumn)
+	query := fmt.Sprintf("SELECT %s AS day_start, type AS group_key, COUNT(*) AS count FROM %s WHERE deleted_at IS NULL AND %s >= ?", day, table, timeColumn)
+	args := []interface{}{offsetMs, offsetMs, since.UnixMilli()}
+	if deviceID > 0 {
+		query += " AND device_id = ?"
+		args = append(args, deviceID)
+	}
+	query += " GROUP BY day_start, type ORDER BY day_start"
+
+	var rows []struct {
+		DayStart int64 `xorm:"'day_start'"`
+		Key      int   `xorm:"'group_key'"`
+		Count    int64 `xorm:"'count'"`
+	}
+	if err := engine.SQL(query, args...).Find(&rows); err != nil {
+		return nil, err
+	}
+	counts := make([]DayCount, len(rows))
+	for i, row := range rows {
+		counts[i] = DayCount{
+			Date:  time.UnixMilli(row.DayStart).UTC().Format("2006-01-02"),
+			Type:  row.Key,
+			Count: row.Count,
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"time"
+
+	"backend/internal/models"
+
+	"xorm.io/xorm"
+)
+
+// RevokedTokenRepository handles the JWT revocation list.
+type RevokedTokenRepository struct {
+	engine *xorm.Engine
+}
+
+// NewRevokedTokenRepository creates a new RevokedTokenRepository.
+func NewRevokedTokenRepository(engine *xorm.Engine) *RevokedTokenRepository {
+	return &RevokedTokenRepository{engine: engine}
+}
+
+// Revoke adds a jti to the revocation list. Revoking an already revoked jti is a no-op.
+// Entries whose token has expired are purged on the way, since they can no longer be used.
+func (r *RevokedTokenRepository) Revoke(jti string, expiresAt time.Time) error {
+	if _, err := r.engine.Where("expires_at < ?", time.Now()).Delete(new(models.RevokedToken)); err != nil {
+		return err
+	}
+	revoked, err := r.IsRevoked(jti)
+	if err != nil || revoked {
+		return err
+	}
+	_, err = r.engine.Insert(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt})
+	return err
+}
+
+// IsRevoked reports whether a jti has been revoked.
+func (r *RevokedTokenRepository) IsRevoked(jti string) (bool, error) {
+	return r.engine.Where("jti = ?", jti).Exist(new(models.RevokedToken))
+}
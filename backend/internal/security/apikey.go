@@ -0,0 +1,45 @@
+package security
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix starts every generated API key, so leaked keys are easy to spot.
+const APIKeyPrefix = "smk_"
+
+// apiKeyLookupLen is how many leading characters of a key are stored in the
+// clear to find its row.
+const apiKeyLookupLen = 12
+
+// GenerateAPIKey returns a new random API key.
+func GenerateAPIKey() (string, error) {
+	random, err := RandomKey(24)
+	if err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + random, nil
+}
+
+// APIKeyLookup returns the leading part of key that identifies its row, or ""
+// if key is not shaped like a generated key.
+func APIKeyLookup(key string) string {
+	if !strings.HasPrefix(key, APIKeyPrefix) || len(key) <= apiKeyLookupLen {
+		return ""
+	}
+	return key[:apiKeyLookupLen]
+}
+
+// HashAPIKey returns the hex SHA-256 of key. Keys are long and random, so a
+// fast hash is enough, unlike passwords.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckAPIKey reports whether key hashes to hash, in constant time.
+func CheckAPIKey(hash, key string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(HashAPIKey(key))) == 1
+}
@@ -22,14 +22,40 @@ func CheckPassword(hash, password string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
 }
 
-// CreateToken issues a JWT for the given user.
+// Token types stored in the "typ" claim.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// CreateToken issues a short-lived access JWT for the given user.
 func CreateToken(cfg *config.Config, user *models.User) (string, error) {
+	return createToken(cfg, user, TokenTypeAccess, time.Duration(cfg.App.AccessTokenMinutes)*time.Minute)
+}
+
+// CreateRefreshToken issues a long-lived refresh JWT that can only be exchanged
+// for new access tokens via /api/refresh.
+func CreateRefreshToken(cfg *config.Config, user *models.User) (string, error) {
+	return createToken(cfg, user, TokenTypeRefresh, cfg.App.RefreshTokenTTL())
+}
+
+// createToken signs a JWT with a random jti so it can be revoked individually.
+func createToken(cfg *config.Config, user *models.User, tokenType string, ttl time.Duration) (string, error) {
+	jti, err := RandomKey(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": user.ID,
-		"u":   user.Username,
-		"exp": time.Now().Add(7 * 24 * time.Hour).Unix(),
+		"sub":  user.ID,
+		"u":    user.Username,
+		"role": user.Role,
+		"typ":  tokenType,
+		"jti":  jti,
+		"iat":  now.Unix(),
+		"exp":  now.Add(ttl).Unix(),
 	})
-	return token.SignedString([]byte(cfg.App.JWTSecret))
+	return token.SignedString(cfg.JWTKey())
 }
 
 // ParseToken validates a JWT string.
@@ -38,7 +64,7 @@ func ParseToken(cfg *config.Config, tokenStr string) (*jwt.MapClaims, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(cfg.App.JWTSecret), nil
+		return cfg.JWTKey(), nil
 	})
 	if err != nil {
 		return nil, err
@@ -48,3 +74,24 @@ func ParseToken(cfg *config.Config, tokenStr string) (*jwt.MapClaims, error) {
 	}
 	return nil, errors.New("invalid token")
 }
+
+// ParseTokenOfType validates a JWT string and checks that it carries the expected
+// "typ" claim and a jti. Returns the claims, the jti and the expiry.
+func ParseTokenOfType(cfg *config.Config, tokenStr, tokenType string) (*jwt.MapClaims, string, time.Time, error) {
+	claims, err := ParseToken(cfg, tokenStr)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	if typ, _ := (*claims)["typ"].(string); typ != tokenType {
+		return nil, "", time.Time{}, errors.New("wrong token type")
+	}
+	jti, _ := (*claims)["jti"].(string)
+	if jti == "" {
+		return nil, "", time.Time{}, errors.New("token has no jti")
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, "", time.Time{}, errors.New("token has no expiry")
+	}
+	return claims, jti, exp.Time, nil
+}
@@ -0,0 +1,31 @@
+package security
+
+import (
+	"testing"
+	"time"
+
+	"backend/config"
+	"backend/internal/models"
+)
+
+func TestRefreshTokenUsesConfiguredTTL(t *testing.T) {
+	cfg := &config.Config{App: config.App{
+		JWTSecret:          "test-secret",
+		AccessTokenMinutes: 15,
+		RefreshTokenDays:   7,
+		TokenTTL:           "1h",
+	}}
+	user := &models.User{ID: 1, Username: "admin", Role: models.RoleAdmin}
+
+	token, err := CreateRefreshToken(cfg, user)
+	if err != nil {
+		t.Fatalf("CreateRefreshToken failed: %v", err)
+	}
+	_, _, exp, err := ParseTokenOfType(cfg, token, TokenTypeRefresh)
+	if err != nil {
+		t.Fatalf("ParseTokenOfType failed: %v", err)
+	}
+	if d := time.Until(exp); d < 59*time.Minute || d > time.Hour+time.Minute {
+		t.Errorf("Expected token to expire in ~1h, expires in %v", d)
+	}
+}
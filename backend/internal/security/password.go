@@ -0,0 +1,69 @@
+package security
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"backend/config"
+)
+
+// knownDefaultPasswords are passwords shipped in sample configs or commonly
+// tried first, rejected regardless of the policy.
+var knownDefaultPasswords = []string{
+	"admin", "admin123", "administrator", "password", "password123",
+	"123456", "12345678", "123456789", "changeme", "change-me", "qwerty",
+}
+
+// IsKnownDefaultPassword reports whether password is a well-known default,
+// compared case-insensitively.
+func IsKnownDefaultPassword(password string) bool {
+	for _, known := range knownDefaultPasswords {
+		if strings.EqualFold(password, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePassword checks password against policy and returns a description
+// of every rule it fails, or nil if it passes. An empty password always fails.
+func ValidatePassword(policy config.PasswordPolicy, password string) []string {
+	var failed []string
+	if password == "" && policy.MinLength <= 1 {
+		failed = append(failed, "not empty")
+	} else if utf8.RuneCountInString(password) < policy.MinLength {
+		failed = append(failed, fmt.Sprintf("at least %d characters", policy.MinLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			symbol = true
+		}
+	}
+	if policy.RequireUpper && !upper {
+		failed = append(failed, "an uppercase letter")
+	}
+	if policy.RequireLower && !lower {
+		failed = append(failed, "a lowercase letter")
+	}
+	if policy.RequireDigit && !digit {
+		failed = append(failed, "a digit")
+	}
+	if policy.RequireSymbol && !symbol {
+		failed = append(failed, "a symbol")
+	}
+	if IsKnownDefaultPassword(password) {
+		failed = append(failed, "not a well-known default password")
+	}
+	return failed
+}
@@ -0,0 +1,39 @@
+package security
+
+import (
+	"reflect"
+	"testing"
+
+	"backend/config"
+)
+
+func TestValidatePassword(t *testing.T) {
+	strict := config.PasswordPolicy{
+		MinLength:     10,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	}
+	tests := []struct {
+		name     string
+		policy   config.PasswordPolicy
+		password string
+		want     []string
+	}{
+		{"strong", strict, "Correct-Horse-9", nil},
+		{"lists every failed rule", strict, "horse", []string{
+			"at least 10 characters", "an uppercase letter", "a digit", "a symbol",
+		}},
+		{"counts characters not bytes", config.PasswordPolicy{MinLength: 4}, "密码密码", nil},
+		{"empty fails a zero policy", config.PasswordPolicy{}, "", []string{"not empty"}},
+		{"known default", config.PasswordPolicy{MinLength: 8}, "Admin123", []string{"not a well-known default password"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidatePassword(tt.policy, tt.password); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidatePassword(%q) = %q, want %q", tt.password, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+)
+
+// SmsForwarderSign computes the sign field SmsForwarder expects when its
+// server has a signing secret configured:
+// URLEncode(Base64(HMAC-SHA256(secret, timestamp + "\n" + secret))),
+// where timestamp is the request's millisecond timestamp.
+func SmsForwarderSign(timestamp int64, secret string) string {
+	stringToSign := strconv.FormatInt(timestamp, 10) + "\n" + secret
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return url.QueryEscape(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
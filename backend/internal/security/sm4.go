@@ -13,9 +13,59 @@ import (
 // Reference: https://gist.github.com/li-xunhuan/4ddded3eb8051d8bdf762c882dbe0ad3
 var sm4IV = []byte{3, 5, 6, 9, 6, 9, 5, 9, 3, 5, 6, 9, 6, 9, 5, 9}
 
+// ErrInvalidSM4Key is returned by ValidateSM4Key for keys that aren't 16 hex-encoded bytes.
+var ErrInvalidSM4Key = errors.New("SM4 key must be 32 hexadecimal characters")
+
+// ValidateSM4Key checks that keyHex is 32 hex characters (upper or lower case),
+// i.e. decodes to a 16-byte SM4 key.
+func ValidateSM4Key(keyHex string) error {
+	if len(keyHex) != 32 {
+		return ErrInvalidSM4Key
+	}
+	if _, err := hex.DecodeString(keyHex); err != nil {
+		return ErrInvalidSM4Key
+	}
+	return nil
+}
+
+// ErrInvalidSM4IV is returned by ValidateSM4IV for IVs that aren't 16 hex-encoded bytes.
+var ErrInvalidSM4IV = errors.New("SM4 IV must be empty or 32 hexadecimal characters")
+
+// ValidateSM4IV checks that ivHex is empty (use the default IV) or decodes to 16 bytes.
+func ValidateSM4IV(ivHex string) error {
+	if ivHex == "" {
+		return nil
+	}
+	if _, err := decodeIV(ivHex); err != nil {
+		return ErrInvalidSM4IV
+	}
+	return nil
+}
+
+// decodeIV returns the IV for ivHex, falling back to the SmsForwarder default when empty.
+func decodeIV(ivHex string) ([]byte, error) {
+	if ivHex == "" {
+		return sm4IV, nil
+	}
+	iv, err := hex.DecodeString(ivHex)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != 16 {
+		return nil, errors.New("sm4 iv must be 16 bytes")
+	}
+	return iv, nil
+}
+
 // SM4EncryptHex encrypts data with the provided hex key using CBC mode and returns hex ciphertext.
 // Compatible with SmsForwarder SM4 encryption.
 func SM4EncryptHex(keyHex string, plain []byte) (string, error) {
+	return SM4EncryptHexWithIV(keyHex, "", plain)
+}
+
+// SM4EncryptHexWithIV is SM4EncryptHex with a hex IV (empty = default IV),
+// for SmsForwarder builds that don't use the stock IV.
+func SM4EncryptHexWithIV(keyHex, ivHex string, plain []byte) (string, error) {
 	key, err := hex.DecodeString(keyHex)
 	if err != nil {
 		return "", err
@@ -23,6 +73,10 @@ func SM4EncryptHex(keyHex string, plain []byte) (string, error) {
 	if len(key) != 16 {
 		return "", errors.New("sm4 key must be 16 bytes")
 	}
+	iv, err := decodeIV(ivHex)
+	if err != nil {
+		return "", err
+	}
 	block, err := sm4.NewCipher(key)
 	if err != nil {
 		return "", err
@@ -33,7 +87,7 @@ func SM4EncryptHex(keyHex string, plain []byte) (string, error) {
 	dst := make([]byte, len(src))
 
 	// CBC mode encryption
-	mode := cipher.NewCBCEncrypter(block, sm4IV)
+	mode := cipher.NewCBCEncrypter(block, iv)
 	mode.CryptBlocks(dst, src)
 
 	return hex.EncodeToString(dst), nil
@@ -42,10 +96,19 @@ func SM4EncryptHex(keyHex string, plain []byte) (string, error) {
 // SM4DecryptHex decrypts hex ciphertext using hex key with CBC mode.
 // Compatible with SmsForwarder SM4 decryption.
 func SM4DecryptHex(keyHex, cipherHex string) ([]byte, error) {
+	return SM4DecryptHexWithIV(keyHex, "", cipherHex)
+}
+
+// SM4DecryptHexWithIV is SM4DecryptHex with a hex IV (empty = default IV).
+func SM4DecryptHexWithIV(keyHex, ivHex, cipherHex string) ([]byte, error) {
 	key, err := hex.DecodeString(keyHex)
 	if err != nil {
 		return nil, err
 	}
+	iv, err := decodeIV(ivHex)
+	if err != nil {
+		return nil, err
+	}
 	cipherBytes, err := hex.DecodeString(cipherHex)
 	if err != nil {
 		return nil, err
@@ -62,7 +125,7 @@ func SM4DecryptHex(keyHex, cipherHex string) ([]byte, error) {
 	dst := make([]byte, len(cipherBytes))
 
 	// CBC mode decryption
-	mode := cipher.NewCBCDecrypter(block, sm4IV)
+	mode := cipher.NewCBCDecrypter(block, iv)
 	mode.CryptBlocks(dst, cipherBytes)
 
 	// Remove PKCS7 padding
@@ -78,13 +141,17 @@ func pkcs7Pad(b []byte, size int) []byte {
 	return append(b, bytes.Repeat([]byte{byte(pad)}, pad)...)
 }
 
+// ErrInvalidPadding is returned when decrypted data doesn't end in valid PKCS7
+// padding, which usually means it was decrypted with the wrong key or IV.
+var ErrInvalidPadding = errors.New("invalid padding")
+
 func pkcs7Unpad(b []byte, size int) ([]byte, error) {
 	if len(b) == 0 || len(b)%size != 0 {
 		return nil, errors.New("invalid padding size")
 	}
 	pad := int(b[len(b)-1])
 	if pad == 0 || pad > size || pad > len(b) {
-		return nil, errors.New("invalid padding")
+		return nil, ErrInvalidPadding
 	}
 	return b[:len(b)-pad], nil
 }
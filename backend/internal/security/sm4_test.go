@@ -88,3 +88,64 @@ func TestSM4InvalidCiphertext(t *testing.T) {
 
 	t.Log("Invalid ciphertext test passed!")
 }
+
+func TestValidateSM4Key(t *testing.T) {
+	valid := []string{
+		"0123456789abcdef0123456789abcdef",
+		"0123456789ABCDEF0123456789ABCDEF", // Uppercase hex
+		"0123456789AbCdEf0123456789aBcDeF",
+	}
+	for _, key := range valid {
+		if err := ValidateSM4Key(key); err != nil {
+			t.Errorf("ValidateSM4Key(%q) = %v, want nil", key, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"0123456789abcdef",                   // Too short
+		"0123456789abcdef0123456789abcdef00", // Too long
+		"0123456789abcdeg0123456789abcdef",   // Non-hex character
+		"0123456789abcdef 123456789abcdef",   // Space
+		"中文中文0123456789abcdef01234567",       // Multi-byte characters
+	}
+	for _, key := range invalid {
+		if err := ValidateSM4Key(key); err != ErrInvalidSM4Key {
+			t.Errorf("ValidateSM4Key(%q) = %v, want ErrInvalidSM4Key", key, err)
+		}
+	}
+}
+
+func TestSM4CustomIV(t *testing.T) {
+	keyHex := "0123456789abcdef0123456789abcdef"
+	ivHex := "000102030405060708090a0b0c0d0e0f"
+	plaintext := []byte(`{"data":{}}`)
+
+	withIV, err := SM4EncryptHexWithIV(keyHex, ivHex, plaintext)
+	if err != nil {
+		t.Fatalf("Encryption with custom IV failed: %v", err)
+	}
+	defaultIV, _ := SM4EncryptHex(keyHex, plaintext)
+	if withIV == defaultIV {
+		t.Fatal("Expected a custom IV to change the ciphertext")
+	}
+
+	decrypted, err := SM4DecryptHexWithIV(keyHex, ivHex, withIV)
+	if err != nil || string(decrypted) != string(plaintext) {
+		t.Fatalf("Decryption with custom IV = %q, %v", decrypted, err)
+	}
+
+	// Empty IV keeps the SmsForwarder default
+	if same, _ := SM4EncryptHexWithIV(keyHex, "", plaintext); same != defaultIV {
+		t.Error("Expected empty IV to match SM4EncryptHex")
+	}
+
+	if err := ValidateSM4IV(""); err != nil {
+		t.Errorf("Expected empty IV to be valid, got %v", err)
+	}
+	for _, iv := range []string{"0102", "zz0102030405060708090a0b0c0d0e0f"} {
+		if err := ValidateSM4IV(iv); err != ErrInvalidSM4IV {
+			t.Errorf("ValidateSM4IV(%q) = %v, want ErrInvalidSM4IV", iv, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPIKeyAuthAndScopes(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{"enable_api_sms_send": true}}
+	})
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	access, _ := login(t, r)
+
+	createKey := func(scopes ...string) (int64, string) {
+		t.Helper()
+		code, resp := doJSON(t, r, "POST", "/api/api-keys", access, gin.H{"label": "monitor", "scopes": scopes})
+		if code != http.StatusCreated {
+			t.Fatalf("create API key failed: %d %v", code, resp)
+		}
+		key, _ := resp["key"].(string)
+		meta := resp["api_key"].(map[string]interface{})
+		if !strings.HasPrefix(key, "smk_") || meta["prefix"] != key[:12] {
+			t.Fatalf("Unexpected key %q for %v", key, meta)
+		}
+		if _, leaked := meta["key_hash"]; leaked {
+			t.Errorf("Expected the key hash not to be returned")
+		}
+		return int64(meta["id"].(float64)), key
+	}
+	call := func(method, path, header, value, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(header, value)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	sendPath := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/sms/send"
+	sendBody := `{"sim_slot":1,"phone_numbers":"10086","msg_content":"hi"}`
+
+	if code, resp := doJSON(t, r, "POST", "/api/api-keys", access, gin.H{"label": "x", "scopes": []string{"delete"}}); code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown scope to be rejected, got %d %v", code, resp)
+	}
+
+	sendID, sendKey := createKey(models.APIScopeSmsSend)
+	if code := call("POST", sendPath, APIKeyHeader, sendKey, sendBody); code != http.StatusOK {
+		t.Errorf("Expected a sms:send key to send, got %d", code)
+	}
+	if code := call("GET", "/api/devices", APIKeyHeader, sendKey, ""); code != http.StatusForbidden {
+		t.Errorf("Expected a sms:send key to be refused reads, got %d", code)
+	}
+	var audit models.AuditLog
+	if has, _ := engine.Where("action = ?", models.AuditSmsSend).Get(&audit); !has || audit.Username != "key:monitor" || audit.UserID != 1 {
+		t.Errorf("Expected the send audited as the key, got %+v", audit)
+	}
+
+	_, allKey := createKey(models.APIScopeAll)
+	if code := call("GET", "/api/devices", "Authorization", "ApiKey "+allKey, ""); code != http.StatusOK {
+		t.Errorf("Expected the ApiKey scheme to be accepted, got %d", code)
+	}
+	if code := call("GET", "/api/api-keys", "Authorization", "ApiKey "+allKey, ""); code != http.StatusForbidden {
+		t.Errorf("Expected keys to be refused key management, got %d", code)
+	}
+	if code := call("GET", "/api/devices", APIKeyHeader, allKey[:len(allKey)-1]+"x", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong key to be rejected, got %d", code)
+	}
+
+	code, resp := doJSON(t, r, "GET", "/api/api-keys", access, nil)
+	if code != http.StatusOK || len(resp["items"].([]interface{})) != 2 {
+		t.Fatalf("Expected 2 API keys, got %d %v", code, resp)
+	}
+	if code, _ := doJSON(t, r, "DELETE", "/api/api-keys/"+strconv.FormatInt(sendID, 10), access, nil); code != http.StatusOK {
+		t.Errorf("Expected revoke to succeed, got %d", code)
+	}
+	if code := call("POST", sendPath, APIKeyHeader, sendKey, sendBody); code != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked key to be rejected, got %d", code)
+	}
+	var stored models.APIKey
+	if has, _ := engine.Where("label = ?", "monitor").Get(&stored); !has || stored.LastUsedAt == nil {
+		t.Errorf("Expected last_used_at to be recorded, got %+v", stored)
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMutatingActionsAreAudited(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	code, resp := doJSON(t, r, "POST", "/api/devices", access, gin.H{
+		"name": "office", "phone_addr": "http://127.0.0.1:1", "sm4_key": testPhoneKey,
+	})
+	if code != http.StatusOK {
+		t.Fatalf("create device failed: %d %v", code, resp)
+	}
+	path := "/api/devices/" + strconv.FormatInt(int64(resp["id"].(float64)), 10)
+	if code, resp := doJSON(t, r, "PUT", path, access, gin.H{"remark": "desk"}); code != http.StatusOK {
+		t.Fatalf("update device failed: %d %v", code, resp)
+	}
+	sms := &models.SmsMessage{DeviceID: 1, Address: "10086", Type: 1, SmsTime: 1}
+	engine.Insert(sms)
+	if code, _ := doJSON(t, r, "DELETE", "/api/sms/"+strconv.FormatInt(sms.ID, 10), access, nil); code != http.StatusOK {
+		t.Fatalf("delete SMS failed: %d", code)
+	}
+	// Rejected requests aren't recorded
+	if code, _ := doJSON(t, r, "PUT", path, access, gin.H{}); code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for an empty update, got %d", code)
+	}
+
+	code, resp = doJSON(t, r, "GET", "/api/audit", access, nil)
+	if code != http.StatusOK || resp["total"] != float64(3) {
+		t.Fatalf("Expected 3 audit entries, got %d %v", code, resp)
+	}
+	items := resp["items"].([]interface{})
+	latest := items[0].(map[string]interface{})
+	if latest["action"] != models.AuditSmsDelete || latest["username"] != "admin" || latest["target_id"] != float64(sms.ID) {
+		t.Errorf("Expected newest entry to be admin's SMS delete, got %v", latest)
+	}
+	if update := items[1].(map[string]interface{}); update["detail"] != "changed remark" {
+		t.Errorf("Expected update detail to list changed fields, got %v", update)
+	}
+
+	_, resp = doJSON(t, r, "GET", "/api/audit?action=device.create", access, nil)
+	if resp["total"] != float64(1) {
+		t.Errorf("Expected action filter to match 1 entry, got %v", resp)
+	}
+}
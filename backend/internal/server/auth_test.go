@@ -0,0 +1,225 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/config"
+	"backend/internal/db"
+	"backend/internal/models"
+	"backend/internal/repository"
+	"backend/internal/security"
+	"backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"xorm.io/xorm"
+)
+
+func newTestRouter(t *testing.T) (*config.Config, *gin.Engine) {
+	t.Helper()
+	cfg, _, r := newTestServer(t)
+	return cfg, r
+}
+
+// newTestServer is newTestRouter that also returns the engine for seeding data.
+func newTestServer(t *testing.T) (*config.Config, *xorm.Engine, *gin.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		App: config.App{
+			JWTSecret:          "test-secret",
+			AccessTokenMinutes: 15,
+			RefreshTokenDays:   7,
+		},
+		Database: config.Database{Driver: "sqlite", DSN: ":memory:"},
+	}
+	engine, err := db.NewEngine(cfg)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+
+	hash, _ := security.HashPassword("secret")
+	if _, err := engine.Insert(&models.User{Username: "admin", Password: hash, Role: models.RoleAdmin}); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	return cfg, engine, NewRouter(cfg, engine)
+}
+
+// doJSON performs a request and decodes the JSON response body into a map.
+func doJSON(t *testing.T, r http.Handler, method, path, token string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+// apiError returns the error object of an error response, or nil.
+func apiError(resp map[string]interface{}) map[string]interface{} {
+	e, _ := resp["error"].(map[string]interface{})
+	return e
+}
+
+func login(t *testing.T, r http.Handler) (string, string) {
+	t.Helper()
+	code, resp := doJSON(t, r, "POST", "/api/login", "", gin.H{"username": "admin", "password": "secret"})
+	if code != http.StatusOK {
+		t.Fatalf("login failed: %d %v", code, resp)
+	}
+	access, _ := resp["token"].(string)
+	refresh, _ := resp["refresh_token"].(string)
+	if access == "" || refresh == "" {
+		t.Fatalf("Expected access and refresh tokens, got %v", resp)
+	}
+	return access, refresh
+}
+
+func TestRefreshAfterAccessTokenExpiry(t *testing.T) {
+	cfg, r := newTestRouter(t)
+	_, refresh := login(t, r)
+
+	expired := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": 1,
+		"typ": security.TokenTypeAccess,
+		"jti": "expired-jti",
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	})
+	expiredToken, _ := expired.SignedString([]byte(cfg.App.JWTSecret))
+	if code, _ := doJSON(t, r, "GET", "/api/profile", expiredToken, nil); code != http.StatusUnauthorized {
+		t.Fatalf("Expected expired access token to be rejected, got %d", code)
+	}
+
+	code, resp := doJSON(t, r, "POST", "/api/refresh", "", gin.H{"refresh_token": refresh})
+	if code != http.StatusOK {
+		t.Fatalf("refresh failed: %d %v", code, resp)
+	}
+	newToken, _ := resp["token"].(string)
+	if code, _ := doJSON(t, r, "GET", "/api/profile", newToken, nil); code != http.StatusOK {
+		t.Fatalf("Expected refreshed access token to work, got %d", code)
+	}
+
+	// A refresh token must not be usable as an access token and vice versa
+	if code, _ := doJSON(t, r, "GET", "/api/profile", refresh, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected refresh token to be rejected by AuthMiddleware, got %d", code)
+	}
+	if code, _ := doJSON(t, r, "POST", "/api/refresh", "", gin.H{"refresh_token": newToken}); code != http.StatusUnauthorized {
+		t.Errorf("Expected access token to be rejected by /api/refresh, got %d", code)
+	}
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	_, r := newTestRouter(t)
+	access, refresh := login(t, r)
+
+	if code, _ := doJSON(t, r, "GET", "/api/profile", access, nil); code != http.StatusOK {
+		t.Fatalf("Expected fresh token to work, got %d", code)
+	}
+	if code, resp := doJSON(t, r, "POST", "/api/logout", access, gin.H{"refresh_token": refresh}); code != http.StatusOK {
+		t.Fatalf("logout failed: %d %v", code, resp)
+	}
+
+	if code, _ := doJSON(t, r, "GET", "/api/profile", access, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked access token to be rejected, got %d", code)
+	}
+	if code, _ := doJSON(t, r, "POST", "/api/refresh", "", gin.H{"refresh_token": refresh}); code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked refresh token to be rejected, got %d", code)
+	}
+
+	// Other sessions are unaffected
+	other, _ := login(t, r)
+	if code, _ := doJSON(t, r, "GET", "/api/profile", other, nil); code != http.StatusOK {
+		t.Errorf("Expected a new session to work after logout, got %d", code)
+	}
+}
+
+func TestMetricsEndpointIsPublic(t *testing.T) {
+	_, r := newTestRouter(t)
+	login(t, r)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected /metrics to be served without auth, got %d", w.Code)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`smserver_login_attempts_total{result="success"}`)) {
+		t.Errorf("Expected login counter in metrics output")
+	}
+}
+
+func TestStreamAcceptsQueryToken(t *testing.T) {
+	_, r := newTestRouter(t)
+	access, _ := login(t, r)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	if resp, err := http.Get(srv.URL + "/api/stream"); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected stream without token to be rejected, got %v %v", resp, err)
+	}
+
+	resp, err := http.Get(srv.URL + "/api/stream?token=" + access)
+	if err != nil {
+		t.Fatalf("stream request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected event stream, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	services.PublishEvent(services.Event{DeviceID: 7, Kind: "sms", Address: "10086", Preview: "hi"})
+
+	buf := make([]byte, 512)
+	n, err := resp.Body.Read(buf)
+	if err != nil {
+		t.Fatalf("read stream: %v", err)
+	}
+	if !bytes.Contains(buf[:n], []byte("event:sms")) || !bytes.Contains(buf[:n], []byte(`"device_id":7`)) {
+		t.Errorf("Unexpected stream data: %q", buf[:n])
+	}
+}
+
+func TestRotateJWTSecretInvalidatesTokens(t *testing.T) {
+	cfg, engine, r := newTestServer(t)
+	access, refresh := login(t, r)
+
+	code, resp := doJSON(t, r, "POST", "/api/security/rotate-jwt-secret", access, nil)
+	secret, _ := resp["jwt_secret"].(string)
+	if code != http.StatusOK || secret == "" || secret == "test-secret" {
+		t.Fatalf("Expected a new secret, got %d %v", code, resp)
+	}
+	if string(cfg.JWTKey()) != secret {
+		t.Errorf("Expected the running config to use the new secret")
+	}
+	stored, ok, err := repository.NewSettingRepository(engine).Get(models.SettingJWTSecret)
+	if err != nil || !ok || stored != secret {
+		t.Errorf("Expected the new secret to be persisted, got %q %v %v", stored, ok, err)
+	}
+
+	if code, _ := doJSON(t, r, "GET", "/api/profile", access, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected old access token to be rejected, got %d", code)
+	}
+	if code, _ := doJSON(t, r, "POST", "/api/refresh", "", gin.H{"refresh_token": refresh}); code != http.StatusUnauthorized {
+		t.Errorf("Expected old refresh token to be rejected, got %d", code)
+	}
+	access, _ = login(t, r)
+	if code, _ := doJSON(t, r, "GET", "/api/profile", access, nil); code != http.StatusOK {
+		t.Errorf("Expected a fresh login to work, got %d", code)
+	}
+}
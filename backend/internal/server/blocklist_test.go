@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBlocklistCRUDAndUnblock(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	if code, _ := doJSON(t, r, "POST", "/api/blocklist", access, gin.H{
+		"match_type": "regex", "pattern": "(\\d+", "action": "hide",
+	}); code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for invalid regex, got %d", code)
+	}
+
+	code, resp := doJSON(t, r, "POST", "/api/blocklist", access, gin.H{
+		"match_type": "prefix", "pattern": "1069", "action": "hide",
+	})
+	if code != http.StatusCreated || resp["enabled"] != true {
+		t.Fatalf("Expected 201 with the entry enabled, got %d: %v", code, resp)
+	}
+	path := "/api/blocklist/" + strconv.FormatInt(int64(resp["id"].(float64)), 10)
+
+	code, resp = doJSON(t, r, "PUT", path, access, gin.H{"match_type": "exact", "pattern": "10690001", "action": "delete"})
+	if code != http.StatusOK || resp["action"] != "delete" {
+		t.Fatalf("Unexpected update response %d: %v", code, resp)
+	}
+	if code, _ := doJSON(t, r, "DELETE", path, access, nil); code != http.StatusOK {
+		t.Fatalf("Expected 200 on delete, got %d", code)
+	}
+
+	device := &models.Device{Name: "a", PhoneAddr: "http://a"}
+	engine.Insert(device)
+	hidden := &models.SmsMessage{DeviceID: device.ID, Address: "10690001", Body: "sale", Type: 1, SmsTime: 1000, Blocked: true}
+	engine.Insert(hidden)
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "hi", Type: 1, SmsTime: 2000})
+
+	_, resp = doJSON(t, r, "GET", "/api/sms", access, nil)
+	if resp["total"] != float64(1) || resp["unread_count"] != float64(1) {
+		t.Errorf("Expected the blocked SMS out of lists and unread counts, got %v", resp)
+	}
+	_, resp = doJSON(t, r, "GET", "/api/blocklist/blocked", access, nil)
+	if resp["total"] != float64(1) {
+		t.Fatalf("Expected one blocked SMS, got %v", resp)
+	}
+
+	unblock := "/api/sms/" + strconv.FormatInt(hidden.ID, 10) + "/unblock"
+	if code, _ := doJSON(t, r, "POST", unblock, access, nil); code != http.StatusOK {
+		t.Fatalf("Expected 200 on unblock, got %d", code)
+	}
+	if code, _ := doJSON(t, r, "POST", unblock, access, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 unblocking twice, got %d", code)
+	}
+	if _, resp = doJSON(t, r, "GET", "/api/sms", access, nil); resp["total"] != float64(2) {
+		t.Errorf("Expected the unblocked SMS back in the list, got %v", resp)
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSendBulkSMSReportsPerRecipientResults(t *testing.T) {
+	_, engine, r := newTestServer(t)
+
+	var inFlight, maxInFlight int32
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+
+		var req phoneclient.SmsSendRequest
+		json.Unmarshal(data, &req)
+		if path == "/sms/send" && req.PhoneNumbers == "10000" {
+			return phoneclient.Response{Code: 500, Msg: "send failed"}
+		}
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{"enable_api_sms_send": true}}
+	})
+
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	if _, err := engine.Insert(&device); err != nil {
+		t.Fatalf("insert device: %v", err)
+	}
+	access, _ := login(t, r)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/sms/bulk"
+
+	numbers := []string{"10086", "10000", "10010", "95588", "95533"}
+	code, resp := doJSON(t, r, "POST", path, access, gin.H{"sim_slot": 1, "numbers": numbers, "body": "hello"})
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", code, resp)
+	}
+	results := resp["results"].([]interface{})
+	if len(results) != len(numbers) {
+		t.Fatalf("Expected %d results, got %v", len(numbers), results)
+	}
+	for i, item := range results {
+		result := item.(map[string]interface{})
+		if result["number"] != numbers[i] {
+			t.Errorf("Result %d is for %v, want %s", i, result["number"], numbers[i])
+		}
+		wantSuccess := numbers[i] != "10000"
+		if result["success"] != wantSuccess {
+			t.Errorf("Result for %s: success=%v, want %v (error %v)", numbers[i], result["success"], wantSuccess, result["error"])
+		}
+	}
+	if resp["success"] != float64(4) || resp["failed"] != float64(1) {
+		t.Errorf("Unexpected summary: success=%v failed=%v", resp["success"], resp["failed"])
+	}
+	if maxInFlight > 3 {
+		t.Errorf("Expected at most 3 concurrent sends, saw %d", maxInFlight)
+	}
+
+	if code, _ := doJSON(t, r, "POST", path, access, gin.H{"sim_slot": 1}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without recipients, got %d", code)
+	}
+}
+
+func TestResendSmsUsesStoredMessage(t *testing.T) {
+	_, engine, r := newTestServer(t)
+
+	var got phoneclient.SmsSendRequest
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		if path == "/sms/send" {
+			json.Unmarshal(data, &got)
+		}
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{"enable_api_sms_send": true}}
+	})
+
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	if _, err := engine.Insert(&device); err != nil {
+		t.Fatalf("insert device: %v", err)
+	}
+	sent := models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "retry me", Type: 2, SimID: 1, SmsTime: 1000}
+	received := models.SmsMessage{DeviceID: device.ID, Address: "10010", Body: "hi", Type: 1, SimID: 0, SmsTime: 2000}
+	if _, err := engine.Insert(&sent, &received); err != nil {
+		t.Fatalf("insert sms: %v", err)
+	}
+	access, _ := login(t, r)
+
+	code, resp := doJSON(t, r, "POST", "/api/sms/"+strconv.FormatInt(sent.ID, 10)+"/resend", access, nil)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", code, resp)
+	}
+	if got.PhoneNumbers != "10086" || got.MsgContent != "retry me" || got.SimSlot != 2 {
+		t.Errorf("Unexpected send request: %+v", got)
+	}
+
+	code, _ = doJSON(t, r, "POST", "/api/sms/"+strconv.FormatInt(received.ID, 10)+"/resend", access, nil)
+	if code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a received SMS, got %d", code)
+	}
+	if code, _ := doJSON(t, r, "POST", "/api/sms/999/resend", access, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing SMS, got %d", code)
+	}
+}
+
+func TestResendSmsSavesTheNewCopyWhenThePhoneIsSlow(t *testing.T) {
+	_, engine, r := newTestServer(t)
+
+	var queries int32
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		if path != "/sms/query" {
+			return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{"enable_api_sms_send": true}}
+		}
+		// The earlier copy is listed at once, the resent one only from the third poll
+		items := []phoneclient.SmsItem{{Number: "10086", Content: "retry me", Type: 2, SimID: 1, Date: 1000}}
+		if atomic.AddInt32(&queries, 1) >= 3 {
+			items = append([]phoneclient.SmsItem{{Number: "10086", Content: "retry me", Type: 2, SimID: 1, Date: time.Now().UnixMilli()}}, items...)
+		}
+		return phoneclient.Response{Code: 200, Msg: "success", Data: items}
+	})
+
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	if _, err := engine.Insert(&device); err != nil {
+		t.Fatalf("insert device: %v", err)
+	}
+	sent := models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "retry me", Type: 2, SimID: 1, SmsTime: 1000}
+	if _, err := engine.Insert(&sent); err != nil {
+		t.Fatalf("insert sms: %v", err)
+	}
+	access, _ := login(t, r)
+
+	if code, resp := doJSON(t, r, "POST", "/api/sms/"+strconv.FormatInt(sent.ID, 10)+"/resend", access, nil); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", code, resp)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		count, _ := engine.Where("device_id = ? AND address = ? AND type = 2", device.ID, "10086").Count(&models.SmsMessage{})
+		if count == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the resent copy to be saved next to the original, got %d rows after %d queries", count, atomic.LoadInt32(&queries))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestContactGroupBulkSend(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	var mu sync.Mutex
+	var sentTo []string
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		if path == "/sms/send" {
+			var req phoneclient.SmsSendRequest
+			json.Unmarshal(data, &req)
+			mu.Lock()
+			sentTo = append(sentTo, req.PhoneNumbers)
+			mu.Unlock()
+		}
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{"enable_api_sms_send": true}}
+	})
+	device := &models.Device{Name: "a", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	other := &models.Device{Name: "b", PhoneAddr: "http://b", SM4Key: testPhoneKey}
+	engine.Insert(device)
+	engine.Insert(other)
+	mom := &models.Contact{DeviceID: device.ID, Name: "Mom", Phone: "13800000001"}
+	dad := &models.Contact{DeviceID: device.ID, Name: "Dad", Phone: "13800000002"}
+	stranger := &models.Contact{DeviceID: other.ID, Name: "Stranger", Phone: "13800000009"}
+	engine.Insert(mom)
+	engine.Insert(dad)
+	engine.Insert(stranger)
+	base := fmt.Sprintf("/api/devices/%d/contact-groups", device.ID)
+
+	code, resp := doJSON(t, r, "POST", base, access, gin.H{"name": "family"})
+	if code != http.StatusCreated {
+		t.Fatalf("create group failed: %d %v", code, resp)
+	}
+	groupID := int64(resp["id"].(float64))
+	if code, _ := doJSON(t, r, "POST", base, access, gin.H{"name": "family"}); code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate name, got %d", code)
+	}
+
+	members := fmt.Sprintf("%s/%d/members", base, groupID)
+	if code, _ := doJSON(t, r, "POST", members, access, gin.H{"contact_ids": []int64{stranger.ID}}); code != http.StatusBadRequest {
+		t.Errorf("Expected another device's contact to be rejected, got %d", code)
+	}
+	code, resp = doJSON(t, r, "POST", members, access, gin.H{"contact_ids": []int64{mom.ID, dad.ID, mom.ID}})
+	if code != http.StatusOK || resp["added"] != float64(2) {
+		t.Fatalf("Expected 2 members added, got %d %v", code, resp)
+	}
+	code, resp = doJSON(t, r, "GET", members, access, nil)
+	if items, _ := resp["items"].([]interface{}); code != http.StatusOK || len(items) != 2 {
+		t.Errorf("Expected 2 members listed, got %d %v", code, resp)
+	}
+
+	// Mom's number is also given directly; she gets one message
+	bulk := fmt.Sprintf("/api/devices/%d/sms/bulk", device.ID)
+	body := gin.H{"sim_slot": 1, "numbers": []string{"13800000001", "10086"}, "group_id": groupID, "body": "dinner at 7"}
+	code, resp = doJSON(t, r, "POST", bulk, access, body)
+	if code != http.StatusOK || resp["success"] != float64(3) {
+		t.Fatalf("Expected 3 sends, got %d %v", code, resp)
+	}
+	sort.Strings(sentTo)
+	if want := []string{"10086", "13800000001", "13800000002"}; fmt.Sprint(sentTo) != fmt.Sprint(want) {
+		t.Errorf("Expected sends to %v, got %v", want, sentTo)
+	}
+
+	code, _ = doJSON(t, r, "DELETE", fmt.Sprintf("%s/%d", members, dad.ID), access, nil)
+	if code != http.StatusOK {
+		t.Errorf("remove member failed: %d", code)
+	}
+	otherBulk := fmt.Sprintf("/api/devices/%d/sms/bulk", other.ID)
+	if code, _ := doJSON(t, r, "POST", otherBulk, access, gin.H{"sim_slot": 1, "group_id": groupID, "body": "x"}); code != http.StatusNotFound {
+		t.Errorf("Expected another device's group to be 404, got %d", code)
+	}
+}
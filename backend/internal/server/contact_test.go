@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"backend/internal/models"
+)
+
+func TestEditHiddenContactUnhidesIt(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	device := &models.Device{Name: "a", PhoneAddr: "http://a"}
+	engine.Insert(device)
+	contact := &models.Contact{DeviceID: device.ID, Name: "10086", Phone: "10086", IsHidden: true}
+	engine.Insert(contact)
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Name: "Carrier", Type: 1, SmsTime: 1})
+	path := fmt.Sprintf("/api/devices/%d/contacts/%d", device.ID, contact.ID)
+
+	code, resp := doJSON(t, r, "PUT", path, access, map[string]string{"name": "China Mobile", "note": "carrier"})
+	if code != http.StatusOK || resp["name"] != "China Mobile" || resp["is_hidden"] != false {
+		t.Fatalf("Expected edited, visible contact, got %d %v", code, resp)
+	}
+	var stored models.Contact
+	engine.ID(contact.ID).Get(&stored)
+	if stored.IsHidden || stored.Note != "carrier" {
+		t.Errorf("Expected edit persisted and contact unhidden, got %+v", stored)
+	}
+
+	smsPath := fmt.Sprintf("/api/devices/%d/sms", device.ID)
+	_, resp = doJSON(t, r, "GET", smsPath, access, nil)
+	if name := resp["items"].([]interface{})[0].(map[string]interface{})["contact_name"]; name != "China Mobile" {
+		t.Errorf("Expected SMS to show the edited contact name, got %v", name)
+	}
+
+	if code, _ := doJSON(t, r, "DELETE", path, access, nil); code != http.StatusOK {
+		t.Fatalf("Expected delete to succeed, got %d", code)
+	}
+	_, resp = doJSON(t, r, "GET", smsPath, access, nil)
+	if name := resp["items"].([]interface{})[0].(map[string]interface{})["contact_name"]; name != "Carrier" {
+		t.Errorf("Expected SMS to fall back to its stored name after delete, got %v", name)
+	}
+	if code, _ := doJSON(t, r, "DELETE", path, access, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a deleted contact, got %d", code)
+	}
+}
+
+func TestQueryAllContactsMergesNumbers(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	a := &models.Device{Name: "a", PhoneAddr: "http://a"}
+	b := &models.Device{Name: "b", PhoneAddr: "http://b"}
+	engine.Insert(a)
+	engine.Insert(b)
+	engine.Insert(&models.Contact{DeviceID: a.ID, Name: "Alice", Phone: "138 0013 8000"})
+	engine.Insert(&models.Contact{DeviceID: b.ID, Name: "Alice W", Phone: "+8613800138000"})
+	engine.Insert(&models.Contact{DeviceID: b.ID, Name: "Bob", Phone: "10010"})
+	engine.Insert(&models.Contact{DeviceID: a.ID, Name: "10086", Phone: "10086", IsHidden: true})
+
+	code, resp := doJSON(t, r, "GET", "/api/contacts", access, nil)
+	if code != http.StatusOK || resp["total"] != float64(2) {
+		t.Fatalf("Expected 2 numbers, got %d %v", code, resp)
+	}
+	alice := resp["items"].([]interface{})[0].(map[string]interface{})
+	if alice["name"] != "Alice" || alice["phone_key"] != "13800138000" || len(alice["device_ids"].([]interface{})) != 2 || len(alice["contacts"].([]interface{})) != 2 {
+		t.Errorf("Expected Alice merged across both devices, got %v", alice)
+	}
+
+	_, resp = doJSON(t, r, "GET", "/api/contacts?keyword=W", access, nil)
+	items := resp["items"].([]interface{})
+	if len(items) != 1 || len(items[0].(map[string]interface{})["device_ids"].([]interface{})) != 2 {
+		t.Errorf("Expected a match on one device to list every device, got %v", resp)
+	}
+
+	_, resp = doJSON(t, r, "GET", "/api/contacts?include_hidden=true&page_size=2&page_num=2", access, nil)
+	if resp["total"] != float64(3) || len(resp["items"].([]interface{})) != 1 {
+		t.Errorf("Expected the hidden contact on the second page, got %v", resp)
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	cfg, r := newTestRouter(t)
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("OPTIONS", "/api/login", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	cases := []struct {
+		name   string
+		allow  []string
+		origin string
+		want   string
+	}{
+		{"nothing configured allows all", nil, "https://a.example", "*"},
+		{"lone wildcard allows all", []string{"*"}, "https://a.example", "*"},
+		{"listed origin is echoed", []string{"https://a.example", "https://b.example"}, "https://b.example", "https://b.example"},
+		{"match ignores case and trailing slash", []string{"https://A.example/"}, "https://a.example", "https://a.example"},
+		{"unlisted origin gets no header", []string{"https://a.example", "https://b.example"}, "https://evil.example", ""},
+		{"wildcard among origins echoes", []string{"https://a.example", "*"}, "https://evil.example", "https://evil.example"},
+		{"several matching entries echo once", []string{"https://a.example", "*", "https://a.example"}, "https://a.example", "https://a.example"},
+	}
+	for _, tc := range cases {
+		cfg.App.AllowOrigins = tc.allow
+		w := preflight(tc.origin)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: expected 204, got %d", tc.name, w.Code)
+		}
+		got := w.Header().Values("Access-Control-Allow-Origin")
+		if tc.want == "" {
+			if len(got) != 0 {
+				t.Errorf("%s: expected no Access-Control-Allow-Origin, got %v", tc.name, got)
+			}
+			continue
+		}
+		if len(got) != 1 || got[0] != tc.want {
+			t.Errorf("%s: Access-Control-Allow-Origin = %v, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCORSConfiguredMethodsAndHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{App: config.App{
+		AllowMethods:  []string{"GET", "PATCH"},
+		AllowHeaders:  []string{"X-Request-Id"},
+		ExposeHeaders: []string{"X-Request-Id"},
+	}}
+	r := gin.New()
+	r.Use(CORSMiddleware(cfg))
+
+	req := httptest.NewRequest("OPTIONS", "/api/devices/1", nil)
+	req.Header.Set("Origin", "https://a.example")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 for preflight, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET,PATCH" {
+		t.Errorf("Access-Control-Allow-Methods = %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "X-Request-Id,Content-Type,Authorization,Idempotency-Key" {
+		t.Errorf("Access-Control-Allow-Headers = %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-Request-Id" {
+		t.Errorf("Access-Control-Expose-Headers = %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Expected credentials to stay allowed, got %q", got)
+	}
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDeviceConnectionTestDoesNotWrite(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{
+			"extra_device_mark": "Pixel", "extra_sim1": "CMCC",
+		}}
+	})
+
+	device := models.Device{Name: "phone", PhoneAddr: "http://127.0.0.1:1", SM4Key: testPhoneKey, Status: "offline"}
+	if _, err := engine.Insert(&device); err != nil {
+		t.Fatalf("insert device: %v", err)
+	}
+	access, _ := login(t, r)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/test"
+
+	// The saved address is unreachable; test against the unsaved one instead
+	code, resp := doJSON(t, r, "POST", path, access, gin.H{"phone_addr": phone.URL})
+	if code != http.StatusOK || resp["success"] != true {
+		t.Fatalf("Expected a successful test, got %d %v", code, resp)
+	}
+	if _, ok := resp["latency_ms"].(float64); !ok {
+		t.Errorf("Expected latency_ms in response, got %v", resp)
+	}
+	if cfg, _ := resp["config"].(map[string]interface{}); cfg["extra_device_mark"] != "Pixel" {
+		t.Errorf("Expected decrypted config, got %v", resp["config"])
+	}
+
+	var saved models.Device
+	engine.ID(device.ID).Get(&saved)
+	if saved.PhoneAddr != device.PhoneAddr || saved.Status != "offline" || saved.DeviceMark != "" {
+		t.Errorf("Expected device to be unchanged, got %+v", saved)
+	}
+
+	if code, _ := doJSON(t, r, "POST", path, access, gin.H{"sm4_key": "short"}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed key, got %d", code)
+	}
+
+}
+
+func TestDeviceConnectionTestReportsWrongKey(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	// Like SmsForwarder, answers 400 to requests it can't decrypt
+	phone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer phone.Close()
+
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	access, _ := login(t, r)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/test"
+
+	code, resp := doJSON(t, r, "POST", path, access, nil)
+	if code != http.StatusOK || resp["success"] != false || apiError(resp)["code"] != "phone_decrypt_failed" || apiError(resp)["hint"] == nil {
+		t.Errorf("Expected a wrong-key failure with a hint, got %d %v", code, resp)
+	}
+}
+
+func TestDeviceProxyURLIsValidated(t *testing.T) {
+	_, _, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	body := gin.H{"name": "p", "phone_addr": "http://10.0.0.2:5000", "sm4_key": testPhoneKey, "proxy_url": "ftp://proxy"}
+	if code, _ := doJSON(t, r, "POST", "/api/devices", access, body); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an ftp proxy, got %d", code)
+	}
+	body["proxy_url"] = "socks5://127.0.0.1:1080"
+	code, resp := doJSON(t, r, "POST", "/api/devices", access, body)
+	if code != http.StatusOK || resp["has_proxy_url"] != true {
+		t.Fatalf("Expected device with a socks5 proxy, got %d %v", code, resp)
+	}
+	path := "/api/devices/" + strconv.FormatInt(int64(resp["id"].(float64)), 10)
+	if code, _ := doJSON(t, r, "PUT", path, access, gin.H{"proxy_url": "not a url"}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when updating to an invalid proxy, got %d", code)
+	}
+}
+
+func TestDeviceReadsOmitSecrets(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	device := models.Device{Name: "phone", PhoneAddr: "http://10.0.0.2:5000", SM4Key: testPhoneKey,
+		SignEnabled: true, SignSecret: "s3cret", ProxyURL: "http://user:pw@proxy:3128"}
+	engine.Insert(&device)
+	access, _ := login(t, r)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10)
+
+	_, list := doJSON(t, r, "GET", "/api/devices", access, nil)
+	items, _ := list["items"].([]interface{})
+	_, detail := doJSON(t, r, "GET", path, access, nil)
+	_, updated := doJSON(t, r, "PUT", path, access, gin.H{"remark": "desk"})
+	if len(items) != 1 {
+		t.Fatalf("Expected one device, got %v", list)
+	}
+	for _, resp := range []map[string]interface{}{items[0].(map[string]interface{}), detail, updated} {
+		for _, field := range []string{"sm4_key", "sign_secret", "proxy_url", "tls_cert"} {
+			if _, ok := resp[field]; ok {
+				t.Errorf("Expected %s to be omitted, got %v", field, resp)
+			}
+		}
+		if resp["has_sm4_key"] != true || resp["has_sign_secret"] != true || resp["has_proxy_url"] != true || resp["has_tls_cert"] != false {
+			t.Errorf("Expected flags for the set secrets, got %v", resp)
+		}
+	}
+}
+
+func TestDevicePhoneAddrIsValidated(t *testing.T) {
+	_, _, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	body := gin.H{"name": "p", "phone_addr": "192.168.1.100:5000", "sm4_key": testPhoneKey}
+	code, resp := doJSON(t, r, "POST", "/api/devices", access, body)
+	if msg, _ := apiError(resp)["message"].(string); code != http.StatusBadRequest || !strings.Contains(msg, "http://") {
+		t.Errorf("Expected 400 naming the missing scheme, got %d %v", code, resp)
+	}
+	body["phone_addr"] = "http://192.168.1.100:5000/"
+	code, resp = doJSON(t, r, "POST", "/api/devices", access, body)
+	if code != http.StatusOK || resp["phone_addr"] != "http://192.168.1.100:5000" {
+		t.Fatalf("Expected the trailing slash to be trimmed, got %d %v", code, resp)
+	}
+
+	path := "/api/devices/" + strconv.FormatInt(int64(resp["id"].(float64)), 10)
+	if code, _ := doJSON(t, r, "PUT", path, access, gin.H{"phone_addr": "ftp://192.168.1.100"}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when updating to an ftp address, got %d", code)
+	}
+	code, resp = doJSON(t, r, "PUT", path, access, gin.H{"phone_addr": " https://smsf.demo.com/ "})
+	if code != http.StatusOK || resp["phone_addr"] != "https://smsf.demo.com" {
+		t.Errorf("Expected the updated address to be normalized, got %d %v", code, resp)
+	}
+}
+
+func TestDeviceExportImport(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	engine.Insert(&models.Device{Name: "office", PhoneAddr: "http://10.0.0.2:5000", SM4Key: testPhoneKey, Tags: "work"})
+	access, _ := login(t, r)
+
+	_, resp := doJSON(t, r, "GET", "/api/devices/export", access, nil)
+	devices, _ := resp["devices"].([]interface{})
+	if len(devices) != 1 || devices[0].(map[string]interface{})["sm4_key"] != "" {
+		t.Fatalf("Expected one device without its SM4 key, got %v", resp)
+	}
+	code, backup := doJSON(t, r, "GET", "/api/devices/export?include_secrets=true", access, nil)
+	if code != http.StatusOK || backup["devices"].([]interface{})[0].(map[string]interface{})["sm4_key"] != testPhoneKey {
+		t.Fatalf("Expected the SM4 key with include_secrets, got %d %v", code, backup)
+	}
+
+	backup["devices"] = append(backup["devices"].([]interface{}),
+		gin.H{"name": "home", "phone_addr": "http://10.0.0.3:5000", "sm4_key": testPhoneKey},
+		gin.H{"name": "copy", "phone_addr": "http://10.0.0.3:5000/", "sm4_key": testPhoneKey},
+		gin.H{"name": "bad", "phone_addr": "http://10.0.0.4:5000", "sm4_key": "xyz"},
+	)
+	code, resp = doJSON(t, r, "POST", "/api/devices/import", access, backup)
+	if code != http.StatusOK || resp["created"] != 1.0 || resp["skipped"] != 2.0 || resp["failed"] != 1.0 {
+		t.Fatalf("Expected 1 created, 2 skipped, 1 failed, got %d %v", code, resp)
+	}
+	if n, _ := engine.Count(&models.Device{}); n != 2 {
+		t.Errorf("Expected 2 devices after import, got %d", n)
+	}
+}
+
+func TestDeviceCapabilitiesCache(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{
+			"enable_api_sms_send": false, "enable_api_wol": true,
+		}}
+	})
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	access, _ := login(t, r)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10)
+
+	if code, resp := doJSON(t, r, "GET", path+"/config", access, nil); code != http.StatusOK {
+		t.Fatalf("config query failed: %d %v", code, resp)
+	}
+	var stored models.Device
+	engine.ID(device.ID).Get(&stored)
+	if stored.Capabilities == nil || stored.Capabilities.SmsSend || !stored.Capabilities.Wol {
+		t.Fatalf("Expected capabilities to be stored, got %+v", stored.Capabilities)
+	}
+
+	phone.Close()
+	body := gin.H{"sim_slot": 1, "phone_numbers": "10086", "msg_content": "hi"}
+	code, resp := doJSON(t, r, "POST", path+"/sms/send", access, body)
+	if code != http.StatusConflict || apiError(resp)["capability"] != "sms_send" {
+		t.Errorf("Expected 409 for sms_send without contacting the phone, got %d %v", code, resp)
+	}
+	bulk := gin.H{"sim_slot": 1, "numbers": []string{"10086", "10010"}, "body": "hi"}
+	code, resp = doJSON(t, r, "POST", path+"/sms/bulk", access, bulk)
+	if code != http.StatusConflict || apiError(resp)["capability"] != "sms_send" {
+		t.Errorf("Expected 409 for a bulk send, got %d %v", code, resp)
+	}
+	sent := models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "hi", Type: 2, SmsTime: 1000}
+	engine.Insert(&sent)
+	code, resp = doJSON(t, r, "POST", "/api/sms/"+strconv.FormatInt(sent.ID, 10)+"/resend", access, nil)
+	if code != http.StatusConflict || apiError(resp)["capability"] != "sms_send" {
+		t.Errorf("Expected 409 for a resend, got %d %v", code, resp)
+	}
+	if n, _ := engine.Count(&models.SmsMessage{}); n != 1 {
+		t.Errorf("Expected no failed sends to be recorded, got %d messages", n)
+	}
+	if code, _ := doJSON(t, r, "POST", path+"/wol", access, gin.H{"mac": "00:11:22:33:44:55"}); code != http.StatusBadGateway {
+		t.Errorf("Expected enabled WOL to try the phone, got %d", code)
+	}
+}
+
+func TestDisabledFeatureQueriesConfigOnce(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	var paths []string
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		paths = append(paths, path)
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{
+			"enable_api_sms_send": true, "enable_api_contact_add": false,
+		}}
+	})
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	access, _ := login(t, r)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/contacts/add"
+	body := gin.H{"name": "Alice", "phone_number": "10086"}
+
+	for i := 0; i < 2; i++ {
+		code, resp := doJSON(t, r, "POST", path, access, body)
+		if code != http.StatusConflict || apiError(resp)["setting"] != "enable_api_contact_add" {
+			t.Fatalf("Expected 409 naming enable_api_contact_add, got %d %v", code, resp)
+		}
+	}
+	if len(paths) != 1 || paths[0] != "/config/query" {
+		t.Errorf("Expected a single config query and no contact add, got %v", paths)
+	}
+}
+
+func TestRefreshSelectedDevices(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	var mu sync.Mutex
+	hits := map[string]int{}
+	newPhone := func(name string) string {
+		return newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+			mu.Lock()
+			hits[name]++
+			mu.Unlock()
+			return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{}}
+		}).URL
+	}
+	selected := models.Device{Name: "selected", PhoneAddr: newPhone("selected"), SM4Key: testPhoneKey}
+	other := models.Device{Name: "other", PhoneAddr: newPhone("other"), SM4Key: testPhoneKey}
+	engine.Insert(&selected)
+	engine.Insert(&other)
+	access, _ := login(t, r)
+
+	code, resp := doJSON(t, r, "POST", "/api/devices/refresh", access, gin.H{"device_ids": []int64{selected.ID}})
+	items, _ := resp["items"].([]interface{})
+	if code != http.StatusOK || resp["refreshed"] != float64(1) || len(items) != 1 {
+		t.Fatalf("Expected only the selected device refreshed, got %d %v", code, resp)
+	}
+	if hits["selected"] == 0 || hits["other"] != 0 {
+		t.Errorf("Expected only the selected phone contacted, got %v", hits)
+	}
+
+	code, resp = doJSON(t, r, "POST", "/api/devices/refresh", access, nil)
+	if code != http.StatusOK || resp["refreshed"] != float64(2) || hits["other"] == 0 {
+		t.Errorf("Expected an empty body to refresh every device, got %d %v (hits %v)", code, resp, hits)
+	}
+}
+
+func TestResetDeviceData(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	synced := time.Now()
+	device := models.Device{Name: "phone", PhoneAddr: "http://phone", SM4Key: testPhoneKey, SmsSyncedAt: &synced, ContactsSyncedAt: &synced}
+	other := models.Device{Name: "other", PhoneAddr: "http://other", SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	engine.Insert(&other)
+	deleted := time.Now()
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Type: 1, SmsTime: 1})
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Type: 1, SmsTime: 2, DeletedAt: &deleted})
+	engine.Insert(&models.SmsMessage{DeviceID: other.ID, Address: "10086", Type: 1, SmsTime: 1})
+	engine.Insert(&models.CallLog{DeviceID: device.ID, Number: "10086", Type: 1, CallTime: 1})
+	engine.Insert(&models.Contact{DeviceID: device.ID, Name: "Carrier", Phone: "10086"})
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/reset-data"
+
+	if code, _ := doJSON(t, r, "POST", path, access, gin.H{}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without confirm, got %d", code)
+	}
+	code, resp := doJSON(t, r, "POST", path, access, gin.H{"confirm": true})
+	removed, _ := resp["removed"].(map[string]interface{})
+	if code != http.StatusOK || removed["sms"] != float64(2) || removed["calls"] != float64(1) || removed["contacts"] != float64(0) {
+		t.Fatalf("Expected 2 SMS and 1 call removed, got %d %v", code, resp)
+	}
+	if n, _ := engine.Unscoped().Count(&models.SmsMessage{}); n != 1 {
+		t.Errorf("Expected only the other device's SMS left, got %d", n)
+	}
+	var stored models.Device
+	engine.ID(device.ID).Get(&stored)
+	if stored.SmsSyncedAt != nil || stored.ContactsSyncedAt == nil {
+		t.Errorf("Expected only the SMS/call sync times cleared, got %v %v", stored.SmsSyncedAt, stored.ContactsSyncedAt)
+	}
+
+	code, resp = doJSON(t, r, "POST", path, access, gin.H{"confirm": true, "include_contacts": true})
+	if removed, _ := resp["removed"].(map[string]interface{}); code != http.StatusOK || removed["contacts"] != float64(1) {
+		t.Errorf("Expected the contact removed, got %d %v", code, resp)
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	_, _, r := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the spec to be public, got %d", w.Code)
+	}
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Spec is not JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("Expected an OpenAPI 3 document, got version %q", spec.OpenAPI)
+	}
+
+	// Every /api route is documented, and every documented operation is routed
+	param := regexp.MustCompile(`:(\w+)`)
+	routed := make(map[string]bool)
+	for _, route := range r.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/") || route.Path == "/api/openapi.json" || route.Path == "/api/docs" {
+			continue
+		}
+		op := strings.ToLower(route.Method) + " " + param.ReplaceAllString(route.Path, "{$1}")
+		routed[op] = true
+	}
+	documented := make(map[string]bool)
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method != "parameters" {
+				documented[method+" "+path] = true
+			}
+		}
+	}
+	for op := range routed {
+		if !documented[op] {
+			t.Errorf("Route %s is missing from openapi.yaml", op)
+		}
+	}
+	for op := range documented {
+		if !routed[op] {
+			t.Errorf("openapi.yaml documents %s, which is not routed", op)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/docs", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/api/openapi.json") {
+		t.Errorf("Expected the Swagger UI page to load the spec, got %d", w.Code)
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestErrorEnvelope(t *testing.T) {
+	_, _, r := newTestServer(t)
+	admin, _ := login(t, r)
+	doJSON(t, r, "POST", "/api/users", admin, gin.H{"username": "viewer", "password": "pw"})
+	_, resp := doJSON(t, r, "POST", "/api/login", "", gin.H{"username": "viewer", "password": "pw"})
+	viewer, _ := resp["token"].(string)
+
+	cases := []struct {
+		name, method, path, token string
+		body                      interface{}
+		status                    int
+		code                      string
+	}{
+		{"invalid id", "GET", "/api/devices/abc", admin, nil, http.StatusBadRequest, "invalid_id"},
+		{"not found", "GET", "/api/devices/999", admin, nil, http.StatusNotFound, "device_not_found"},
+		{"validation", "POST", "/api/devices", admin, gin.H{"name": "phone"}, http.StatusBadRequest, "invalid_request"},
+		{"no credentials", "GET", "/api/devices", "", nil, http.StatusUnauthorized, "unauthorized"},
+		{"wrong role", "POST", "/api/devices", viewer, gin.H{"name": "phone"}, http.StatusForbidden, "forbidden"},
+		{"bad login", "POST", "/api/login", "", gin.H{"username": "admin", "password": "wrong"}, http.StatusUnauthorized, "unauthorized"},
+	}
+	for _, tc := range cases {
+		code, resp := doJSON(t, r, tc.method, tc.path, tc.token, tc.body)
+		e := apiError(resp)
+		if code != tc.status || e["code"] != tc.code {
+			t.Errorf("%s: expected %d %s, got %d %v", tc.name, tc.status, tc.code, code, resp)
+		}
+		if msg, _ := e["message"].(string); msg == "" {
+			t.Errorf("%s: expected a message, got %v", tc.name, resp)
+		}
+	}
+}
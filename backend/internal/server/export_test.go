@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"backend/internal/models"
+)
+
+// download performs an authenticated GET and returns the status and body.
+func download(t *testing.T, r http.Handler, path, token string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+func TestExportSms(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	device := models.Device{Name: "phone", PhoneAddr: "http://10.0.0.2:5000", SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	engine.Insert(&models.Contact{DeviceID: device.ID, Name: "Carrier", Phone: "10086"})
+	for _, sms := range []*models.SmsMessage{
+		{DeviceID: device.ID, Address: "10086", Body: "hello, \"world\"", Type: 1, SmsTime: 1000},
+		{DeviceID: device.ID, Address: "10086", Body: "reply", Type: 2, SmsTime: 2000, IsRead: true},
+		{DeviceID: device.ID, Address: "95555", Body: "loan offer", Type: 1, SmsTime: 3000, Blocked: true},
+	} {
+		engine.Insert(sms)
+	}
+	access, _ := login(t, r)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/sms/export"
+
+	code, body := download(t, r, path, access)
+	rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if code != http.StatusOK || err != nil || len(rows) != 3 {
+		t.Fatalf("Expected a header and two messages, got %d %v %q", code, err, body)
+	}
+	if rows[1][0] != "10086" || rows[1][1] != "Carrier" || rows[1][2] != "hello, \"world\"" || rows[2][3] != "2" || rows[2][6] != "true" {
+		t.Errorf("Unexpected CSV rows %q", rows)
+	}
+
+	code, body = download(t, r, path+"?format=json&type=2", access)
+	var items []map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &items); code != http.StatusOK || err != nil || len(items) != 1 || items[0]["body"] != "reply" {
+		t.Errorf("Expected the sent message as JSON, got %d %v %s", code, err, body)
+	}
+
+	if code, _ := download(t, r, path+"?format=xml", access); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown format, got %d", code)
+	}
+}
+
+func TestExportCalls(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	device := models.Device{Name: "phone", PhoneAddr: "http://10.0.0.2:5000", SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	for _, call := range []*models.CallLog{
+		{DeviceID: device.ID, Number: "10086", Type: 1, Duration: 30, CallTime: 1000},
+		{DeviceID: device.ID, Number: "10010", Type: 3, CallTime: 2000},
+		{DeviceID: device.ID, Number: "10000", Type: 2, Duration: 5, CallTime: 3000},
+	} {
+		engine.Insert(call)
+	}
+	access, _ := login(t, r)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/calls/export"
+
+	code, body := download(t, r, path+"?from=1000&to=2000", access)
+	rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if code != http.StatusOK || err != nil || len(rows) != 3 {
+		t.Fatalf("Expected a header and the two calls in range, got %d %v %q", code, err, body)
+	}
+	if rows[1][0] != "10086" || rows[1][2] != "incoming" || rows[1][3] != "30" || rows[2][2] != "missed" {
+		t.Errorf("Unexpected CSV rows %q", rows)
+	}
+
+	code, body = download(t, r, path+"?format=json&type=2", access)
+	var items []map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &items); code != http.StatusOK || err != nil || len(items) != 1 || items[0]["number"] != "10000" {
+		t.Errorf("Expected the outgoing call as JSON, got %d %v %s", code, err, body)
+	}
+
+	if code, _ := download(t, r, path+"?from=3000&to=1000", access); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an inverted range, got %d", code)
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestForwardRuleCRUDRejectsInvalidRegex(t *testing.T) {
+	_, r := newTestRouter(t)
+	access, _ := login(t, r)
+
+	code, resp := doJSON(t, r, "POST", "/api/forward-rules", access, gin.H{
+		"match_type": "regex", "pattern": "(\\d+", "target_url": "https://example.com/hook",
+	})
+	if code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for invalid regex, got %d", code)
+	}
+	if msg, _ := apiError(resp)["message"].(string); !strings.Contains(msg, "invalid regex") {
+		t.Errorf("Expected a clear regex error, got %q", msg)
+	}
+
+	code, resp = doJSON(t, r, "POST", "/api/forward-rules", access, gin.H{
+		"name": "otp", "match_type": "regex", "pattern": "\\d{6}", "target_url": "https://example.com/hook",
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %v", code, resp)
+	}
+	if resp["enabled"] != true {
+		t.Errorf("Expected new rule to be enabled by default, got %v", resp["enabled"])
+	}
+	path := "/api/forward-rules/" + strconv.FormatInt(int64(resp["id"].(float64)), 10)
+
+	code, resp = doJSON(t, r, "PUT", path, access, gin.H{
+		"match_type": "sim", "pattern": "1", "target_url": "https://example.com/hook", "enabled": false,
+	})
+	if code != http.StatusOK || resp["match_type"] != "sim" || resp["enabled"] != false {
+		t.Fatalf("Unexpected update response %d: %v", code, resp)
+	}
+
+	code, resp = doJSON(t, r, "GET", "/api/forward-rules", access, nil)
+	if items, _ := resp["items"].([]interface{}); code != http.StatusOK || len(items) != 1 {
+		t.Fatalf("Expected 1 rule, got %d: %v", code, resp)
+	}
+
+	if code, _ := doJSON(t, r, "DELETE", path, access, nil); code != http.StatusOK {
+		t.Fatalf("Expected 200 on delete, got %d", code)
+	}
+	if code, _ := doJSON(t, r, "DELETE", path, access, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 deleting a missing rule, got %d", code)
+	}
+}
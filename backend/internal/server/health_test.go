@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"backend/internal/models"
+)
+
+func TestHealthReportsDatabaseState(t *testing.T) {
+	_, engine, r := newTestServer(t)
+
+	if code, resp := doJSON(t, r, "GET", "/api/health", "", nil); code != http.StatusOK || resp["status"] != "ok" {
+		t.Fatalf("Expected healthy status, got %d %v", code, resp)
+	}
+
+	engine.Insert(&models.Device{Name: "a", PhoneAddr: "http://a", Status: "online"})
+	engine.Insert(&models.Device{Name: "b", PhoneAddr: "http://b", Status: "offline"})
+	access, _ := login(t, r)
+	if code, _ := doJSON(t, r, "GET", "/api/health/devices", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected device health to require auth, got %d", code)
+	}
+	code, resp := doJSON(t, r, "GET", "/api/health/devices", access, nil)
+	if code != http.StatusOK || resp["online"] != float64(1) || resp["offline"] != float64(1) {
+		t.Fatalf("Unexpected device health %d: %v", code, resp)
+	}
+
+	engine.Close()
+	if code, _ := doJSON(t, r, "GET", "/api/health", "", nil); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 once the database is closed, got %d", code)
+	}
+}
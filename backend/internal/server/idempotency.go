@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IdempotencyKeyHeader lets clients retry a side-effecting request safely:
+// a repeat with the same key gets the first response instead of running again.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyTTL is how long a key's response is remembered.
+const idempotencyTTL = 10 * time.Minute
+
+// maxIdempotencyKeyLen bounds the keys clients may send.
+const maxIdempotencyKeyLen = 255
+
+// idempotencyStore remembers the response for each recently used key.
+type idempotencyStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*idempotentResponse
+	lastSweep time.Time
+}
+
+// idempotentResponse is a recorded response; done is false while the first
+// request is still being handled.
+type idempotentResponse struct {
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*idempotentResponse),
+	}
+}
+
+// begin returns the recorded response for key, or reserves the key and
+// returns nil if it is unused or expired.
+func (s *idempotencyStore) begin(key string) *idempotentResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		return e
+	}
+	s.entries[key] = &idempotentResponse{expires: now.Add(s.ttl)}
+	return nil
+}
+
+// finish records the response for a key reserved by begin.
+func (s *idempotencyStore) finish(key string, status int, contentType string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = &idempotentResponse{
+		done:        true,
+		status:      status,
+		contentType: contentType,
+		body:        body,
+		expires:     s.now().Add(s.ttl),
+	}
+}
+
+// abandon releases a key whose request never finished, e.g. after a panic, or
+// whose response shouldn't be replayed.
+func (s *idempotencyStore) abandon(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && !e.done {
+		delete(s.entries, key)
+	}
+}
+
+// sweep drops expired entries. Runs at most once per ttl; callers must hold s.mu.
+func (s *idempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// recordingWriter copies the response body as it is written.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware replays the first response to requests that repeat an
+// Idempotency-Key header within idempotencyTTL, marking replays with an
+// Idempotent-Replayed header. Keys are scoped to the user and path. A repeat
+// that arrives while the first request is still running gets 409. Server
+// errors (5xx) and 429 aren't recorded, so a retry with the same key runs
+// again once the phone is back or the quota has room. Requests without the
+// header are handled normally.
+func IdempotencyMiddleware() gin.HandlerFunc {
+	store := newIdempotencyStore(idempotencyTTL)
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, handlers.ErrorBody(handlers.CodeInvalidRequest, "Idempotency-Key must be at most 255 characters"))
+			return
+		}
+		key = idempotencyScope(c) + " " + c.Request.URL.Path + " " + key
+
+		if prev := store.begin(key); prev != nil {
+			if !prev.done {
+				c.AbortWithStatusJSON(http.StatusConflict, handlers.ErrorBody(handlers.CodeConflict, "a request with this Idempotency-Key is still in progress"))
+				return
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(prev.status, prev.contentType, prev.body)
+			c.Abort()
+			return
+		}
+
+		finished := false
+		defer func() {
+			if !finished {
+				store.abandon(key)
+			}
+		}()
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		if status := w.Status(); status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+			return
+		}
+		store.finish(key, w.Status(), w.Header().Get("Content-Type"), w.body.Bytes())
+		finished = true
+	}
+}
+
+// idempotencyScope identifies the authenticated user so keys from different
+// users never collide.
+func idempotencyScope(c *gin.Context) string {
+	if claims, ok := c.Get("claims"); ok {
+		if userClaims, ok := claims.(*jwt.MapClaims); ok {
+			if sub, ok := (*userClaims)["sub"].(float64); ok {
+				return "user:" + strconv.FormatInt(int64(sub), 10)
+			}
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+)
+
+func TestSendSmsIdempotencyKey(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	var sends int32
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		if path == "/sms/send" {
+			atomic.AddInt32(&sends, 1)
+		}
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{"enable_api_sms_send": true}}
+	})
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	access, _ := login(t, r)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/sms/send"
+
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"sim_slot":1,"phone_numbers":"10086","msg_content":"hi"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+access)
+		req.Header.Set(IdempotencyKeyHeader, key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := send("retry-1")
+	if first.Code != http.StatusOK {
+		t.Fatalf("first send failed: %d %s", first.Code, first.Body)
+	}
+	second := send("retry-1")
+	if second.Code != http.StatusOK || second.Body.String() != first.Body.String() || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected the first response replayed, got %d %s %v", second.Code, second.Body, second.Header())
+	}
+	if n := atomic.LoadInt32(&sends); n != 1 {
+		t.Errorf("Expected one send for a repeated key, got %d", n)
+	}
+
+	send("retry-2")
+	if n := atomic.LoadInt32(&sends); n != 2 {
+		t.Errorf("Expected a new key to send again, got %d sends", n)
+	}
+}
+
+func TestIdempotencyKeyIsReleasedAfterAFailure(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	var sends int32
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		// The phone refuses the first send only
+		if path == "/sms/send" && atomic.AddInt32(&sends, 1) == 1 {
+			return phoneclient.Response{Code: 500, Msg: "send failed"}
+		}
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{"enable_api_sms_send": true}}
+	})
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey, SendLimitHour: 2}
+	engine.Insert(&device)
+	access, _ := login(t, r)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/sms/send"
+
+	send := func(numbers, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"sim_slot":1,"phone_numbers":"`+numbers+`","msg_content":"hi"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+access)
+		req.Header.Set(IdempotencyKeyHeader, key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("10086", "retry-1"); w.Code < http.StatusInternalServerError {
+		t.Fatalf("Expected the phone's failure, got %d %s", w.Code, w.Body)
+	}
+	if w := send("10086", "retry-1"); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected a retry after a failure to send again, got %d %v", w.Code, w.Header())
+	}
+
+	// Over the quota: 429 now, but the same key may pass once there is room
+	if w := send("10010;10000", "retry-2"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 over the quota, got %d %s", w.Code, w.Body)
+	}
+	engine.ID(device.ID).Cols("send_limit_hour").Update(&models.Device{})
+	if w := send("10010;10000", "retry-2"); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected the retry to send once the quota allows, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestIdempotencyStoreExpiry(t *testing.T) {
+	now := time.Now()
+	store := newIdempotencyStore(time.Minute)
+	store.now = func() time.Time { return now }
+
+	if store.begin("k") != nil {
+		t.Fatal("Expected an unused key to be reserved")
+	}
+	if prev := store.begin("k"); prev == nil || prev.done {
+		t.Fatalf("Expected the key to be in progress, got %+v", prev)
+	}
+	store.finish("k", http.StatusOK, "application/json", []byte(`{}`))
+	if prev := store.begin("k"); prev == nil || !prev.done || prev.status != http.StatusOK {
+		t.Fatalf("Expected the recorded response, got %+v", prev)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if store.begin("k") != nil {
+		t.Errorf("Expected an expired key to be reusable")
+	}
+}
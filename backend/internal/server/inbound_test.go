@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+	"backend/internal/security"
+)
+
+func TestInboundPushStoresSms(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	device := models.Device{Name: "phone", PhoneAddr: "http://127.0.0.1:1", SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	signed := models.Device{Name: "signed", PhoneAddr: "http://127.0.0.1:2", SM4Key: testPhoneKey, SignEnabled: true, SignSecret: "s3cret"}
+	engine.Insert(&signed)
+
+	noSign := func(int64) string { return "" }
+	push := func(d models.Device, key string, sign func(int64) string, item phoneclient.SmsItem) int {
+		t.Helper()
+		now := time.Now().UnixMilli()
+		plain, _ := json.Marshal(phoneclient.PushRequest{Data: item, Timestamp: now, Sign: sign(now)})
+		body, err := security.SM4EncryptHexWithIV(key, "", plain)
+		if err != nil {
+			t.Fatalf("encrypt push: %v", err)
+		}
+		req := httptest.NewRequest("POST", "/api/devices/"+strconv.FormatInt(d.ID, 10)+"/inbound", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	otp := phoneclient.SmsItem{Number: "10086", Content: "code 1234", Date: 1700000000000}
+
+	if code := push(device, testPhoneKey, noSign, otp); code != http.StatusOK {
+		t.Fatalf("Expected the push accepted, got %d", code)
+	}
+	if code := push(device, testPhoneKey, noSign, otp); code != http.StatusOK {
+		t.Errorf("Expected a repeated push acknowledged, got %d", code)
+	}
+	var stored []models.SmsMessage
+	engine.Where("device_id = ?", device.ID).Find(&stored)
+	if len(stored) != 1 || stored[0].Type != 1 || !stored[0].Pushed || stored[0].Body != "code 1234" {
+		t.Errorf("Expected one pushed received SMS, got %+v", stored)
+	}
+	if has, _ := engine.Where("device_id = ? AND phone = ?", device.ID, "10086").Exist(&models.Contact{}); !has {
+		t.Errorf("Expected a hidden contact for the sender")
+	}
+
+	if code := push(device, "ffffffffffffffffffffffffffffffff", noSign, otp); code != http.StatusUnauthorized {
+		t.Errorf("Expected a push with the wrong key rejected, got %d", code)
+	}
+	if code := push(device, testPhoneKey, noSign, phoneclient.SmsItem{Content: "no sender"}); code != http.StatusBadRequest {
+		t.Errorf("Expected a push without a number rejected, got %d", code)
+	}
+	if code := push(signed, testPhoneKey, func(int64) string { return "bogus" }, otp); code != http.StatusUnauthorized {
+		t.Errorf("Expected a badly signed push rejected, got %d", code)
+	}
+	if code := push(signed, testPhoneKey, func(ts int64) string { return security.SmsForwarderSign(ts, signed.SignSecret) }, otp); code != http.StatusOK {
+		t.Errorf("Expected a signed push accepted, got %d", code)
+	}
+}
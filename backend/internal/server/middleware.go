@@ -1,31 +1,73 @@
 package server
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
 	"backend/config"
+	"backend/internal/handlers"
+	"backend/internal/logging"
+	"backend/internal/models"
+	"backend/internal/repository"
 	"backend/internal/security"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"xorm.io/xorm"
 )
 
-// AuthMiddleware ensures requests provide a valid JWT.
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
+// AuthMiddleware ensures requests provide a valid, unrevoked access JWT, or an
+// API key as "Authorization: ApiKey <key>" or an X-API-Key header. API key
+// requests get claims for the key's owner and are limited to the key's scopes.
+func AuthMiddleware(cfg *config.Config, engine *xorm.Engine) gin.HandlerFunc {
+	return authMiddleware(cfg, engine, false)
+}
+
+// StreamAuthMiddleware is AuthMiddleware that also accepts the token as a
+// ?token= query parameter, since browsers' EventSource can't set headers.
+// Only use it on streaming endpoints; query strings end up in access logs.
+func StreamAuthMiddleware(cfg *config.Config, engine *xorm.Engine) gin.HandlerFunc {
+	return authMiddleware(cfg, engine, true)
+}
+
+func authMiddleware(cfg *config.Config, engine *xorm.Engine, allowQueryToken bool) gin.HandlerFunc {
+	revoked := repository.NewRevokedTokenRepository(engine)
 	return func(c *gin.Context) {
+		if key := requestAPIKey(c); key != "" {
+			authenticateAPIKey(c, engine, key)
+			return
+		}
 		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" && allowQueryToken {
+			if token := c.Query("token"); token != "" {
+				authHeader = "Bearer " + token
+			}
+		}
 		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing Authorization header"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, handlers.ErrorBody(handlers.CodeUnauthorized, "missing Authorization header"))
 			return
 		}
 		parts := strings.SplitN(authHeader, " ", 2)
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid Authorization header"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, handlers.ErrorBody(handlers.CodeUnauthorized, "invalid Authorization header"))
+			return
+		}
+		claims, jti, _, err := security.ParseTokenOfType(cfg, parts[1], security.TokenTypeAccess)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, handlers.ErrorBody(handlers.CodeUnauthorized, err.Error()))
 			return
 		}
-		claims, err := security.ParseToken(cfg, parts[1])
+		isRevoked, err := revoked.IsRevoked(jti)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.AbortWithStatusJSON(http.StatusInternalServerError, handlers.ErrorBody(handlers.CodeInternal, err.Error()))
+			return
+		}
+		if isRevoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, handlers.ErrorBody(handlers.CodeUnauthorized, "token has been revoked"))
 			return
 		}
 		c.Set("claims", claims)
@@ -33,38 +75,186 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 	}
 }
 
-// CORSMiddleware allows configurable origins for the web app.
-func CORSMiddleware(cfg *config.Config) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		origin := c.Request.Header.Get("Origin")
-
-		// Determine which origin to allow
-		allowedOrigin := ""
-		if len(cfg.App.AllowOrigins) == 0 {
-			// No origins configured, allow all
-			allowedOrigin = "*"
-		} else if len(cfg.App.AllowOrigins) == 1 && cfg.App.AllowOrigins[0] == "*" {
-			// Wildcard configured
-			allowedOrigin = "*"
-		} else {
-			// Check if request origin is in allowed list
-			for _, allowed := range cfg.App.AllowOrigins {
-				if allowed == origin || allowed == "*" {
-					allowedOrigin = origin
-					break
-				}
+// APIKeyHeader is an alternative to "Authorization: ApiKey <key>".
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyTouchInterval limits how often a key's last_used_at is written.
+const apiKeyTouchInterval = time.Minute
+
+// requestAPIKey returns the API key the request authenticates with, or "".
+func requestAPIKey(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) == 2 && strings.ToLower(parts[0]) == "apikey" {
+		return strings.TrimSpace(parts[1])
+	}
+	return ""
+}
+
+// authenticateAPIKey checks plain against the stored key hashes and the
+// route against the key's scopes, then sets claims for the key's owner.
+func authenticateAPIKey(c *gin.Context, engine *xorm.Engine, plain string) {
+	repo := repository.NewAPIKeyRepository(engine)
+	var key *models.APIKey
+	if lookup := security.APIKeyLookup(plain); lookup != "" {
+		candidates, err := repo.FindByPrefix(lookup)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, handlers.ErrorBody(handlers.CodeInternal, err.Error()))
+			return
+		}
+		for i := range candidates {
+			if security.CheckAPIKey(candidates[i].KeyHash, plain) {
+				key = &candidates[i]
+			}
+		}
+	}
+	if key == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, handlers.ErrorBody(handlers.CodeUnauthorized, "invalid API key"))
+		return
+	}
+
+	var user models.User
+	has, err := engine.ID(key.UserID).Get(&user)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, handlers.ErrorBody(handlers.CodeInternal, err.Error()))
+		return
+	}
+	if !has {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, handlers.ErrorBody(handlers.CodeUnauthorized, "invalid API key"))
+		return
+	}
+	if !apiKeyAllows(key.Scopes, c.Request.Method, c.FullPath()) {
+		c.AbortWithStatusJSON(http.StatusForbidden, handlers.ErrorBody(handlers.CodeForbidden, "API key scope does not allow this request"))
+		return
+	}
+
+	if now := time.Now(); key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := repo.TouchLastUsed(key.ID, now); err != nil {
+			slog.WarnContext(c.Request.Context(), "record API key use failed", "operation", "api_key_auth", "api_key_id", key.ID, "error", err)
+		}
+	}
+	c.Set("claims", &jwt.MapClaims{"sub": float64(user.ID), "u": "key:" + key.Label, "role": user.Role})
+	c.Next()
+}
+
+// apiKeyAllows reports whether scopes cover the route. Keys can never manage
+// API keys, so a leaked key can't mint or keep others.
+func apiKeyAllows(scopes []string, method, route string) bool {
+	if strings.HasPrefix(route, "/api/api-keys") {
+		return false
+	}
+	for _, scope := range scopes {
+		switch scope {
+		case models.APIScopeAll:
+			return true
+		case models.APIScopeRead:
+			if method == http.MethodGet || method == http.MethodHead {
+				return true
 			}
-			// If no match found, use first allowed origin as fallback
-			if allowedOrigin == "" && len(cfg.App.AllowOrigins) > 0 {
-				allowedOrigin = cfg.App.AllowOrigins[0]
+		case models.APIScopeSmsSend:
+			if method == http.MethodPost && (route == "/api/devices/:id/sms/send" || route == "/api/devices/:id/sms/bulk") {
+				return true
 			}
 		}
+	}
+	return false
+}
+
+// RequireRole rejects requests whose token doesn't carry the given role with 403.
+// Must run after AuthMiddleware.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := c.Get("claims")
+		userClaims, ok := claims.(*jwt.MapClaims)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, handlers.ErrorBody(handlers.CodeUnauthorized, "invalid claims"))
+			return
+		}
+		if r, _ := (*userClaims)["role"].(string); r != role {
+			c.AbortWithStatusJSON(http.StatusForbidden, handlers.ErrorBody(handlers.CodeForbidden, "insufficient permissions"))
+			return
+		}
+		c.Next()
+	}
+}
 
+// RequestIDHeader carries the ID that ties together the logs of one request.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLen bounds client-supplied request IDs.
+const maxRequestIDLen = 128
+
+// RequestIDMiddleware takes the request's X-Request-Id, or generates one if it
+// is missing or malformed, and echoes it in the response. The ID is stored in
+// the gin context as "request_id" and in the request context, so logs written
+// with that context during the request (e.g. phone API calls) carry it.
+// Requests that end with a 5xx status are logged with it.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		ctx := logging.WithRequestID(c.Request.Context(), id)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if status := c.Writer.Status(); status >= http.StatusInternalServerError {
+			slog.ErrorContext(ctx, "request failed", "operation", "http_request",
+				"method", c.Request.Method, "path", c.FullPath(), "status", status, "errors", c.Errors.String())
+		}
+	}
+}
+
+// validRequestID accepts IDs of up to maxRequestIDLen letters, digits and -_.:
+// so a client can't inject arbitrary text into logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 16-character hex ID.
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// CORSMiddleware allows configurable origins for the web app.
+// A request from an origin outside the allow list gets no
+// Access-Control-Allow-Origin header, so the browser blocks it.
+func CORSMiddleware(cfg *config.Config) gin.HandlerFunc {
+	allowMethods := strings.Join(cfg.App.CORSMethods(), ",")
+	allowHeaders := strings.Join(cfg.App.CORSHeaders(), ",")
+	exposeHeaders := strings.Join(cfg.App.ExposeHeaders, ",")
+	return func(c *gin.Context) {
+		allowedOrigin := corsAllowedOrigin(cfg.App.AllowOrigins, c.Request.Header.Get("Origin"))
 		if allowedOrigin != "" {
 			c.Header("Access-Control-Allow-Origin", allowedOrigin)
 		}
-		c.Header("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin,Content-Type,Authorization")
+		if allowedOrigin != "*" {
+			// The header depends on the request origin, so caches must key on it
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		c.Header("Access-Control-Allow-Methods", allowMethods)
+		c.Header("Access-Control-Allow-Headers", allowHeaders)
+		if exposeHeaders != "" {
+			c.Header("Access-Control-Expose-Headers", exposeHeaders)
+		}
 		c.Header("Access-Control-Allow-Credentials", "true")
 
 		if c.Request.Method == "OPTIONS" {
@@ -74,3 +264,23 @@ func CORSMiddleware(cfg *config.Config) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// corsAllowedOrigin returns the Access-Control-Allow-Origin value for a
+// request origin, or "" if it isn't allowed. No configured origins, or a lone
+// "*", allow every origin. Otherwise the request origin is echoed once if any
+// entry matches it (scheme and host compare case-insensitively), including a
+// "*" entry mixed with explicit origins.
+func corsAllowedOrigin(allowOrigins []string, origin string) string {
+	if len(allowOrigins) == 0 || (len(allowOrigins) == 1 && allowOrigins[0] == "*") {
+		return "*"
+	}
+	if origin == "" {
+		return ""
+	}
+	for _, allowed := range allowOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
+}
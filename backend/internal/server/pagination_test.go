@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"backend/internal/models"
+)
+
+func TestPaginatedListMetadata(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	device := &models.Device{Name: "a", PhoneAddr: "http://a"}
+	engine.Insert(device)
+	for i := 0; i < 5; i++ {
+		engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "hi", Type: 1, SmsTime: int64(1000 + i)})
+	}
+
+	code, resp := doJSON(t, r, "GET", "/api/sms?page_num=1&page_size=2", access, nil)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %v", code, resp)
+	}
+	if resp["total_pages"] != float64(3) || resp["has_next"] != true {
+		t.Errorf("Unexpected first page metadata: %v", resp)
+	}
+
+	_, resp = doJSON(t, r, "GET", "/api/sms?page_num=3&page_size=2", access, nil)
+	if resp["has_next"] != false || len(resp["items"].([]interface{})) != 1 {
+		t.Errorf("Unexpected last page: %v", resp)
+	}
+
+	_, resp = doJSON(t, r, "GET", "/api/sms?page_size=100000", access, nil)
+	if resp["size"] != float64(200) {
+		t.Errorf("Expected page_size clamped to 200, got %v", resp["size"])
+	}
+}
@@ -0,0 +1,432 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"backend/internal/logging"
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+	"backend/internal/security"
+	"backend/internal/services"
+)
+
+const testPhoneKey = "0123456789abcdef0123456789abcdef"
+
+// newFakePhone starts an httptest SmsForwarder speaking the SM4-encrypted
+// protocol. respond gets the request path and decrypted data payload.
+func newFakePhone(t *testing.T, respond func(path string, data json.RawMessage) phoneclient.Response) *httptest.Server {
+	t.Helper()
+	phone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		plain, err := security.SM4DecryptHex(testPhoneKey, string(body))
+		if err != nil {
+			t.Errorf("fake phone: decrypt request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var req struct {
+			Data json.RawMessage `json:"data"`
+		}
+		json.Unmarshal(plain, &req)
+
+		out, _ := json.Marshal(respond(r.URL.Path, req.Data))
+		cipherHex, _ := security.SM4EncryptHex(testPhoneKey, out)
+		w.Write([]byte(cipherHex))
+	}))
+	t.Cleanup(phone.Close)
+	return phone
+}
+
+func TestPhoneErrorsMapToStatusAndCode(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		return phoneclient.Response{Code: 500, Msg: "WOL接口未开启"}
+	})
+
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/wol"
+
+	code, resp := doJSON(t, r, "POST", path, access, map[string]string{"mac": "00:11:22:33:44:55"})
+	if code != http.StatusConflict || apiError(resp)["code"] != "phone_feature_disabled" || apiError(resp)["phone_code"] != float64(500) {
+		t.Errorf("Expected 409 phone_feature_disabled, got %d %v", code, resp)
+	}
+
+	phoneclient.SetOptions(phoneclient.Options{}) // No retries against the dead address
+	defer phoneclient.SetOptions(phoneclient.Options{MaxRetries: 3, RetryBackoff: 500 * time.Millisecond})
+	engine.ID(device.ID).Cols("phone_addr").Update(&models.Device{PhoneAddr: "http://127.0.0.1:1"})
+	code, resp = doJSON(t, r, "POST", path, access, map[string]string{"mac": "00:11:22:33:44:55"})
+	if code != http.StatusBadGateway || apiError(resp)["code"] != "phone_unreachable" {
+		t.Errorf("Expected 502 phone_unreachable, got %d %v", code, resp)
+	}
+}
+
+func TestPingDevice(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+	var hits int32
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		atomic.AddInt32(&hits, 1)
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{}}
+	})
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/ping"
+
+	code, resp := doJSON(t, r, "GET", path, access, nil)
+	if code != http.StatusOK || resp["reachable"] != true || resp["error"] != nil {
+		t.Errorf("Expected a reachable phone, got %d %v", code, resp)
+	}
+	if _, ok := resp["latency_ms"].(float64); !ok {
+		t.Errorf("Expected latency_ms, got %v", resp)
+	}
+
+	// A dead address is reported in the body after a single attempt, even
+	// with retries enabled; an unreachable phone is not an error of the ping.
+	engine.ID(device.ID).Cols("phone_addr").Update(&models.Device{PhoneAddr: "http://127.0.0.1:1"})
+	code, resp = doJSON(t, r, "GET", path, access, nil)
+	if code != http.StatusOK || resp["reachable"] != false || apiError(resp)["code"] != "phone_unreachable" {
+		t.Errorf("Expected an unreachable phone, got %d %v", code, resp)
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("Expected one query to the live phone, got %d", n)
+	}
+}
+
+func TestSendSmsRejectsTooManySegments(t *testing.T) {
+	cfg, engine, r := newTestServer(t)
+	cfg.App.SmsMaxSegments = 2
+	access, _ := login(t, r)
+	var hits int32
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		atomic.AddInt32(&hits, 1)
+		return phoneclient.Response{Code: 200, Msg: "success"}
+	})
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/sms/send"
+
+	// 140 UCS-2 units need three 67-unit segments
+	body := map[string]interface{}{"sim_slot": 1, "phone_numbers": "10086", "msg_content": strings.Repeat("你好", 70)}
+	code, resp := doJSON(t, r, "POST", path, access, body)
+	if e := apiError(resp); code != http.StatusBadRequest || e["code"] != "sms_too_long" || e["segments"] != float64(3) ||
+		e["max_segments"] != float64(2) || e["encoding"] != "ucs2" {
+		t.Errorf("Expected 400 sms_too_long with 3 of 2 segments, got %d %v", code, resp)
+	}
+	if n := atomic.LoadInt32(&hits); n != 0 {
+		t.Errorf("Expected the phone not to be contacted, got %d requests", n)
+	}
+}
+
+func TestSendSmsAutoSimSlot(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+	var lastSlot int32
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		if path == "/sms/send" {
+			var req phoneclient.SmsSendRequest
+			json.Unmarshal(data, &req)
+			atomic.StoreInt32(&lastSlot, int32(req.SimSlot))
+		}
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{"enable_api_sms_send": true}}
+	})
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey,
+		SimInfo: `[{"slot":1,"carrier":"A","number":""},{"slot":2,"carrier":"B","number":"13800000000"}]`}
+	engine.Insert(&device)
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "+86 10086", Body: "old", Type: 1, SmsTime: 1000, SimID: 0})
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/sms/send"
+	send := func(number string) (int, map[string]interface{}) {
+		return doJSON(t, r, "POST", path, access, map[string]interface{}{"sim_slot": 0, "phone_numbers": number, "msg_content": "hi"})
+	}
+
+	if code, resp := send("10086"); code != http.StatusOK || resp["sim_slot"] != float64(1) || resp["sim_auto"] != "last_used" ||
+		atomic.LoadInt32(&lastSlot) != 1 {
+		t.Errorf("Expected SIM1 from the conversation, got %d %v", code, resp)
+	}
+	if code, resp := send("10010"); code != http.StatusOK || resp["sim_slot"] != float64(2) || resp["sim_auto"] != "has_number" ||
+		atomic.LoadInt32(&lastSlot) != 2 {
+		t.Errorf("Expected SIM2 with its own number, got %d %v", code, resp)
+	}
+
+	engine.ID(device.ID).Cols("sim_info").Update(&models.Device{SimInfo: `[{"slot":1,"carrier":"A"},{"slot":2,"carrier":"B"}]`})
+	if code, resp := send("10010"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when no SIM stands out, got %d %v", code, resp)
+	}
+	if code, _ := doJSON(t, r, "POST", path, access, map[string]interface{}{"sim_slot": 3, "phone_numbers": "10010", "msg_content": "hi"}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown slot, got %d", code)
+	}
+	if code, _ := doJSON(t, r, "POST", path, access, map[string]interface{}{"phone_numbers": "10010", "msg_content": "hi"}); code != http.StatusBadRequest {
+		t.Errorf("Expected sim_slot to stay required, got %d", code)
+	}
+}
+
+func TestSendSmsQuota(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		if path == "/sms/send" {
+			var req phoneclient.SmsSendRequest
+			json.Unmarshal(data, &req)
+			if req.PhoneNumbers == "10010" {
+				return phoneclient.Response{Code: 500, Msg: "failed"}
+			}
+		}
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{"enable_api_sms_send": true}}
+	})
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey, SendLimitHour: 3, SendLimitDay: 10}
+	engine.Insert(&device)
+	id := strconv.FormatInt(device.ID, 10)
+	send := func(numbers string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/devices/"+id+"/sms/send",
+			strings.NewReader(`{"sim_slot":1,"phone_numbers":"`+numbers+`","msg_content":"hi"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+access)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("10086;10000")
+	if w.Code != http.StatusOK || w.Header().Get("X-Quota-Remaining-Hour") != "1" || w.Header().Get("X-Quota-Remaining-Day") != "8" ||
+		w.Header().Get("X-Quota-Limit-Hour") != "3" || w.Header().Get("X-Quota-Reset-Hour") == "" {
+		t.Fatalf("Expected two sends counted, got %d %v", w.Code, w.Header())
+	}
+	// A send the phone refuses doesn't use the quota
+	if w := send("10010"); w.Code == http.StatusOK {
+		t.Fatalf("Expected the phone's failure, got %d", w.Code)
+	}
+	if w := send("10086;10000"); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 for two sends with one left, got %d %s", w.Code, w.Body)
+	} else {
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if e := apiError(resp); e["code"] != "send_quota_exceeded" || e["window"] != "hour" || e["remaining"] != float64(1) || e["reset_at"] == nil {
+			t.Errorf("Unexpected quota error %v", resp)
+		}
+	}
+	if w := send("10086"); w.Code != http.StatusOK || w.Header().Get("X-Quota-Remaining-Hour") != "0" {
+		t.Errorf("Expected the last send of the hour to pass, got %d %v", w.Code, w.Header())
+	}
+	if code, resp := doJSON(t, r, "POST", "/api/devices/"+id+"/sms/bulk", access, map[string]interface{}{
+		"sim_slot": 1, "numbers": []string{"10086"}, "body": "hi",
+	}); code != http.StatusTooManyRequests {
+		t.Errorf("Expected bulk sends to share the quota, got %d %v", code, resp)
+	}
+
+	if code, _ := doJSON(t, r, "PUT", "/api/devices/"+id, access, map[string]interface{}{"send_limit_hour": -1}); code != http.StatusBadRequest {
+		t.Errorf("Expected a negative limit to be rejected, got %d", code)
+	}
+	doJSON(t, r, "PUT", "/api/devices/"+id, access, map[string]interface{}{"send_limit_hour": 0})
+	if w := send("10086"); w.Code != http.StatusOK || w.Header().Get("X-Quota-Remaining-Hour") != "" || w.Header().Get("X-Quota-Remaining-Day") != "6" {
+		t.Errorf("Expected only the daily quota once the hourly one is lifted, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestSendSmsCommandStatus(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		switch path {
+		case "/sms/query":
+			return phoneclient.Response{Code: 200, Msg: "success", Data: []phoneclient.SmsItem{
+				{Number: "10086", Content: "hi", Type: 2, Date: time.Now().UnixMilli()},
+			}}
+		case "/sms/send":
+			var req phoneclient.SmsSendRequest
+			json.Unmarshal(data, &req)
+			if req.PhoneNumbers == "10010" {
+				return phoneclient.Response{Code: 500, Msg: "failed"}
+			}
+		}
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{"enable_api_sms_send": true}}
+	})
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/sms/send"
+
+	code, resp := doJSON(t, r, "POST", path, access, map[string]interface{}{"sim_slot": 1, "phone_numbers": "10086", "msg_content": "hi"})
+	if code != http.StatusOK || resp["command_id"] == nil {
+		t.Fatalf("Expected a command id, got %d %v", code, resp)
+	}
+	cmdPath := "/api/commands/" + strconv.FormatInt(int64(resp["command_id"].(float64)), 10)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, resp = doJSON(t, r, "GET", cmdPath, access, nil)
+		if resp["status"] == models.CommandStatusDone || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if resp["status"] != models.CommandStatusDone || resp["type"] != models.CommandTypeSendSms {
+		t.Errorf("Expected the send to end done once saved, got %v", resp)
+	}
+
+	code, resp = doJSON(t, r, "POST", path, access, map[string]interface{}{"sim_slot": 1, "phone_numbers": "10010", "msg_content": "hi"})
+	if code == http.StatusOK {
+		t.Fatalf("Expected the phone's failure, got %d %v", code, resp)
+	}
+	var failed models.Command
+	if has, _ := engine.Where("status = ?", models.CommandStatusFailed).Get(&failed); !has || failed.Result == "" {
+		t.Errorf("Expected a failed command with the error, got %+v", failed)
+	}
+	var sentSms, failedSms models.SmsMessage
+	engine.Where("address = ? AND type = 2", "10086").Get(&sentSms)
+	engine.Where("address = ? AND type = 2", "10010").Get(&failedSms)
+	if sentSms.DeliveryStatus != models.DeliveryStatusSent || failedSms.DeliveryStatus != models.DeliveryStatusFailed || failedSms.Body != "hi" {
+		t.Errorf("Expected the sent message sent and the refused one failed, got %+v and %+v", sentSms, failedSms)
+	}
+
+	if code, _ := doJSON(t, r, "GET", "/api/commands/999", access, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown command, got %d", code)
+	}
+}
+
+func TestSendSmsPollsUntilSentMessageAppears(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+	var queries int32
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		if path != "/sms/query" {
+			return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{"enable_api_sms_send": true}}
+		}
+		// The phone only saves the message by the third query
+		items := []phoneclient.SmsItem{}
+		if atomic.AddInt32(&queries, 1) >= 3 {
+			items = append(items, phoneclient.SmsItem{Number: "10086", Content: "hi", Type: 2, Date: time.Now().UnixMilli()})
+		}
+		return phoneclient.Response{Code: 200, Msg: "success", Data: items}
+	})
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	engine.Insert(&device)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/sms/send"
+
+	code, resp := doJSON(t, r, "POST", path, access, map[string]interface{}{"sim_slot": 1, "phone_numbers": "10086", "msg_content": "hi"})
+	if code != http.StatusOK {
+		t.Fatalf("Expected the send to succeed, got %d %v", code, resp)
+	}
+	cmdPath := "/api/commands/" + strconv.FormatInt(int64(resp["command_id"].(float64)), 10)
+	deadline := time.Now().Add(6 * time.Second)
+	for {
+		_, resp = doJSON(t, r, "GET", cmdPath, access, nil)
+		if resp["result"] != "" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if n, _ := engine.Where("address = ? AND type = 2", "10086").Count(&models.SmsMessage{}); n != 1 {
+		t.Errorf("Expected the sent message saved once it appeared, got %d", n)
+	}
+	if resp["status"] != models.CommandStatusDone {
+		t.Errorf("Expected the command done, got %v", resp)
+	}
+	time.Sleep(time.Second)
+	if n := atomic.LoadInt32(&queries); n != 3 {
+		t.Errorf("Expected polling to stop at the third query, got %d queries", n)
+	}
+}
+
+func TestRequestIDReachesPhoneClientLogs(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		return phoneclient.Response{Code: 500, Msg: "boom"}
+	})
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey}
+	engine.Insert(&device)
+
+	var logs bytes.Buffer
+	h, _ := logging.NewHandler(&logs, "info", "json")
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(h))
+
+	query := func(requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/devices/"+strconv.FormatInt(device.ID, 10)+"/config", nil)
+		req.Header.Set("Authorization", "Bearer "+access)
+		if requestID != "" {
+			req.Header.Set("X-Request-Id", requestID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := query("trace-42")
+	if got := w.Header().Get("X-Request-Id"); got != "trace-42" {
+		t.Errorf("Expected the client's request ID echoed, got %q", got)
+	}
+	if !bytes.Contains(logs.Bytes(), []byte(`"msg":"phone API error"`)) || !bytes.Contains(logs.Bytes(), []byte(`"request_id":"trace-42"`)) {
+		t.Errorf("Expected the phone client log to carry the request ID, got %s", logs.String())
+	}
+
+	if got := query("").Header().Get("X-Request-Id"); len(got) != 16 {
+		t.Errorf("Expected a generated request ID, got %q", got)
+	}
+	if got := query("bad id\n").Header().Get("X-Request-Id"); got == "bad id\n" || len(got) != 16 {
+		t.Errorf("Expected a malformed request ID replaced, got %q", got)
+	}
+}
+
+func TestQueuedSendSmsFollowsSendRules(t *testing.T) {
+	cfg, engine, r := newTestServer(t)
+	cfg.App.SmsMaxSegments = 2
+	access, _ := login(t, r)
+	phone := newFakePhone(t, func(path string, data json.RawMessage) phoneclient.Response {
+		if path == "/sms/send" {
+			return phoneclient.Response{Code: 500, Msg: "failed"}
+		}
+		return phoneclient.Response{Code: 200, Msg: "success", Data: map[string]interface{}{"enable_api_sms_send": true}}
+	})
+	device := models.Device{Name: "phone", PhoneAddr: phone.URL, SM4Key: testPhoneKey, SendLimitHour: 2}
+	engine.Insert(&device)
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/commands"
+	enqueue := func(numbers, msg string) (int, map[string]interface{}) {
+		return doJSON(t, r, "POST", path, access, map[string]interface{}{
+			"type": "send_sms", "payload": map[string]interface{}{"sim_slot": 1, "phone_numbers": numbers, "msg_content": msg},
+		})
+	}
+
+	if code, resp := enqueue("10086", strings.Repeat("你好", 70)); code != http.StatusBadRequest || apiError(resp)["code"] != "sms_too_long" {
+		t.Errorf("Expected 400 sms_too_long, got %d %v", code, resp)
+	}
+	code, resp := enqueue("10086;10010", "hi")
+	if code != http.StatusAccepted {
+		t.Fatalf("Expected the send to be queued, got %d %v", code, resp)
+	}
+	if code, resp := enqueue("10000", "hi"); code != http.StatusTooManyRequests || apiError(resp)["code"] != "send_quota_exceeded" {
+		t.Errorf("Expected queued sends to count against the quota, got %d %v", code, resp)
+	}
+
+	// The phone refuses the send: the command fails and the messages are kept as failed
+	var cmd models.Command
+	engine.ID(int64(resp["id"].(float64))).Get(&cmd)
+	if err := services.NewCommandService(engine).Execute(context.Background(), &cmd); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if n, _ := engine.Where("type = 2 AND delivery_status = ?", models.DeliveryStatusFailed).Count(&models.SmsMessage{}); n != 2 {
+		t.Errorf("Expected both recipients recorded as failed, got %d", n)
+	}
+	retryPath := "/api/commands/" + strconv.FormatInt(cmd.ID, 10) + "/retry"
+	if code, resp := doJSON(t, r, "POST", retryPath, access, nil); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the retry to need quota, got %d %v", code, resp)
+	}
+	engine.ID(device.ID).Cols("send_limit_hour", "capabilities").Update(&models.Device{Capabilities: &models.DeviceCapabilities{}})
+	if code, resp := doJSON(t, r, "POST", retryPath, access, nil); code != http.StatusConflict || apiError(resp)["code"] != "phone_feature_disabled" {
+		t.Errorf("Expected the retry to be refused with sending disabled, got %d %v", code, resp)
+	}
+	if code, resp := enqueue("10000", "hi"); code != http.StatusConflict {
+		t.Errorf("Expected the queue to be refused with sending disabled, got %d %v", code, resp)
+	}
+}
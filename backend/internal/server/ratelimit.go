@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginLimiter tracks failed login attempts per client IP over a sliding window.
+// Once an IP reaches maxFailures within window it is locked out for lockout.
+type loginLimiter struct {
+	maxFailures int
+	window      time.Duration
+	lockout     time.Duration
+	now         func() time.Time
+
+	mu        sync.Mutex
+	clients   map[string]*loginAttempts
+	lastSweep time.Time
+}
+
+type loginAttempts struct {
+	failures    []time.Time
+	lockedUntil time.Time
+}
+
+func newLoginLimiter(maxFailures int, window, lockout time.Duration) *loginLimiter {
+	return &loginLimiter{
+		maxFailures: maxFailures,
+		window:      window,
+		lockout:     lockout,
+		now:         time.Now,
+		clients:     make(map[string]*loginAttempts),
+	}
+}
+
+// retryAfter returns how long the IP is still locked out, or 0 if it may try.
+func (l *loginLimiter) retryAfter(ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	if a, ok := l.clients[ip]; ok && now.Before(a.lockedUntil) {
+		return a.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// fail records a failed attempt and starts a lockout once the limit is reached.
+func (l *loginLimiter) fail(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	a, ok := l.clients[ip]
+	if !ok {
+		a = &loginAttempts{}
+		l.clients[ip] = a
+	}
+	a.failures = append(pruneBefore(a.failures, now.Add(-l.window)), now)
+	if len(a.failures) >= l.maxFailures {
+		a.lockedUntil = now.Add(l.lockout)
+		a.failures = nil
+	}
+}
+
+// reset forgets all failures of an IP after a successful login.
+func (l *loginLimiter) reset(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.clients, ip)
+}
+
+// sweep drops idle entries so the map doesn't grow with every IP ever seen.
+// Runs at most once per window; callers must hold l.mu.
+func (l *loginLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+	for ip, a := range l.clients {
+		a.failures = pruneBefore(a.failures, now.Add(-l.window))
+		if len(a.failures) == 0 && !now.Before(a.lockedUntil) {
+			delete(l.clients, ip)
+		}
+	}
+}
+
+// pruneBefore drops timestamps older than cutoff; times are in ascending order.
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// LoginRateLimitMiddleware throttles failed logins per client IP.
+// A 401 from the login handler counts as a failure, a 200 resets the counter,
+// and locked-out clients get 429 without reaching the handler.
+func LoginRateLimitMiddleware(cfg *config.Config) gin.HandlerFunc {
+	rl := cfg.App.LoginRateLimit
+	if rl.MaxFailures <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+	limiter := newLoginLimiter(rl.MaxFailures,
+		time.Duration(rl.WindowSeconds)*time.Second,
+		time.Duration(rl.LockoutSeconds)*time.Second)
+
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		if wait := limiter.retryAfter(ip); wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds()+0.5)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, handlers.ErrorBody(handlers.CodeRateLimited, "too many failed login attempts, try again later"))
+			return
+		}
+
+		c.Next()
+
+		switch c.Writer.Status() {
+		case http.StatusUnauthorized:
+			limiter.fail(ip)
+		case http.StatusOK:
+			limiter.reset(ip)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/config"
+)
+
+func TestLoginLimiterLockoutAndReset(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := newLoginLimiter(3, time.Minute, 5*time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		l.fail("1.2.3.4")
+	}
+	if wait := l.retryAfter("1.2.3.4"); wait != 0 {
+		t.Fatalf("Expected no lockout below the limit, got %v", wait)
+	}
+
+	// Failures outside the window don't count
+	now = now.Add(2 * time.Minute)
+	l.fail("1.2.3.4")
+	if wait := l.retryAfter("1.2.3.4"); wait != 0 {
+		t.Fatalf("Expected old failures to expire, got lockout %v", wait)
+	}
+
+	l.fail("1.2.3.4")
+	l.fail("1.2.3.4")
+	if wait := l.retryAfter("1.2.3.4"); wait != 5*time.Minute {
+		t.Fatalf("Expected 5m lockout, got %v", wait)
+	}
+	if wait := l.retryAfter("5.6.7.8"); wait != 0 {
+		t.Fatalf("Expected other IPs to be unaffected, got %v", wait)
+	}
+
+	now = now.Add(5 * time.Minute)
+	if wait := l.retryAfter("1.2.3.4"); wait != 0 {
+		t.Fatalf("Expected lockout to end, got %v", wait)
+	}
+	if len(l.clients) != 0 {
+		t.Errorf("Expected idle entries to be swept, got %d", len(l.clients))
+	}
+
+	l.fail("1.2.3.4")
+	l.fail("1.2.3.4")
+	l.reset("1.2.3.4")
+	l.fail("1.2.3.4")
+	if wait := l.retryAfter("1.2.3.4"); wait != 0 {
+		t.Errorf("Expected successful login to reset failures, got lockout %v", wait)
+	}
+}
+
+func TestLoginRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	cfg, engine, _ := newTestServer(t)
+	cfg.App.LoginRateLimit = config.LoginRateLimit{MaxFailures: 3, WindowSeconds: 60, LockoutSeconds: 300}
+
+	attempt := func(r http.Handler, forwardedFor string) int {
+		req := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username":"admin","password":"wrong"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// No trusted proxies: a new X-Forwarded-For on every attempt is the same client
+	r := NewRouter(cfg, engine)
+	for i := 0; i < 3; i++ {
+		attempt(r, "10.0.0."+strconv.Itoa(i))
+	}
+	if code := attempt(r, "10.0.0.99"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected rotating X-Forwarded-For to be locked out, got %d", code)
+	}
+
+	// Behind a trusted proxy the forwarded address names the client
+	cfg.App.TrustedProxies = []string{"192.0.2.0/24"} // httptest's RemoteAddr
+	r = NewRouter(cfg, engine)
+	for i := 0; i < 3; i++ {
+		attempt(r, "10.0.1.1")
+	}
+	if code := attempt(r, "10.0.1.1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the forwarded client to be locked out, got %d", code)
+	}
+	if code := attempt(r, "10.0.1.2"); code != http.StatusUnauthorized {
+		t.Errorf("Expected another forwarded client to be unaffected, got %d", code)
+	}
+}
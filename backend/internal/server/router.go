@@ -1,8 +1,13 @@
 package server
 
 import (
+	"log/slog"
+
 	"backend/config"
+	"backend/internal/apidocs"
 	"backend/internal/handlers"
+	"backend/internal/metrics"
+	"backend/internal/models"
 
 	"github.com/gin-gonic/gin"
 	"xorm.io/xorm"
@@ -14,68 +19,170 @@ import (
 func NewRouter(cfg *config.Config, engine *xorm.Engine) *gin.Engine {
 	// Use gin.New() instead of gin.Default() to disable request logging
 	r := gin.New()
+	// Only listed proxies may set the client IP through X-Forwarded-For; by
+	// default any client could spoof it and dodge the login rate limit
+	if err := r.SetTrustedProxies(cfg.App.TrustedProxies); err != nil {
+		slog.Error("invalid app.trusted_proxies, trusting no proxy", "error", err)
+		r.SetTrustedProxies(nil)
+	}
 	r.Use(gin.Recovery()) // Add recovery middleware only
+	r.Use(RequestIDMiddleware())
 	r.Use(CORSMiddleware(cfg))
 
-	r.GET("/api/health", func(c *gin.Context) { c.JSON(200, gin.H{"status": "ok"}) })
-	r.POST("/api/login", handlers.Login(cfg, engine))
+	r.GET("/api/health", handlers.Health(engine))
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	r.GET("/api/openapi.json", gin.WrapH(apidocs.SpecHandler())) // OpenAPI description of this API
+	r.GET("/api/docs", gin.WrapH(apidocs.UIHandler()))           // Swagger UI for it
+	r.POST("/api/login", LoginRateLimitMiddleware(cfg), handlers.Login(cfg, engine))
+	r.POST("/api/refresh", handlers.Refresh(cfg, engine))
+	r.GET("/api/stream", StreamAuthMiddleware(cfg, engine), handlers.Stream()) // SSE feed of newly synced SMS/calls
+	r.POST("/api/devices/:id/inbound", handlers.ReceivePushedSms(engine))      // SMS pushed by the phone; authenticated by the device's SM4 key
 
 	api := r.Group("/api")
-	api.Use(AuthMiddleware(cfg))
+	api.Use(AuthMiddleware(cfg, engine))
+	// Mutating routes (send, delete, reconfigure) are limited to admins; viewers are read-only
+	adminOnly := RequireRole(models.RoleAdmin)
+	// Replays the first response to a repeated Idempotency-Key instead of sending again
+	idempotent := IdempotencyMiddleware()
+	// Per-device send quotas, shared by every route that sends SMS
+	sendQuota := handlers.NewSendQuota()
 	{
+		api.POST("/logout", handlers.Logout(cfg, engine))
+
+		// Per-device connectivity from the DB (no phone calls)
+		api.GET("/health/devices", handlers.DevicesHealth(engine))
+
 		// User profile
 		api.GET("/profile", handlers.Profile(engine))
-		api.POST("/users/password", handlers.UpdatePassword(engine))
+		api.POST("/users/password", handlers.UpdatePassword(cfg, engine))
+
+		// User management
+		api.GET("/users", handlers.ListUsers(engine))
+		api.POST("/users", adminOnly, handlers.CreateUser(cfg, engine))
+		api.DELETE("/users/:id", adminOnly, handlers.DeleteUser(engine))
+
+		// API keys for machine clients (the key is only shown on creation)
+		api.GET("/api-keys", adminOnly, handlers.ListAPIKeys(engine))
+		api.POST("/api-keys", adminOnly, handlers.CreateAPIKey(engine))
+		api.DELETE("/api-keys/:id", adminOnly, handlers.RevokeAPIKey(engine))
+
+		// Audit log of mutating actions (admin only: details include recipients)
+		api.GET("/audit", adminOnly, handlers.ListAuditLogs(engine))
+
+		// Invalidate every session by replacing the JWT secret
+		api.POST("/security/rotate-jwt-secret", adminOnly, handlers.RotateJWTSecret(cfg, engine))
 
 		// All devices SMS and Calls
 		api.GET("/sms", handlers.QueryAllSms(engine))
 		api.POST("/sms/:id/read", handlers.MarkSmsAsRead(engine))
 		api.POST("/sms/mark-read-all", handlers.MarkAllSmsAsReadGlobally(engine)) // Mark all SMS as read (globally)
-		api.DELETE("/sms/:id", handlers.DeleteSms(engine))
-		api.POST("/sms/delete", handlers.DeleteMultipleSms(engine))
+		api.DELETE("/sms/:id", adminOnly, handlers.DeleteSms(engine))
+		api.POST("/sms/delete", adminOnly, handlers.DeleteMultipleSms(engine))
+		api.POST("/sms/:id/restore", adminOnly, handlers.RestoreSms(engine))          // Restore a soft-deleted SMS
+		api.GET("/devices/:id/sms/trash", handlers.QuerySmsTrash(engine))             // Soft-deleted SMS of a device, newest deletion first
+		api.POST("/sms/:id/resend", adminOnly, handlers.ResendSms(engine, sendQuota)) // Send a stored sent/failed SMS again
 		api.GET("/calls", handlers.QueryAllCalls(engine))
 		api.POST("/calls/:id/read", handlers.MarkCallAsRead(engine))
-		api.DELETE("/calls/:id", handlers.DeleteCall(engine))
-		api.POST("/calls/delete", handlers.DeleteMultipleCalls(engine))
+		api.DELETE("/calls/:id", adminOnly, handlers.DeleteCall(engine))
+		api.POST("/calls/delete", adminOnly, handlers.DeleteMultipleCalls(engine))
+		api.GET("/contacts", handlers.QueryAllContacts(engine)) // Contacts of all devices, merged by number
+
+		// Global search across SMS, calls and contacts
+		api.GET("/search", handlers.Search(engine))
+
+		// Dashboard totals (optional device_id scope)
+		api.GET("/stats", handlers.Stats(engine))
+		api.GET("/stats/timeline", handlers.StatsTimeline(engine)) // Per-day SMS or call counts for charts
 
 		// Device management
 		api.GET("/devices", handlers.ListDevices(engine))
-		api.POST("/devices", handlers.CreateDevice(engine))
-		api.POST("/devices/refresh", handlers.RefreshAllDevices(engine))
+		api.POST("/devices", adminOnly, handlers.CreateDevice(engine))
+		api.POST("/devices/refresh", handlers.RefreshAllDevices(cfg, engine))
+		api.GET("/devices/export", adminOnly, handlers.ExportDevices(engine))
+		api.POST("/devices/import", adminOnly, handlers.ImportDevices(engine))
 		api.GET("/devices/:id", handlers.DeviceDetail(engine))
-		api.PUT("/devices/:id", handlers.UpdateDevice(engine))
-		api.DELETE("/devices/:id", handlers.DeleteDevice(engine))
+		api.PUT("/devices/:id", adminOnly, handlers.UpdateDevice(engine))
+		api.DELETE("/devices/:id", adminOnly, handlers.DeleteDevice(engine))
 
 		// Phone control - direct calls to phone's SmsForwarder API
 		// Query phone configuration (test connection)
 		api.GET("/devices/:id/config", handlers.QueryConfig(engine))
+		// Pure connection test (optionally with unsaved address/key), no DB writes;
+		// admin only, since it sends the stored key to any address given
+		api.POST("/devices/:id/test", adminOnly, handlers.TestDevice(engine))
+		api.GET("/devices/:id/ping", handlers.PingDevice(engine)) // Reachability and latency only
+		// Clean slate: permanently delete stored SMS/calls (and optionally contacts)
+		api.POST("/devices/:id/reset-data", adminOnly, handlers.ResetDeviceData(engine))
 
 		// SMS operations
-		api.GET("/devices/:id/sms", handlers.QuerySms(engine))                    // Query SMS from database with sync
-		api.POST("/devices/:id/sms/send", handlers.SendSMS(engine))               // Send SMS via phone
-		api.POST("/devices/:id/sms/sync", handlers.SyncSms(engine))               // Manual sync SMS from phone
-		api.POST("/devices/:id/sms/mark-read", handlers.MarkAllSmsAsRead(engine)) // Mark all SMS as read
+		api.GET("/devices/:id/sms", handlers.QuerySms(engine))                                             // Query SMS from database with sync
+		api.POST("/devices/:id/sms/send", adminOnly, idempotent, handlers.SendSMS(cfg, engine, sendQuota)) // Send SMS via phone; honors Idempotency-Key
+		api.POST("/devices/:id/sms/bulk", adminOnly, handlers.SendBulkSMS(cfg, engine, sendQuota))         // Send to many recipients, per-recipient results
+		api.POST("/devices/:id/sms/sync", handlers.SyncSms(engine))                                        // Manual sync SMS from phone
+		api.POST("/devices/:id/sms/mark-read", handlers.MarkAllSmsAsRead(engine))                          // Mark all SMS as read
+		api.GET("/devices/:id/sms/export", handlers.ExportSms(engine))                                     // Export all SMS as CSV/JSON
+		api.GET("/devices/:id/conversations", handlers.ListConversations(engine))                          // SMS grouped by address
+		api.GET("/devices/:id/conversations/:address", handlers.ConversationThread(engine))                // Full thread with one address
+		api.POST("/devices/:id/conversations/:address/sync", handlers.SyncConversation(engine))            // Sync only this thread from phone
+		api.POST("/devices/:id/conversations/:address/archive", adminOnly, handlers.ArchiveConversation(engine))
+		api.POST("/devices/:id/conversations/:address/unarchive", adminOnly, handlers.UnarchiveConversation(engine))
 
 		// Call logs
 		api.GET("/devices/:id/calls", handlers.QueryCalls(engine))                    // Query calls from database with sync
 		api.POST("/devices/:id/calls/sync", handlers.SyncCalls(engine))               // Manual sync calls from phone
 		api.POST("/devices/:id/calls/mark-read", handlers.MarkAllCallsAsRead(engine)) // Mark all calls as read
+		api.GET("/devices/:id/calls/export", handlers.ExportCalls(engine))            // Export all calls as CSV/JSON
 
 		// Contacts
-		api.GET("/devices/:id/contacts", handlers.QueryContacts(engine))      // Query contacts from database with sync
-		api.POST("/devices/:id/contacts/add", handlers.AddContact(engine))    // Add contact to phone
-		api.POST("/devices/:id/contacts/sync", handlers.SyncContacts(engine)) // Manual sync contacts from phone
+		api.GET("/devices/:id/contacts", handlers.QueryContacts(engine))                          // Query contacts from database with sync
+		api.POST("/devices/:id/contacts/add", adminOnly, handlers.AddContact(engine))             // Add contact to phone
+		api.POST("/devices/:id/contacts/sync", handlers.SyncContacts(engine))                     // Manual sync contacts from phone
+		api.PUT("/devices/:id/contacts/:contactId", adminOnly, handlers.UpdateContact(engine))    // Edit local contact (unhides it)
+		api.DELETE("/devices/:id/contacts/:contactId", adminOnly, handlers.DeleteContact(engine)) // Delete local contact
+
+		// Contact groups (per device), usable as bulk SMS recipients
+		api.GET("/devices/:id/contact-groups", handlers.ListContactGroups(engine))
+		api.POST("/devices/:id/contact-groups", adminOnly, handlers.CreateContactGroup(engine))
+		api.DELETE("/devices/:id/contact-groups/:groupId", adminOnly, handlers.DeleteContactGroup(engine))
+		api.GET("/devices/:id/contact-groups/:groupId/members", handlers.ListContactGroupMembers(engine))
+		api.POST("/devices/:id/contact-groups/:groupId/members", adminOnly, handlers.AddContactGroupMembers(engine))
+		api.DELETE("/devices/:id/contact-groups/:groupId/members/:contactId", adminOnly, handlers.RemoveContactGroupMember(engine))
+
+		// Sync progress (SMS, calls and contacts)
+		api.GET("/devices/:id/sync/progress", handlers.SyncProgress(engine)) // Running syncs and their progress
 
 		// Battery and location
-		api.GET("/devices/:id/battery", handlers.QueryBattery(engine))   // Query battery status
-		api.GET("/devices/:id/location", handlers.QueryLocation(engine)) // Query location
+		api.GET("/devices/:id/battery", handlers.QueryBattery(engine))             // Query battery status
+		api.GET("/devices/:id/location", handlers.QueryLocation(engine))           // Query location
+		api.GET("/devices/:id/battery/history", handlers.BatteryHistory(engine))   // Battery readings over time
+		api.GET("/devices/:id/location/history", handlers.LocationHistory(engine)) // Recorded location track
 
 		// Wake-on-LAN
-		api.POST("/devices/:id/wol", handlers.WakeOnLan(engine)) // Send WOL packet via phone
+		api.POST("/devices/:id/wol", adminOnly, handlers.WakeOnLan(engine)) // Send WOL packet via phone
 
 		// Clone configuration (一键换新机)
-		api.POST("/devices/:id/clone/pull", handlers.ClonePull(engine)) // Pull config from phone
-		api.POST("/devices/:id/clone/push", handlers.ClonePush(engine)) // Push config to phone
+		api.POST("/devices/:id/clone/pull", adminOnly, handlers.ClonePull(engine)) // Pull config from phone
+		api.POST("/devices/:id/clone/push", adminOnly, handlers.ClonePush(engine)) // Push config to phone
+
+		// SMS forwarding rules (admin only: rules carry webhook secrets)
+		api.GET("/forward-rules", adminOnly, handlers.ListForwardRules(engine))
+		api.POST("/forward-rules", adminOnly, handlers.CreateForwardRule(engine))
+		api.PUT("/forward-rules/:id", adminOnly, handlers.UpdateForwardRule(engine))
+		api.DELETE("/forward-rules/:id", adminOnly, handlers.DeleteForwardRule(engine))
+
+		// Spam blocklist for received SMS
+		api.GET("/blocklist", adminOnly, handlers.ListBlocklist(engine))
+		api.POST("/blocklist", adminOnly, handlers.CreateBlocklist(engine))
+		api.PUT("/blocklist/:id", adminOnly, handlers.UpdateBlocklist(engine))
+		api.DELETE("/blocklist/:id", adminOnly, handlers.DeleteBlocklist(engine))
+		api.GET("/blocklist/blocked", adminOnly, handlers.ListBlockedSms(engine)) // SMS hidden by the blocklist
+		api.POST("/sms/:id/unblock", adminOnly, handlers.UnblockSms(engine))      // Show a hidden SMS again
+
+		// Command queue - async, retryable phone operations
+		api.POST("/devices/:id/commands", adminOnly, handlers.EnqueueCommand(cfg, engine, sendQuota)) // Enqueue a command
+		api.GET("/devices/:id/commands", handlers.ListCommands(engine))                               // List commands (optional status filter)
+		api.GET("/commands/:id", handlers.GetCommand(engine))                                         // Poll a command's status and result
+		api.POST("/commands/:id/retry", adminOnly, handlers.RetryCommand(cfg, engine, sendQuota))     // Retry a failed command
 	}
 	return r
 }
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"backend/internal/models"
+)
+
+func TestSmsQueryTimeRange(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	device := &models.Device{Name: "a", PhoneAddr: "http://a"}
+	engine.Insert(device)
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "old", Type: 1, SmsTime: 1704067200000}) // 2024-01-01
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "new", Type: 1, SmsTime: 1735689600000}) // 2025-01-01
+
+	code, resp := doJSON(t, r, "GET", "/api/sms?from=2024-06-01T00:00:00Z", access, nil)
+	if code != http.StatusOK || resp["total"] != float64(1) {
+		t.Fatalf("Expected one message after an RFC3339 from, got %d %v", code, resp)
+	}
+	_, resp = doJSON(t, r, "GET", "/api/sms?to=1704067200000", access, nil)
+	if resp["total"] != float64(1) {
+		t.Errorf("Expected an inclusive millisecond to bound, got %v", resp)
+	}
+
+	if code, _ := doJSON(t, r, "GET", "/api/sms?from=2000&to=1000", access, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for from after to, got %d", code)
+	}
+	if code, _ := doJSON(t, r, "GET", "/api/sms?from=yesterday", access, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unparseable from, got %d", code)
+	}
+}
+
+func TestSmsQuerySortOrder(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	device := &models.Device{Name: "a", PhoneAddr: "http://a"}
+	engine.Insert(device)
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10010", Body: "first", Type: 1, SmsTime: 1000})
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "second", Type: 1, SmsTime: 2000})
+
+	firstBody := func(query string) interface{} {
+		code, resp := doJSON(t, r, "GET", "/api/sms"+query, access, nil)
+		if code != http.StatusOK {
+			t.Fatalf("Expected 200 for %q, got %d %v", query, code, resp)
+		}
+		return resp["items"].([]interface{})[0].(map[string]interface{})["body"]
+	}
+	if got := firstBody(""); got != "second" {
+		t.Errorf("Expected newest first by default, got %v", got)
+	}
+	if got := firstBody("?sort=asc"); got != "first" {
+		t.Errorf("Expected oldest first with sort=asc, got %v", got)
+	}
+	if got := firstBody("?sort_by=address&sort=desc"); got != "second" {
+		t.Errorf("Expected highest address first, got %v", got)
+	}
+
+	for _, query := range []string{"?sort=sideways", "?sort_by=body", "?sort_by=sms_time%3BDROP%20TABLE%20sms_message"} {
+		if code, _ := doJSON(t, r, "GET", "/api/sms"+query, access, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %q, got %d", query, code)
+		}
+	}
+}
+
+func TestSmsQuerySimFilter(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	device := &models.Device{Name: "a", PhoneAddr: "http://a"}
+	engine.Insert(device)
+	for i, sim := range []int{0, 1, 1, -1} {
+		engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Type: 1, SimID: sim, SmsTime: int64(i + 1)})
+	}
+
+	for query, want := range map[string]float64{"": 4, "?sim_id=0": 1, "?sim_id=1": 2, "?sim_id=-1": 1} {
+		code, resp := doJSON(t, r, "GET", "/api/sms"+query, access, nil)
+		if code != http.StatusOK || resp["total"] != want {
+			t.Errorf("Expected %v messages for %q, got %d %v", want, query, code, resp["total"])
+		}
+	}
+	if code, _ := doJSON(t, r, "GET", "/api/sms?sim_id=2", access, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown SIM slot, got %d", code)
+	}
+}
+
+func TestSmsQueryMarkRead(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	device := &models.Device{Name: "a", PhoneAddr: "http://a"}
+	engine.Insert(device)
+	for i := int64(1); i <= 3; i++ {
+		engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "hi", Type: 1, SmsTime: i * 1000})
+	}
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10)
+
+	_, resp := doJSON(t, r, "GET", path+"/sms?page_size=2", access, nil)
+	if _, ok := resp["unread_count"]; ok {
+		t.Errorf("Expected no unread_count without mark_read, got %v", resp)
+	}
+	if unread, _ := engine.Where("is_read = ?", false).Count(&models.SmsMessage{}); unread != 3 {
+		t.Fatalf("Expected a plain query to leave messages unread, %d unread", unread)
+	}
+
+	code, resp := doJSON(t, r, "GET", path+"/sms?page_size=2&mark_read=true", access, nil)
+	if code != http.StatusOK || resp["unread_count"] != float64(1) {
+		t.Fatalf("Expected unread_count 1, got %d %v", code, resp)
+	}
+	for _, item := range resp["items"].([]interface{}) {
+		if item.(map[string]interface{})["is_read"] != true {
+			t.Errorf("Expected returned messages to be read, got %v", item)
+		}
+	}
+
+	_, resp = doJSON(t, r, "GET", path+"/conversations/10086?mark_read=true", access, nil)
+	if resp["unread_count"] != float64(0) {
+		t.Errorf("Expected the thread to clear the last unread message, got %v", resp)
+	}
+}
+
+func TestConversationArchive(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	device := &models.Device{Name: "a", PhoneAddr: "http://a"}
+	engine.Insert(device)
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "old promo", Type: 1, SmsTime: 1000})
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10010", Body: "hello", Type: 1, SmsTime: 2000})
+	path := "/api/devices/" + strconv.FormatInt(device.ID, 10)
+
+	code, resp := doJSON(t, r, "POST", path+"/conversations/10086/archive", access, nil)
+	if code != http.StatusOK || resp["updated"] != float64(1) {
+		t.Fatalf("Expected one message archived, got %d %v", code, resp)
+	}
+
+	if _, resp = doJSON(t, r, "GET", path+"/sms", access, nil); resp["total"] != float64(1) {
+		t.Errorf("Expected archived messages out of the default list, got %v", resp)
+	}
+	if _, resp = doJSON(t, r, "GET", path+"/sms?include_archived=true", access, nil); resp["total"] != float64(2) {
+		t.Errorf("Expected include_archived to return both, got %v", resp)
+	}
+	if _, resp = doJSON(t, r, "GET", path+"/conversations", access, nil); resp["total"] != float64(1) {
+		t.Errorf("Expected one visible conversation, got %v", resp)
+	}
+	_, resp = doJSON(t, r, "GET", path+"/conversations?include_archived=true", access, nil)
+	var archived []interface{}
+	for _, item := range resp["items"].([]interface{}) {
+		if conv := item.(map[string]interface{}); conv["archived"] == true {
+			archived = append(archived, conv["address"])
+		}
+	}
+	if len(archived) != 1 || archived[0] != "10086" {
+		t.Errorf("Expected 10086 flagged as archived, got %v", resp)
+	}
+	_, resp = doJSON(t, r, "GET", "/api/search?q=promo", access, nil)
+	if totals, _ := resp["totals"].(map[string]interface{}); totals["sms"] != float64(1) {
+		t.Errorf("Expected archived messages to stay searchable, got %v", resp)
+	}
+
+	doJSON(t, r, "POST", path+"/conversations/10086/unarchive", access, nil)
+	if _, resp = doJSON(t, r, "GET", path+"/sms", access, nil); resp["total"] != float64(2) {
+		t.Errorf("Expected unarchived messages back in the list, got %v", resp)
+	}
+}
+
+func TestSmsQueryUnreadOnly(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	device := &models.Device{Name: "a", PhoneAddr: "http://a"}
+	engine.Insert(device)
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "unread in", Type: 1, SmsTime: 1000})
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "read in", Type: 1, SmsTime: 2000, IsRead: true})
+	engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "unread out", Type: 2, SmsTime: 3000})
+	engine.Insert(&models.CallLog{DeviceID: device.ID, Number: "10086", Type: 3, CallTime: 1000})
+	engine.Insert(&models.CallLog{DeviceID: device.ID, Number: "10086", Type: 3, CallTime: 2000, IsRead: true})
+
+	code, resp := doJSON(t, r, "GET", "/api/sms?unread_only=true&type=1", access, nil)
+	if code != http.StatusOK || resp["total"] != float64(1) {
+		t.Fatalf("Expected one unread received message, got %d %v", code, resp)
+	}
+	if body := resp["items"].([]interface{})[0].(map[string]interface{})["body"]; body != "unread in" {
+		t.Errorf("Expected the unread message, got %v", body)
+	}
+	_, resp = doJSON(t, r, "GET", "/api/sms?unread_only=true", access, nil)
+	if resp["total"] != float64(2) || resp["unread_count"] != float64(2) {
+		t.Errorf("Expected two unread messages across types, got %v", resp)
+	}
+
+	_, resp = doJSON(t, r, "GET", "/api/calls?unread_only=true&type=3", access, nil)
+	if resp["total"] != float64(1) || resp["unread_count"] != float64(1) {
+		t.Errorf("Expected one unread missed call, got %v", resp)
+	}
+	_, resp = doJSON(t, r, "GET", "/api/calls", access, nil)
+	if resp["total"] != float64(2) {
+		t.Errorf("Expected all calls without unread_only, got %v", resp)
+	}
+}
+
+func TestSmsTrashRoute(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	device := &models.Device{Name: "a", PhoneAddr: "http://a"}
+	engine.Insert(device)
+	sms := &models.SmsMessage{DeviceID: device.ID, Address: "10086", Body: "oops", Type: 1, SmsTime: 1000}
+	engine.Insert(sms)
+	id := strconv.FormatInt(sms.ID, 10)
+	trash := "/api/devices/" + strconv.FormatInt(device.ID, 10) + "/sms/trash"
+
+	if code, resp := doJSON(t, r, "DELETE", "/api/sms/"+id, access, nil); code != http.StatusOK {
+		t.Fatalf("Expected delete to succeed, got %d %v", code, resp)
+	}
+	code, resp := doJSON(t, r, "GET", trash, access, nil)
+	items, _ := resp["items"].([]interface{})
+	if code != http.StatusOK || resp["total"] != float64(1) || len(items) != 1 || items[0].(map[string]interface{})["id"] != float64(sms.ID) {
+		t.Fatalf("Expected the deleted SMS in the trash, got %d %v", code, resp)
+	}
+
+	if code, resp := doJSON(t, r, "POST", "/api/sms/"+id+"/restore", access, nil); code != http.StatusOK {
+		t.Fatalf("Expected restore to succeed, got %d %v", code, resp)
+	}
+	if _, resp := doJSON(t, r, "GET", trash, access, nil); resp["total"] != float64(0) {
+		t.Errorf("Expected an empty trash after restoring, got %v", resp)
+	}
+	if code, _ := doJSON(t, r, "GET", "/api/devices/999/sms/trash", access, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown device, got %d", code)
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+)
+
+func TestStatsTotals(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	a := &models.Device{Name: "a", PhoneAddr: "http://a", Status: "online"}
+	b := &models.Device{Name: "b", PhoneAddr: "http://b", Status: "offline"}
+	engine.Insert(a)
+	engine.Insert(b)
+	engine.Insert(&models.SmsMessage{DeviceID: a.ID, Address: "1", Type: 1, SmsTime: 1})
+	engine.Insert(&models.SmsMessage{DeviceID: a.ID, Address: "1", Type: 2, SmsTime: 2, IsRead: true})
+	engine.Insert(&models.SmsMessage{DeviceID: b.ID, Address: "2", Type: 1, SimID: -1, SmsTime: 3})
+	engine.Insert(&models.CallLog{DeviceID: b.ID, Number: "2", Type: 3, SimID: -1, CallTime: 4})
+	engine.Insert(&models.Contact{DeviceID: a.ID, Name: "Alice", Phone: "1"})
+	engine.Insert(&models.Contact{DeviceID: a.ID, Name: "2", Phone: "2", IsHidden: true})
+
+	code, resp := doJSON(t, r, "GET", "/api/stats", access, nil)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %v", code, resp)
+	}
+	devices := resp["devices"].(map[string]interface{})
+	sms := resp["sms"].(map[string]interface{})
+	calls := resp["calls"].(map[string]interface{})
+	if devices["total"] != float64(2) || devices["online"] != float64(1) {
+		t.Errorf("Unexpected device counts: %v", devices)
+	}
+	if sms["total"] != float64(3) || sms["received"] != float64(2) || sms["sent"] != float64(1) || sms["unread"] != float64(2) {
+		t.Errorf("Unexpected SMS counts: %v", sms)
+	}
+	if calls["total"] != float64(1) || calls["missed"] != float64(1) {
+		t.Errorf("Unexpected call counts: %v", calls)
+	}
+	if resp["contacts"] != float64(1) {
+		t.Errorf("Expected hidden contacts to be excluded, got %v", resp["contacts"])
+	}
+	top := resp["top_devices"].([]interface{})
+	if len(top) != 2 || top[0].(map[string]interface{})["device_name"] != "a" {
+		t.Errorf("Expected device a to lead top_devices, got %v", top)
+	}
+
+	sims := resp["sims"].([]interface{})
+	if len(sims) != 2 {
+		t.Fatalf("Expected one SIM row per device, got %v", sims)
+	}
+	unknown := sims[1].(map[string]interface{})
+	if unknown["sim"] != "unknown" || unknown["sim_id"] != float64(-1) || unknown["sms"] != float64(1) || unknown["calls"] != float64(1) {
+		t.Errorf("Expected device b's records under the unknown SIM, got %v", unknown)
+	}
+
+	_, resp = doJSON(t, r, "GET", fmt.Sprintf("/api/stats?device_id=%d", b.ID), access, nil)
+	if resp["sms"].(map[string]interface{})["total"] != float64(1) || resp["devices"].(map[string]interface{})["online"] != float64(0) {
+		t.Errorf("Expected stats scoped to device b, got %v", resp)
+	}
+	if code, _ := doJSON(t, r, "GET", "/api/stats?device_id=99", access, nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown device, got %d", code)
+	}
+}
+
+func TestStatsTimeline(t *testing.T) {
+	_, engine, r := newTestServer(t)
+	access, _ := login(t, r)
+
+	a := &models.Device{Name: "a", PhoneAddr: "http://a"}
+	b := &models.Device{Name: "b", PhoneAddr: "http://b"}
+	engine.Insert(a)
+	engine.Insert(b)
+	now := time.Now().In(engine.TZLocation)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	at := func(days int, hours time.Duration) int64 { return today.AddDate(0, 0, -days).Add(hours).UnixMilli() }
+	engine.Insert(&models.SmsMessage{DeviceID: a.ID, Address: "1", Type: 1, SmsTime: at(0, 1*time.Minute)})
+	engine.Insert(&models.SmsMessage{DeviceID: a.ID, Address: "1", Type: 1, SmsTime: at(0, 2*time.Minute)})
+	engine.Insert(&models.SmsMessage{DeviceID: a.ID, Address: "1", Type: 2, SmsTime: at(1, 23*time.Hour)})
+	engine.Insert(&models.SmsMessage{DeviceID: b.ID, Address: "2", Type: 1, SmsTime: at(1, time.Hour)})
+	engine.Insert(&models.SmsMessage{DeviceID: a.ID, Address: "1", Type: 1, SmsTime: at(40, 0)})
+	engine.Insert(&models.CallLog{DeviceID: a.ID, Number: "1", Type: 3, CallTime: at(2, time.Hour)})
+
+	code, resp := doJSON(t, r, "GET", "/api/stats/timeline?days=7", access, nil)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %v", code, resp)
+	}
+	items := resp["items"].([]interface{})
+	if len(items) != 7 {
+		t.Fatalf("Expected a row per day, got %d", len(items))
+	}
+	last := items[6].(map[string]interface{})
+	yesterday := items[5].(map[string]interface{})
+	if last["date"] != today.Format("2006-01-02") || last["received"] != float64(2) || last["sent"] != float64(0) {
+		t.Errorf("Unexpected today row: %v", last)
+	}
+	if yesterday["received"] != float64(1) || yesterday["sent"] != float64(1) {
+		t.Errorf("Unexpected yesterday row: %v", yesterday)
+	}
+	if first := items[0].(map[string]interface{}); first["received"] != float64(0) {
+		t.Errorf("Expected an empty first day, got %v", first)
+	}
+
+	_, resp = doJSON(t, r, "GET", fmt.Sprintf("/api/stats/timeline?days=7&device_id=%d", a.ID), access, nil)
+	if row := resp["items"].([]interface{})[5].(map[string]interface{}); row["received"] != float64(0) || row["sent"] != float64(1) {
+		t.Errorf("Expected device b's message left out, got %v", row)
+	}
+
+	_, resp = doJSON(t, r, "GET", "/api/stats/timeline?kind=call&days=7", access, nil)
+	if row := resp["items"].([]interface{})[4].(map[string]interface{}); row["missed"] != float64(1) || row["incoming"] != float64(0) {
+		t.Errorf("Unexpected call row: %v", row)
+	}
+	if code, _ := doJSON(t, r, "GET", "/api/stats/timeline?kind=mms", access, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown kind to be rejected, got %d", code)
+	}
+}
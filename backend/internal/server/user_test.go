@@ -0,0 +1,117 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUserManagement(t *testing.T) {
+	_, r := newTestRouter(t)
+	access, _ := login(t, r)
+
+	code, resp := doJSON(t, r, "POST", "/api/users", access, gin.H{"username": "family", "password": "pw"})
+	if code != http.StatusCreated {
+		t.Fatalf("create user failed: %d %v", code, resp)
+	}
+	if _, leaked := resp["password"]; leaked {
+		t.Errorf("Expected password hash not to be returned")
+	}
+	newID := int64(resp["id"].(float64))
+
+	if code, _ := doJSON(t, r, "POST", "/api/users", access, gin.H{"username": "family", "password": "pw"}); code != http.StatusConflict {
+		t.Errorf("Expected duplicate username to be rejected, got %d", code)
+	}
+
+	code, resp = doJSON(t, r, "GET", "/api/users", access, nil)
+	if code != http.StatusOK || len(resp["items"].([]interface{})) != 2 {
+		t.Fatalf("Expected 2 users, got %d %v", code, resp)
+	}
+
+	// admin is user 1 and cannot delete themselves
+	if code, _ := doJSON(t, r, "DELETE", "/api/users/1", access, nil); code != http.StatusConflict {
+		t.Errorf("Expected self-delete to be rejected, got %d", code)
+	}
+	if code, _ := doJSON(t, r, "DELETE", fmt.Sprintf("/api/users/%d", newID), access, nil); code != http.StatusOK {
+		t.Errorf("Expected delete of other user to succeed, got %d", code)
+	}
+	if code, _ := doJSON(t, r, "DELETE", fmt.Sprintf("/api/users/%d", newID), access, nil); code != http.StatusNotFound {
+		t.Errorf("Expected deleting a missing user to return 404, got %d", code)
+	}
+}
+
+func TestViewerIsReadOnly(t *testing.T) {
+	_, r := newTestRouter(t)
+	admin, _ := login(t, r)
+
+	code, resp := doJSON(t, r, "POST", "/api/users", admin, gin.H{"username": "viewer", "password": "pw"})
+	if code != http.StatusCreated || resp["role"] != "viewer" {
+		t.Fatalf("Expected new user to default to viewer, got %d %v", code, resp)
+	}
+
+	code, resp = doJSON(t, r, "POST", "/api/login", "", gin.H{"username": "viewer", "password": "pw"})
+	if code != http.StatusOK {
+		t.Fatalf("viewer login failed: %d %v", code, resp)
+	}
+	if user, _ := resp["user"].(map[string]interface{}); user["role"] != "viewer" {
+		t.Errorf("Expected login response to include role, got %v", resp["user"])
+	}
+	viewer := resp["token"].(string)
+
+	if code, resp := doJSON(t, r, "GET", "/api/profile", viewer, nil); code != http.StatusOK || resp["role"] != "viewer" {
+		t.Errorf("Expected profile with viewer role, got %d %v", code, resp)
+	}
+	if code, _ := doJSON(t, r, "GET", "/api/devices", viewer, nil); code != http.StatusOK {
+		t.Errorf("Expected viewer to list devices, got %d", code)
+	}
+
+	forbidden := []struct{ method, path string }{
+		{"POST", "/api/devices"},
+		{"DELETE", "/api/devices/1"},
+		{"POST", "/api/devices/1/sms/send"},
+		{"POST", "/api/devices/1/wol"},
+		{"POST", "/api/devices/1/test"},
+		{"POST", "/api/devices/1/clone/push"},
+		{"DELETE", "/api/sms/1"},
+		{"POST", "/api/devices/1/conversations/10086/archive"},
+		{"POST", "/api/devices/1/conversations/10086/unarchive"},
+		{"POST", "/api/users"},
+	}
+	for _, f := range forbidden {
+		if code, _ := doJSON(t, r, f.method, f.path, viewer, gin.H{}); code != http.StatusForbidden {
+			t.Errorf("%s %s: expected 403 for viewer, got %d", f.method, f.path, code)
+		}
+	}
+
+	if code, _ := doJSON(t, r, "POST", "/api/users", admin, gin.H{"username": "x", "password": "pw", "role": "root"}); code != http.StatusBadRequest {
+		t.Errorf("Expected unknown role to be rejected, got %d", code)
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	cfg, _, r := newTestServer(t)
+	cfg.Security.PasswordPolicy = config.PasswordPolicy{MinLength: 8, RequireDigit: true}
+	access, _ := login(t, r)
+
+	code, resp := doJSON(t, r, "POST", "/api/users", access, gin.H{"username": "family", "password": "short"})
+	if code != http.StatusBadRequest {
+		t.Fatalf("Expected weak password to be rejected, got %d %v", code, resp)
+	}
+	if rules, _ := apiError(resp)["failed_rules"].([]interface{}); len(rules) != 2 || apiError(resp)["code"] != "weak_password" {
+		t.Errorf("Expected length and digit rules to fail, got %v", resp)
+	}
+	if code, resp := doJSON(t, r, "POST", "/api/users", access, gin.H{"username": "family", "password": "longer-pw-1"}); code != http.StatusCreated {
+		t.Errorf("Expected strong password to be accepted, got %d %v", code, resp)
+	}
+
+	if code, _ := doJSON(t, r, "POST", "/api/users/password", access, gin.H{"old": "secret", "new": "admin123"}); code != http.StatusBadRequest {
+		t.Errorf("Expected known default password to be rejected, got %d", code)
+	}
+	if code, resp := doJSON(t, r, "POST", "/api/users/password", access, gin.H{"old": "secret", "new": "n3w-secret"}); code != http.StatusOK {
+		t.Errorf("Expected password change to succeed, got %d %v", code, resp)
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"backend/internal/models"
+)
+
+// Alert events posted to the configured webhook.
+const (
+	AlertBatteryLow       = "battery.low"
+	AlertBatteryRecovered = "battery.recovered"
+	AlertDeviceOffline    = "device.offline"
+	AlertDeviceOnline     = "device.online"
+)
+
+// AlertOptions configures device health alerts.
+type AlertOptions struct {
+	BatteryThreshold int // Alert when battery drops below this percentage (0 = disabled)
+	OfflineFailures  int // Alert after this many consecutive failed polls of an online device (0 = disabled)
+}
+
+// AlertPayload is the JSON body posted to the webhook for a device alert.
+type AlertPayload struct {
+	Event      string `json:"event"` // battery.low, battery.recovered, device.offline, device.online
+	DeviceID   int64  `json:"device_id"`
+	DeviceName string `json:"device_name"`
+	Battery    int    `json:"battery,omitempty"`   // Battery percentage (battery events)
+	Threshold  int    `json:"threshold,omitempty"` // Configured battery alert threshold (battery events)
+	Failures   int    `json:"failures,omitempty"`  // Consecutive failed polls (device.offline)
+	Time       int64  `json:"time"`                // Alert timestamp in milliseconds
+}
+
+// deviceHealth tracks one device's failed-poll streak for offline alerts.
+type deviceHealth struct {
+	failures  int  // Consecutive failed polls
+	wasOnline bool // The device was online when the streak began
+	offline   bool // An offline alert was sent and the device hasn't recovered yet
+}
+
+// alerts holds the alert options and the per-device state used to fire only
+// on transitions. The state is in memory, so after a restart a device that is
+// still low alerts once more.
+var alerts = struct {
+	sync.Mutex
+	opts       AlertOptions
+	batteryLow map[int64]bool // Devices last seen below the battery threshold
+	health     map[int64]*deviceHealth
+}{batteryLow: make(map[int64]bool), health: make(map[int64]*deviceHealth)}
+
+// SetAlerts replaces the process-wide alert options. Call once at startup.
+func SetAlerts(opts AlertOptions) {
+	alerts.Lock()
+	defer alerts.Unlock()
+	alerts.opts = opts
+}
+
+// CheckBatteryLevel records a battery reading and alerts when the device falls
+// below the threshold (battery.low) or charges back to it (battery.recovered).
+// Readings that don't cross the threshold fire nothing.
+func CheckBatteryLevel(device *models.Device, level int) {
+	alerts.Lock()
+	threshold := alerts.opts.BatteryThreshold
+	if threshold <= 0 {
+		alerts.Unlock()
+		return
+	}
+	wasLow := alerts.batteryLow[device.ID]
+	isLow := level < threshold
+	alerts.batteryLow[device.ID] = isLow
+	alerts.Unlock()
+
+	switch {
+	case isLow && !wasLow:
+		sendAlert(AlertPayload{Event: AlertBatteryLow, DeviceID: device.ID, DeviceName: device.Name, Battery: level, Threshold: threshold})
+	case !isLow && wasLow:
+		sendAlert(AlertPayload{Event: AlertBatteryRecovered, DeviceID: device.ID, DeviceName: device.Name, Battery: level, Threshold: threshold})
+	}
+}
+
+// RecordPollResult tracks whether polling a device succeeded. Call it before
+// the device's stored status is updated for this poll. After OfflineFailures
+// consecutive failures of a device that was online it sends device.offline,
+// and device.online on the first successful poll after that.
+func RecordPollResult(device *models.Device, ok bool) {
+	alerts.Lock()
+	limit := alerts.opts.OfflineFailures
+	if limit <= 0 {
+		alerts.Unlock()
+		return
+	}
+	h := alerts.health[device.ID]
+	if h == nil {
+		h = &deviceHealth{}
+		alerts.health[device.ID] = h
+	}
+
+	var alert *AlertPayload
+	if ok {
+		if h.offline {
+			alert = &AlertPayload{Event: AlertDeviceOnline, DeviceID: device.ID, DeviceName: device.Name}
+		}
+		*h = deviceHealth{}
+	} else {
+		if h.failures == 0 {
+			h.wasOnline = device.Status == "online"
+		}
+		h.failures++
+		if h.wasOnline && !h.offline && h.failures >= limit {
+			h.offline = true
+			alert = &AlertPayload{Event: AlertDeviceOffline, DeviceID: device.ID, DeviceName: device.Name, Failures: h.failures}
+		}
+	}
+	alerts.Unlock()
+
+	if alert != nil {
+		sendAlert(*alert)
+	}
+}
+
+// sendAlert logs an alert and queues it for the configured webhook, if any.
+func sendAlert(payload AlertPayload) {
+	payload.Time = time.Now().UnixMilli()
+	log.Printf("[Alert] %s: device %d (%s)", payload.Event, payload.DeviceID, payload.DeviceName)
+
+	opts := currentWebhookOptions()
+	if opts.URL == "" {
+		return
+	}
+	enqueueWebhook(webhookTarget{URL: opts.URL, Secret: opts.Secret}, payload)
+}
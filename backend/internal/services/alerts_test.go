@@ -0,0 +1,95 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+)
+
+// newAlertHook points the webhook at a test server and returns the events it receives.
+func newAlertHook(t *testing.T) <-chan string {
+	t.Helper()
+	events := make(chan string, 8)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload AlertPayload
+		json.Unmarshal(body, &payload)
+		events <- payload.Event
+	}))
+	t.Cleanup(hook.Close)
+
+	SetWebhook(WebhookOptions{URL: hook.URL, Timeout: time.Second})
+	t.Cleanup(func() { SetWebhook(WebhookOptions{}) })
+	return events
+}
+
+// expectAlerts checks that exactly the given events arrive, in order.
+func expectAlerts(t *testing.T, events <-chan string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-events:
+			if got != w {
+				t.Errorf("Expected alert %q, got %q", w, got)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected alert %q, got none", w)
+		}
+	}
+	select {
+	case got := <-events:
+		t.Errorf("Unexpected extra alert %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestBatteryAlertsFireOnTransitionsOnly(t *testing.T) {
+	events := newAlertHook(t)
+	SetAlerts(AlertOptions{BatteryThreshold: 20})
+	defer SetAlerts(AlertOptions{})
+
+	device := &models.Device{ID: 9001, Name: "gateway"}
+	for _, level := range []int{50, 25, 18, 15, 10} {
+		CheckBatteryLevel(device, level)
+	}
+	expectAlerts(t, events, AlertBatteryLow)
+
+	for _, level := range []int{19, 20, 60} {
+		CheckBatteryLevel(device, level)
+	}
+	expectAlerts(t, events, AlertBatteryRecovered)
+}
+
+func TestOfflineAlertAfterConsecutiveFailures(t *testing.T) {
+	events := newAlertHook(t)
+	SetAlerts(AlertOptions{OfflineFailures: 3})
+	defer SetAlerts(AlertOptions{})
+
+	device := &models.Device{ID: 9002, Name: "gateway", Status: "online"}
+	RecordPollResult(device, false)
+	device.Status = "offline" // the poller marks it offline after the first failure
+	RecordPollResult(device, false)
+	RecordPollResult(device, true) // a blip shorter than the limit stays silent
+	device.Status = "online"
+	for i := 0; i < 5; i++ {
+		RecordPollResult(device, false)
+		device.Status = "offline"
+	}
+	expectAlerts(t, events, AlertDeviceOffline)
+
+	RecordPollResult(device, true)
+	RecordPollResult(device, true)
+	expectAlerts(t, events, AlertDeviceOnline)
+
+	// A device that was never online doesn't alert
+	never := &models.Device{ID: 9003, Name: "spare", Status: "offline"}
+	for i := 0; i < 5; i++ {
+		RecordPollResult(never, false)
+	}
+	expectAlerts(t, events)
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"backend/internal/models"
+	"backend/internal/repository"
+)
+
+// ValidateBlocklist checks an entry's match type, pattern and action.
+// Regex patterns are compiled (and cached) so errors surface at creation time.
+func ValidateBlocklist(entry *models.Blocklist) error {
+	if entry.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+	switch entry.MatchType {
+	case models.BlockMatchExact, models.BlockMatchPrefix:
+	case models.BlockMatchRegex:
+		if _, err := compileRulePattern(entry.Pattern); err != nil {
+			return fmt.Errorf("invalid regex pattern: %v", err)
+		}
+	default:
+		return fmt.Errorf("invalid match_type %q; use exact, prefix or regex", entry.MatchType)
+	}
+	switch entry.Action {
+	case models.BlockActionHide, models.BlockActionDelete:
+	default:
+		return fmt.Errorf("invalid action %q; use hide or delete", entry.Action)
+	}
+	return nil
+}
+
+// MatchBlocklist reports whether a sender address is covered by the entry.
+func MatchBlocklist(entry *models.Blocklist, address string) bool {
+	switch entry.MatchType {
+	case models.BlockMatchExact:
+		return address == entry.Pattern
+	case models.BlockMatchPrefix:
+		return strings.HasPrefix(address, entry.Pattern)
+	case models.BlockMatchRegex:
+		re, err := compileRulePattern(entry.Pattern)
+		return err == nil && re.MatchString(address)
+	}
+	return false
+}
+
+// blockAction returns the action of the first entry matching a received SMS,
+// or "" if none does. Sent messages are never blocked.
+func blockAction(entries []models.Blocklist, sms *models.SmsMessage) string {
+	if sms.Type != 1 {
+		return ""
+	}
+	for i := range entries {
+		if MatchBlocklist(&entries[i], sms.Address) {
+			return entries[i].Action
+		}
+	}
+	return ""
+}
+
+// activeBlocklist loads the enabled blocklist entries for a device, logging
+// instead of failing so a lookup error never aborts a sync.
+func (s *SyncService) activeBlocklist(deviceID int64) []models.Blocklist {
+	entries, err := repository.NewBlocklistRepository(s.engine).FindActive(deviceID)
+	if err != nil {
+		log.Printf("[Blocklist] device %d: load entries error: %v", deviceID, err)
+		return nil
+	}
+	return entries
+}
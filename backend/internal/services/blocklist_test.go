@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+)
+
+func TestMatchBlocklist(t *testing.T) {
+	cases := []struct {
+		name  string
+		entry models.Blocklist
+		want  bool
+	}{
+		{"exact match", models.Blocklist{MatchType: models.BlockMatchExact, Pattern: "+8610690000"}, true},
+		{"exact needs the whole number", models.Blocklist{MatchType: models.BlockMatchExact, Pattern: "10690000"}, false},
+		{"prefix match", models.Blocklist{MatchType: models.BlockMatchPrefix, Pattern: "+86106"}, true},
+		{"prefix mismatch", models.Blocklist{MatchType: models.BlockMatchPrefix, Pattern: "106"}, false},
+		{"regex match", models.Blocklist{MatchType: models.BlockMatchRegex, Pattern: `^\+86106\d+$`}, true},
+		{"regex mismatch", models.Blocklist{MatchType: models.BlockMatchRegex, Pattern: `^95\d+$`}, false},
+	}
+	for _, tc := range cases {
+		if got := MatchBlocklist(&tc.entry, "+8610690000"); got != tc.want {
+			t.Errorf("%s: MatchBlocklist = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	for _, entry := range []models.Blocklist{
+		{MatchType: models.BlockMatchRegex, Pattern: `(\d+`, Action: models.BlockActionHide},
+		{MatchType: models.BlockMatchExact, Pattern: "", Action: models.BlockActionHide},
+		{MatchType: "contains", Pattern: "x", Action: models.BlockActionHide},
+		{MatchType: models.BlockMatchExact, Pattern: "x", Action: "mute"},
+	} {
+		if err := ValidateBlocklist(&entry); err == nil {
+			t.Errorf("Expected entry %+v to be rejected", entry)
+		}
+	}
+}
+
+func TestSyncAppliesBlocklist(t *testing.T) {
+	// Type 0 syncs received and sent and must report the same counts
+	for _, smsType := range []int{1, 0} {
+		engine := newTestEngine(t)
+		fp, device := newFakePhone(t, engine)
+		fp.sms = []phoneclient.SmsItem{
+			{Number: "10690001", Content: "big sale", Type: 1, Date: 1700000000000},
+			{Number: "95555", Content: "loan offer", Type: 1, Date: 1700000001000},
+			{Number: "10086", Content: "code 1234", Type: 1, Date: 1700000002000},
+		}
+		for _, entry := range []*models.Blocklist{
+			{MatchType: models.BlockMatchPrefix, Pattern: "1069", Action: models.BlockActionDelete, Enabled: true},
+			{MatchType: models.BlockMatchExact, Pattern: "95555", Action: models.BlockActionHide, Enabled: true},
+		} {
+			if _, err := engine.Insert(entry); err != nil {
+				t.Fatalf("insert blocklist entry: %v", err)
+			}
+		}
+
+		result, err := NewSyncService(engine).SyncSms(context.Background(), device, smsType, SyncOptions{})
+		if err != nil {
+			t.Fatalf("sms sync failed: %v", err)
+		}
+		if result.NewCount != 2 || result.Blocked != 1 {
+			t.Errorf("Type %d: expected 2 stored and 1 dropped, got %+v", smsType, result)
+		}
+
+		var stored []models.SmsMessage
+		engine.Asc("sms_time").Find(&stored)
+		if len(stored) != 2 || stored[0].Address != "95555" || !stored[0].Blocked || stored[1].Blocked {
+			t.Errorf("Type %d: expected the hidden message flagged and the other left alone, got %+v", smsType, stored)
+		}
+	}
+}
+
+func TestSyncRemembersDeleteBlockedSms(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+	// The newest page holds nothing but blocked messages
+	fp.sms = []phoneclient.SmsItem{
+		{Number: "10690002", Content: "sale ends", Type: 1, Date: 1700000003000},
+		{Number: "10690001", Content: "big sale", Type: 1, Date: 1700000002000},
+		{Number: "10086", Content: "code 1234", Type: 1, Date: 1700000001000},
+	}
+	engine.Insert(&models.Blocklist{MatchType: models.BlockMatchPrefix, Pattern: "1069", Action: models.BlockActionDelete, Enabled: true})
+	service := NewSyncService(engine)
+
+	result, err := service.SyncSms(context.Background(), device, 1, SyncOptions{PageSize: 2})
+	if err != nil {
+		t.Fatalf("sms sync failed: %v", err)
+	}
+	if result.NewCount != 1 || result.Blocked != 2 {
+		t.Errorf("Expected the walk to go past the blocked page, got %+v", result)
+	}
+	result, err = service.SyncSms(context.Background(), device, 1, SyncOptions{PageSize: 2, Force: true})
+	if err != nil {
+		t.Fatalf("second sms sync failed: %v", err)
+	}
+	if result.NewCount != 0 || result.Blocked != 0 {
+		t.Errorf("Expected blocked messages to be dropped only once, got %+v", result)
+	}
+
+	var stored []models.SmsMessage
+	engine.Find(&stored)
+	if len(stored) != 1 || stored[0].Address != "10086" {
+		t.Errorf("Expected only the allowed message to be visible, got %+v", stored)
+	}
+	var tombstones []models.SmsMessage
+	engine.Unscoped().Where("deleted_at IS NOT NULL").Find(&tombstones)
+	if len(tombstones) != 2 || tombstones[0].Body != "" || !tombstones[0].Blocked {
+		t.Errorf("Expected bodiless deleted tombstones for the blocked messages, got %+v", tombstones)
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+	"backend/internal/repository"
+
+	"xorm.io/xorm"
+)
+
+// CommandService dispatches queued commands to phones.
+type CommandService struct {
+	engine *xorm.Engine
+}
+
+// NewCommandService creates a new CommandService.
+func NewCommandService(engine *xorm.Engine) *CommandService {
+	return &CommandService{engine: engine}
+}
+
+// DecodeCommandPayload parses a command payload into the phoneclient request
+// matching the command type. Used both to validate on enqueue and to dispatch.
+func DecodeCommandPayload(cmdType, payload string) (interface{}, error) {
+	var target interface{}
+	switch cmdType {
+	case models.CommandTypeSendSms:
+		target = &phoneclient.SmsSendRequest{}
+	case models.CommandTypeWol:
+		target = &phoneclient.WolRequest{}
+	case models.CommandTypeAddContact:
+		target = &phoneclient.ContactAddRequest{}
+	default:
+		return nil, fmt.Errorf("unsupported command type: %s", cmdType)
+	}
+
+	if err := json.Unmarshal([]byte(payload), target); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	switch req := target.(type) {
+	case *phoneclient.SmsSendRequest:
+		if req.PhoneNumbers == "" || req.MsgContent == "" {
+			return nil, fmt.Errorf("send_sms requires phone_numbers and msg_content")
+		}
+	case *phoneclient.WolRequest:
+		if req.Mac == "" {
+			return nil, fmt.Errorf("wol requires mac")
+		}
+	case *phoneclient.ContactAddRequest:
+		if req.PhoneNumber == "" || req.Name == "" {
+			return nil, fmt.Errorf("add_contact requires name and phone_number")
+		}
+	}
+	return target, nil
+}
+
+// Execute claims a pending command, dispatches it through phoneclient and
+// records the final status and result.
+func (s *CommandService) Execute(ctx context.Context, cmd *models.Command) error {
+	repo := repository.NewCommandRepository(s.engine)
+
+	claimed, err := repo.Claim(cmd.ID)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		// Another worker picked it up, or it was modified meanwhile
+		return nil
+	}
+
+	status := models.CommandStatusDone
+	result, err := s.dispatch(ctx, cmd)
+	if err != nil {
+		status = models.CommandStatusFailed
+		result = err.Error()
+		log.Printf("[CommandService] command %d (%s) on device %d failed: %v", cmd.ID, cmd.Type, cmd.DeviceID, err)
+	}
+
+	return repo.Complete(cmd.ID, status, result)
+}
+
+// dispatch sends the command to the phone and returns a human-readable result.
+func (s *CommandService) dispatch(ctx context.Context, cmd *models.Command) (string, error) {
+	var device models.Device
+	has, err := s.engine.ID(cmd.DeviceID).Get(&device)
+	if err != nil {
+		return "", err
+	}
+	if !has {
+		return "", fmt.Errorf("device not found")
+	}
+
+	req, err := DecodeCommandPayload(cmd.Type, cmd.Payload)
+	if err != nil {
+		return "", err
+	}
+
+	client := phoneclient.NewClient(&device)
+	switch r := req.(type) {
+	case *phoneclient.SmsSendRequest:
+		if err := client.SendSms(ctx, *r); err != nil {
+			var failed []OutgoingSms
+			for _, number := range SmsRecipients(r.PhoneNumbers) {
+				failed = append(failed, OutgoingSms{Number: number, Body: r.MsgContent})
+			}
+			RecordFailedSms(s.engine, &device, r.SimSlot, failed)
+			return "", err
+		}
+		return "SMS sent successfully", nil
+	case *phoneclient.WolRequest:
+		if err := client.SendWol(ctx, *r); err != nil {
+			return "", err
+		}
+		return "WOL packet sent successfully", nil
+	case *phoneclient.ContactAddRequest:
+		if err := client.AddContact(ctx, *r); err != nil {
+			return "", err
+		}
+		return "Contact added successfully", nil
+	}
+	return "", fmt.Errorf("unsupported command type: %s", cmd.Type)
+}
+
+// OutgoingSms is one message sent, or meant to be sent, to one number.
+type OutgoingSms struct {
+	Number string
+	Body   string
+}
+
+// SmsRecipients splits the semicolon-separated phone_numbers of a send
+// request into the numbers it sends to.
+func SmsRecipients(phoneNumbers string) []string {
+	var numbers []string
+	for _, n := range strings.Split(phoneNumbers, ";") {
+		if n = strings.TrimSpace(n); n != "" {
+			numbers = append(numbers, n)
+		}
+	}
+	return numbers
+}
+
+// RecordFailedSms stores messages the phone refused to send as sent SMS with
+// delivery status failed, so they show up in the conversation, and can be
+// resent, instead of vanishing. simSlot is 1 or 2 as in send requests.
+// Failures are logged, since the send already failed anyway.
+func RecordFailedSms(engine *xorm.Engine, device *models.Device, simSlot int, failed []OutgoingSms) {
+	repo := repository.NewSmsRepository(engine)
+	contactRepo := repository.NewContactRepository(engine)
+	now := time.Now().UnixMilli()
+	for i, msg := range failed {
+		if _, err := contactRepo.EnsureHiddenContact(device.ID, msg.Number, ""); err != nil {
+			log.Printf("[SendSMS] ensure hidden contact error: %v", err)
+		}
+		sms := &models.SmsMessage{
+			DeviceID:       device.ID,
+			Address:        msg.Number,
+			Body:           msg.Body,
+			Type:           2,
+			SimID:          simSlot - 1,
+			SmsTime:        now + int64(i), // Distinct times keep repeated numbers apart under the unique key
+			IsRead:         true,
+			DeliveryStatus: models.DeliveryStatusFailed,
+		}
+		if err := repo.Insert(sms); err != nil {
+			log.Printf("[SendSMS] failed to record failed message to %s: %v", msg.Number, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// deviceContexts tracks a cancelable context per device for background work
+// (syncs, pollers) that must outlive the HTTP request that started it.
+var deviceContexts = struct {
+	sync.Mutex
+	m map[int64]*deviceContext
+}{m: make(map[int64]*deviceContext)}
+
+type deviceContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// DeviceContext returns a context for background work on a device.
+// It is canceled by CancelDeviceWork, e.g. when the device is deleted.
+func DeviceContext(deviceID int64) context.Context {
+	deviceContexts.Lock()
+	defer deviceContexts.Unlock()
+
+	if dc, ok := deviceContexts.m[deviceID]; ok {
+		return dc.ctx
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	deviceContexts.m[deviceID] = &deviceContext{ctx: ctx, cancel: cancel}
+	return ctx
+}
+
+// CancelDeviceWork cancels all background work running on a device.
+// Work started afterwards gets a fresh context.
+func CancelDeviceWork(deviceID int64) {
+	deviceContexts.Lock()
+	defer deviceContexts.Unlock()
+
+	if dc, ok := deviceContexts.m[deviceID]; ok {
+		dc.cancel()
+		delete(deviceContexts.m, deviceID)
+	}
+}
+
+// CancelAllDeviceWork cancels background work on every device, e.g. on shutdown.
+func CancelAllDeviceWork() {
+	deviceContexts.Lock()
+	defer deviceContexts.Unlock()
+
+	for id, dc := range deviceContexts.m {
+		dc.cancel()
+		delete(deviceContexts.m, id)
+	}
+}
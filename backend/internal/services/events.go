@@ -0,0 +1,71 @@
+package services
+
+import (
+	"sync"
+)
+
+// eventBufferSize is how many undelivered events a subscriber may queue
+// before further events to it are dropped.
+const eventBufferSize = 64
+
+// previewLength caps the SMS body preview carried by an event, in runes
+const previewLength = 80
+
+// Event announces a newly synced record.
+type Event struct {
+	DeviceID int64  `json:"device_id"`
+	Kind     string `json:"kind"`    // sms, call
+	Address  string `json:"address"` // SMS sender/recipient or call number
+	Type     int    `json:"type"`    // SMS: 1=received, 2=sent; call: 1=incoming, 2=outgoing, 3=missed
+	Preview  string `json:"preview"` // Truncated SMS body, empty for calls
+	Time     int64  `json:"time"`    // Record timestamp in milliseconds
+}
+
+// eventSubscribers is the in-process event bus: one buffered channel per subscriber.
+var eventSubscribers = struct {
+	sync.Mutex
+	m map[chan Event]struct{}
+}{m: make(map[chan Event]struct{})}
+
+// SubscribeEvents registers a new event subscriber. The returned function
+// unsubscribes and closes the channel; it must be called when done.
+func SubscribeEvents() (<-chan Event, func()) {
+	ch := make(chan Event, eventBufferSize)
+
+	eventSubscribers.Lock()
+	eventSubscribers.m[ch] = struct{}{}
+	eventSubscribers.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			eventSubscribers.Lock()
+			delete(eventSubscribers.m, ch)
+			eventSubscribers.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// PublishEvent delivers an event to all subscribers without blocking.
+// Slow subscribers whose buffer is full miss the event.
+func PublishEvent(ev Event) {
+	eventSubscribers.Lock()
+	defer eventSubscribers.Unlock()
+
+	for ch := range eventSubscribers.m {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// truncatePreview shortens s to previewLength runes.
+func truncatePreview(s string) string {
+	runes := []rune(s)
+	if len(runes) <= previewLength {
+		return s
+	}
+	return string(runes[:previewLength]) + "…"
+}
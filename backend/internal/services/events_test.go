@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+)
+
+func TestSyncPublishesEventsForNewRecords(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+	engine.Insert(&models.Contact{DeviceID: device.ID, Name: "10086", Phone: "10086", IsHidden: true})
+	fp.sms = []phoneclient.SmsItem{{Number: "10086", Content: "your code is 1234", Type: 1, Date: 1700000000000}}
+	fp.calls = []phoneclient.CallItem{{Number: "10010", Type: 3, DateLong: 1700000000000}}
+
+	events, unsubscribe := SubscribeEvents()
+	defer unsubscribe()
+
+	service := NewSyncService(engine)
+	if _, err := service.SyncSms(context.Background(), device, 1, SyncOptions{}); err != nil {
+		t.Fatalf("sms sync failed: %v", err)
+	}
+	if _, err := service.SyncCalls(context.Background(), device, 0, SyncOptions{}); err != nil {
+		t.Fatalf("call sync failed: %v", err)
+	}
+
+	var got []Event
+	for len(events) > 0 {
+		got = append(got, <-events)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 events, got %+v", got)
+	}
+	if got[0].Kind != "sms" || got[0].DeviceID != device.ID || got[0].Address != "10086" || got[0].Preview != "your code is 1234" {
+		t.Errorf("Unexpected sms event: %+v", got[0])
+	}
+	if got[1].Kind != "call" || got[1].Address != "10010" || got[1].Type != 3 {
+		t.Errorf("Unexpected call event: %+v", got[1])
+	}
+
+	// Nothing new on the next sync, so nothing is published
+	service.SyncSms(context.Background(), device, 1, SyncOptions{})
+	if len(events) != 0 {
+		t.Errorf("Expected no events for an unchanged phone, got %d", len(events))
+	}
+}
+
+func TestUnsubscribeStopsDelivery(t *testing.T) {
+	events, unsubscribe := SubscribeEvents()
+	unsubscribe()
+	unsubscribe() // safe to call twice
+
+	PublishEvent(Event{Kind: "sms"})
+	if _, ok := <-events; ok {
+		t.Errorf("Expected channel to be closed after unsubscribe")
+	}
+}
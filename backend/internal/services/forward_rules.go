@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"backend/internal/models"
+	"backend/internal/repository"
+)
+
+// ruleRegexCache holds compiled forward rule patterns keyed by source, so
+// each pattern is compiled once rather than per message.
+var ruleRegexCache sync.Map // string -> *regexp.Regexp
+
+// compileRulePattern returns the cached compiled regex for pattern.
+func compileRulePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := ruleRegexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	ruleRegexCache.Store(pattern, re)
+	return re, nil
+}
+
+// ValidateForwardRule checks a rule's match type, pattern and target URL.
+// Regex patterns are compiled (and cached) so errors surface at creation time.
+func ValidateForwardRule(rule *models.ForwardRule) error {
+	switch rule.MatchType {
+	case models.ForwardMatchSender, models.ForwardMatchContains:
+		if rule.Pattern == "" {
+			return fmt.Errorf("pattern is required for match_type %q", rule.MatchType)
+		}
+	case models.ForwardMatchRegex:
+		if _, err := compileRulePattern(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid regex pattern: %v", err)
+		}
+	case models.ForwardMatchSim:
+		if _, err := strconv.Atoi(rule.Pattern); err != nil {
+			return fmt.Errorf("pattern must be a SIM slot number (0=SIM1, 1=SIM2) for match_type sim")
+		}
+	default:
+		return fmt.Errorf("invalid match_type %q; use sender, contains, regex or sim", rule.MatchType)
+	}
+
+	u, err := url.Parse(rule.TargetURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("target_url must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// MatchForwardRule reports whether a received SMS satisfies the rule.
+func MatchForwardRule(rule *models.ForwardRule, sms *models.SmsMessage) bool {
+	switch rule.MatchType {
+	case models.ForwardMatchSender:
+		return strings.Contains(sms.Address, rule.Pattern)
+	case models.ForwardMatchContains:
+		return strings.Contains(strings.ToLower(sms.Body), strings.ToLower(rule.Pattern))
+	case models.ForwardMatchRegex:
+		re, err := compileRulePattern(rule.Pattern)
+		return err == nil && re.MatchString(sms.Body)
+	case models.ForwardMatchSim:
+		slot, err := strconv.Atoi(rule.Pattern)
+		return err == nil && sms.SimID == slot
+	}
+	return false
+}
+
+// activeForwardRules loads the enabled rules for a device, logging instead of
+// failing so a rule lookup error never aborts a sync.
+func (s *SyncService) activeForwardRules(deviceID int64) []models.ForwardRule {
+	rules, err := repository.NewForwardRuleRepository(s.engine).FindActive(deviceID)
+	if err != nil {
+		log.Printf("[ForwardRule] device %d: load rules error: %v", deviceID, err)
+		return nil
+	}
+	return rules
+}
+
+// forwardReceivedSms queues a webhook delivery to every rule the SMS matches.
+func forwardReceivedSms(rules []models.ForwardRule, device *models.Device, sms *models.SmsMessage, contactName string) {
+	for i := range rules {
+		rule := &rules[i]
+		if !MatchForwardRule(rule, sms) {
+			continue
+		}
+		payload := receivedSmsPayload(device, sms, contactName)
+		payload.RuleID = rule.ID
+		enqueueWebhook(webhookTarget{URL: rule.TargetURL, Secret: rule.Secret}, payload)
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+)
+
+func TestMatchForwardRule(t *testing.T) {
+	sms := &models.SmsMessage{Address: "+8610086", Body: "Your verification CODE is 482913", SimID: 1}
+
+	cases := []struct {
+		name string
+		rule models.ForwardRule
+		want bool
+	}{
+		{"sender contains", models.ForwardRule{MatchType: models.ForwardMatchSender, Pattern: "10086"}, true},
+		{"sender mismatch", models.ForwardRule{MatchType: models.ForwardMatchSender, Pattern: "95588"}, false},
+		{"body contains ignores case", models.ForwardRule{MatchType: models.ForwardMatchContains, Pattern: "code"}, true},
+		{"body contains mismatch", models.ForwardRule{MatchType: models.ForwardMatchContains, Pattern: "bank"}, false},
+		{"regex match", models.ForwardRule{MatchType: models.ForwardMatchRegex, Pattern: `\b\d{6}\b`}, true},
+		{"regex mismatch", models.ForwardRule{MatchType: models.ForwardMatchRegex, Pattern: `^\d+$`}, false},
+		{"sim slot match", models.ForwardRule{MatchType: models.ForwardMatchSim, Pattern: "1"}, true},
+		{"sim slot mismatch", models.ForwardRule{MatchType: models.ForwardMatchSim, Pattern: "0"}, false},
+	}
+	for _, tc := range cases {
+		if got := MatchForwardRule(&tc.rule, sms); got != tc.want {
+			t.Errorf("%s: MatchForwardRule = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestValidateForwardRuleRejectsInvalidPatterns(t *testing.T) {
+	valid := models.ForwardRule{MatchType: models.ForwardMatchRegex, Pattern: `\d{4,6}`, TargetURL: "https://example.com/hook"}
+	if err := ValidateForwardRule(&valid); err != nil {
+		t.Fatalf("Expected a valid rule, got %v", err)
+	}
+
+	for _, rule := range []models.ForwardRule{
+		{MatchType: models.ForwardMatchRegex, Pattern: `(\d+`, TargetURL: "https://example.com/hook"},
+		{MatchType: models.ForwardMatchSim, Pattern: "SIM1", TargetURL: "https://example.com/hook"},
+		{MatchType: models.ForwardMatchContains, Pattern: "", TargetURL: "https://example.com/hook"},
+		{MatchType: "prefix", Pattern: "x", TargetURL: "https://example.com/hook"},
+		{MatchType: models.ForwardMatchSender, Pattern: "x", TargetURL: "ftp://example.com"},
+	} {
+		if err := ValidateForwardRule(&rule); err == nil {
+			t.Errorf("Expected rule %+v to be rejected", rule)
+		}
+	}
+}
+
+func TestSyncDispatchesMatchingForwardRules(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+	fp.sms = []phoneclient.SmsItem{
+		{Number: "95588", Content: "balance changed", Type: 1, SimID: 0, Date: 1700000000000},
+		{Number: "10086", Content: "code 1234", Type: 1, SimID: 1, Date: 1700000001000},
+	}
+
+	payloads := make(chan WebhookPayload, 4)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p WebhookPayload
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &p)
+		payloads <- p
+	}))
+	defer hook.Close()
+
+	matching := models.ForwardRule{MatchType: models.ForwardMatchSim, Pattern: "1", TargetURL: hook.URL, Enabled: true}
+	disabled := models.ForwardRule{MatchType: models.ForwardMatchSender, Pattern: "95588", TargetURL: hook.URL, Enabled: false}
+	otherDevice := models.ForwardRule{DeviceID: device.ID + 1, MatchType: models.ForwardMatchSender, Pattern: "95588", TargetURL: hook.URL, Enabled: true}
+	for _, rule := range []*models.ForwardRule{&matching, &disabled, &otherDevice} {
+		if _, err := engine.Insert(rule); err != nil {
+			t.Fatalf("insert rule: %v", err)
+		}
+	}
+
+	if _, err := NewSyncService(engine).SyncSms(context.Background(), device, 1, SyncOptions{}); err != nil {
+		t.Fatalf("sms sync failed: %v", err)
+	}
+
+	select {
+	case p := <-payloads:
+		if p.RuleID != matching.ID || p.Address != "10086" || p.Body != "code 1234" {
+			t.Errorf("Unexpected forwarded payload: %+v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("matching rule was not dispatched")
+	}
+	select {
+	case p := <-payloads:
+		t.Errorf("Unexpected extra delivery: %+v", p)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
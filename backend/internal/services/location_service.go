@@ -0,0 +1,64 @@
+package services
+
+import (
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+	"backend/internal/repository"
+
+	"xorm.io/xorm"
+)
+
+// LocationService persists location fixes reported by phones.
+type LocationService struct {
+	engine *xorm.Engine
+}
+
+// NewLocationService creates a new LocationService.
+func NewLocationService(engine *xorm.Engine) *LocationService {
+	return &LocationService{engine: engine}
+}
+
+// Record stores a location fix for the device and makes it the device's last
+// known location (latitude, longitude, address and time). A fix identical to
+// the previous one is not stored in the history again. A 0,0 fix means the
+// phone has no fix, so it is ignored and the previous location kept.
+// Returns whether a new history row was written.
+func (s *LocationService) Record(device *models.Device, location *phoneclient.LocationResponse) (bool, error) {
+	if location.Latitude == 0 && location.Longitude == 0 {
+		return false, nil
+	}
+	repo := repository.NewLocationHistoryRepository(s.engine)
+
+	latest, err := repo.FindLatest(device.ID)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	stored := false
+	if latest == nil || latest.Latitude != location.Latitude || latest.Longitude != location.Longitude {
+		record := &models.LocationHistory{
+			DeviceID:   device.ID,
+			Latitude:   location.Latitude,
+			Longitude:  location.Longitude,
+			Address:    location.Address,
+			Provider:   location.Provider,
+			FixTime:    location.Time,
+			RecordedAt: now,
+		}
+		if err := repo.Insert(record); err != nil {
+			return false, err
+		}
+		stored = true
+	}
+
+	device.Latitude = location.Latitude
+	device.Longitude = location.Longitude
+	device.LocationAddress = location.Address
+	device.LocationAt = &now
+	if _, err := s.engine.ID(device.ID).Cols("latitude", "longitude", "location_address", "location_at").Update(device); err != nil {
+		return stored, err
+	}
+	return stored, nil
+}
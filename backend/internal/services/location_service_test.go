@@ -0,0 +1,71 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+	"backend/internal/repository"
+)
+
+func TestLocationRecordSkipsIdenticalConsecutiveFix(t *testing.T) {
+	engine := newTestEngine(t)
+	device := &models.Device{Name: "phone", PhoneAddr: "http://phone", SM4Key: "00"}
+	if _, err := engine.Insert(device); err != nil {
+		t.Fatalf("insert device: %v", err)
+	}
+
+	service := NewLocationService(engine)
+	fixes := []phoneclient.LocationResponse{
+		{Latitude: 31.23, Longitude: 121.47, Provider: "gps"},
+		{Latitude: 31.23, Longitude: 121.47, Provider: "gps"},
+		{Latitude: 31.24, Longitude: 121.48, Provider: "network"},
+		{Latitude: 31.23, Longitude: 121.47, Provider: "gps"},
+	}
+	wantStored := []bool{true, false, true, true}
+	for i := range fixes {
+		stored, err := service.Record(device, &fixes[i])
+		if err != nil {
+			t.Fatalf("Record %d failed: %v", i, err)
+		}
+		if stored != wantStored[i] {
+			t.Errorf("Record %d: expected stored=%v, got %v", i, wantStored[i], stored)
+		}
+	}
+
+	items, err := repository.NewLocationHistoryRepository(engine).FindRange(device.ID, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("FindRange failed: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 stored fixes, got %d", len(items))
+	}
+
+	var stored models.Device
+	engine.ID(device.ID).Get(&stored)
+	if stored.Latitude != 31.23 || stored.Longitude != 121.47 {
+		t.Errorf("Expected device position to follow the latest fix, got %v,%v", stored.Latitude, stored.Longitude)
+	}
+}
+
+func TestLocationRecordKeepsLastFixOnZeroFix(t *testing.T) {
+	engine := newTestEngine(t)
+	device := &models.Device{Name: "phone", PhoneAddr: "http://phone", SM4Key: "00"}
+	engine.Insert(device)
+
+	service := NewLocationService(engine)
+	if _, err := service.Record(device, &phoneclient.LocationResponse{Latitude: 31.23, Longitude: 121.47, Address: "Shanghai"}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	stored, err := service.Record(device, &phoneclient.LocationResponse{Address: "unknown"})
+	if err != nil || stored {
+		t.Fatalf("Expected a 0,0 fix to be ignored, got stored=%v err=%v", stored, err)
+	}
+
+	var got models.Device
+	engine.ID(device.ID).Get(&got)
+	if got.Latitude != 31.23 || got.Longitude != 121.47 || got.LocationAddress != "Shanghai" || got.LocationAt == nil {
+		t.Errorf("Expected the previous fix kept, got %v,%v %q %v", got.Latitude, got.Longitude, got.LocationAddress, got.LocationAt)
+	}
+}
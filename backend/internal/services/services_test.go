@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"backend/config"
+	"backend/internal/db"
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+	"backend/internal/security"
+
+	"xorm.io/xorm"
+	"xorm.io/xorm/contexts"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+// newTestEngine boots an in-memory SQLite engine with the full schema.
+func newTestEngine(t *testing.T) *xorm.Engine {
+	t.Helper()
+	cfg := &config.Config{
+		Database: config.Database{Driver: "sqlite", DSN: ":memory:"},
+	}
+	engine, err := db.NewEngine(cfg)
+	if err != nil {
+		t.Fatalf("NewEngine failed: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+	return engine
+}
+
+// queryCounter is a xorm hook counting executed SQL statements.
+type queryCounter struct {
+	n int64
+}
+
+func (q *queryCounter) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	return c.Ctx, nil
+}
+
+func (q *queryCounter) AfterProcess(c *contexts.ContextHook) error {
+	atomic.AddInt64(&q.n, 1)
+	return nil
+}
+
+func (q *queryCounter) reset()       { atomic.StoreInt64(&q.n, 0) }
+func (q *queryCounter) count() int64 { return atomic.LoadInt64(&q.n) }
+
+// fakePhone is an httptest SmsForwarder speaking the SM4-encrypted protocol.
+// SMS and call items are served newest first, paginated like the real app.
+type fakePhone struct {
+	t        *testing.T
+	mu       sync.Mutex
+	sms      []phoneclient.SmsItem
+	calls    []phoneclient.CallItem
+	contacts []phoneclient.ContactItem
+	hits     map[string]int
+	server   *httptest.Server
+	// keywordFilter makes /sms/query honor keyword against numbers and
+	// content; otherwise it is ignored, like older SmsForwarder versions
+	keywordFilter bool
+	// keywordContentOnly, with keywordFilter, matches keyword against content only
+	keywordContentOnly bool
+}
+
+// newFakePhone starts a fake phone and registers a device pointing at it.
+func newFakePhone(t *testing.T, engine *xorm.Engine) (*fakePhone, *models.Device) {
+	t.Helper()
+	fp := &fakePhone{t: t, hits: make(map[string]int)}
+	fp.server = httptest.NewServer(http.HandlerFunc(fp.handle))
+	t.Cleanup(fp.server.Close)
+
+	device := &models.Device{
+		Name:      "fake",
+		PhoneAddr: fp.server.URL,
+		SM4Key:    testKey,
+	}
+	if _, err := engine.Insert(device); err != nil {
+		t.Fatalf("insert device: %v", err)
+	}
+	return fp, device
+}
+
+func (fp *fakePhone) hitCount(path string) int {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	return fp.hits[path]
+}
+
+func (fp *fakePhone) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	plain, err := security.SM4DecryptHex(testKey, string(body))
+	if err != nil {
+		fp.t.Errorf("fake phone: decrypt request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Data json.RawMessage `json:"data"`
+	}
+	json.Unmarshal(plain, &req)
+
+	fp.mu.Lock()
+	fp.hits[r.URL.Path]++
+	var data interface{}
+	switch r.URL.Path {
+	case "/sms/query":
+		var q phoneclient.SmsQueryRequest
+		json.Unmarshal(req.Data, &q)
+		var filtered []phoneclient.SmsItem
+		for _, item := range fp.sms {
+			if q.Type != 0 && item.Type != q.Type {
+				continue
+			}
+			if fp.keywordFilter && q.Keyword != "" && (fp.keywordContentOnly || !strings.Contains(item.Number, q.Keyword)) && !strings.Contains(item.Content, q.Keyword) {
+				continue
+			}
+			filtered = append(filtered, item)
+		}
+		data = page(filtered, q.PageNum, q.PageSize)
+	case "/call/query":
+		var q phoneclient.CallQueryRequest
+		json.Unmarshal(req.Data, &q)
+		var filtered []phoneclient.CallItem
+		for _, item := range fp.calls {
+			if q.Type == 0 || item.Type == q.Type {
+				filtered = append(filtered, item)
+			}
+		}
+		data = page(filtered, q.PageNum, q.PageSize)
+	case "/contact/query":
+		data = fp.contacts
+	default:
+		data = map[string]interface{}{}
+	}
+	fp.mu.Unlock()
+
+	respBytes, _ := json.Marshal(phoneclient.Response{Code: 200, Msg: "success", Data: data})
+	cipherHex, err := security.SM4EncryptHex(testKey, respBytes)
+	if err != nil {
+		fp.t.Errorf("fake phone: encrypt response: %v", err)
+		return
+	}
+	w.Write([]byte(cipherHex))
+}
+
+// page returns the 1-based page of items, or an empty slice past the end.
+func page[T any](items []T, pageNum, pageSize int) []T {
+	start := (pageNum - 1) * pageSize
+	if start >= len(items) {
+		return []T{}
+	}
+	end := start + pageSize
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
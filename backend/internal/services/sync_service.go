@@ -1,8 +1,14 @@
 package services
 
 import (
-	"log"
-
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backend/internal/metrics"
 	"backend/internal/models"
 	"backend/internal/phoneclient"
 	"backend/internal/repository"
@@ -22,31 +28,223 @@ func NewSyncService(engine *xorm.Engine) *SyncService {
 
 // SyncResult represents the result of a sync operation.
 type SyncResult struct {
-	NewCount     int  `json:"new_count"`
-	UpdatedCount int  `json:"updated_count"`
-	IsComplete   bool `json:"is_complete"` // true if reached existing data or no more data
+	NewCount     int        `json:"new_count"`
+	UpdatedCount int        `json:"updated_count"`
+	IsComplete   bool       `json:"is_complete"`         // true if reached existing data or no more data
+	SyncedAt     *time.Time `json:"synced_at,omitempty"` // Set when the sync succeeded
+	Skipped      bool       `json:"skipped,omitempty"`   // true if the same sync was already running
+	Blocked      int        `json:"blocked,omitempty"`   // New received SMS dropped by a delete blocklist entry
+	Truncated    bool       `json:"truncated,omitempty"` // true if the sync stopped at the page cap with records possibly left
+	// ClientFiltered is set by SyncConversation when the phone couldn't filter
+	// by address and unfiltered pages were searched instead.
+	ClientFiltered bool `json:"client_filtered,omitempty"`
+}
+
+// syncKey identifies one data type ("sms", "calls" or "contacts") of a device.
+type syncKey struct {
+	deviceID int64
+	kind     string
+}
+
+// syncInFlight holds the syncs currently running. Page loads start a background
+// sync every time, so without this rapid refreshes would sync the same device
+// many times over in parallel.
+var syncInFlight sync.Map // syncKey -> *syncProgress
+
+// syncKinds lists the data types in the order SyncProgressOf reports them.
+var syncKinds = []string{"sms", "calls", "contacts"}
+
+// SyncProgress describes a sync that is running now.
+type SyncProgress struct {
+	Kind      string    `json:"kind"` // sms, calls or contacts
+	Full      bool      `json:"full"` // Walking every page up to the cap
+	StartedAt time.Time `json:"started_at"`
+	Pages     int       `json:"pages"`     // Pages fetched from the phone so far
+	NewCount  int       `json:"new_count"` // Records inserted so far
+}
+
+// syncProgress is the live SyncProgress of a running sync, updated as it walks pages.
+type syncProgress struct {
+	mu sync.Mutex
+	p  SyncProgress
+}
+
+// page records one page fetched from the phone.
+func (sp *syncProgress) page() {
+	sp.mu.Lock()
+	sp.p.Pages++
+	sp.mu.Unlock()
+}
+
+// inserted records n newly stored records.
+func (sp *syncProgress) inserted(n int) {
+	sp.mu.Lock()
+	sp.p.NewCount += n
+	sp.mu.Unlock()
+}
+
+// SyncProgressOf returns the syncs of a device that are running now, so
+// long syncs can be followed while the request that started them is blocked.
+func SyncProgressOf(deviceID int64) []SyncProgress {
+	running := []SyncProgress{}
+	for _, kind := range syncKinds {
+		if v, ok := syncInFlight.Load(syncKey{deviceID, kind}); ok {
+			sp := v.(*syncProgress)
+			sp.mu.Lock()
+			running = append(running, sp.p)
+			sp.mu.Unlock()
+		}
+	}
+	return running
+}
+
+// beginSync claims the sync of one data type of a device, returning nil if
+// it is already running. A successful claim must be released with endSync.
+func beginSync(deviceID int64, kind string, full bool) *syncProgress {
+	sp := &syncProgress{p: SyncProgress{Kind: kind, Full: full, StartedAt: time.Now()}}
+	if _, running := syncInFlight.LoadOrStore(syncKey{deviceID, kind}, sp); running {
+		return nil
+	}
+	return sp
+}
+
+// endSync releases a claim taken by beginSync.
+func endSync(deviceID int64, kind string) {
+	syncInFlight.Delete(syncKey{deviceID, kind})
+}
+
+// markSynced records a successful sync of one data type ("sms", "calls" or
+// "contacts") on the device and in the result. A failure to save the time is
+// only logged, since the sync itself succeeded.
+func (s *SyncService) markSynced(device *models.Device, kind string, result *SyncResult) {
+	now := time.Now()
+	result.SyncedAt = &now
+
+	// Write through a fresh struct: the caller's device may be shared with a handler
+	var update models.Device
+	var column string
+	switch kind {
+	case "sms":
+		update.SmsSyncedAt, column = &now, "sms_synced_at"
+	case "calls":
+		update.CallsSyncedAt, column = &now, "calls_synced_at"
+	case "contacts":
+		update.ContactsSyncedAt, column = &now, "contacts_synced_at"
+	}
+	if _, err := s.engine.ID(device.ID).Cols(column).Update(&update); err != nil {
+		slog.Error("save sync time failed", "operation", "sync_"+kind, "device_id", device.ID, "error", err)
+	}
+}
+
+// smsDedupWindow is the fuzzy duplicate window in milliseconds (0 = exact keys only).
+var smsDedupWindow atomic.Int64
+
+// SetSmsDedupWindow makes SMS sync skip messages whose address, type and body
+// match a stored or just-synced message within window of its timestamp.
+// SmsForwarder occasionally reports one message twice with timestamps a few
+// milliseconds apart, which the exact unique key lets through. 0 disables it.
+// Call once at startup.
+func SetSmsDedupWindow(window time.Duration) {
+	smsDedupWindow.Store(window.Milliseconds())
+}
+
+// isNearDuplicate reports whether sms matches one of the pending messages or a
+// stored one within window milliseconds. Lookup errors are logged and treated
+// as no match, falling back to exact-key behavior.
+func isNearDuplicate(repo *repository.SmsRepository, sms *models.SmsMessage, pending []*models.SmsMessage, window int64) bool {
+	for _, p := range pending {
+		if p.Address == sms.Address && p.Type == sms.Type && p.Body == sms.Body &&
+			p.SmsTime >= sms.SmsTime-window && p.SmsTime <= sms.SmsTime+window {
+			return true
+		}
+	}
+	dup, err := repo.HasNearDuplicate(sms.DeviceID, sms.Address, sms.Type, sms.Body, sms.SmsTime, window)
+	if err != nil {
+		slog.Error("near-duplicate check failed", "operation", "sync_sms", "device_id", sms.DeviceID, "error", err)
+		return false
+	}
+	return dup
+}
+
+// Default sync limits, used until SetSyncLimits is called.
+const (
+	defaultSyncPageSize = 50
+	defaultSyncMaxPages = 100
+)
+
+// syncPageSize and syncMaxPages hold the limits set by SetSyncLimits (0 = default).
+var syncPageSize, syncMaxPages atomic.Int64
+
+// SetSyncLimits sets how many records a sync requests per page and how many
+// pages one SMS or call sync walks at most, unless SyncOptions overrides them.
+// Zero or negative values keep the defaults (50 and 100). Call once at startup.
+func SetSyncLimits(pageSize, maxPages int) {
+	syncPageSize.Store(int64(pageSize))
+	syncMaxPages.Store(int64(maxPages))
+}
+
+// SyncOptions controls how a sync walks the phone's pages.
+type SyncOptions struct {
+	// Force skips the latest-timestamp fast path and always walks pages
+	// until a page contains no new records.
+	Force bool
+	// Full walks every page up to MaxPages, even past pages that contain no
+	// new records. It stops early only when the phone runs out of records.
+	// Use it for the first sync of a phone whose newest records are already
+	// stored, e.g. after re-adding a device, or to finish a truncated sync.
+	Full bool
+	// PageSize and MaxPages override the limits set by SetSyncLimits for this
+	// sync (0 = configured limit). Syncs that hit MaxPages are marked Truncated.
+	PageSize int
+	MaxPages int
+}
+
+// limits returns the page size and page cap for a sync.
+func (o SyncOptions) limits() (pageSize, maxPages int) {
+	pageSize, maxPages = o.PageSize, o.MaxPages
+	if pageSize <= 0 {
+		pageSize = int(syncPageSize.Load())
+	}
+	if pageSize <= 0 {
+		pageSize = defaultSyncPageSize
+	}
+	if maxPages <= 0 {
+		maxPages = int(syncMaxPages.Load())
+	}
+	if maxPages <= 0 {
+		maxPages = defaultSyncMaxPages
+	}
+	return pageSize, maxPages
 }
 
 // SyncSms performs incremental SMS sync from phone.
 // Fetches pages of SMS until it encounters existing records.
 // If smsType is 0, syncs both received (1) and sent (2) messages.
 // IMPORTANT: Ensures contacts are synced first before syncing SMS.
-func (s *SyncService) SyncSms(device *models.Device, smsType int) (*SyncResult, error) {
+// Returns immediately with Skipped set if an SMS sync of the device is already running.
+// Progress can be followed through SyncProgressOf while it runs.
+func (s *SyncService) SyncSms(ctx context.Context, device *models.Device, smsType int, opts SyncOptions) (*SyncResult, error) {
+	progress := beginSync(device.ID, "sms", opts.Full)
+	if progress == nil {
+		return &SyncResult{Skipped: true}, nil
+	}
+	defer endSync(device.ID, "sms")
+
 	// Check if contacts have been synced for this device
 	// If not, sync contacts first to ensure we have accurate contact names
 	contactRepo := repository.NewContactRepository(s.engine)
 	hasSynced, err := contactRepo.HasAnySynced(device.ID)
 	if err != nil {
-		log.Printf("[SyncSms] failed to check contacts sync status: %v", err)
+		slog.ErrorContext(ctx, "check contacts sync status failed", "operation", "sync_sms", "device_id", device.ID, "error", err)
 	} else if !hasSynced {
 		// No contacts synced yet, sync contacts first
-		log.Printf("[SyncSms] device %d: syncing contacts first before SMS sync", device.ID)
-		_, err := s.SyncContacts(device)
+		slog.InfoContext(ctx, "syncing contacts first before SMS sync", "operation", "sync_sms", "device_id", device.ID)
+		_, err := s.SyncContacts(ctx, device)
 		if err != nil {
-			log.Printf("[SyncSms] device %d: failed to sync contacts: %v", device.ID, err)
+			slog.WarnContext(ctx, "contact sync before SMS sync failed", "operation", "sync_sms", "device_id", device.ID, "error", err)
 			// Continue anyway - SMS sync can still work with hidden contacts
 		} else {
-			log.Printf("[SyncSms] device %d: contacts synced successfully", device.ID)
+			slog.InfoContext(ctx, "contacts synced before SMS sync", "operation", "sync_sms", "device_id", device.ID)
 		}
 	}
 
@@ -54,52 +252,62 @@ func (s *SyncService) SyncSms(device *models.Device, smsType int) (*SyncResult,
 
 	// If type is 0 (all), sync both received and sent
 	if smsType == 0 {
-		// Sync received messages
-		r1, err := s.syncSmsType(device, 1)
-		if err != nil {
-			return result, err
-		}
-		result.NewCount += r1.NewCount
-
-		// Sync sent messages
-		r2, err := s.syncSmsType(device, 2)
-		if err != nil {
-			return result, err
+		result.IsComplete = true
+		for _, t := range []int{1, 2} {
+			r, err := s.syncSmsType(ctx, device, t, opts, progress)
+			if r != nil {
+				result.NewCount += r.NewCount
+				result.UpdatedCount += r.UpdatedCount
+				result.Blocked += r.Blocked
+				result.IsComplete = result.IsComplete && r.IsComplete
+				result.Truncated = result.Truncated || r.Truncated
+			}
+			if err != nil {
+				return result, err
+			}
 		}
-		result.NewCount += r2.NewCount
-		result.IsComplete = r1.IsComplete && r2.IsComplete
-		return result, nil
+	} else if result, err = s.syncSmsType(ctx, device, smsType, opts, progress); err != nil {
+		return result, err
 	}
 
-	return s.syncSmsType(device, smsType)
+	s.markSynced(device, "sms", result)
+	return result, nil
 }
 
 // syncSmsType syncs SMS of a specific type.
 // Logic: Fetch pages until all items in a page already exist in DB, or no more data.
 // This ensures we capture all new records even if they're not strictly ordered.
+// Unless opts.Force or opts.Full is set, the walk is skipped entirely when the newest
+// message on the first page is not newer than the newest stored one (nothing changed
+// on the phone). opts.Full keeps walking past pages with nothing new.
 // Also ensures hidden contacts are created for all phone numbers.
-func (s *SyncService) syncSmsType(device *models.Device, smsType int) (*SyncResult, error) {
+func (s *SyncService) syncSmsType(ctx context.Context, device *models.Device, smsType int, opts SyncOptions, progress *syncProgress) (*SyncResult, error) {
 	client := phoneclient.NewClient(device)
 	repo := repository.NewSmsRepository(s.engine)
-	contactRepo := repository.NewContactRepository(s.engine)
+	store := s.newSmsStore(device)
 
-	const pageSize = 50
-	const maxPages = 100
+	pageSize, maxPages := opts.limits()
 	pageNum := 1
 	result := &SyncResult{}
 
 	// Reduced logging: only log start and errors
 	for pageNum <= maxPages {
+		// Stop walking pages if the caller went away or the device was deleted
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
 		// Fetch from phone
-		items, err := client.QuerySms(phoneclient.SmsQueryRequest{
+		items, err := client.QuerySms(ctx, phoneclient.SmsQueryRequest{
 			Type:     smsType,
 			PageNum:  pageNum,
 			PageSize: pageSize,
 		})
 		if err != nil {
-			log.Printf("[SyncSms] device %d type %d page %d error: %v", device.ID, smsType, pageNum, err)
+			slog.ErrorContext(ctx, "fetch SMS page failed", "operation", "sync_sms", "device_id", device.ID, "type", smsType, "page", pageNum, "error", err)
 			return result, err
 		}
+		progress.page()
 
 		// No more data
 		if len(items) == 0 {
@@ -107,54 +315,26 @@ func (s *SyncService) syncSmsType(device *models.Device, smsType int) (*SyncResu
 			break
 		}
 
-		var newItems []*models.SmsMessage
-		existingCount := 0
-
-		for _, item := range items {
-			// Check if exists (including soft-deleted records)
-			// This prevents re-syncing messages that user has deleted
-			exists, err := repo.ExistsIncludingDeleted(device.ID, item.Number, item.Date, item.Type)
+		// Fast path: nothing newer than what we already have, skip per-item checks
+		if pageNum == 1 && !opts.Force && !opts.Full {
+			latest, err := repo.GetLatestSmsTimeIncludingDeleted(device.ID, smsType)
 			if err != nil {
-				log.Printf("[SyncSms] check exists error: %v", err)
-				continue
-			}
-
-			if exists {
-				existingCount++
-			} else {
-				// Ensure hidden contact exists for this phone number
-				// This will create a hidden contact if it doesn't exist
-				// If it exists (hidden or not), it will just return the existing one
-				_, err := contactRepo.EnsureHiddenContact(device.ID, item.Number, item.Name)
-				if err != nil {
-					log.Printf("[SyncSms] ensure hidden contact error: %v", err)
-					// Continue anyway, contact creation failure shouldn't block SMS sync
-				}
-
-				newItems = append(newItems, &models.SmsMessage{
-					DeviceID: device.ID,
-					Address:  item.Number,
-					Name:     item.Name,
-					Body:     item.Content,
-					Type:     item.Type,
-					SimID:    item.SimID,
-					SmsTime:  item.Date,
-				})
+				slog.ErrorContext(ctx, "get latest SMS time failed", "operation", "sync_sms", "device_id", device.ID, "error", err)
+			} else if latest > 0 && newestSmsTime(items) <= latest {
+				result.IsComplete = true
+				break
 			}
 		}
 
-		// Save new items
-		if len(newItems) > 0 {
-			inserted, err := repo.InsertBatch(newItems)
-			if err != nil {
-				log.Printf("[SyncSms] insert batch error: %v", err)
-			} else {
-				result.NewCount += int(inserted)
-			}
+		before := result.NewCount
+		newItems, err := store.store(ctx, items, result)
+		if err != nil {
+			return result, err
 		}
+		progress.inserted(result.NewCount - before)
 
 		// Stop only when ALL items in this page already exist (no new data to sync)
-		if len(newItems) == 0 {
+		if newItems == 0 && !opts.Full {
 			result.IsComplete = true
 			break
 		}
@@ -163,58 +343,405 @@ func (s *SyncService) syncSmsType(device *models.Device, smsType int) (*SyncResu
 		pageNum++
 	}
 
+	// The loop only ends without a break when it ran out of pages
+	if !result.IsComplete {
+		result.Truncated = true
+		slog.WarnContext(ctx, "SMS sync stopped at the page cap, more messages may remain", "operation", "sync_sms", "device_id", device.ID, "type", smsType, "max_pages", maxPages)
+	}
+
 	// Only log if there were new messages
 	if result.NewCount > 0 {
-		log.Printf("[SyncSms] device %d type %d: synced %d new messages", device.ID, smsType, result.NewCount)
+		slog.InfoContext(ctx, "SMS synced", "operation", "sync_sms", "device_id", device.ID, "type", smsType, "new", result.NewCount)
+	}
+	return result, nil
+}
+
+// SyncConversation syncs the SMS exchanged with one address, received and sent,
+// so a thread view doesn't have to wait for a full SMS sync. Pages are queried
+// with QuerySmsByAddress and walked like syncSmsType walks them. If the phone
+// can't filter by address, the sync falls back to walking unfiltered pages and
+// keeping the address's messages, which costs about as much as an SMS sync;
+// ClientFiltered is then set. It shares the SMS sync's claim, so it is skipped
+// while an SMS sync of the device is running. The device's sms_synced_at is
+// left alone, since other conversations weren't synced.
+func (s *SyncService) SyncConversation(ctx context.Context, device *models.Device, address string, opts SyncOptions) (*SyncResult, error) {
+	progress := beginSync(device.ID, "sms", opts.Full)
+	if progress == nil {
+		return &SyncResult{Skipped: true}, nil
+	}
+	defer endSync(device.ID, "sms")
+
+	result := &SyncResult{IsComplete: true}
+	for _, smsType := range []int{1, 2} {
+		r, err := s.syncConversationType(ctx, device, address, smsType, opts, progress)
+		if r != nil {
+			result.NewCount += r.NewCount
+			result.UpdatedCount += r.UpdatedCount
+			result.Blocked += r.Blocked
+			result.IsComplete = result.IsComplete && r.IsComplete
+			result.Truncated = result.Truncated || r.Truncated
+			result.ClientFiltered = result.ClientFiltered || r.ClientFiltered
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+	now := time.Now()
+	result.SyncedAt = &now
+	if result.NewCount > 0 {
+		slog.InfoContext(ctx, "conversation synced", "operation", "sync_conversation", "device_id", device.ID, "new", result.NewCount, "client_filtered", result.ClientFiltered)
 	}
 	return result, nil
 }
 
+// syncConversationType syncs the messages of one type with address. It stops
+// at the first page with nothing new, or when the phone runs out of messages.
+// Unfiltered pages may hold nothing from the address, so once it has fallen
+// back it also stops at a page reaching back past the newest stored message.
+func (s *SyncService) syncConversationType(ctx context.Context, device *models.Device, address string, smsType int, opts SyncOptions, progress *syncProgress) (*SyncResult, error) {
+	client := phoneclient.NewClient(device)
+	store := s.newSmsStore(device)
+
+	// latest is the newest stored message with the address, watermark the newest
+	// stored one of any address: an unfiltered page reaching back past it holds
+	// nothing an earlier SMS sync hasn't seen
+	repo := repository.NewSmsRepository(s.engine)
+	latest, err := repo.GetLatestAddressSmsTime(device.ID, address, smsType)
+	if err != nil {
+		slog.ErrorContext(ctx, "get latest conversation SMS time failed", "operation", "sync_conversation", "device_id", device.ID, "error", err)
+	}
+	watermark, err := repo.GetLatestSmsTimeIncludingDeleted(device.ID, smsType)
+	if err != nil {
+		slog.ErrorContext(ctx, "get latest SMS time failed", "operation", "sync_conversation", "device_id", device.ID, "error", err)
+	}
+
+	pageSize, maxPages := opts.limits()
+	result := &SyncResult{}
+	for pageNum := 1; pageNum <= maxPages; pageNum++ {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		req := phoneclient.SmsQueryRequest{Type: smsType, PageNum: pageNum, PageSize: pageSize}
+		var page, items []phoneclient.SmsItem
+		if !result.ClientFiltered {
+			var supported bool
+			items, supported, err = client.QuerySmsByAddress(ctx, address, req)
+			page = items
+			// The keyword didn't select the address: search unfiltered pages instead
+			result.ClientFiltered = err == nil && !supported && pageNum == 1
+		}
+		if result.ClientFiltered {
+			page, err = client.QuerySms(ctx, req)
+			items = phoneclient.FilterSmsByAddress(page, address)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "fetch conversation SMS page failed", "operation", "sync_conversation", "device_id", device.ID, "type", smsType, "page", pageNum, "error", err)
+			return result, err
+		}
+		progress.page()
+
+		if len(page) == 0 {
+			result.IsComplete = true
+			break
+		}
+		if pageNum == 1 && !opts.Force && !opts.Full && latest > 0 && len(items) > 0 && newestSmsTime(items) <= latest {
+			result.IsComplete = true
+			break
+		}
+
+		before := result.NewCount
+		newItems, err := store.store(ctx, items, result)
+		if err != nil {
+			return result, err
+		}
+		progress.inserted(result.NewCount - before)
+
+		if opts.Full {
+			continue
+		}
+		if len(items) > 0 && newItems == 0 || result.ClientFiltered && watermark > 0 && oldestSmsTime(page) <= watermark {
+			result.IsComplete = true
+			break
+		}
+	}
+
+	if !result.IsComplete {
+		result.Truncated = true
+		slog.WarnContext(ctx, "conversation sync stopped at the page cap, more messages may remain", "operation", "sync_conversation", "device_id", device.ID, "type", smsType, "max_pages", maxPages)
+	}
+	return result, nil
+}
+
+// oldestSmsTime returns the smallest timestamp in a page of phone SMS items.
+func oldestSmsTime(items []phoneclient.SmsItem) int64 {
+	var oldest int64
+	for i, item := range items {
+		if i == 0 || item.Date < oldest {
+			oldest = item.Date
+		}
+	}
+	return oldest
+}
+
+// smsStore inserts SMS items reported by the phone. One is used per sync, so
+// the blocklist is loaded at most once, and only when there is something new.
+type smsStore struct {
+	s               *SyncService
+	device          *models.Device
+	repo            *repository.SmsRepository
+	contactRepo     *repository.ContactRepository
+	dedupWindow     int64
+	blocklist       []models.Blocklist
+	blocklistLoaded bool
+	pushed          bool // Items were pushed by the phone rather than fetched
+}
+
+func (s *SyncService) newSmsStore(device *models.Device) *smsStore {
+	return &smsStore{
+		s:           s,
+		device:      device,
+		repo:        repository.NewSmsRepository(s.engine),
+		contactRepo: repository.NewContactRepository(s.engine),
+		dedupWindow: smsDedupWindow.Load(),
+	}
+}
+
+// store inserts the items that aren't stored yet (soft-deleted ones included,
+// so messages the user deleted don't come back), applying the dedup window and
+// blocklist and ensuring a hidden contact for each number. Messages a delete
+// entry drops are stored as deleted tombstones without their body, so they
+// are only counted once. New visible messages are published as events, and
+// received ones notified and forwarded. Counts are added to result. Returns
+// how many items were new; an insert failure is logged rather than returned,
+// as one bad page shouldn't end a sync.
+func (st *smsStore) store(ctx context.Context, items []phoneclient.SmsItem, result *SyncResult) (int, error) {
+	device := st.device
+	// Check which items are new in a single query (including soft-deleted records)
+	// This prevents re-syncing messages that user has deleted
+	keys := make([]repository.SmsKey, len(items))
+	for i, item := range items {
+		keys[i] = repository.SmsKey{Address: item.Number, SmsTime: item.Date, Type: item.Type}
+	}
+	newKeys, err := st.repo.FilterNewSms(device.ID, keys)
+	if err != nil {
+		slog.ErrorContext(ctx, "check existing SMS failed", "operation", "sync_sms", "device_id", device.ID, "error", err)
+		return 0, err
+	}
+	isNew := make(map[repository.SmsKey]bool, len(newKeys))
+	for _, key := range newKeys {
+		isNew[key] = true
+	}
+
+	var newItems, tombstones []*models.SmsMessage
+	var contactNames []string // Parallel to newItems, for webhook payloads
+	for i, item := range items {
+		if !isNew[keys[i]] {
+			st.updateDeliveryStatus(ctx, item, result)
+			continue
+		}
+		// Consume the key so a duplicate within the same page isn't inserted twice
+		delete(isNew, keys[i])
+
+		sms := &models.SmsMessage{
+			DeviceID:    device.ID,
+			Address:     item.Number,
+			Name:        item.Name,
+			Body:        item.Content,
+			Type:        item.Type,
+			SimID:       item.SimID,
+			SmsTime:     item.Date,
+			Attachments: item.Attachments,
+			Pushed:      st.pushed,
+		}
+		if sms.Type == 2 {
+			sms.DeliveryStatus = item.DeliveryStatus()
+		}
+		if st.dedupWindow > 0 && isNearDuplicate(st.repo, sms, newItems, st.dedupWindow) {
+			continue
+		}
+		if !st.blocklistLoaded && sms.Type == 1 {
+			st.blocklist = st.s.activeBlocklist(device.ID)
+			st.blocklistLoaded = true
+		}
+		switch blockAction(st.blocklist, sms) {
+		case models.BlockActionDelete:
+			// Kept as an empty, deleted tombstone so later syncs know it
+			// instead of dropping (and counting) it again
+			result.Blocked++
+			sms.Body, sms.Attachments, sms.Blocked = "", nil, true
+			tombstones = append(tombstones, sms)
+			continue
+		case models.BlockActionHide:
+			sms.Blocked = true
+		}
+
+		// Ensure hidden contact exists for this phone number
+		// This will create a hidden contact if it doesn't exist
+		// If it exists (hidden or not), it will just return the existing one
+		contactName := item.Name
+		contact, err := st.contactRepo.EnsureHiddenContact(device.ID, item.Number, item.Name)
+		if err != nil {
+			slog.ErrorContext(ctx, "ensure hidden contact failed", "operation", "sync_sms", "device_id", device.ID, "error", err)
+			// Continue anyway, contact creation failure shouldn't block SMS sync
+		} else {
+			contactName = contact.Name
+		}
+		contactNames = append(contactNames, contactName)
+		newItems = append(newItems, sms)
+	}
+	if len(tombstones) > 0 {
+		if err := st.repo.InsertDeleted(tombstones); err != nil {
+			slog.ErrorContext(ctx, "insert blocked SMS tombstones failed", "operation", "sync_sms", "device_id", device.ID, "error", err)
+		}
+	}
+	if len(newItems) == 0 {
+		return len(tombstones), nil
+	}
+
+	// Save new items
+	inserted, err := st.repo.InsertBatch(newItems)
+	if err != nil {
+		slog.ErrorContext(ctx, "insert SMS batch failed", "operation", "sync_sms", "device_id", device.ID, "error", err)
+		return len(newItems), nil
+	}
+	result.NewCount += int(inserted)
+	metrics.SyncedRecords.WithLabelValues(metrics.DeviceLabel(device), "sms").Add(float64(inserted))
+	var rules []models.ForwardRule
+	rulesLoaded := false
+	for i, sms := range newItems {
+		if sms.Blocked {
+			continue // Hidden messages raise no events or notifications
+		}
+		PublishEvent(Event{
+			DeviceID: device.ID,
+			Kind:     "sms",
+			Address:  sms.Address,
+			Type:     sms.Type,
+			Preview:  truncatePreview(sms.Body),
+			Time:     sms.SmsTime,
+		})
+		if sms.Type == 1 {
+			if !rulesLoaded {
+				rules = st.s.activeForwardRules(device.ID)
+				rulesLoaded = true
+			}
+			notifyReceivedSms(device, sms, contactNames[i])
+			forwardReceivedSms(rules, device, sms, contactNames[i])
+		}
+	}
+	return len(newItems) + len(tombstones), nil
+}
+
+// updateDeliveryStatus applies the delivery status the phone reports for an
+// already stored sent message, counting a change in result.UpdatedCount.
+// Failures are logged: a stale status shouldn't stop a sync.
+func (st *smsStore) updateDeliveryStatus(ctx context.Context, item phoneclient.SmsItem, result *SyncResult) {
+	status := item.DeliveryStatus()
+	if item.Type != 2 || status == "" {
+		return
+	}
+	updated, err := st.repo.UpdateDeliveryStatus(st.device.ID, item.Number, item.Date, status)
+	if err != nil {
+		slog.ErrorContext(ctx, "update delivery status failed", "operation", "sync_sms", "device_id", st.device.ID, "error", err)
+		return
+	}
+	if updated {
+		result.UpdatedCount++
+	}
+}
+
+// ReceiveSms stores an SMS the phone pushed as it arrived, the same way sync
+// stores new ones: already stored messages are ignored, and the blocklist,
+// dedup window, contacts, events, notifications and forward rules all apply.
+// A push of an already stored sent message updates its delivery status.
+// Pushed messages don't advance sync's fast-path watermark, so a message
+// whose push was lost is still picked up by the next sync.
+func (s *SyncService) ReceiveSms(ctx context.Context, device *models.Device, item phoneclient.SmsItem) (*SyncResult, error) {
+	store := s.newSmsStore(device)
+	store.pushed = true
+	result := &SyncResult{IsComplete: true}
+	newItems, err := store.store(ctx, []phoneclient.SmsItem{item}, result)
+	if err != nil {
+		return nil, err
+	}
+	if newItems > result.NewCount {
+		// store only logs insert failures; the phone should hear about it and retry
+		return nil, errors.New("insert SMS failed")
+	}
+	return result, nil
+}
+
+// newestSmsTime returns the largest timestamp in a page of phone SMS items.
+func newestSmsTime(items []phoneclient.SmsItem) int64 {
+	var newest int64
+	for _, item := range items {
+		if item.Date > newest {
+			newest = item.Date
+		}
+	}
+	return newest
+}
+
 // SyncCalls performs incremental call log sync from phone.
 // callType: 0=all, 1=incoming, 2=outgoing, 3=missed
 // Phone API supports type=0 to fetch all types at once.
 // Logic: Fetch pages until all items in a page already exist in DB, or no more data.
 // Also ensures hidden contacts are created for all phone numbers.
 // IMPORTANT: Ensures contacts are synced first before syncing calls.
-func (s *SyncService) SyncCalls(device *models.Device, callType int) (*SyncResult, error) {
+// Returns immediately with Skipped set if a call sync of the device is already running.
+// opts.Force has no effect: call sync has no fast path. opts.Full keeps walking
+// past pages with nothing new. Progress can be followed through SyncProgressOf.
+func (s *SyncService) SyncCalls(ctx context.Context, device *models.Device, callType int, opts SyncOptions) (*SyncResult, error) {
+	progress := beginSync(device.ID, "calls", opts.Full)
+	if progress == nil {
+		return &SyncResult{Skipped: true}, nil
+	}
+	defer endSync(device.ID, "calls")
+
 	// Check if contacts have been synced for this device
 	// If not, sync contacts first to ensure we have accurate contact names
 	contactRepo := repository.NewContactRepository(s.engine)
 	hasSynced, err := contactRepo.HasAnySynced(device.ID)
 	if err != nil {
-		log.Printf("[SyncCalls] failed to check contacts sync status: %v", err)
+		slog.ErrorContext(ctx, "check contacts sync status failed", "operation", "sync_calls", "device_id", device.ID, "error", err)
 	} else if !hasSynced {
 		// No contacts synced yet, sync contacts first
-		log.Printf("[SyncCalls] device %d: syncing contacts first before calls sync", device.ID)
-		_, err := s.SyncContacts(device)
+		slog.InfoContext(ctx, "syncing contacts first before call sync", "operation", "sync_calls", "device_id", device.ID)
+		_, err := s.SyncContacts(ctx, device)
 		if err != nil {
-			log.Printf("[SyncCalls] device %d: failed to sync contacts: %v", device.ID, err)
+			slog.WarnContext(ctx, "contact sync before call sync failed", "operation", "sync_calls", "device_id", device.ID, "error", err)
 			// Continue anyway - calls sync can still work with hidden contacts
 		} else {
-			log.Printf("[SyncCalls] device %d: contacts synced successfully", device.ID)
+			slog.InfoContext(ctx, "contacts synced before call sync", "operation", "sync_calls", "device_id", device.ID)
 		}
 	}
 
 	client := phoneclient.NewClient(device)
 	repo := repository.NewCallRepository(s.engine)
 
-	const pageSize = 50
-	const maxPages = 100
+	pageSize, maxPages := opts.limits()
 	pageNum := 1
 	result := &SyncResult{}
 
 	// Reduced logging: only log errors and final result
 	for pageNum <= maxPages {
+		// Stop walking pages if the caller went away or the device was deleted
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
 		// Fetch from phone
-		items, err := client.QueryCalls(phoneclient.CallQueryRequest{
+		items, err := client.QueryCalls(ctx, phoneclient.CallQueryRequest{
 			Type:     callType,
 			PageNum:  pageNum,
 			PageSize: pageSize,
 		})
 		if err != nil {
-			log.Printf("[SyncCalls] device %d type %d page %d error: %v", device.ID, callType, pageNum, err)
+			slog.ErrorContext(ctx, "fetch call page failed", "operation", "sync_calls", "device_id", device.ID, "type", callType, "page", pageNum, "error", err)
 			return result, err
 		}
+		progress.page()
 
 		// No more data
 		if len(items) == 0 {
@@ -222,54 +749,73 @@ func (s *SyncService) SyncCalls(device *models.Device, callType int) (*SyncResul
 			break
 		}
 
-		var newItems []*models.CallLog
-		existingCount := 0
+		// Check which items are new in a single query (including soft-deleted records)
+		// This prevents re-syncing calls that user has deleted
+		keys := make([]repository.CallKey, len(items))
+		for i, item := range items {
+			keys[i] = repository.CallKey{Number: item.Number, CallTime: item.DateLong, Type: item.Type}
+		}
+		newKeys, err := repo.FilterNewCalls(device.ID, keys)
+		if err != nil {
+			slog.ErrorContext(ctx, "check existing calls failed", "operation", "sync_calls", "device_id", device.ID, "error", err)
+			return result, err
+		}
+		isNew := make(map[repository.CallKey]bool, len(newKeys))
+		for _, key := range newKeys {
+			isNew[key] = true
+		}
 
-		for _, item := range items {
-			// Check if exists (including soft-deleted records)
-			// This prevents re-syncing calls that user has deleted
-			exists, err := repo.ExistsIncludingDeleted(device.ID, item.Number, item.DateLong, item.Type)
-			if err != nil {
-				log.Printf("[SyncCalls] check exists error: %v", err)
+		var newItems []*models.CallLog
+		for i, item := range items {
+			if !isNew[keys[i]] {
 				continue
 			}
+			// Consume the key so a duplicate within the same page isn't inserted twice
+			delete(isNew, keys[i])
 
-			if exists {
-				existingCount++
-			} else {
-				// Ensure hidden contact exists for this phone number
-				// This will create a hidden contact if it doesn't exist
-				// If it exists (hidden or not), it will just return the existing one
-				_, err := contactRepo.EnsureHiddenContact(device.ID, item.Number, item.Name)
-				if err != nil {
-					log.Printf("[SyncCalls] ensure hidden contact error: %v", err)
-					// Continue anyway, contact creation failure shouldn't block call sync
-				}
-
-				newItems = append(newItems, &models.CallLog{
-					DeviceID: device.ID,
-					Number:   item.Number,
-					Name:     item.Name,
-					Type:     item.Type,
-					Duration: item.Duration,
-					SimID:    item.SimID,
-					CallTime: item.DateLong,
-				})
+			// Ensure hidden contact exists for this phone number
+			// This will create a hidden contact if it doesn't exist
+			// If it exists (hidden or not), it will just return the existing one
+			_, err := contactRepo.EnsureHiddenContact(device.ID, item.Number, item.Name)
+			if err != nil {
+				slog.ErrorContext(ctx, "ensure hidden contact failed", "operation", "sync_calls", "device_id", device.ID, "error", err)
+				// Continue anyway, contact creation failure shouldn't block call sync
 			}
+
+			newItems = append(newItems, &models.CallLog{
+				DeviceID: device.ID,
+				Number:   item.Number,
+				Name:     item.Name,
+				Type:     item.Type,
+				Duration: item.Duration,
+				SimID:    item.SimID,
+				CallTime: item.DateLong,
+			})
 		}
 
 		// Save new items
 		if len(newItems) > 0 {
 			inserted, err := repo.InsertBatch(newItems)
 			if err != nil {
-				log.Printf("[SyncCalls] insert batch error: %v", err)
+				slog.ErrorContext(ctx, "insert call batch failed", "operation", "sync_calls", "device_id", device.ID, "error", err)
 			} else {
 				result.NewCount += int(inserted)
+				progress.inserted(int(inserted))
+				metrics.SyncedRecords.WithLabelValues(metrics.DeviceLabel(device), "call").Add(float64(inserted))
+				for _, call := range newItems {
+					PublishEvent(Event{
+						DeviceID: device.ID,
+						Kind:     "call",
+						Address:  call.Number,
+						Type:     call.Type,
+						Time:     call.CallTime,
+					})
+				}
 			}
 		}
 
 		// Stop only when ALL items in this page already exist (no new data to sync)
-		if len(newItems) == 0 {
+		if len(newItems) == 0 && !opts.Full {
 			result.IsComplete = true
 			break
 		}
@@ -278,29 +824,46 @@ func (s *SyncService) SyncCalls(device *models.Device, callType int) (*SyncResul
 		pageNum++
 	}
 
+	// The loop only ends without a break when it ran out of pages
+	if !result.IsComplete {
+		result.Truncated = true
+		slog.WarnContext(ctx, "call sync stopped at the page cap, more calls may remain", "operation", "sync_calls", "device_id", device.ID, "type", callType, "max_pages", maxPages)
+	}
+
 	// Only log if there were new calls
 	if result.NewCount > 0 {
-		log.Printf("[SyncCalls] device %d type %d: synced %d new calls", device.ID, callType, result.NewCount)
+		slog.InfoContext(ctx, "calls synced", "operation", "sync_calls", "device_id", device.ID, "type", callType, "new", result.NewCount)
 	}
+	s.markSynced(device, "calls", result)
 	return result, nil
 }
 
 // SyncContacts performs full contact sync from phone.
 // Since phone API doesn't support pagination, we do full sync.
-func (s *SyncService) SyncContacts(device *models.Device) (*SyncResult, error) {
+// Returns immediately with Skipped set if a contact sync of the device is already running.
+func (s *SyncService) SyncContacts(ctx context.Context, device *models.Device) (*SyncResult, error) {
+	if beginSync(device.ID, "contacts", false) == nil {
+		return &SyncResult{Skipped: true}, nil
+	}
+	defer endSync(device.ID, "contacts")
+
 	client := phoneclient.NewClient(device)
 	repo := repository.NewContactRepository(s.engine)
 
 	result := &SyncResult{}
 
 	// Fetch all contacts from phone
-	items, err := client.QueryContacts(phoneclient.ContactQueryRequest{})
+	items, err := client.QueryContacts(ctx, phoneclient.ContactQueryRequest{})
 	if err != nil {
-		log.Printf("[SyncContacts] device %d error: %v", device.ID, err)
+		slog.ErrorContext(ctx, "fetch contacts failed", "operation", "sync_contacts", "device_id", device.ID, "error", err)
 		return result, err
 	}
 
 	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
 		contact := &models.Contact{
 			DeviceID: device.ID,
 			Name:     item.Name,
@@ -309,7 +872,7 @@ func (s *SyncService) SyncContacts(device *models.Device) (*SyncResult, error) {
 
 		isNew, err := repo.Upsert(contact)
 		if err != nil {
-			log.Printf("[SyncContacts] upsert error: %v", err)
+			slog.ErrorContext(ctx, "upsert contact failed", "operation", "sync_contacts", "device_id", device.ID, "error", err)
 			continue
 		}
 
@@ -323,7 +886,8 @@ func (s *SyncService) SyncContacts(device *models.Device) (*SyncResult, error) {
 	result.IsComplete = true
 	// Only log if there were changes
 	if result.NewCount > 0 || result.UpdatedCount > 0 {
-		log.Printf("[SyncContacts] device %d: synced %d new, %d updated", device.ID, result.NewCount, result.UpdatedCount)
+		slog.InfoContext(ctx, "contacts synced", "operation", "sync_contacts", "device_id", device.ID, "new", result.NewCount, "updated", result.UpdatedCount)
 	}
+	s.markSynced(device, "contacts", result)
 	return result, nil
 }
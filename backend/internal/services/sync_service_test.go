@@ -0,0 +1,502 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+	"backend/internal/repository"
+
+	"xorm.io/xorm"
+)
+
+func TestSyncSmsFastPathSkipsUnchangedPhone(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+
+	// 120 received messages on the phone, newest first
+	for i := 0; i < 120; i++ {
+		fp.sms = append(fp.sms, phoneclient.SmsItem{
+			Number:  "10086",
+			Content: "msg",
+			Type:    1,
+			Date:    int64(1700000000000 - i*1000),
+		})
+	}
+	// Mark contacts as synced so SyncSms doesn't trigger a contact sync
+	engine.Insert(&models.Contact{DeviceID: device.ID, Name: "10086", Phone: "10086", IsHidden: true})
+
+	service := NewSyncService(engine)
+	ctx := context.Background()
+
+	// Initial sync stores everything
+	result, err := service.SyncSms(ctx, device, 1, SyncOptions{})
+	if err != nil {
+		t.Fatalf("initial sync failed: %v", err)
+	}
+	if result.NewCount != 120 {
+		t.Fatalf("Expected 120 new messages, got %d", result.NewCount)
+	}
+
+	counter := &queryCounter{}
+	engine.AddHook(counter)
+
+	// Nothing changed on the phone: fast path
+	counter.reset()
+	result, err = service.SyncSms(ctx, device, 1, SyncOptions{})
+	if err != nil {
+		t.Fatalf("fast sync failed: %v", err)
+	}
+	if result.NewCount != 0 || !result.IsComplete {
+		t.Fatalf("Expected complete sync with 0 new, got %+v", result)
+	}
+	fastQueries := counter.count()
+
+	// Forced deep walk checks the first page with one batched existence query
+	counter.reset()
+	result, err = service.SyncSms(ctx, device, 1, SyncOptions{Force: true})
+	if err != nil {
+		t.Fatalf("forced sync failed: %v", err)
+	}
+	if result.NewCount != 0 || !result.IsComplete {
+		t.Fatalf("Expected complete forced sync with 0 new, got %+v", result)
+	}
+	forcedQueries := counter.count()
+
+	t.Logf("no-change sync: fast path %d queries, forced %d queries", fastQueries, forcedQueries)
+	if fastQueries > forcedQueries {
+		t.Errorf("Expected fast path to use no more queries than forced sync (%d > %d)", fastQueries, forcedQueries)
+	}
+	// Existence checks are batched per page, not issued per item
+	if forcedQueries > 3 {
+		t.Errorf("Expected a constant number of queries for a 50-item page, got %d", forcedQueries)
+	}
+
+	// A new message on the phone is still picked up without forcing
+	fp.mu.Lock()
+	fp.sms = append([]phoneclient.SmsItem{{Number: "10010", Content: "new", Type: 1, Date: 1700000001000}}, fp.sms...)
+	fp.mu.Unlock()
+	result, err = service.SyncSms(ctx, device, 1, SyncOptions{})
+	if err != nil {
+		t.Fatalf("sync after new message failed: %v", err)
+	}
+	if result.NewCount != 1 {
+		t.Errorf("Expected 1 new message, got %d", result.NewCount)
+	}
+}
+
+func TestSyncSmsStoresAttachments(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+	engine.Insert(&models.Contact{DeviceID: device.ID, Name: "10086", Phone: "10086", IsHidden: true})
+
+	fp.sms = []phoneclient.SmsItem{
+		{
+			Number:      "10086",
+			Content:     "photo",
+			Type:        1,
+			Date:        1700000002000,
+			Attachments: []models.SmsAttachment{{URL: "content://mms/part/1", ContentType: "image/jpeg"}},
+		},
+		{Number: "10086", Content: "plain", Type: 1, Date: 1700000001000},
+	}
+
+	if _, err := NewSyncService(engine).SyncSms(context.Background(), device, 1, SyncOptions{}); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	items, _, err := repository.NewSmsRepository(engine).FindByDevice(device.ID, 0, 1, 10, "", repository.ListOptions{})
+	if err != nil {
+		t.Fatalf("FindByDevice failed: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(items))
+	}
+	if len(items[0].Attachments) != 1 || items[0].Attachments[0].ContentType != "image/jpeg" {
+		t.Errorf("Expected MMS attachment to round-trip, got %+v", items[0].Attachments)
+	}
+	if len(items[1].Attachments) != 0 {
+		t.Errorf("Expected plain SMS without attachments, got %+v", items[1].Attachments)
+	}
+}
+
+func TestSyncDoesNotReinsertDeletedRecords(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+	engine.Insert(&models.Contact{DeviceID: device.ID, Name: "10086", Phone: "10086", IsHidden: true})
+
+	fp.sms = []phoneclient.SmsItem{{Number: "10086", Content: "delete me", Type: 1, Date: 1700000000000}}
+	fp.calls = []phoneclient.CallItem{{Number: "10086", Type: 3, DateLong: 1700000000000}}
+
+	service := NewSyncService(engine)
+	ctx := context.Background()
+	if _, err := service.SyncSms(ctx, device, 1, SyncOptions{}); err != nil {
+		t.Fatalf("sms sync failed: %v", err)
+	}
+	if _, err := service.SyncCalls(ctx, device, 0, SyncOptions{}); err != nil {
+		t.Fatalf("call sync failed: %v", err)
+	}
+
+	// User deletes both records; the phone still has them
+	if _, err := engine.Where("device_id = ?", device.ID).Delete(&models.SmsMessage{}); err != nil {
+		t.Fatalf("delete sms: %v", err)
+	}
+	if _, err := engine.Where("device_id = ?", device.ID).Delete(&models.CallLog{}); err != nil {
+		t.Fatalf("delete call: %v", err)
+	}
+
+	smsResult, err := service.SyncSms(ctx, device, 1, SyncOptions{Force: true})
+	if err != nil {
+		t.Fatalf("forced sms sync failed: %v", err)
+	}
+	callResult, err := service.SyncCalls(ctx, device, 0, SyncOptions{})
+	if err != nil {
+		t.Fatalf("call resync failed: %v", err)
+	}
+	if smsResult.NewCount != 0 || callResult.NewCount != 0 {
+		t.Errorf("Expected deleted records not to be re-synced, got sms=%d calls=%d", smsResult.NewCount, callResult.NewCount)
+	}
+
+	visible, _ := engine.Count(&models.SmsMessage{DeviceID: device.ID})
+	all, _ := engine.Unscoped().Count(&models.SmsMessage{DeviceID: device.ID})
+	if visible != 0 || all != 1 {
+		t.Errorf("Expected 1 soft-deleted sms and none visible, got visible=%d all=%d", visible, all)
+	}
+	visible, _ = engine.Count(&models.CallLog{DeviceID: device.ID})
+	all, _ = engine.Unscoped().Count(&models.CallLog{DeviceID: device.ID})
+	if visible != 0 || all != 1 {
+		t.Errorf("Expected 1 soft-deleted call and none visible, got visible=%d all=%d", visible, all)
+	}
+}
+
+func TestSyncRecordsLastSyncTime(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+	fp.contacts = append(fp.contacts, phoneclient.ContactItem{Name: "Alice", PhoneNumber: "111"})
+
+	service := NewSyncService(engine)
+	result, err := service.SyncContacts(context.Background(), device)
+	if err != nil {
+		t.Fatalf("SyncContacts failed: %v", err)
+	}
+	if result.SyncedAt == nil {
+		t.Fatalf("Expected the sync result to carry the sync time")
+	}
+
+	var stored models.Device
+	engine.ID(device.ID).Get(&stored)
+	if stored.ContactsSyncedAt == nil || stored.SmsSyncedAt != nil || stored.CallsSyncedAt != nil {
+		t.Errorf("Expected only contacts_synced_at to be set, got sms=%v calls=%v contacts=%v",
+			stored.SmsSyncedAt, stored.CallsSyncedAt, stored.ContactsSyncedAt)
+	}
+
+	if _, err := service.SyncCalls(context.Background(), device, 0, SyncOptions{}); err != nil {
+		t.Fatalf("SyncCalls failed: %v", err)
+	}
+	engine.ID(device.ID).Get(&stored)
+	if stored.CallsSyncedAt == nil {
+		t.Errorf("Expected calls_synced_at after a call sync")
+	}
+}
+
+func TestSyncSkipsWhenAlreadyRunning(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+
+	if beginSync(device.ID, "contacts", false) == nil {
+		t.Fatalf("Expected to claim an idle sync")
+	}
+	result, err := NewSyncService(engine).SyncContacts(context.Background(), device)
+	endSync(device.ID, "contacts")
+	if err != nil || !result.Skipped {
+		t.Fatalf("Expected the overlapping sync to be skipped, got %+v err=%v", result, err)
+	}
+	if hits := fp.hitCount("/contact/query"); hits != 0 {
+		t.Errorf("Expected no phone requests for a skipped sync, got %d", hits)
+	}
+
+	result, err = NewSyncService(engine).SyncContacts(context.Background(), device)
+	if err != nil || result.Skipped || fp.hitCount("/contact/query") != 1 {
+		t.Errorf("Expected a sync after release to run, got %+v err=%v", result, err)
+	}
+}
+
+func TestSyncSmsFuzzyDedup(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+	engine.Insert(&models.Contact{DeviceID: device.ID, Name: "10086", Phone: "10086", IsHidden: true})
+
+	// The same message reported twice, 3ms apart, plus a genuine repeat later on
+	fp.sms = []phoneclient.SmsItem{
+		{Number: "10086", Content: "code 1234", Type: 1, Date: 1700000060000},
+		{Number: "10086", Content: "code 1234", Type: 1, Date: 1700000000003},
+		{Number: "10086", Content: "code 1234", Type: 1, Date: 1700000000000},
+	}
+	service := NewSyncService(engine)
+
+	// Exact keys only by default: all three are kept
+	result, err := service.SyncSms(context.Background(), device, 1, SyncOptions{})
+	if err != nil || result.NewCount != 3 {
+		t.Fatalf("Expected 3 messages without fuzzy dedup, got %+v, %v", result, err)
+	}
+
+	engine.Unscoped().Where("device_id = ?", device.ID).Delete(&models.SmsMessage{})
+	SetSmsDedupWindow(2 * time.Second)
+	defer SetSmsDedupWindow(0)
+	result, err = service.SyncSms(context.Background(), device, 1, SyncOptions{})
+	if err != nil || result.NewCount != 2 {
+		t.Fatalf("Expected the near-identical pair to collapse, got %+v, %v", result, err)
+	}
+
+	// A later report of the same message with yet another timestamp matches the stored one
+	fp.sms = append([]phoneclient.SmsItem{{Number: "10086", Content: "code 1234", Type: 1, Date: 1700000060900}}, fp.sms...)
+	result, err = service.SyncSms(context.Background(), device, 1, SyncOptions{Force: true})
+	if err != nil || result.NewCount != 0 {
+		t.Errorf("Expected a near-duplicate of a stored message to be skipped, got %+v, %v", result, err)
+	}
+}
+
+func TestSyncMarksTruncatedAtPageCap(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+	engine.Insert(&models.Contact{DeviceID: device.ID, Name: "10086", Phone: "10086", IsHidden: true})
+	for i := 0; i < 25; i++ {
+		fp.sms = append(fp.sms, phoneclient.SmsItem{Number: "10086", Content: "msg", Type: 1, Date: int64(1700000000000 - i*1000)})
+		fp.calls = append(fp.calls, phoneclient.CallItem{Number: "10086", Type: 1, DateLong: int64(1700000000000 - i*1000)})
+	}
+	service := NewSyncService(engine)
+	ctx := context.Background()
+
+	limits := SyncOptions{PageSize: 10, MaxPages: 2}
+	result, err := service.SyncSms(ctx, device, 1, limits)
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if result.NewCount != 20 || !result.Truncated || result.IsComplete {
+		t.Fatalf("Expected 20 new and truncated at 2 pages of 10, got %+v", result)
+	}
+	if result, err = service.SyncSms(ctx, device, 2, limits); err != nil || result.Truncated {
+		t.Errorf("Expected a sync that runs out of data untruncated, got %+v, %v", result, err)
+	}
+
+	SetSyncLimits(10, 1)
+	defer SetSyncLimits(0, 0)
+	result, err = service.SyncCalls(ctx, device, 0, SyncOptions{})
+	if err != nil {
+		t.Fatalf("call sync failed: %v", err)
+	}
+	if result.NewCount != 10 || !result.Truncated {
+		t.Errorf("Expected the configured limits to cap calls at 10, got %+v", result)
+	}
+}
+
+func TestFullSyncWalksPastStoredPages(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+	engine.Insert(&models.Contact{DeviceID: device.ID, Name: "10086", Phone: "10086", IsHidden: true})
+	for i := 0; i < 30; i++ {
+		fp.sms = append(fp.sms, phoneclient.SmsItem{Number: "10086", Content: "msg", Type: 1, Date: int64(1700000000000 - i*1000)})
+	}
+	// The device was re-added: only the newest 10 messages are stored
+	for _, item := range fp.sms[:10] {
+		engine.Insert(&models.SmsMessage{DeviceID: device.ID, Address: item.Number, Body: item.Content, Type: 1, SmsTime: item.Date})
+	}
+	service := NewSyncService(engine)
+	ctx := context.Background()
+
+	result, err := service.SyncSms(ctx, device, 1, SyncOptions{Force: true, PageSize: 10})
+	if err != nil || result.NewCount != 0 {
+		t.Fatalf("Expected an incremental sync to stop at the stored page, got %+v, %v", result, err)
+	}
+	result, err = service.SyncSms(ctx, device, 1, SyncOptions{Full: true, PageSize: 10})
+	if err != nil {
+		t.Fatalf("full sync failed: %v", err)
+	}
+	if result.NewCount != 20 || !result.IsComplete || result.Truncated {
+		t.Errorf("Expected a full sync to store the 20 older messages, got %+v", result)
+	}
+	if running := SyncProgressOf(device.ID); len(running) != 0 {
+		t.Errorf("Expected no running syncs afterwards, got %+v", running)
+	}
+}
+
+func TestSyncProgressOfRunningSync(t *testing.T) {
+	progress := beginSync(42, "calls", true)
+	if progress == nil {
+		t.Fatal("Expected to claim an idle sync")
+	}
+	defer endSync(42, "calls")
+	progress.page()
+	progress.page()
+	progress.inserted(7)
+
+	running := SyncProgressOf(42)
+	if len(running) != 1 || running[0].Kind != "calls" || !running[0].Full || running[0].Pages != 2 || running[0].NewCount != 7 {
+		t.Errorf("Unexpected progress %+v", running)
+	}
+}
+
+func TestReceiveSmsKeepsSyncFallback(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+	engine.Insert(&models.Contact{DeviceID: device.ID, Name: "10086", Phone: "10086", IsHidden: true})
+	service := NewSyncService(engine)
+	ctx := context.Background()
+
+	fp.sms = []phoneclient.SmsItem{{Number: "10086", Content: "old", Type: 1, Date: 1700000000000}}
+	if _, err := service.SyncSms(ctx, device, 1, SyncOptions{}); err != nil {
+		t.Fatalf("initial sync failed: %v", err)
+	}
+
+	// Two new messages arrive but only the newer one's push gets through
+	lost := phoneclient.SmsItem{Number: "10086", Content: "lost", Type: 1, Date: 1700000001000}
+	pushed := phoneclient.SmsItem{Number: "10086", Content: "pushed", Type: 1, Date: 1700000002000}
+	fp.mu.Lock()
+	fp.sms = append([]phoneclient.SmsItem{pushed, lost}, fp.sms...)
+	fp.mu.Unlock()
+
+	result, err := service.ReceiveSms(ctx, device, pushed)
+	if err != nil || result.NewCount != 1 {
+		t.Fatalf("Expected the push stored, got %+v %v", result, err)
+	}
+	if result, _ := service.ReceiveSms(ctx, device, pushed); result.NewCount != 0 {
+		t.Errorf("Expected a repeated push to be ignored, got %+v", result)
+	}
+
+	result, err = service.SyncSms(ctx, device, 1, SyncOptions{})
+	if err != nil {
+		t.Fatalf("sync after push failed: %v", err)
+	}
+	if result.NewCount != 1 {
+		t.Errorf("Expected sync to pick up the message whose push was lost, got %+v", result)
+	}
+	var stored models.SmsMessage
+	if has, _ := engine.Where("body = ?", "pushed").Get(&stored); !has || !stored.Pushed {
+		t.Errorf("Expected the pushed message flagged, got %+v", stored)
+	}
+}
+
+func TestSyncUpdatesDeliveryStatus(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+	engine.Insert(&models.Contact{DeviceID: device.ID, Name: "10086", Phone: "10086", IsHidden: true})
+	service := NewSyncService(engine)
+	ctx := context.Background()
+
+	fp.sms = []phoneclient.SmsItem{{Number: "10086", Content: "hi", Type: 2, Date: 1700000000000}}
+	if _, err := service.SyncSms(ctx, device, 2, SyncOptions{}); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	var sms models.SmsMessage
+	engine.Where("device_id = ?", device.ID).Get(&sms)
+	if sms.DeliveryStatus != models.DeliveryStatusSent {
+		t.Fatalf("Expected a sent message without a report to be sent, got %q", sms.DeliveryStatus)
+	}
+
+	// The phone reports delivery afterwards
+	delivered := 0
+	fp.mu.Lock()
+	fp.sms[0].Status = &delivered
+	fp.mu.Unlock()
+	result, err := service.SyncSms(ctx, device, 2, SyncOptions{Force: true})
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	var updated models.SmsMessage
+	engine.ID(sms.ID).Get(&updated)
+	if result.UpdatedCount != 1 || updated.DeliveryStatus != models.DeliveryStatusDelivered {
+		t.Errorf("Expected the report applied, got %+v and %q", result, updated.DeliveryStatus)
+	}
+}
+
+func TestSyncConversation(t *testing.T) {
+	// 40 messages alternating between two numbers, received and sent, newest first
+	fill := func(fp *fakePhone) {
+		for i := 0; i < 40; i++ {
+			number, smsType := "10086", 1
+			if i%2 == 1 {
+				number = "10010"
+			}
+			if i%4 >= 2 {
+				smsType = 2
+			}
+			fp.sms = append(fp.sms, phoneclient.SmsItem{Number: number, Content: "msg", Type: smsType, Date: int64(1700000000000 - i*1000)})
+		}
+	}
+	stored := func(engine *xorm.Engine, device *models.Device, address string) int64 {
+		n, _ := engine.Where("device_id = ? AND address = ?", device.ID, address).Count(&models.SmsMessage{})
+		return n
+	}
+	ctx := context.Background()
+	opts := SyncOptions{PageSize: 5}
+
+	t.Run("phone filters by number", func(t *testing.T) {
+		engine := newTestEngine(t)
+		fp, device := newFakePhone(t, engine)
+		fp.keywordFilter = true
+		fill(fp)
+
+		service := NewSyncService(engine)
+		result, err := service.SyncConversation(ctx, device, "+8610086", opts)
+		if err != nil || result.NewCount != 20 || !result.IsComplete || result.ClientFiltered {
+			t.Fatalf("Expected the 20 messages with 10086 from filtered pages, got %+v, %v", result, err)
+		}
+		if n := stored(engine, device, "10010"); n != 0 {
+			t.Errorf("Expected no messages of other numbers, got %d", n)
+		}
+		if hits := fp.hitCount("/sms/query"); hits > 10 {
+			t.Errorf("Expected only filtered pages to be fetched, got %d queries", hits)
+		}
+		if result, err = service.SyncConversation(ctx, device, "10086", opts); err != nil || result.NewCount != 0 || !result.IsComplete {
+			t.Errorf("Expected a repeat sync to find nothing new, got %+v, %v", result, err)
+		}
+	})
+
+	t.Run("phone matches the keyword against content only", func(t *testing.T) {
+		engine := newTestEngine(t)
+		fp, device := newFakePhone(t, engine)
+		fp.keywordFilter, fp.keywordContentOnly = true, true
+		fill(fp)
+
+		// The filtered page is empty, which must not pass for an empty conversation
+		result, err := NewSyncService(engine).SyncConversation(ctx, device, "10086", opts)
+		if err != nil || result.NewCount != 20 || !result.IsComplete || !result.ClientFiltered {
+			t.Fatalf("Expected the 20 messages with 10086 from unfiltered pages, got %+v, %v", result, err)
+		}
+	})
+
+	t.Run("phone ignores the keyword", func(t *testing.T) {
+		engine := newTestEngine(t)
+		fp, device := newFakePhone(t, engine)
+		fill(fp)
+
+		service := NewSyncService(engine)
+		result, err := service.SyncConversation(ctx, device, "10086", opts)
+		if err != nil || result.NewCount != 20 || !result.IsComplete || !result.ClientFiltered {
+			t.Fatalf("Expected the 20 messages with 10086 from unfiltered pages, got %+v, %v", result, err)
+		}
+		if n := stored(engine, device, "10010"); n != 0 {
+			t.Errorf("Expected no messages of other numbers, got %d", n)
+		}
+
+		// After an SMS sync, only pages newer than the stored messages are searched
+		engine.Insert(&models.Contact{DeviceID: device.ID, Name: "10010", Phone: "10010", IsHidden: true})
+		if _, err := service.SyncSms(ctx, device, 0, SyncOptions{}); err != nil {
+			t.Fatalf("sms sync failed: %v", err)
+		}
+		fp.mu.Lock()
+		fp.sms = append([]phoneclient.SmsItem{{Number: "10010", Content: "new", Type: 1, Date: 1700000001000}}, fp.sms...)
+		fp.mu.Unlock()
+		before := fp.hitCount("/sms/query")
+		result, err = service.SyncConversation(ctx, device, "10086", opts)
+		if err != nil || result.NewCount != 0 || !result.IsComplete {
+			t.Fatalf("Expected nothing new with 10086, got %+v, %v", result, err)
+		}
+		// Per type: the keyword probe and one unfiltered page
+		if hits := fp.hitCount("/sms/query") - before; hits > 4 {
+			t.Errorf("Expected the walk to stop at stored messages, got %d queries", hits)
+		}
+	})
+}
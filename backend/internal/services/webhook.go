@@ -0,0 +1,218 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backend/internal/models"
+)
+
+// WebhookSignatureHeader carries the hex HMAC-SHA256 of the request body,
+// prefixed with "sha256=", when a webhook secret is configured.
+const WebhookSignatureHeader = "X-SMServer-Signature"
+
+// webhookQueueSize is how many deliveries may wait for a worker before
+// further notifications are dropped.
+const webhookQueueSize = 256
+
+// webhookWorkers is how many deliveries run at once, so a target that is down
+// and being retried doesn't hold up notifications to the others.
+const webhookWorkers = 4
+
+// WebhookOptions configures the notifier for newly received SMS.
+type WebhookOptions struct {
+	URL          string        // Target URL (empty = disabled)
+	Secret       string        // HMAC key for the signature header (empty = unsigned)
+	MaxRetries   int           // Retries after the first attempt for failed deliveries (0=no retry)
+	RetryBackoff time.Duration // Delay before the first retry, doubled after each retry
+	Timeout      time.Duration // Per-attempt HTTP timeout
+}
+
+// WebhookPayload is the JSON body posted for a newly received SMS.
+type WebhookPayload struct {
+	Event       string `json:"event"` // sms.received
+	DeviceID    int64  `json:"device_id"`
+	DeviceName  string `json:"device_name"`
+	Address     string `json:"address"`      // Sender phone number
+	ContactName string `json:"contact_name"` // Contact name, or the number if unknown
+	Body        string `json:"body"`
+	SimID       int    `json:"sim_id"`            // 0=SIM1, 1=SIM2, -1=unknown
+	Time        int64  `json:"time"`              // SMS timestamp in milliseconds
+	RuleID      int64  `json:"rule_id,omitempty"` // Forward rule that matched, absent for the default webhook
+}
+
+// webhookTarget is a destination for webhook deliveries.
+type webhookTarget struct {
+	URL    string
+	Secret string
+}
+
+type webhookJob struct {
+	target  webhookTarget
+	payload interface{} // WebhookPayload or AlertPayload
+}
+
+var webhook = struct {
+	sync.RWMutex
+	opts    WebhookOptions
+	queue   chan webhookJob
+	once    sync.Once
+	pending atomic.Int64 // Queued or in-flight deliveries
+}{
+	opts: WebhookOptions{
+		MaxRetries:   3,
+		RetryBackoff: time.Second,
+		Timeout:      10 * time.Second,
+	},
+	queue: make(chan webhookJob, webhookQueueSize),
+}
+
+// SetWebhook replaces the process-wide webhook options. Call once at startup.
+func SetWebhook(opts WebhookOptions) {
+	webhook.Lock()
+	defer webhook.Unlock()
+	webhook.opts = opts
+}
+
+func currentWebhookOptions() WebhookOptions {
+	webhook.RLock()
+	defer webhook.RUnlock()
+	return webhook.opts
+}
+
+// notifyReceivedSms queues a webhook for a newly synced received SMS.
+// It never blocks the sync: if no webhook is configured nothing happens, and if
+// the queue is full the notification is dropped and logged.
+func notifyReceivedSms(device *models.Device, sms *models.SmsMessage, contactName string) {
+	opts := currentWebhookOptions()
+	if opts.URL == "" {
+		return
+	}
+	enqueueWebhook(webhookTarget{URL: opts.URL, Secret: opts.Secret}, receivedSmsPayload(device, sms, contactName))
+}
+
+// receivedSmsPayload builds the webhook body for a received SMS.
+func receivedSmsPayload(device *models.Device, sms *models.SmsMessage, contactName string) WebhookPayload {
+	if contactName == "" {
+		contactName = sms.Address
+	}
+	return WebhookPayload{
+		Event:       "sms.received",
+		DeviceID:    device.ID,
+		DeviceName:  device.Name,
+		Address:     sms.Address,
+		ContactName: contactName,
+		Body:        sms.Body,
+		SimID:       sms.SimID,
+		Time:        sms.SmsTime,
+	}
+}
+
+// enqueueWebhook hands a delivery to the background workers, starting them on first use.
+func enqueueWebhook(target webhookTarget, payload interface{}) {
+	webhook.once.Do(func() {
+		for i := 0; i < webhookWorkers; i++ {
+			go runWebhookWorker()
+		}
+	})
+	webhook.pending.Add(1)
+	select {
+	case webhook.queue <- webhookJob{target: target, payload: payload}:
+	default:
+		webhook.pending.Add(-1)
+		log.Printf("[Webhook] queue full, dropping notification to %s", target.URL)
+	}
+}
+
+// runWebhookWorker delivers queued webhooks. Deliveries run concurrently
+// across workers, so they may arrive out of order.
+func runWebhookWorker() {
+	for job := range webhook.queue {
+		if err := deliverWebhook(job.target, job.payload, currentWebhookOptions()); err != nil {
+			log.Printf("[Webhook] delivery to %s failed: %v", job.target.URL, err)
+		}
+		webhook.pending.Add(-1)
+	}
+}
+
+// FlushWebhooks waits for queued and in-flight webhook deliveries to finish, or
+// for ctx to end. Call it on shutdown once nothing else queues notifications.
+func FlushWebhooks(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		n := webhook.pending.Load()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d webhook deliveries not finished: %w", n, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverWebhook posts the payload to the target, retrying network errors,
+// 429 and 5xx responses up to opts.MaxRetries times.
+func deliverWebhook(target webhookTarget, payload interface{}, opts WebhookOptions) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+	client := &http.Client{Timeout: opts.Timeout}
+	backoff := opts.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		retryable, err := postWebhook(client, target, body)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= opts.MaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// postWebhook makes one delivery attempt and reports whether a failure is worth retrying.
+func postWebhook(client *http.Client, target webhookTarget, body []byte) (retryable bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if target.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+signWebhook(target.Secret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+// signWebhook returns the hex HMAC-SHA256 of body keyed by secret.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/phoneclient"
+)
+
+func TestSyncNotifiesWebhookForReceivedSms(t *testing.T) {
+	engine := newTestEngine(t)
+	fp, device := newFakePhone(t, engine)
+	engine.Insert(&models.Contact{DeviceID: device.ID, Name: "Carrier", Phone: "10086"})
+	fp.sms = []phoneclient.SmsItem{
+		{Number: "10086", Content: "your code is 1234", Type: 1, SimID: 1, Date: 1700000000000},
+		{Number: "10010", Content: "outgoing", Type: 2, Date: 1700000001000},
+	}
+
+	received := make(chan *http.Request, 4)
+	bodies := make(chan []byte, 4)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer hook.Close()
+
+	SetWebhook(WebhookOptions{URL: hook.URL, Secret: "s3cret", Timeout: time.Second})
+	defer SetWebhook(WebhookOptions{})
+
+	if _, err := NewSyncService(engine).SyncSms(context.Background(), device, 0, SyncOptions{}); err != nil {
+		t.Fatalf("sms sync failed: %v", err)
+	}
+
+	var req *http.Request
+	var body []byte
+	select {
+	case req = <-received:
+		body = <-bodies
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.Event != "sms.received" || payload.DeviceID != device.ID || payload.Address != "10086" ||
+		payload.ContactName != "Carrier" || payload.Body != "your code is 1234" || payload.SimID != 1 || payload.Time != 1700000000000 {
+		t.Errorf("Unexpected payload: %+v", payload)
+	}
+	if got, want := req.Header.Get(WebhookSignatureHeader), "sha256="+signWebhook("s3cret", body); got != want {
+		t.Errorf("Signature = %q, want %q", got, want)
+	}
+
+	select {
+	case r := <-received:
+		t.Errorf("Unexpected second webhook call: %s", r.URL)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestDeliverWebhookRetriesServerErrors(t *testing.T) {
+	var calls int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer hook.Close()
+
+	opts := WebhookOptions{MaxRetries: 3, RetryBackoff: time.Millisecond, Timeout: time.Second}
+	if err := deliverWebhook(webhookTarget{URL: hook.URL}, WebhookPayload{}, opts); err != nil {
+		t.Fatalf("Expected delivery to succeed after retries, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+
+	if err := deliverWebhook(webhookTarget{URL: rejecting.URL}, WebhookPayload{}, opts); err == nil {
+		t.Fatal("Expected a 400 response to fail delivery")
+	}
+	if calls != 1 {
+		t.Errorf("Expected a 400 not to be retried, got %d attempts", calls)
+	}
+}
+
+func TestFailingWebhookTargetDoesNotStallOthers(t *testing.T) {
+	SetWebhook(WebhookOptions{MaxRetries: 2, RetryBackoff: 300 * time.Millisecond, Timeout: time.Second})
+	defer SetWebhook(WebhookOptions{})
+
+	var failing int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failing, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	delivered := make(chan struct{}, 1)
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer up.Close()
+
+	enqueueWebhook(webhookTarget{URL: down.URL}, WebhookPayload{})
+	enqueueWebhook(webhookTarget{URL: up.URL}, WebhookPayload{})
+
+	// The down target is still being retried when the other one is reached
+	select {
+	case <-delivered:
+	case <-time.After(250 * time.Millisecond):
+		t.Fatal("Expected a healthy target to be delivered while another is retried")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := FlushWebhooks(ctx); err != nil {
+		t.Fatalf("Expected the queue to flush, got %v", err)
+	}
+	if n := atomic.LoadInt32(&failing); n != 3 {
+		t.Errorf("Expected the flush to wait for all 3 attempts, got %d", n)
+	}
+}
@@ -0,0 +1,44 @@
+package smsutil
+
+import (
+	"strings"
+	"unicode"
+)
+
+// defaultCountryCode is dropped from numbers so "+8613800138000" and
+// "13800138000" compare equal. SmsForwarder phones report local numbers
+// without it.
+const defaultCountryCode = "86"
+
+// NormalizePhone returns the form of a phone number used to compare numbers:
+// spaces, dashes, dots and parentheses are removed, a leading "00" becomes
+// "+", and the default country code is dropped. Numbers of other countries
+// keep their "+" prefix. Values that aren't numbers, such as alphanumeric
+// sender IDs, are only trimmed.
+func NormalizePhone(number string) string {
+	number = strings.TrimSpace(number)
+	digits := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r), r == '-', r == '.', r == '(', r == ')':
+			return -1
+		}
+		return r
+	}, number)
+
+	if strings.HasPrefix(digits, "00") {
+		digits = "+" + digits[2:]
+	}
+	rest := strings.TrimPrefix(digits, "+")
+	if rest == "" || strings.IndexFunc(rest, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+		return number
+	}
+
+	switch {
+	case strings.HasPrefix(digits, "+"+defaultCountryCode):
+		return strings.TrimPrefix(digits, "+"+defaultCountryCode)
+	case len(digits) == 13 && strings.HasPrefix(digits, defaultCountryCode+"1"):
+		// Mobile number with the country code but no "+", e.g. 8613800138000
+		return digits[len(defaultCountryCode):]
+	}
+	return digits
+}
@@ -0,0 +1,28 @@
+package smsutil
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	cases := map[string]string{
+		"13800138000":       "13800138000",
+		"+8613800138000":    "13800138000",
+		"+86 138 0013 8000": "13800138000",
+		"138 0013 8000":     "13800138000",
+		"138-0013-8000":     "13800138000",
+		"008613800138000":   "13800138000",
+		"8613800138000":     "13800138000",
+		" 10086 ":           "10086",
+		"95588":             "95588",
+		"(010) 6552-9988":   "01065529988",
+		"+1 (415) 555-0100": "+14155550100",
+		"0014155550100":     "+14155550100",
+		"Apple":             "Apple",
+		"*#06#":             "*#06#",
+		"":                  "",
+	}
+	for in, want := range cases {
+		if got := NormalizePhone(in); got != want {
+			t.Errorf("NormalizePhone(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Package smsutil has helpers for SMS bodies and phone numbers: segment
+// estimates and number normalization.
+package smsutil
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// Encodings an SMS body can be sent in.
+const (
+	EncodingGSM7 = "gsm7" // 7-bit default alphabet, 160 characters per single SMS
+	EncodingUCS2 = "ucs2" // UTF-16, used as soon as one character is outside GSM-7
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet (without the escape character).
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension characters are sent as an escape plus one septet, so they count twice.
+const gsm7Extension = "\f^{}\\[~]|€"
+
+// Segments describes how a body is sent.
+type Segments struct {
+	Encoding   string `json:"encoding"`    // EncodingGSM7 or EncodingUCS2
+	Units      int    `json:"units"`       // GSM-7 septets or UTF-16 code units
+	Count      int    `json:"segments"`    // Number of SMS the body is split into
+	PerSegment int    `json:"per_segment"` // Units each segment holds at this length
+}
+
+// Estimate returns the encoding and segment count of body. A body that fits
+// one SMS holds 160 GSM-7 septets or 70 UCS-2 units; longer bodies are sent as
+// concatenated segments of 153 or 67, the rest of each carrying the UDH.
+func Estimate(body string) Segments {
+	septets := 0
+	gsm := true
+	for _, r := range body {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			septets++
+		case strings.ContainsRune(gsm7Extension, r):
+			septets += 2
+		default:
+			gsm = false
+		}
+		if !gsm {
+			break
+		}
+	}
+
+	s := Segments{Encoding: EncodingGSM7, Units: septets, PerSegment: 160}
+	multi := 153
+	if !gsm {
+		s = Segments{Encoding: EncodingUCS2, Units: len(utf16.Encode([]rune(body))), PerSegment: 70}
+		multi = 67
+	}
+	switch {
+	case s.Units == 0:
+		s.Count = 0
+	case s.Units <= s.PerSegment:
+		s.Count = 1
+	default:
+		s.PerSegment = multi
+		s.Count = (s.Units + multi - 1) / multi
+	}
+	return s
+}
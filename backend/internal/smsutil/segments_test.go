@@ -0,0 +1,34 @@
+package smsutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		encoding string
+		units    int
+		count    int
+	}{
+		{"empty", "", EncodingGSM7, 0, 0},
+		{"single gsm", strings.Repeat("a", 160), EncodingGSM7, 160, 1},
+		{"two gsm", strings.Repeat("a", 161), EncodingGSM7, 161, 2},
+		{"extension counts twice", strings.Repeat("€", 80), EncodingGSM7, 160, 1},
+		{"extension overflows", strings.Repeat("€", 80) + "a", EncodingGSM7, 161, 2},
+		{"single ucs2", strings.Repeat("你", 70), EncodingUCS2, 70, 1},
+		{"two ucs2", strings.Repeat("你", 71), EncodingUCS2, 71, 2},
+		{"one non-gsm char switches encoding", strings.Repeat("a", 70) + "你", EncodingUCS2, 71, 2},
+		{"surrogate pair is two units", "😀", EncodingUCS2, 2, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Estimate(tc.body)
+			if got.Encoding != tc.encoding || got.Units != tc.units || got.Count != tc.count {
+				t.Errorf("Estimate = %+v, want %s/%d units/%d segments", got, tc.encoding, tc.units, tc.count)
+			}
+		})
+	}
+}
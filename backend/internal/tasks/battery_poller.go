@@ -1,43 +1,68 @@
 package tasks
 
 import (
-	"log"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"backend/internal/metrics"
 	"backend/internal/models"
 	"backend/internal/phoneclient"
+	"backend/internal/repository"
+	"backend/internal/services"
 
 	"xorm.io/xorm"
 )
 
+// historyCleanupInterval is how often expired battery history is purged
+const historyCleanupInterval = time.Hour
+
 // BatteryPoller periodically queries battery status from all devices
+// and records each reading in the battery history.
 type BatteryPoller struct {
-	engine   *xorm.Engine
-	interval time.Duration
-	stopCh   chan struct{}
+	engine      *xorm.Engine
+	interval    time.Duration
+	retention   time.Duration // 0 keeps history forever
+	sem         chan struct{} // Bounds concurrent device polls
+	lastCleanup time.Time
+	stopCh      chan struct{}
+	wg          sync.WaitGroup // Tracks run and in-flight device polls
 }
 
-// NewBatteryPoller creates a new battery poller
-func NewBatteryPoller(engine *xorm.Engine, interval time.Duration) *BatteryPoller {
+// NewBatteryPoller creates a new battery poller.
+// retention is how long battery history is kept (0 = forever);
+// maxConcurrent is how many devices are polled at once.
+func NewBatteryPoller(engine *xorm.Engine, interval, retention time.Duration, maxConcurrent int) *BatteryPoller {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
 	return &BatteryPoller{
-		engine:   engine,
-		interval: interval,
-		stopCh:   make(chan struct{}),
+		engine:    engine,
+		interval:  interval,
+		retention: retention,
+		sem:       make(chan struct{}, maxConcurrent),
+		stopCh:    make(chan struct{}),
 	}
 }
 
 // Start begins the periodic battery polling
 func (bp *BatteryPoller) Start() {
-	log.Printf("Starting battery poller with interval %v", bp.interval)
+	slog.Info("battery poller started", "operation", "battery_poll", "interval", bp.interval)
+	bp.wg.Add(1)
 	go bp.run()
 }
 
-// Stop stops the battery poller
+// Stop stops the battery poller and waits for in-flight polls to finish
 func (bp *BatteryPoller) Stop() {
 	close(bp.stopCh)
+	bp.wg.Wait()
 }
 
 func (bp *BatteryPoller) run() {
+	defer bp.wg.Done()
+
 	// Poll immediately on start
 	bp.pollAllDevices()
 
@@ -49,32 +74,49 @@ func (bp *BatteryPoller) run() {
 		case <-ticker.C:
 			bp.pollAllDevices()
 		case <-bp.stopCh:
-			log.Println("Battery poller stopped")
+			slog.Info("battery poller stopped", "operation", "battery_poll")
 			return
 		}
 	}
 }
 
 func (bp *BatteryPoller) pollAllDevices() {
+	bp.cleanupHistory()
+
 	var devices []models.Device
 	if err := bp.engine.Find(&devices); err != nil {
-		log.Printf("Failed to fetch devices for battery polling: %v", err)
+		slog.Error("fetch devices for battery polling failed", "operation", "battery_poll", "error", err)
 		return
 	}
 
 	for _, device := range devices {
-		go bp.pollDevice(&device)
+		// Wait for a free slot so only a bounded number of phones are contacted at once
+		select {
+		case bp.sem <- struct{}{}:
+		case <-bp.stopCh:
+			return
+		}
+		bp.wg.Add(1)
+		go func() {
+			defer bp.wg.Done()
+			defer func() { <-bp.sem }()
+			bp.pollDevice(&device)
+		}()
 	}
 }
 
 func (bp *BatteryPoller) pollDevice(device *models.Device) {
 	client := phoneclient.NewClient(device)
+	ctx := services.DeviceContext(device.ID)
 
 	// First try to query config to check if device is online
-	config, err := client.QueryConfig()
+	config, err := client.QueryConfig(ctx)
+	services.RecordPollResult(device, err == nil)
 	if err != nil {
 		// Device is offline
+		metrics.DeviceOnline.WithLabelValues(metrics.DeviceLabel(device)).Set(0)
 		if device.Status != "offline" {
+			slog.Warn("device went offline", "operation", "battery_poll", "device_id", device.ID, "error", err)
 			device.Status = "offline"
 			bp.engine.ID(device.ID).Cols("status").Update(device)
 		}
@@ -82,25 +124,76 @@ func (bp *BatteryPoller) pollDevice(device *models.Device) {
 	}
 
 	// Device is online, update device info
+	metrics.DeviceOnline.WithLabelValues(metrics.DeviceLabel(device)).Set(1)
 	device.Status = "online"
 	device.DeviceMark = config.ExtraDeviceMark
 	device.ExtraSim1 = config.ExtraSim1
 	device.ExtraSim2 = config.ExtraSim2
+	device.SimInfo = config.SimInfoJSON()
+	device.Capabilities = config.Capabilities()
 	device.LastSeen = time.Now()
 
 	// Query battery if enabled
 	if config.EnableAPIBatteryQuery {
-		battery, err := client.QueryBattery()
-		if err == nil {
+		battery, err := client.QueryBattery(ctx)
+		if err != nil {
+			slog.Debug("battery query failed", "operation", "battery_poll", "device_id", device.ID, "error", err)
+		} else {
 			device.BatteryLevel = battery.Level
 			device.BatteryStatus = battery.Status
 			device.BatteryPlugged = battery.Plugged
+
+			level, ok := parseBatteryLevel(battery.Level)
+			if ok {
+				// A garbled reading must not look like an empty battery
+				metrics.DeviceBattery.WithLabelValues(metrics.DeviceLabel(device)).Set(float64(level))
+				services.CheckBatteryLevel(device, level)
+			}
+
+			record := &models.BatteryHistory{
+				DeviceID:   device.ID,
+				Level:      level,
+				Status:     battery.Status,
+				Plugged:    battery.Plugged,
+				RecordedAt: time.Now(),
+			}
+			if err := repository.NewBatteryHistoryRepository(bp.engine).Insert(record); err != nil {
+				slog.Error("record battery history failed", "operation", "battery_poll", "device_id", device.ID, "error", err)
+			}
 		}
 	}
 
 	// Update device
 	bp.engine.ID(device.ID).Cols(
-		"status", "device_mark", "extra_sim1", "extra_sim2", "last_seen",
+		"status", "device_mark", "extra_sim1", "extra_sim2", "sim_info", "capabilities", "last_seen",
 		"battery_level", "battery_status", "battery_plugged",
 	).Update(device)
 }
+
+// cleanupHistory purges battery history older than the retention period,
+// at most once per historyCleanupInterval.
+func (bp *BatteryPoller) cleanupHistory() {
+	if bp.retention <= 0 || time.Since(bp.lastCleanup) < historyCleanupInterval {
+		return
+	}
+	bp.lastCleanup = time.Now()
+
+	deleted, err := repository.NewBatteryHistoryRepository(bp.engine).DeleteBefore(time.Now().Add(-bp.retention))
+	if err != nil {
+		slog.Error("clean up battery history failed", "operation", "battery_history_cleanup", "error", err)
+		return
+	}
+	if deleted > 0 {
+		slog.Info("removed expired battery history", "operation", "battery_history_cleanup", "deleted", deleted)
+	}
+}
+
+// parseBatteryLevel converts a level such as "85%" to 85.
+// ok is false (and the level 0) if the value is unparsable.
+func parseBatteryLevel(level string) (n int, ok bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(level), "%")))
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
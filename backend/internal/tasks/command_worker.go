@@ -0,0 +1,85 @@
+package tasks
+
+import (
+	"log"
+	"time"
+
+	"backend/internal/repository"
+	"backend/internal/services"
+
+	"xorm.io/xorm"
+)
+
+// commandBatchSize limits how many pending commands are picked up per tick
+const commandBatchSize = 20
+
+// CommandWorker periodically dispatches pending commands to phones
+type CommandWorker struct {
+	engine   *xorm.Engine
+	interval time.Duration
+	stopCh   chan struct{}
+	done     chan struct{} // Closed when run returns
+}
+
+// NewCommandWorker creates a new command worker
+func NewCommandWorker(engine *xorm.Engine, interval time.Duration) *CommandWorker {
+	return &CommandWorker{
+		engine:   engine,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start fails commands a previous run left in sent, then begins processing the command queue
+func (cw *CommandWorker) Start() {
+	log.Printf("Starting command worker with interval %v", cw.interval)
+	repo := repository.NewCommandRepository(cw.engine)
+	if n, err := repo.FailInterrupted("interrupted by server restart"); err != nil {
+		log.Printf("Failed to recover interrupted commands: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted commands as failed", n)
+	}
+	go cw.run()
+}
+
+// Stop stops the command worker and waits for the current batch to finish
+func (cw *CommandWorker) Stop() {
+	close(cw.stopCh)
+	<-cw.done
+}
+
+func (cw *CommandWorker) run() {
+	defer close(cw.done)
+
+	ticker := time.NewTicker(cw.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cw.processPending()
+		case <-cw.stopCh:
+			log.Println("Command worker stopped")
+			return
+		}
+	}
+}
+
+// processPending executes pending commands sequentially, oldest first,
+// so commands for the same phone are delivered in the order they were queued.
+func (cw *CommandWorker) processPending() {
+	repo := repository.NewCommandRepository(cw.engine)
+	commands, err := repo.FindPending(commandBatchSize)
+	if err != nil {
+		log.Printf("Failed to fetch pending commands: %v", err)
+		return
+	}
+
+	service := services.NewCommandService(cw.engine)
+	for i := range commands {
+		if err := service.Execute(services.DeviceContext(commands[i].DeviceID), &commands[i]); err != nil {
+			log.Printf("Failed to execute command %d: %v", commands[i].ID, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package tasks
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/services"
+
+	"xorm.io/xorm"
+)
+
+// syncWorkers bounds how many devices are synced concurrently
+const syncWorkers = 4
+
+// SyncScheduler periodically syncs SMS and call logs of every device on the
+// device's own PollingInterval. Devices with a PollingInterval of 0 are skipped.
+type SyncScheduler struct {
+	engine   *xorm.Engine
+	interval time.Duration
+	stopCh   chan struct{}
+	sem      chan struct{}
+	wg       sync.WaitGroup // Tracks run and in-flight device syncs
+
+	mu       sync.Mutex
+	inFlight map[int64]bool
+	lastRun  map[int64]time.Time
+}
+
+// NewSyncScheduler creates a new sync scheduler.
+// interval is how often the scheduler checks which devices are due for a sync.
+func NewSyncScheduler(engine *xorm.Engine, interval time.Duration) *SyncScheduler {
+	return &SyncScheduler{
+		engine:   engine,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+		sem:      make(chan struct{}, syncWorkers),
+		inFlight: make(map[int64]bool),
+		lastRun:  make(map[int64]time.Time),
+	}
+}
+
+// Start begins the periodic sync
+func (ss *SyncScheduler) Start() {
+	log.Printf("Starting sync scheduler with interval %v", ss.interval)
+	ss.wg.Add(1)
+	go ss.run()
+}
+
+// Stop stops the sync scheduler and waits for in-flight syncs to finish.
+// A running sync finishes its current page unless its device context is
+// canceled (services.CancelAllDeviceWork), which makes it stop early.
+func (ss *SyncScheduler) Stop() {
+	close(ss.stopCh)
+	ss.wg.Wait()
+}
+
+func (ss *SyncScheduler) run() {
+	defer ss.wg.Done()
+
+	ticker := time.NewTicker(ss.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ss.scheduleDueDevices()
+		case <-ss.stopCh:
+			log.Println("Sync scheduler stopped")
+			return
+		}
+	}
+}
+
+// scheduleDueDevices starts a sync for every device whose polling interval has
+// elapsed since its last run. Offline devices are left to the battery poller,
+// which flips them back online once they answer again.
+func (ss *SyncScheduler) scheduleDueDevices() {
+	var devices []models.Device
+	if err := ss.engine.Where("polling_interval > 0").Find(&devices); err != nil {
+		log.Printf("[SyncScheduler] failed to fetch devices: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for i := range devices {
+		device := devices[i]
+		if device.Status == "offline" {
+			continue
+		}
+		if !ss.claim(device.ID, time.Duration(device.PollingInterval)*time.Second, now) {
+			continue
+		}
+		ss.wg.Add(1)
+		go func() {
+			defer ss.wg.Done()
+			ss.syncDevice(&device)
+		}()
+	}
+}
+
+// claim marks a device as in flight if it is due and not already running
+func (ss *SyncScheduler) claim(deviceID int64, interval time.Duration, now time.Time) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.inFlight[deviceID] {
+		return false
+	}
+	if last, ok := ss.lastRun[deviceID]; ok && now.Sub(last) < interval {
+		return false
+	}
+	ss.inFlight[deviceID] = true
+	ss.lastRun[deviceID] = now
+	return true
+}
+
+func (ss *SyncScheduler) release(deviceID int64) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.inFlight, deviceID)
+}
+
+func (ss *SyncScheduler) syncDevice(device *models.Device) {
+	defer ss.release(device.ID)
+
+	select {
+	case ss.sem <- struct{}{}:
+		defer func() { <-ss.sem }()
+	case <-ss.stopCh:
+		return
+	}
+
+	ctx := services.DeviceContext(device.ID)
+	syncService := services.NewSyncService(ss.engine)
+
+	if result, err := syncService.SyncSms(ctx, device, 0, services.SyncOptions{}); err != nil {
+		log.Printf("[SyncScheduler] device %d: sms sync failed: %v", device.ID, err)
+	} else if result.NewCount > 0 {
+		log.Printf("[SyncScheduler] device %d: synced %d new sms", device.ID, result.NewCount)
+	}
+
+	if result, err := syncService.SyncCalls(ctx, device, 0, services.SyncOptions{}); err != nil {
+		log.Printf("[SyncScheduler] device %d: call sync failed: %v", device.ID, err)
+	} else if result.NewCount > 0 {
+		log.Printf("[SyncScheduler] device %d: synced %d new calls", device.ID, result.NewCount)
+	}
+}
@@ -1,22 +1,47 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"backend/config"
 	"backend/internal/db"
+	"backend/internal/logging"
 	"backend/internal/models"
+	"backend/internal/phoneclient"
+	"backend/internal/repository"
 	"backend/internal/security"
 	"backend/internal/server"
+	"backend/internal/services"
 	"backend/internal/tasks"
 
 	"github.com/gin-gonic/gin"
 	"xorm.io/xorm"
 )
 
+// shutdownTimeout bounds how long shutdown waits for in-flight requests and
+// background tasks before canceling device work
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	// -check (or SM_MODE=check) validates the config and database, then exits
+	// without starting the server or any background task
+	checkOnly := flag.Bool("check", false, "validate config and database connectivity, then exit")
+	flag.Parse()
+	if os.Getenv("SM_MODE") == "check" {
+		*checkOnly = true
+	}
+
 	// Set GIN to release mode to reduce logging
 	gin.SetMode(gin.ReleaseMode)
 
@@ -30,6 +55,38 @@ func main() {
 		log.Fatalf("load config: %v", err)
 	}
 
+	if err := logging.Setup(cfg.App.LogLevel, cfg.App.LogFormat); err != nil {
+		log.Fatalf("app.log_level/app.log_format: %v", err)
+	}
+
+	if err := phoneclient.ValidateProxyURL(cfg.App.PhoneProxy); err != nil {
+		log.Fatalf("app.phone_proxy: %v", err)
+	}
+	phoneclient.SetOptions(phoneclient.Options{
+		MaxRetries:         cfg.App.PhoneMaxRetries,
+		RetryBackoff:       500 * time.Millisecond,
+		DebugIO:            cfg.App.DebugPhoneIO,
+		ProxyURL:           cfg.App.PhoneProxy,
+		InsecureSkipVerify: cfg.App.PhoneInsecureSkipVerify,
+		MaxResponseBytes:   int64(cfg.App.PhoneMaxResponseMB) << 20,
+	})
+
+	services.SetWebhook(services.WebhookOptions{
+		URL:          cfg.App.Webhook.URL,
+		Secret:       cfg.App.Webhook.Secret,
+		MaxRetries:   cfg.App.Webhook.MaxRetries,
+		RetryBackoff: time.Second,
+		Timeout:      10 * time.Second,
+	})
+
+	services.SetSmsDedupWindow(cfg.App.SmsDedupDuration())
+	services.SetSyncLimits(cfg.App.SyncPageSize, cfg.App.SyncMaxPages)
+
+	services.SetAlerts(services.AlertOptions{
+		BatteryThreshold: cfg.App.BatteryAlertThreshold,
+		OfflineFailures:  cfg.App.OfflineAlertFailures,
+	})
+
 	engine, err := db.NewEngine(cfg)
 	if err != nil {
 		log.Fatalf("init db: %v", err)
@@ -37,19 +94,178 @@ func main() {
 	if err := ensureAdmin(cfg, engine); err != nil {
 		log.Fatalf("ensure admin: %v", err)
 	}
+	if err := checkInsecureDefaults(cfg, engine); err != nil {
+		log.Fatalf("startup safety check: %v", err)
+	}
+	if err := loadRotatedJWTSecret(cfg, engine); err != nil {
+		log.Fatalf("load jwt secret: %v", err)
+	}
+	if *checkOnly {
+		if err := printCheckSummary(configPath, cfg, engine); err != nil {
+			log.Fatalf("check: %v", err)
+		}
+		engine.Close()
+		return
+	}
+
+	// Start battery poller (poll on the configured interval, keep history for the configured days)
+	var batteryPoller *tasks.BatteryPoller
+	if interval := cfg.App.BatteryPollDuration(); interval > 0 {
+		var batteryRetention time.Duration
+		if cfg.App.BatteryHistoryDays > 0 {
+			batteryRetention = time.Duration(cfg.App.BatteryHistoryDays) * 24 * time.Hour
+		}
+		batteryPoller = tasks.NewBatteryPoller(engine, interval, batteryRetention, cfg.App.MaxConcurrentPolls)
+		batteryPoller.Start()
+	} else {
+		log.Println("battery poller disabled; devices refresh on demand only")
+	}
+
+	// Start command worker (dispatch queued commands every 2 seconds)
+	commandWorker := tasks.NewCommandWorker(engine, 2*time.Second)
+	commandWorker.Start()
+
+	// Start sync scheduler (per-device SMS/call sync on each device's polling interval)
+	var syncScheduler *tasks.SyncScheduler
+	if cfg.App.SyncIntervalSeconds > 0 {
+		syncScheduler = tasks.NewSyncScheduler(engine, time.Duration(cfg.App.SyncIntervalSeconds)*time.Second)
+		syncScheduler.Start()
+	}
+
+	srv := &http.Server{
+		Addr:    cfg.App.Addr,
+		Handler: server.NewRouter(cfg, engine),
+	}
+	go func() {
+		log.Printf("starting server on %s", cfg.App.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server failed: %v", err)
+		}
+	}()
+
+	// Wait for SIGINT/SIGTERM, then drain in-flight requests and background work
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("shutting down...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("server shutdown: %v", err)
+	}
 
-	// Start battery poller (poll every 5 minutes)
-	batteryPoller := tasks.NewBatteryPoller(engine, 5*time.Minute)
-	batteryPoller.Start()
+	stopped := make(chan struct{})
+	go func() {
+		if batteryPoller != nil {
+			batteryPoller.Stop()
+		}
+		commandWorker.Stop()
+		if syncScheduler != nil {
+			syncScheduler.Stop()
+		}
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		// Make running syncs stop after their current batch instead of walking more pages
+		log.Println("background tasks still running, canceling device work")
+		services.CancelAllDeviceWork()
+		<-stopped
+	}
+	// Deliver notifications the syncs and alerts queued before exiting
+	if err := services.FlushWebhooks(ctx); err != nil {
+		log.Printf("webhook flush: %v", err)
+	}
 
-	router := server.NewRouter(cfg, engine)
-	log.Printf("starting server on %s", cfg.App.Addr)
-	if err := router.Run(cfg.App.Addr); err != nil {
-		log.Fatalf("server failed: %v", err)
+	if err := engine.Close(); err != nil {
+		log.Printf("close db: %v", err)
 	}
+	log.Println("server stopped")
 }
 
-// ensureAdmin seeds a default admin account if none exists.
+// printCheckSummary reports what -check validated, for CI logs.
+func printCheckSummary(configPath string, cfg *config.Config, engine *xorm.Engine) error {
+	users, err := engine.Count(new(models.User))
+	if err != nil {
+		return err
+	}
+	devices, err := engine.Count(new(models.Device))
+	if err != nil {
+		return err
+	}
+	fmt.Println("config check passed")
+	fmt.Printf("  config:   %s\n", configPath)
+	fmt.Printf("  listen:   %s\n", cfg.App.Addr)
+	fmt.Printf("  database: %s (connected, schema in sync)\n", cfg.Database.Driver)
+	fmt.Printf("  users:    %d (admin %q)\n", users, cfg.Security.DefaultAdminUser)
+	fmt.Printf("  devices:  %d\n", devices)
+	if interval := cfg.App.BatteryPollDuration(); interval > 0 {
+		fmt.Printf("  battery poller: every %s\n", interval)
+	} else {
+		fmt.Println("  battery poller: disabled")
+	}
+	return nil
+}
+
+// loadRotatedJWTSecret switches to the JWT secret stored by the rotate endpoint,
+// if any, so rotated secrets survive restarts.
+func loadRotatedJWTSecret(cfg *config.Config, engine *xorm.Engine) error {
+	secret, ok, err := repository.NewSettingRepository(engine).Get(models.SettingJWTSecret)
+	if err != nil || !ok {
+		return err
+	}
+	cfg.SetJWTSecret(secret)
+	log.Println("using the rotated JWT secret stored in the database; app.jwt_secret is ignored")
+	return nil
+}
+
+// checkInsecureDefaults refuses to start a server that is reachable beyond
+// loopback, accepts CORS requests from any origin and still lets the default
+// admin log in with the configured default password, unless app.allow_insecure
+// is set, in which case it only logs a warning.
+func checkInsecureDefaults(cfg *config.Config, engine *xorm.Engine) error {
+	if !cfg.App.AllowsAnyOrigin() || isLoopbackAddr(cfg.App.Addr) {
+		return nil
+	}
+	var admin models.User
+	found, err := engine.Where("username = ?", cfg.Security.DefaultAdminUser).Get(&admin)
+	if err != nil {
+		return err
+	}
+	if !found || !security.CheckPassword(admin.Password, cfg.Security.DefaultAdminPassword) {
+		return nil
+	}
+
+	problem := fmt.Sprintf("listening on %s with CORS open to any origin while admin %q still has the default password",
+		cfg.App.Addr, admin.Username)
+	if !cfg.App.AllowInsecure {
+		return fmt.Errorf("%s; change the password, restrict app.allow_origins or bind app.addr to loopback (set app.allow_insecure: true to start anyway)", problem)
+	}
+	log.Println("****************************************************************")
+	log.Printf("WARNING: %s. Anyone who can reach this server can log in.", problem)
+	log.Println("****************************************************************")
+	return nil
+}
+
+// isLoopbackAddr reports whether a listen address such as "127.0.0.1:8080" only
+// accepts local connections. An empty host (":8080") listens on every interface.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// ensureAdmin seeds a default admin account if none exists. A default password
+// that fails the password policy is logged, or refused when
+// security.reject_weak_admin_password is set.
 func ensureAdmin(cfg *config.Config, engine *xorm.Engine) error {
 	count, err := engine.Count(new(models.User))
 	if err != nil {
@@ -58,6 +274,13 @@ func ensureAdmin(cfg *config.Config, engine *xorm.Engine) error {
 	if count > 0 {
 		return nil
 	}
+	if failed := security.ValidatePassword(cfg.Security.PasswordPolicy, cfg.Security.DefaultAdminPassword); len(failed) > 0 {
+		if cfg.Security.RejectWeakAdminPassword {
+			return fmt.Errorf("security.default_admin_password does not meet the policy: %s", strings.Join(failed, ", "))
+		}
+		log.Printf("WARNING: seeding admin %q with a weak password (%s); change it after first login",
+			cfg.Security.DefaultAdminUser, strings.Join(failed, ", "))
+	}
 	hash, err := security.HashPassword(cfg.Security.DefaultAdminPassword)
 	if err != nil {
 		return err
@@ -65,6 +288,7 @@ func ensureAdmin(cfg *config.Config, engine *xorm.Engine) error {
 	user := models.User{
 		Username: cfg.Security.DefaultAdminUser,
 		Password: hash,
+		Role:     models.RoleAdmin,
 	}
 	_, err = engine.Insert(&user)
 	return err
@@ -295,11 +295,8 @@ export default function DeviceDetailPage({ params }: { params: Promise<{ id: str
                 <Label className="text-muted-foreground">SM4 Key</Label>
                 <div className="flex items-center gap-2 mt-1">
                   <code className="text-sm bg-muted px-2 py-1 rounded flex-1 truncate font-mono">
-                    {device.sm4_key}
+                    {device.has_sm4_key ? '••••••••••••••••' : 'Not set'}
                   </code>
-                  <Button variant="ghost" size="icon" onClick={() => copyToClipboard(device.sm4_key, 'SM4 Key')}>
-                    <Copy className="h-4 w-4" />
-                  </Button>
                 </div>
               </div>
               <div>
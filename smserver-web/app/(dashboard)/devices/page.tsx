@@ -205,7 +205,7 @@ export default function DevicesPage() {
     setEditForm({
       name: device.name,
       phoneAddr: device.phone_addr,
-      sm4Key: device.sm4_key,
+      sm4Key: '',
       remark: device.remark || '',
       pollingInterval: device.polling_interval || 0,
     });
@@ -222,11 +222,7 @@ export default function DevicesPage() {
       toast.error('Phone address is required');
       return;
     }
-    if (!editForm.sm4Key.trim()) {
-      toast.error('SM4 Key is required');
-      return;
-    }
-    if (editForm.sm4Key.length !== 32) {
+    if (editForm.sm4Key && editForm.sm4Key.length !== 32) {
       toast.error('SM4 Key must be 32 hex characters');
       return;
     }
@@ -235,7 +231,7 @@ export default function DevicesPage() {
     const res = await api.updateDevice(editingDevice.id, {
       name: editForm.name.trim(),
       phone_addr: editForm.phoneAddr.trim(),
-      sm4_key: editForm.sm4Key.trim(),
+      sm4_key: editForm.sm4Key.trim() || undefined, // Blank keeps the current key
       remark: editForm.remark.trim(),
       polling_interval: editForm.pollingInterval,
     });
@@ -600,10 +596,10 @@ export default function DevicesPage() {
             </div>
 
             <div className="space-y-2">
-              <Label htmlFor="edit-sm4Key">SM4 Key *</Label>
+              <Label htmlFor="edit-sm4Key">SM4 Key</Label>
               <Input
                 id="edit-sm4Key"
-                placeholder="32-character hex string"
+                placeholder="Leave blank to keep the current key"
                 value={editForm.sm4Key}
                 onChange={(e) => setEditForm({ ...editForm, sm4Key: e.target.value })}
                 className="font-mono"
@@ -29,6 +29,7 @@ export function AuthProvider({ children }: { children: ReactNode }) {
           setUser(res.data);
         } else {
           localStorage.removeItem('token');
+          localStorage.removeItem('refresh_token');
           setToken(null);
         }
         setIsLoading(false);
@@ -45,6 +46,7 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     }
     if (res.data) {
       localStorage.setItem('token', res.data.token);
+      localStorage.setItem('refresh_token', res.data.refresh_token);
       setToken(res.data.token);
       setUser(res.data.user);
       router.push('/devices');
@@ -53,7 +55,10 @@ export function AuthProvider({ children }: { children: ReactNode }) {
   };
 
   const logout = () => {
+    // Revoke tokens server-side; local state is cleared regardless of the outcome
+    api.logout();
     localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
     setToken(null);
     setUser(null);
     router.push('/');
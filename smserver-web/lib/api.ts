@@ -3,11 +3,55 @@ const API_BASE = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080';
 interface ApiResponse<T = unknown> {
   data?: T;
   error?: string;
+  // Stable failure kind from the error envelope, e.g. device_not_found,
+  // invalid_request, phone_feature_disabled or phone_unreachable
+  code?: string;
+}
+
+// Body of every error response: {"error": {"code": "...", "message": "..."}}.
+// Some codes add fields, e.g. hint on phone errors.
+export interface ApiErrorBody {
+  code: string;
+  message: string;
+  [detail: string]: unknown;
+}
+
+// Exchange the stored refresh token for a new access token.
+// Returns false if there is no refresh token or it was rejected.
+async function refreshAccessToken(): Promise<boolean> {
+  const refreshToken = typeof window !== 'undefined' ? localStorage.getItem('refresh_token') : null;
+  if (!refreshToken) {
+    return false;
+  }
+  try {
+    const response = await fetch(`${API_BASE}/api/refresh`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refresh_token: refreshToken }),
+    });
+    if (!response.ok) {
+      return false;
+    }
+    const data = await response.json();
+    localStorage.setItem('token', data.token);
+    return true;
+  } catch {
+    return false;
+  }
+}
+
+// newIdempotencyKey returns a random key; crypto.randomUUID only exists on HTTPS or localhost
+function newIdempotencyKey(): string {
+  if (typeof crypto !== 'undefined' && typeof crypto.randomUUID === 'function') {
+    return crypto.randomUUID();
+  }
+  return `${Date.now().toString(36)}-${Math.random().toString(36).slice(2)}${Math.random().toString(36).slice(2)}`;
 }
 
 async function request<T>(
   endpoint: string,
-  options: RequestInit = {}
+  options: RequestInit = {},
+  retried = false
 ): Promise<ApiResponse<T>> {
   const token = typeof window !== 'undefined' ? localStorage.getItem('token') : null;
 
@@ -26,6 +70,11 @@ async function request<T>(
       headers,
     });
 
+    // Access tokens are short-lived; refresh once and retry
+    if (response.status === 401 && !retried && endpoint !== '/api/login' && (await refreshAccessToken())) {
+      return request<T>(endpoint, options, true);
+    }
+
     // Handle 204 No Content or empty responses
     if (response.status === 204 || response.headers.get('content-length') === '0') {
       if (!response.ok) {
@@ -37,7 +86,8 @@ async function request<T>(
     const data = await response.json();
 
     if (!response.ok) {
-      return { error: data.error || 'Request failed' };
+      const err: ApiErrorBody | undefined = data.error;
+      return { error: err?.message || 'Request failed', code: err?.code };
     }
 
     return { data };
@@ -49,10 +99,13 @@ async function request<T>(
 export interface User {
   id: number;
   username: string;
+  role: 'admin' | 'viewer'; // viewers are read-only
 }
 
 export interface LoginResponse {
   token: string;
+  refresh_token: string;
+  expires_in: number; // Access token lifetime in seconds
   user: User;
 }
 
@@ -61,7 +114,10 @@ export interface Device {
   id: number;
   name: string;
   phone_addr: string;   // Phone HTTP server address
-  sm4_key: string;      // SM4 encryption key
+  has_sm4_key: boolean; // SM4 key is set (the key itself is never returned)
+  sm4_iv?: string;      // Optional SM4 IV (empty = SmsForwarder default)
+  sign_enabled?: boolean; // Sign requests with the signing secret
+  has_sign_secret?: boolean; // Signing secret is set (never returned)
   status: string;       // online, offline, unknown
   battery: number;
   battery_level: string;   // e.g., "85%"
@@ -69,16 +125,52 @@ export interface Device {
   battery_plugged: string; // e.g., "AC", "USB", "无"
   latitude: number;
   longitude: number;
-  sim_info: string;
+  location_address: string;
+  location_at: string | null; // When the last known fix was received, null = never
+  sim_info: string;     // SIM cards as JSON; parsed into sims by getDevice
+  sims?: SimInfo[];     // Only returned by getDevice
   device_mark: string;
   extra_sim1: string;
   extra_sim2: string;
   polling_interval: number; // Polling interval in seconds (0=disabled, 5/10/15/30/60)
   last_seen: string;
   remark: string;
+  tags?: string;
+  has_proxy_url?: boolean; // Device has its own proxy (the URL is never returned)
+  insecure_skip_verify?: boolean; // Accept any HTTPS certificate (insecure, LAN use only)
+  has_tls_cert?: boolean; // A PEM certificate or CA is pinned (never returned)
+  send_limit_hour?: number; // SMS per rolling hour (0 = unlimited)
+  send_limit_day?: number; // SMS per rolling day (0 = unlimited)
+  capabilities?: DeviceCapabilities | null; // Features enabled in SmsForwarder, null = not queried yet
+  app_version?: string; // SmsForwarder version name, from clone pull
+  sms_synced_at: string | null; // Last successful sync per data type, null = never
+  calls_synced_at: string | null;
+  contacts_synced_at: string | null;
   created_at: string;
 }
 
+// SmsForwarder API features enabled on a phone, as of its last config query
+export interface DeviceCapabilities {
+  sms_send: boolean;
+  sms_query: boolean;
+  call_query: boolean;
+  contact_query: boolean;
+  contact_add?: boolean; // Absent when the app version doesn't report it
+  battery_query: boolean;
+  wol: boolean;
+  location?: boolean;    // Absent when the app version doesn't report it
+  clone: boolean;
+}
+
+// SIM card reported by the phone
+export interface SimInfo {
+  slot: number;    // 1=SIM1, 2=SIM2, as sim_slot when sending
+  carrier: string;
+  number: string;  // Often empty
+  country_iso?: string;
+  subscription_id?: number;
+}
+
 // Phone config response from /config/query
 export interface PhoneConfig {
   enable_api_battery_query: boolean;
@@ -95,6 +187,12 @@ export interface PhoneConfig {
 }
 
 // SMS message from database (cached from phone)
+export interface PingResult {
+  reachable: boolean;
+  latency_ms: number;
+  error?: ApiErrorBody; // Why the phone could not be queried
+}
+
 export interface SmsMessage {
   id: number;
   device_id: number;
@@ -105,6 +203,10 @@ export interface SmsMessage {
   sim_id: number;     // 0=SIM1, 1=SIM2, -1=unknown
   sms_time: number;   // timestamp in milliseconds
   is_read: boolean;   // read status
+  blocked?: boolean;  // hidden by a blocklist entry
+  archived?: boolean; // conversation archived
+  pushed?: boolean;   // pushed by the phone on arrival rather than synced
+  delivery_status?: 'sent' | 'delivered' | 'failed'; // sent messages only
   created_at: string;
 }
 
@@ -130,6 +232,24 @@ export interface Contact {
   phone: string;
   email?: string;
   note?: string;
+  is_hidden: boolean; // Auto-created from SMS/calls, no real contact name
+  created_at: string;
+}
+
+// One phone number across all devices, from GET /api/contacts
+export interface UnifiedContact {
+  phone_key: string; // Normalized number
+  name: string;
+  device_ids: number[];
+  contacts: (Contact & { device_name: string })[];
+}
+
+// Named set of one device's contacts, usable as bulk SMS recipients
+export interface ContactGroup {
+  id: number;
+  device_id: number;
+  name: string;
+  member_count?: number; // Only returned by getContactGroups
   created_at: string;
 }
 
@@ -148,6 +268,42 @@ export interface SyncResult {
   new_count: number;
   updated_count: number;
   is_complete: boolean;
+  synced_at?: string;
+  skipped?: boolean; // Same sync was already running
+  blocked?: number; // New received SMS dropped by a delete blocklist entry
+  truncated?: boolean; // Stopped at the page cap; older records were not fetched
+  client_filtered?: boolean; // Conversation sync: the phone couldn't filter by number
+}
+
+// One day of GET /api/stats/timeline; the counts depend on the kind
+export interface TimelineDay {
+  date: string; // YYYY-MM-DD in the server's time zone
+  received?: number;
+  sent?: number;
+  incoming?: number;
+  outgoing?: number;
+  missed?: number;
+}
+
+// Queued or tracked phone command
+export interface Command {
+  id: number;
+  device_id: number;
+  type: string; // send_sms, wol, add_contact
+  payload: string;
+  status: 'pending' | 'sent' | 'done' | 'failed'; // For direct SMS sends: sent=accepted by phone, done=saved to database
+  result: string;
+  created_at: string;
+  updated_at: string;
+}
+
+// A sync running on the server (GET /api/devices/:id/sync/progress)
+export interface SyncProgress {
+  kind: 'sms' | 'calls' | 'contacts';
+  full: boolean;
+  started_at: string;
+  pages: number;     // Pages fetched from the phone so far
+  new_count: number; // Records inserted so far
 }
 
 // Paginated response with optional sync result
@@ -178,6 +334,17 @@ export interface BatteryStatus {
   plugged: string;
 }
 
+// API key for machine clients; the key itself is only returned on creation
+export interface ApiKey {
+  id: number;
+  user_id: number;
+  label: string;
+  prefix: string;
+  scopes: ('*' | 'read' | 'sms:send')[];
+  created_at: string;
+  last_used_at: string | null;
+}
+
 // Location from phone
 export interface LocationInfo {
   address?: string;
@@ -224,6 +391,12 @@ export const api = {
       body: JSON.stringify({ username, password }),
     }),
 
+  logout: () =>
+    request('/api/logout', {
+      method: 'POST',
+      body: JSON.stringify({ refresh_token: localStorage.getItem('refresh_token') }),
+    }),
+
   getProfile: () => request<User>('/api/profile'),
 
   updatePassword: (oldPassword: string, newPassword: string) =>
@@ -232,11 +405,31 @@ export const api = {
       body: JSON.stringify({ old: oldPassword, new: newPassword }),
     }),
 
+  // API keys (admin only)
+  getApiKeys: () => request<{ items: ApiKey[] }>('/api/api-keys'),
+
+  createApiKey: (label: string, scopes: ApiKey['scopes']) =>
+    request<{ api_key: ApiKey; key: string }>('/api/api-keys', {
+      method: 'POST',
+      body: JSON.stringify({ label, scopes }),
+    }),
+
+  revokeApiKey: (id: number) =>
+    request(`/api/api-keys/${id}`, { method: 'DELETE' }),
+
+  // Per-day SMS or call counts for charts
+  getStatsTimeline: (kind: 'sms' | 'call' = 'sms', days = 30, deviceId?: number) =>
+    request<{ kind: string; days: number; items: TimelineDay[] }>(
+      `/api/stats/timeline?kind=${kind}&days=${days}${deviceId ? `&device_id=${deviceId}` : ''}`
+    ),
+
   // Devices
   getDevices: () => request<{ items: Device[] }>('/api/devices'),
 
-  refreshDevices: () => request<{ items: Device[]; refreshed: number; online_count: number }>('/api/devices/refresh', {
+  // Omit deviceIds (or pass none) to refresh every device
+  refreshDevices: (deviceIds?: number[]) => request<{ items: Device[]; refreshed: number; online_count: number }>('/api/devices/refresh', {
     method: 'POST',
+    ...(deviceIds?.length ? { body: JSON.stringify({ device_ids: deviceIds }) } : {}),
   }),
 
   createDevice: (name: string, phoneAddr: string, sm4Key: string, remark?: string, pollingInterval?: number) =>
@@ -247,7 +440,7 @@ export const api = {
 
   getDevice: (id: string | number) => request<Device>(`/api/devices/${id}`),
 
-  updateDevice: (id: string | number, data: { name?: string; phone_addr?: string; sm4_key?: string; remark?: string; polling_interval?: number }) =>
+  updateDevice: (id: string | number, data: { name?: string; phone_addr?: string; sm4_key?: string; sm4_iv?: string; remark?: string; polling_interval?: number; tags?: string; proxy_url?: string; insecure_skip_verify?: boolean; tls_cert?: string; send_limit_hour?: number; send_limit_day?: number }) =>
     request<Device>(`/api/devices/${id}`, {
       method: 'PUT',
       body: JSON.stringify(data),
@@ -260,6 +453,17 @@ export const api = {
   getPhoneConfig: (deviceId: string | number) =>
     request<PhoneConfig>(`/api/devices/${deviceId}/config`),
 
+  // Permanently delete stored SMS/calls (and optionally contacts) of a device
+  resetDeviceData: (deviceId: string | number, includeContacts = false) =>
+    request<{ removed: { sms: number; calls: number; contacts: number } }>(`/api/devices/${deviceId}/reset-data`, {
+      method: 'POST',
+      body: JSON.stringify({ confirm: true, include_contacts: includeContacts }),
+    }),
+
+  // Reachability and latency only, no DB writes
+  pingDevice: (deviceId: string | number) =>
+    request<PingResult>(`/api/devices/${deviceId}/ping`),
+
   // All devices SMS - query from database
   getAllSms: (type?: number, pageNum?: number, pageSize?: number, keyword?: string, deviceId?: number) => {
     const params = new URLSearchParams();
@@ -272,6 +476,17 @@ export const api = {
     return request<PaginatedResponse<SmsMessageWithDevice>>(`/api/sms${queryString ? `?${queryString}` : ''}`);
   },
 
+  // All devices contacts, merged by normalized number
+  getAllContacts: (pageNum?: number, pageSize?: number, keyword?: string, includeHidden?: boolean) => {
+    const params = new URLSearchParams();
+    if (pageNum !== undefined) params.append('page_num', pageNum.toString());
+    if (pageSize !== undefined) params.append('page_size', pageSize.toString());
+    if (keyword) params.append('keyword', keyword);
+    if (includeHidden) params.append('include_hidden', 'true');
+    const queryString = params.toString();
+    return request<PaginatedResponse<UnifiedContact>>(`/api/contacts${queryString ? `?${queryString}` : ''}`);
+  },
+
   // All devices calls - query from database
   getAllCalls: (type?: number, pageNum?: number, pageSize?: number, phoneNumber?: string, deviceId?: number) => {
     const params = new URLSearchParams();
@@ -296,6 +511,10 @@ export const api = {
     return request<PaginatedResponse<SmsMessage>>(`/api/devices/${deviceId}/sms${queryString ? `?${queryString}` : ''}`);
   },
 
+  // Running syncs of a device; poll while a full sync request is pending
+  getSyncProgress: (deviceId: string | number) =>
+    request<{ device_id: number; running: SyncProgress[] }>(`/api/devices/${deviceId}/sync/progress`),
+
   // SMS - manual sync from phone
   syncDeviceSms: (deviceId: string | number, type?: number) =>
     request<SyncResult>(`/api/devices/${deviceId}/sms/sync`, {
@@ -303,12 +522,25 @@ export const api = {
       body: JSON.stringify({ type: type || 0 }),
     }),
 
-  sendSms: (deviceId: string | number, simSlot: number, phoneNumbers: string, msgContent: string) =>
-    request<{ message: string }>(`/api/devices/${deviceId}/sms/send`, {
+  // SMS - sync only the thread with one address from phone
+  syncConversation: (deviceId: string | number, address: string) =>
+    request<SyncResult>(`/api/devices/${deviceId}/conversations/${encodeURIComponent(address)}/sync`, {
+      method: 'POST',
+    }),
+
+  // Pass the same idempotencyKey when retrying one send so the server never sends it twice.
+  // simSlot 0 lets the server choose the SIM; the response reports the one used.
+  sendSms: (deviceId: string | number, simSlot: number, phoneNumbers: string, msgContent: string, idempotencyKey: string = newIdempotencyKey()) =>
+    request<{ message: string; command_id: number; sim_slot: number; sim_auto?: 'only_sim' | 'last_used' | 'has_number' }>(`/api/devices/${deviceId}/sms/send`, {
       method: 'POST',
+      headers: { 'Idempotency-Key': idempotencyKey },
       body: JSON.stringify({ sim_slot: simSlot, phone_numbers: phoneNumbers, msg_content: msgContent }),
     }),
 
+  // Poll the outcome of a send through its command_id
+  getCommand: (commandId: number) =>
+    request<Command>(`/api/commands/${commandId}`),
+
   // Calls - query from database with background sync
   getDeviceCalls: (deviceId: string | number, type?: number, pageNum?: number, pageSize?: number, phoneNumber?: string, forceSync?: boolean) => {
     const params = new URLSearchParams();
@@ -329,10 +561,11 @@ export const api = {
     }),
 
   // Contacts - query from database with background sync
-  getDeviceContacts: (deviceId: string | number, keyword?: string, forceSync?: boolean) => {
+  getDeviceContacts: (deviceId: string | number, keyword?: string, forceSync?: boolean, includeHidden?: boolean) => {
     const params = new URLSearchParams();
     if (keyword) params.append('keyword', keyword);
     if (forceSync) params.append('sync', 'true');
+    if (includeHidden) params.append('include_hidden', 'true');
     const queryString = params.toString();
     return request<ContactsResponse>(`/api/devices/${deviceId}/contacts${queryString ? `?${queryString}` : ''}`);
   },
@@ -349,6 +582,31 @@ export const api = {
       body: JSON.stringify({ name, phone_number: phoneNumber }),
     }),
 
+  // Contact groups (per device)
+  getContactGroups: (deviceId: string | number) =>
+    request<{ items: ContactGroup[] }>(`/api/devices/${deviceId}/contact-groups`),
+
+  createContactGroup: (deviceId: string | number, name: string) =>
+    request<ContactGroup>(`/api/devices/${deviceId}/contact-groups`, {
+      method: 'POST',
+      body: JSON.stringify({ name }),
+    }),
+
+  deleteContactGroup: (deviceId: string | number, groupId: number) =>
+    request(`/api/devices/${deviceId}/contact-groups/${groupId}`, { method: 'DELETE' }),
+
+  getContactGroupMembers: (deviceId: string | number, groupId: number) =>
+    request<{ group: ContactGroup; items: Contact[]; total: number }>(`/api/devices/${deviceId}/contact-groups/${groupId}/members`),
+
+  addContactGroupMembers: (deviceId: string | number, groupId: number, contactIds: number[]) =>
+    request<{ added: number }>(`/api/devices/${deviceId}/contact-groups/${groupId}/members`, {
+      method: 'POST',
+      body: JSON.stringify({ contact_ids: contactIds }),
+    }),
+
+  removeContactGroupMember: (deviceId: string | number, groupId: number, contactId: number) =>
+    request(`/api/devices/${deviceId}/contact-groups/${groupId}/members/${contactId}`, { method: 'DELETE' }),
+
   // Battery - query from phone
   getBattery: (deviceId: string | number) =>
     request<BatteryStatus>(`/api/devices/${deviceId}/battery`),
@@ -420,6 +678,20 @@ export const api = {
       body: JSON.stringify({ ids }),
     }),
 
+  // SMS trash - deleted messages of a device, and restoring one
+  getSmsTrash: (deviceId: string | number, pageNum?: number, pageSize?: number) => {
+    const params = new URLSearchParams();
+    if (pageNum !== undefined) params.append('page_num', pageNum.toString());
+    if (pageSize !== undefined) params.append('page_size', pageSize.toString());
+    const queryString = params.toString();
+    return request<PaginatedResponse<SmsMessage>>(`/api/devices/${deviceId}/sms/trash${queryString ? `?${queryString}` : ''}`);
+  },
+
+  restoreSms: (id: number) =>
+    request<{ message: string }>(`/api/sms/${id}/restore`, {
+      method: 'POST',
+    }),
+
   // Delete Calls
   deleteCall: (id: number) =>
     request<{ message: string }>(`/api/calls/${id}`, {